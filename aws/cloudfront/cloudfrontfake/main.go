@@ -0,0 +1,192 @@
+// Package cloudfrontfake is an in-memory stand-in for the parts of the CloudFront API used by the
+// github.com/PyramidSystemsInc/go/aws/cloudfront package, so it can be unit tested offline.
+package cloudfrontfake
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/cloudfront/cloudfrontiface"
+)
+
+// CloudFront keeps distributions and origin access identities in memory, keyed by id. Every change to a
+// distribution gives it a new ETag, and updates must send the current one. Calling an operation that is
+// not implemented panics.
+type CloudFront struct {
+	cloudfrontiface.CloudFrontAPI
+
+	mutex                  sync.Mutex
+	counter                int
+	AccountID              string
+	Distributions          map[string]*cloudfront.Distribution
+	ETags                  map[string]string
+	OriginAccessIdentities map[string]*cloudfront.OriginAccessIdentity
+	Tags                   map[string][]*cloudfront.Tag
+}
+
+// New returns an empty fake for account 123456789012.
+func New() *CloudFront {
+	return &CloudFront{
+		AccountID:              "123456789012",
+		Distributions:          map[string]*cloudfront.Distribution{},
+		ETags:                  map[string]string{},
+		OriginAccessIdentities: map[string]*cloudfront.OriginAccessIdentity{},
+		Tags:                   map[string][]*cloudfront.Tag{},
+	}
+}
+
+// CreateCloudFrontOriginAccessIdentityWithContext creates an origin access identity.
+func (fake *CloudFront) CreateCloudFrontOriginAccessIdentityWithContext(ctx aws.Context, input *cloudfront.CreateCloudFrontOriginAccessIdentityInput, opts ...request.Option) (*cloudfront.CreateCloudFrontOriginAccessIdentityOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	id := fake.id("E")
+	identity := &cloudfront.OriginAccessIdentity{
+		CloudFrontOriginAccessIdentityConfig: input.CloudFrontOriginAccessIdentityConfig,
+		Id:                                   aws.String(id),
+		S3CanonicalUserId:                    aws.String(fmt.Sprintf("%064d", fake.counter)),
+	}
+	fake.OriginAccessIdentities[id] = identity
+	return &cloudfront.CreateCloudFrontOriginAccessIdentityOutput{
+		CloudFrontOriginAccessIdentity: identity,
+		ETag:                           aws.String(fake.id("ETAG")),
+		Location:                       aws.String("https://cloudfront.amazonaws.com/2020-05-31/origin-access-identity/cloudfront/" + id),
+	}, nil
+}
+
+// CreateDistributionWithContext creates a deployed distribution.
+func (fake *CloudFront) CreateDistributionWithContext(ctx aws.Context, input *cloudfront.CreateDistributionInput, opts ...request.Option) (*cloudfront.CreateDistributionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	id := fake.id("E")
+	distribution := &cloudfront.Distribution{
+		ARN:                aws.String(fmt.Sprintf("arn:aws:cloudfront::%s:distribution/%s", fake.AccountID, id)),
+		DistributionConfig: input.DistributionConfig,
+		DomainName:         aws.String(fmt.Sprintf("d%013d.cloudfront.net", fake.counter)),
+		Id:                 aws.String(id),
+		Status:             aws.String("Deployed"),
+	}
+	fake.Distributions[id] = distribution
+	fake.ETags[id] = fake.id("ETAG")
+	return &cloudfront.CreateDistributionOutput{
+		Distribution: distribution,
+		ETag:         aws.String(fake.ETags[id]),
+	}, nil
+}
+
+// GetDistributionWithContext returns a distribution and its current ETag.
+func (fake *CloudFront) GetDistributionWithContext(ctx aws.Context, input *cloudfront.GetDistributionInput, opts ...request.Option) (*cloudfront.GetDistributionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	distribution, err := fake.distribution(input.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudfront.GetDistributionOutput{
+		Distribution: distribution,
+		ETag:         aws.String(fake.ETags[aws.StringValue(distribution.Id)]),
+	}, nil
+}
+
+// GetDistributionConfigWithContext returns a copy of the configuration of a distribution and its current ETag.
+func (fake *CloudFront) GetDistributionConfigWithContext(ctx aws.Context, input *cloudfront.GetDistributionConfigInput, opts ...request.Option) (*cloudfront.GetDistributionConfigOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	distribution, err := fake.distribution(input.Id)
+	if err != nil {
+		return nil, err
+	}
+	config := *distribution.DistributionConfig
+	return &cloudfront.GetDistributionConfigOutput{
+		DistributionConfig: &config,
+		ETag:               aws.String(fake.ETags[aws.StringValue(distribution.Id)]),
+	}, nil
+}
+
+// ListDistributionsWithContext lists every distribution, ordered by id.
+func (fake *CloudFront) ListDistributionsWithContext(ctx aws.Context, input *cloudfront.ListDistributionsInput, opts ...request.Option) (*cloudfront.ListDistributionsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var ids []string
+	for id := range fake.Distributions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var summaries []*cloudfront.DistributionSummary
+	for _, id := range ids {
+		distribution := fake.Distributions[id]
+		summaries = append(summaries, &cloudfront.DistributionSummary{
+			ARN:        distribution.ARN,
+			Aliases:    distribution.DistributionConfig.Aliases,
+			Comment:    distribution.DistributionConfig.Comment,
+			DomainName: distribution.DomainName,
+			Enabled:    distribution.DistributionConfig.Enabled,
+			Id:         distribution.Id,
+			Status:     distribution.Status,
+		})
+	}
+	return &cloudfront.ListDistributionsOutput{
+		DistributionList: &cloudfront.DistributionList{
+			IsTruncated: aws.Bool(false),
+			Items:       summaries,
+			MaxItems:    input.MaxItems,
+			Quantity:    aws.Int64(int64(len(summaries))),
+		},
+	}, nil
+}
+
+// UpdateDistributionWithContext replaces the configuration of a distribution when input.IfMatch is its current ETag.
+func (fake *CloudFront) UpdateDistributionWithContext(ctx aws.Context, input *cloudfront.UpdateDistributionInput, opts ...request.Option) (*cloudfront.UpdateDistributionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	distribution, err := fake.distribution(input.Id)
+	if err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(distribution.Id)
+	if aws.StringValue(input.IfMatch) != fake.ETags[id] {
+		return nil, awserr.New(cloudfront.ErrCodePreconditionFailed, "The request failed because it didn't meet the preconditions in one or more request-header fields.", nil)
+	}
+	distribution.DistributionConfig = input.DistributionConfig
+	fake.ETags[id] = fake.id("ETAG")
+	return &cloudfront.UpdateDistributionOutput{
+		Distribution: distribution,
+		ETag:         aws.String(fake.ETags[id]),
+	}, nil
+}
+
+// TagResourceWithContext adds or overwrites tags of a distribution.
+func (fake *CloudFront) TagResourceWithContext(ctx aws.Context, input *cloudfront.TagResourceInput, opts ...request.Option) (*cloudfront.TagResourceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	arn := aws.StringValue(input.Resource)
+	var tags []*cloudfront.Tag
+	for _, tag := range fake.Tags[arn] {
+		overwritten := false
+		for _, added := range input.Tags.Items {
+			overwritten = overwritten || aws.StringValue(added.Key) == aws.StringValue(tag.Key)
+		}
+		if !overwritten {
+			tags = append(tags, tag)
+		}
+	}
+	fake.Tags[arn] = append(tags, input.Tags.Items...)
+	return &cloudfront.TagResourceOutput{}, nil
+}
+
+func (fake *CloudFront) id(prefix string) string {
+	fake.counter++
+	return fmt.Sprintf("%s%012d", prefix, fake.counter)
+}
+
+func (fake *CloudFront) distribution(id *string) (*cloudfront.Distribution, error) {
+	distribution, ok := fake.Distributions[aws.StringValue(id)]
+	if !ok {
+		return nil, awserr.New(cloudfront.ErrCodeNoSuchDistribution, "The specified distribution does not exist.", nil)
+	}
+	return distribution, nil
+}
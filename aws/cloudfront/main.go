@@ -1,27 +1,59 @@
 package cloudfront
 
 import (
+  "context"
   "time"
 
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/cloudfront"
+  "github.com/aws/aws-sdk-go/service/cloudfront/cloudfrontiface"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Creates, tags and disables CloudFront distributions in front of S3 websites
+type Client struct {
+  CloudFront cloudfrontiface.CloudFrontAPI
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    CloudFront: cloudfront.New(awsSession),
+  }
+}
+
 // CreateDistributionFromS3Bucket - Creates an AWS CloudFront distribution from an S3 bucket
 func CreateDistributionFromS3Bucket(domainName string, awsSession *session.Session) string {
-  cloudfrontClient := cloudfront.New(awsSession)
-  OAIResult, err := cloudfrontClient.CreateCloudFrontOriginAccessIdentity(&cloudfront.CreateCloudFrontOriginAccessIdentityInput{
+  distributionDomainName, err := CreateDistributionFromS3BucketE(domainName, awsSession)
+  errors.QuitIfError(err)
+  return distributionDomainName
+}
+
+// CreateDistributionFromS3BucketE - Creates an AWS CloudFront distribution from an S3 bucket and returns its domain name, or an error
+func CreateDistributionFromS3BucketE(domainName string, awsSession *session.Session) (string, error) {
+  return CreateDistributionFromS3BucketWithContext(context.Background(), domainName, awsSession)
+}
+
+// CreateDistributionFromS3BucketWithContext - CreateDistributionFromS3BucketE with a context to allow cancellation
+func CreateDistributionFromS3BucketWithContext(ctx context.Context, domainName string, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateDistributionFromS3Bucket(ctx, domainName)
+}
+
+// CreateDistributionFromS3Bucket - Creates an AWS CloudFront distribution from an S3 bucket and returns its domain name, or an error
+func (client *Client) CreateDistributionFromS3Bucket(ctx context.Context, domainName string) (string, error) {
+  OAIResult, err := client.CloudFront.CreateCloudFrontOriginAccessIdentityWithContext(ctx, &cloudfront.CreateCloudFrontOriginAccessIdentityInput{
     CloudFrontOriginAccessIdentityConfig: &cloudfront.OriginAccessIdentityConfig{
       CallerReference: createCallerReference(),
       Comment: aws.String(str.Concat("Identity for ", domainName)),
     },
   })
-  errors.LogIfError(err)
+  if err != nil {
+    return "", err
+  }
   originAccessId := str.Concat("origin-access-identity/cloudfront/", *OAIResult.CloudFrontOriginAccessIdentity.Id)
-  distroResult, err := cloudfrontClient.CreateDistribution(&cloudfront.CreateDistributionInput{
+  distroResult, err := client.CloudFront.CreateDistributionWithContext(ctx, &cloudfront.CreateDistributionInput{
     DistributionConfig: &cloudfront.DistributionConfig{
       Aliases: &cloudfront.Aliases{
         Items: []*string {
@@ -88,37 +120,75 @@ func CreateDistributionFromS3Bucket(domainName string, awsSession *session.Sessi
       },
     },
   })
-  errors.QuitIfError(err)
-  return *distroResult.Distribution.DomainName
+  if err != nil {
+    return "", err
+  }
+  return *distroResult.Distribution.DomainName, nil
 }
 
 // DisableDistribution - Disables an AWS CloudFront distribution
 func DisableDistribution(alias string, awsSession *session.Session) {
-  cloudfrontClient := cloudfront.New(awsSession)
-  distributionId := getDistributionIdUsingAlias(alias, cloudfrontClient)
-  if distributionId != "" {
-    result, err := cloudfrontClient.GetDistributionConfig(&cloudfront.GetDistributionConfigInput{
-      Id: aws.String(distributionId),
-    })
-    errors.LogIfError(err)
-    distributionConfig := result.DistributionConfig
-    distributionConfig.SetEnabled(false)
-    eTag := getDistributionETag(distributionId, cloudfrontClient)
-    _, err = cloudfrontClient.UpdateDistribution(&cloudfront.UpdateDistributionInput {
-      DistributionConfig: distributionConfig,
-      Id: aws.String(distributionId),
-      IfMatch: aws.String(eTag),
-    })
-    errors.LogIfError(err)
+  errors.LogIfError(DisableDistributionE(alias, awsSession))
+}
+
+// DisableDistributionE - Disables an AWS CloudFront distribution, returning any error. A distribution that cannot be found is ignored
+func DisableDistributionE(alias string, awsSession *session.Session) error {
+  return DisableDistributionWithContext(context.Background(), alias, awsSession)
+}
+
+// DisableDistributionWithContext - DisableDistributionE with a context to allow cancellation
+func DisableDistributionWithContext(ctx context.Context, alias string, awsSession *session.Session) error {
+  return New(awsSession).DisableDistribution(ctx, alias)
+}
+
+// DisableDistribution - Disables an AWS CloudFront distribution, returning any error. A distribution that cannot be found is ignored
+func (client *Client) DisableDistribution(ctx context.Context, alias string) error {
+  distributionId, err := client.getDistributionIdUsingAlias(ctx, alias)
+  if err != nil || distributionId == "" {
+    return err
+  }
+  result, err := client.CloudFront.GetDistributionConfigWithContext(ctx, &cloudfront.GetDistributionConfigInput{
+    Id: aws.String(distributionId),
+  })
+  if err != nil {
+    return err
+  }
+  distributionConfig := result.DistributionConfig
+  distributionConfig.SetEnabled(false)
+  eTag, err := client.getDistributionETag(ctx, distributionId)
+  if err != nil {
+    return err
   }
+  _, err = client.CloudFront.UpdateDistributionWithContext(ctx, &cloudfront.UpdateDistributionInput {
+    DistributionConfig: distributionConfig,
+    Id: aws.String(distributionId),
+    IfMatch: aws.String(eTag),
+  })
+  return err
 }
 
 // TagDistribution - Adds a tag to an AWS CloudFront distribution
 func TagDistribution(distributionFqdn string, key string, value string, awsSession *session.Session) {
-  cloudfrontClient := cloudfront.New(awsSession)
-  arn, err := getArn(distributionFqdn, cloudfrontClient)
-  errors.QuitIfError(err)
-  _, err = cloudfrontClient.TagResource(&cloudfront.TagResourceInput{
+  errors.QuitIfError(TagDistributionE(distributionFqdn, key, value, awsSession))
+}
+
+// TagDistributionE - Adds a tag to an AWS CloudFront distribution, returning any error
+func TagDistributionE(distributionFqdn string, key string, value string, awsSession *session.Session) error {
+  return TagDistributionWithContext(context.Background(), distributionFqdn, key, value, awsSession)
+}
+
+// TagDistributionWithContext - TagDistributionE with a context to allow cancellation
+func TagDistributionWithContext(ctx context.Context, distributionFqdn string, key string, value string, awsSession *session.Session) error {
+  return New(awsSession).TagDistribution(ctx, distributionFqdn, key, value)
+}
+
+// TagDistribution - Adds a tag to an AWS CloudFront distribution, returning any error
+func (client *Client) TagDistribution(ctx context.Context, distributionFqdn string, key string, value string) error {
+  arn, err := client.getArn(ctx, distributionFqdn)
+  if err != nil {
+    return err
+  }
+  _, err = client.CloudFront.TagResourceWithContext(ctx, &cloudfront.TagResourceInput{
     Resource: aws.String(arn),
     Tags: &cloudfront.Tags{
       Items: []*cloudfront.Tag{
@@ -129,14 +199,16 @@ func TagDistribution(distributionFqdn string, key string, value string, awsSessi
       },
     },
   })
-  errors.QuitIfError(err)
+  return err
 }
 
-func getArn(distributionFqdn string, cloudfrontClient *cloudfront.CloudFront) (string, error) {
-  distributions, err := cloudfrontClient.ListDistributions(&cloudfront.ListDistributionsInput{
+func (client *Client) getArn(ctx context.Context, distributionFqdn string) (string, error) {
+  distributions, err := client.CloudFront.ListDistributionsWithContext(ctx, &cloudfront.ListDistributionsInput{
     MaxItems: aws.Int64(500),
   })
-  errors.QuitIfError(err)
+  if err != nil {
+    return "", err
+  }
   distributionSummaries := distributions.DistributionList.Items
   for _, distribution := range distributionSummaries {
     if *distribution.DomainName == distributionFqdn {
@@ -146,34 +218,38 @@ func getArn(distributionFqdn string, cloudfrontClient *cloudfront.CloudFront) (s
   return "", errors.New(str.Concat("Distribution not found with the provided domain name: ", distributionFqdn))
 }
 
-func getDistributionIdUsingAlias(targetAlias string, cloudfrontClient *cloudfront.CloudFront) string {
-  distributions, err := cloudfrontClient.ListDistributions(&cloudfront.ListDistributionsInput{
+func (client *Client) getDistributionIdUsingAlias(ctx context.Context, targetAlias string) (string, error) {
+  distributions, err := client.CloudFront.ListDistributionsWithContext(ctx, &cloudfront.ListDistributionsInput{
     MaxItems: aws.Int64(500),
   })
-  errors.QuitIfError(err)
+  if err != nil {
+    return "", err
+  }
   distributionSummaries := distributions.DistributionList.Items
   for _, distributionSummary := range distributionSummaries {
     if distributionSummary.Aliases != nil {
       for _, alias := range distributionSummary.Aliases.Items {
         if *alias == targetAlias {
-          return *distributionSummary.Id
+          return *distributionSummary.Id, nil
         }
       }
     }
   }
-  return ""
+  return "", nil
 }
 
 func createCallerReference() *string {
   return aws.String(time.Now().String())
 }
 
-func getDistributionETag(id string, cloudfrontClient *cloudfront.CloudFront) string {
-  distribution, err := cloudfrontClient.GetDistribution(&cloudfront.GetDistributionInput{
+func (client *Client) getDistributionETag(ctx context.Context, id string) (string, error) {
+  distribution, err := client.CloudFront.GetDistributionWithContext(ctx, &cloudfront.GetDistributionInput{
     Id: aws.String(id),
   })
-  errors.QuitIfError(err)
-  return *distribution.ETag
+  if err != nil {
+    return "", err
+  }
+  return *distribution.ETag, nil
 }
 
 /*
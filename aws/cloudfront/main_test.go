@@ -0,0 +1,91 @@
+package cloudfront
+
+import (
+  "context"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/cloudfront/cloudfrontfake"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/service/cloudfront"
+)
+
+func newFakeClient() (*Client, *cloudfrontfake.CloudFront) {
+  fake := cloudfrontfake.New()
+  return &Client{CloudFront: fake}, fake
+}
+
+func onlyDistribution(t *testing.T, fake *cloudfrontfake.CloudFront) *cloudfront.Distribution {
+  if len(fake.Distributions) != 1 {
+    t.Fatalf("expected one distribution, got %d", len(fake.Distributions))
+  }
+  for _, distribution := range fake.Distributions {
+    return distribution
+  }
+  return nil
+}
+
+// TestCreateDistributionFromS3Bucket creates a distribution in front of a bucket through an origin access identity.
+func TestCreateDistributionFromS3Bucket(t *testing.T) {
+  client, fake := newFakeClient()
+
+  domainName, err := client.CreateDistributionFromS3Bucket(context.Background(), "www.example.com")
+  if err != nil {
+    t.Fatal(err)
+  }
+  distribution := onlyDistribution(t, fake)
+  if aws.StringValue(distribution.DomainName) != domainName {
+    t.Errorf("expected the domain name %s, got %s", aws.StringValue(distribution.DomainName), domainName)
+  }
+  config := distribution.DistributionConfig
+  if !aws.BoolValue(config.Enabled) || aws.StringValue(config.Aliases.Items[0]) != "www.example.com" {
+    t.Errorf("expected an enabled distribution for www.example.com, got %v", config)
+  }
+  if len(fake.OriginAccessIdentities) != 1 {
+    t.Errorf("expected one origin access identity, got %d", len(fake.OriginAccessIdentities))
+  }
+}
+
+// TestDisableDistribution disables a distribution found by its alias, and ignores an alias without one.
+func TestDisableDistribution(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  _, err := client.CreateDistributionFromS3Bucket(ctx, "www.example.com")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.DisableDistribution(ctx, "www.example.com")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if aws.BoolValue(onlyDistribution(t, fake).DistributionConfig.Enabled) {
+    t.Error("the distribution was not disabled")
+  }
+  err = client.DisableDistribution(ctx, "www.example.org")
+  if err != nil {
+    t.Errorf("expected a missing distribution to be ignored, got %v", err)
+  }
+}
+
+// TestTagDistribution tags a distribution found by its domain name, and refuses a domain name without one.
+func TestTagDistribution(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  domainName, err := client.CreateDistributionFromS3Bucket(ctx, "www.example.com")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.TagDistribution(ctx, domainName, "pac-project", "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  tags := fake.Tags[aws.StringValue(onlyDistribution(t, fake).ARN)]
+  if len(tags) != 1 || aws.StringValue(tags[0].Value) != "example" {
+    t.Errorf("unexpected tags %v", tags)
+  }
+  err = client.TagDistribution(ctx, "missing.cloudfront.net", "pac-project", "example")
+  if err == nil {
+    t.Error("expected an error for a missing distribution")
+  }
+}
@@ -0,0 +1,110 @@
+// Package cloudwatchlogsfake is an in-memory stand-in for the parts of the CloudWatch Logs API used by the
+// github.com/PyramidSystemsInc/go/aws/cloudwatchlogs package, so it can be unit tested offline.
+package cloudwatchlogsfake
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// CloudWatchLogs keeps log events in memory, keyed by log group name. Seed Events (or call AddEvent) before use.
+// Calling an operation that is not implemented panics.
+type CloudWatchLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	mutex   sync.Mutex
+	counter int
+	Events  map[string][]*cloudwatchlogs.FilteredLogEvent
+	// PageSize is the number of events FilterLogEvents returns per page.
+	PageSize int
+}
+
+// New returns a fake without log groups, paging every 100 events.
+func New() *CloudWatchLogs {
+	return &CloudWatchLogs{
+		Events:   map[string][]*cloudwatchlogs.FilteredLogEvent{},
+		PageSize: 100,
+	}
+}
+
+// AddEvent appends an event to a stream of a log group, creating the group if needed.
+func (fake *CloudWatchLogs) AddEvent(logGroup string, logStream string, timestamp int64, message string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.counter++
+	fake.Events[logGroup] = append(fake.Events[logGroup], &cloudwatchlogs.FilteredLogEvent{
+		EventId:       aws.String(strconv.Itoa(fake.counter)),
+		LogStreamName: aws.String(logStream),
+		Message:       aws.String(message),
+		Timestamp:     aws.Int64(timestamp),
+	})
+}
+
+// FilterLogEventsWithContext returns a page of the events of a group in the requested streams and time range,
+// oldest first. The next token is the offset of the following page.
+func (fake *CloudWatchLogs) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	events, ok := fake.Events[aws.StringValue(input.LogGroupName)]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "The specified log group does not exist.", nil)
+	}
+	streams := map[string]bool{}
+	for _, stream := range input.LogStreamNames {
+		streams[aws.StringValue(stream)] = true
+	}
+	var matching []*cloudwatchlogs.FilteredLogEvent
+	for _, event := range events {
+		timestamp := aws.Int64Value(event.Timestamp)
+		if len(streams) > 0 && !streams[aws.StringValue(event.LogStreamName)] {
+			continue
+		}
+		if input.StartTime != nil && timestamp < *input.StartTime {
+			continue
+		}
+		if input.EndTime != nil && timestamp > *input.EndTime {
+			continue
+		}
+		matching = append(matching, event)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return aws.Int64Value(matching[i].Timestamp) < aws.Int64Value(matching[j].Timestamp)
+	})
+	offset := 0
+	if input.NextToken != nil {
+		offset, _ = strconv.Atoi(*input.NextToken)
+	}
+	output := &cloudwatchlogs.FilterLogEventsOutput{}
+	end := offset + fake.PageSize
+	if end < len(matching) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(matching)
+	}
+	if offset < end {
+		output.Events = matching[offset:end]
+	}
+	return output, nil
+}
+
+// FilterLogEventsPagesWithContext calls fn with every page of FilterLogEventsWithContext until fn returns false.
+func (fake *CloudWatchLogs) FilterLogEventsPagesWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, fn func(*cloudwatchlogs.FilterLogEventsOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.FilterLogEventsWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.NextToken == nil) || output.NextToken == nil {
+			return nil
+		}
+		page.NextToken = output.NextToken
+	}
+}
@@ -0,0 +1,169 @@
+package cloudwatchlogs
+
+import (
+  "context"
+  "fmt"
+  "time"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/session"
+  "github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+  "github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+  "github.com/PyramidSystemsInc/go/errors"
+)
+
+// Client - Fetches and follows log streams, such as those of ECS tasks and Lambda functions
+type Client struct {
+  CloudWatchLogs cloudwatchlogsiface.CloudWatchLogsAPI
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    CloudWatchLogs: cloudwatchlogs.New(awsSession),
+  }
+}
+
+// LogEvent - A single log line and the stream it was written to
+type LogEvent struct {
+  Timestamp  time.Time
+  Stream     string
+  Message    string
+}
+
+// LogOptions - Narrows the events read by FetchLogs and TailLogs
+type LogOptions struct {
+  // Streams - Names of the log streams to read. Empty reads every stream of the group
+  Streams       []string
+  // Start - Earliest event to read. Zero reads from the beginning of the group
+  Start         time.Time
+  // End - Latest event to read. Zero reads up to now, or keeps reading new events when following
+  End           time.Time
+  // Follow - Keeps polling for new events until the context is cancelled
+  Follow        bool
+  // PollInterval - Time between polls when following. Defaults to 2 seconds
+  PollInterval  time.Duration
+}
+
+func FetchLogs(logGroup string, options LogOptions, awsSession *session.Session) []LogEvent {
+  events, err := FetchLogsE(logGroup, options, awsSession)
+  errors.QuitIfError(err)
+  return events
+}
+
+// FetchLogsE - Returns the events of a log group within the time range of the options, oldest first, or an error
+func FetchLogsE(logGroup string, options LogOptions, awsSession *session.Session) ([]LogEvent, error) {
+  return FetchLogsWithContext(context.Background(), logGroup, options, awsSession)
+}
+
+// FetchLogsWithContext - FetchLogsE with a context to allow cancellation
+func FetchLogsWithContext(ctx context.Context, logGroup string, options LogOptions, awsSession *session.Session) ([]LogEvent, error) {
+  return New(awsSession).FetchLogs(ctx, logGroup, options)
+}
+
+// FetchLogs - Returns the events of a log group within the time range of the options, oldest first, or an error. Follow is ignored
+func (client *Client) FetchLogs(ctx context.Context, logGroup string, options LogOptions) ([]LogEvent, error) {
+  var events []LogEvent
+  options.Follow = false
+  err := client.TailLogs(ctx, logGroup, options, func(event LogEvent) {
+    events = append(events, event)
+  })
+  return events, err
+}
+
+// TailLogs - Prints the messages of a log group to stdout as they are read, oldest first
+func TailLogs(logGroup string, options LogOptions, awsSession *session.Session) {
+  errors.QuitIfError(TailLogsE(logGroup, options, func(event LogEvent) {
+    fmt.Println(event.Message)
+  }, awsSession))
+}
+
+// TailLogsE - Passes the events of a log group to handle as they are read, oldest first, returning any error.
+// When following, it keeps polling for new events until the context is cancelled or the end of the time range is reached
+func TailLogsE(logGroup string, options LogOptions, handle func(LogEvent), awsSession *session.Session) error {
+  return TailLogsWithContext(context.Background(), logGroup, options, handle, awsSession)
+}
+
+// TailLogsWithContext - TailLogsE where cancelling the context stops following without an error
+func TailLogsWithContext(ctx context.Context, logGroup string, options LogOptions, handle func(LogEvent), awsSession *session.Session) error {
+  return New(awsSession).TailLogs(ctx, logGroup, options, handle)
+}
+
+// TailLogs - Passes the events of a log group to handle as they are read, oldest first, returning any error.
+// When following, it keeps polling for new events until the context is cancelled or the end of the time range is reached
+func (client *Client) TailLogs(ctx context.Context, logGroup string, options LogOptions, handle func(LogEvent)) error {
+  pollInterval := options.PollInterval
+  if pollInterval == 0 {
+    pollInterval = 2 * time.Second
+  }
+  start := options.Start
+  seen := map[string]time.Time{}
+  for {
+    last, err := client.filterLogEvents(ctx, logGroup, options.Streams, start, options.End, seen, handle)
+    if err != nil {
+      if options.Follow && ctx.Err() != nil {
+        return nil
+      }
+      return err
+    }
+    if !options.Follow || (!options.End.IsZero() && time.Now().After(options.End)) {
+      return nil
+    }
+    if !last.IsZero() {
+      start = last
+      for id, timestamp := range seen {
+        if timestamp.Before(start) {
+          delete(seen, id)
+        }
+      }
+    }
+    err = aws.SleepWithContext(ctx, pollInterval)
+    if err != nil {
+      return nil
+    }
+  }
+}
+
+// filterLogEvents - Reads every page of events from start to end, skipping the IDs already seen, and returns the timestamp of the newest event
+func (client *Client) filterLogEvents(ctx context.Context, logGroup string, streams []string, start time.Time, end time.Time, seen map[string]time.Time, handle func(LogEvent)) (time.Time, error) {
+  input := &cloudwatchlogs.FilterLogEventsInput{
+    LogGroupName: aws.String(logGroup),
+  }
+  if len(streams) > 0 {
+    input.LogStreamNames = aws.StringSlice(streams)
+  }
+  if !start.IsZero() {
+    input.StartTime = aws.Int64(toMillis(start))
+  }
+  if !end.IsZero() {
+    input.EndTime = aws.Int64(toMillis(end))
+  }
+  var last time.Time
+  err := client.CloudWatchLogs.FilterLogEventsPagesWithContext(ctx, input, func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
+    for _, event := range page.Events {
+      id := aws.StringValue(event.EventId)
+      if _, ok := seen[id]; ok {
+        continue
+      }
+      timestamp := fromMillis(aws.Int64Value(event.Timestamp))
+      seen[id] = timestamp
+      if timestamp.After(last) {
+        last = timestamp
+      }
+      handle(LogEvent{
+        Timestamp: timestamp,
+        Stream: aws.StringValue(event.LogStreamName),
+        Message: aws.StringValue(event.Message),
+      })
+    }
+    return true
+  })
+  return last, err
+}
+
+func toMillis(t time.Time) int64 {
+  return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(millis int64) time.Time {
+  return time.Unix(0, millis * int64(time.Millisecond))
+}
@@ -0,0 +1,67 @@
+package cloudwatchlogs
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/PyramidSystemsInc/go/aws/cloudwatchlogs/cloudwatchlogsfake"
+)
+
+// TestFetchLogs reads a time range of one stream across several pages of the in-memory fake.
+func TestFetchLogs(t *testing.T) {
+  fake := cloudwatchlogsfake.New()
+  fake.PageSize = 2
+  for i := int64(1); i <= 5; i++ {
+    fake.AddEvent("test-group", "app", i * 1000, "app line")
+    fake.AddEvent("test-group", "sidecar", i * 1000, "sidecar line")
+  }
+  client := &Client{CloudWatchLogs: fake}
+
+  events, err := client.FetchLogs(context.Background(), "test-group", LogOptions{
+    Streams: []string{"app"},
+    Start: time.Unix(2, 0),
+    End: time.Unix(4, 0),
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(events) != 3 {
+    t.Fatalf("expected 3 events from 2s to 4s, got %d", len(events))
+  }
+  for _, event := range events {
+    if event.Stream != "app" || event.Message != "app line" {
+      t.Errorf("expected only events of the app stream, got %+v", event)
+    }
+  }
+  if !events[0].Timestamp.Equal(time.Unix(2, 0)) {
+    t.Errorf("expected the oldest event first, got %s", events[0].Timestamp)
+  }
+}
+
+// TestTailLogsFollow follows a group, adds an event while polling and checks every event is handled exactly once.
+func TestTailLogsFollow(t *testing.T) {
+  fake := cloudwatchlogsfake.New()
+  fake.AddEvent("test-group", "app", 1000, "first")
+  client := &Client{CloudWatchLogs: fake}
+
+  ctx, cancel := context.WithCancel(context.Background())
+  var messages []string
+  err := client.TailLogs(ctx, "test-group", LogOptions{
+    Follow: true,
+    PollInterval: 10 * time.Millisecond,
+  }, func(event LogEvent) {
+    messages = append(messages, event.Message)
+    if event.Message == "first" {
+      fake.AddEvent("test-group", "app", 1000, "second")
+    } else {
+      cancel()
+    }
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(messages) != 2 || messages[1] != "second" {
+    t.Errorf("expected first and second once each, got %v", messages)
+  }
+}
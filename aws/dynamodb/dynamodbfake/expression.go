@@ -0,0 +1,619 @@
+package dynamodbfake
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// expression evaluates a condition, key condition or filter expression against one item. It
+// understands AND, OR, NOT and parentheses, the comparators =, <>, <, <=, > and >=, BETWEEN, IN,
+// and the functions attribute_exists, attribute_not_exists, attribute_type, begins_with,
+// contains and size. Paths may be nested with dots but not indexed.
+type expression struct {
+	tokens   []string
+	position int
+	item     map[string]*dynamodb.AttributeValue
+	names    map[string]*string
+	values   map[string]*dynamodb.AttributeValue
+	// paths holds the top-level attributes read, so that key conditions can be checked.
+	paths map[string]bool
+}
+
+// evaluate reports whether the expression holds for the item and returns the top-level
+// attributes it reads. An empty expression always holds.
+func evaluate(text string, item map[string]*dynamodb.AttributeValue, names map[string]*string, values map[string]*dynamodb.AttributeValue) (bool, map[string]bool, error) {
+	parser := &expression{
+		tokens: tokenize(text),
+		item:   item,
+		names:  names,
+		values: values,
+		paths:  map[string]bool{},
+	}
+	if len(parser.tokens) == 0 {
+		return true, parser.paths, nil
+	}
+	holds, err := parser.or()
+	if err == nil && parser.position < len(parser.tokens) {
+		err = parser.invalid("unexpected " + parser.tokens[parser.position])
+	}
+	return holds, parser.paths, err
+}
+
+func tokenize(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		switch character := rune(text[i]); {
+		case unicode.IsSpace(character):
+			i++
+		case strings.ContainsRune("(),=+-", character):
+			tokens = append(tokens, text[i:i+1])
+			i++
+		case character == '<' || character == '>':
+			if i+1 < len(text) && (text[i+1] == '=' || (character == '<' && text[i+1] == '>')) {
+				tokens = append(tokens, text[i:i+2])
+				i += 2
+			} else {
+				tokens = append(tokens, text[i:i+1])
+				i++
+			}
+		default:
+			end := i
+			for end < len(text) && !unicode.IsSpace(rune(text[end])) && !strings.ContainsRune("(),=<>+-", rune(text[end])) {
+				end++
+			}
+			tokens = append(tokens, text[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
+
+func (parser *expression) or() (bool, error) {
+	holds, err := parser.and()
+	for err == nil && parser.accept("OR") {
+		var right bool
+		right, err = parser.and()
+		holds = holds || right
+	}
+	return holds, err
+}
+
+func (parser *expression) and() (bool, error) {
+	holds, err := parser.not()
+	for err == nil && parser.accept("AND") {
+		var right bool
+		right, err = parser.not()
+		holds = holds && right
+	}
+	return holds, err
+}
+
+func (parser *expression) not() (bool, error) {
+	if parser.accept("NOT") {
+		holds, err := parser.not()
+		return !holds, err
+	}
+	return parser.primary()
+}
+
+func (parser *expression) primary() (bool, error) {
+	if parser.accept("(") {
+		holds, err := parser.or()
+		if err != nil {
+			return false, err
+		}
+		return holds, parser.expect(")")
+	}
+	if parser.peek(1) == "(" {
+		switch function := parser.peek(0); function {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			parser.position += 2
+			return parser.function(function)
+		}
+	}
+	left, err := parser.operand()
+	if err != nil {
+		return false, err
+	}
+	operator := parser.next()
+	switch {
+	case strings.EqualFold(operator, "BETWEEN"):
+		low, err := parser.operand()
+		if err != nil {
+			return false, err
+		}
+		if err := parser.expect("AND"); err != nil {
+			return false, err
+		}
+		high, err := parser.operand()
+		if err != nil {
+			return false, err
+		}
+		fromLow, toHigh := compare(left, low), compare(left, high)
+		return (fromLow == 0 || fromLow == 1) && (toHigh == -1 || toHigh == 0), nil
+	case strings.EqualFold(operator, "IN"):
+		if err := parser.expect("("); err != nil {
+			return false, err
+		}
+		found := false
+		for {
+			candidate, err := parser.operand()
+			if err != nil {
+				return false, err
+			}
+			found = found || compare(left, candidate) == 0
+			if !parser.accept(",") {
+				break
+			}
+		}
+		return found, parser.expect(")")
+	}
+	right, err := parser.operand()
+	if err != nil {
+		return false, err
+	}
+	order := compare(left, right)
+	switch operator {
+	case "=":
+		return order == 0, nil
+	case "<>":
+		return order != 0, nil
+	case "<":
+		return order == -1, nil
+	case "<=":
+		return order == -1 || order == 0, nil
+	case ">":
+		return order == 1, nil
+	case ">=":
+		return order == 0 || order == 1, nil
+	}
+	return false, parser.invalid("unknown comparator " + operator)
+}
+
+func (parser *expression) function(name string) (bool, error) {
+	value, err := parser.operand()
+	if err != nil {
+		return false, err
+	}
+	var argument *dynamodb.AttributeValue
+	if name != "attribute_exists" && name != "attribute_not_exists" {
+		if err := parser.expect(","); err != nil {
+			return false, err
+		}
+		argument, err = parser.operand()
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := parser.expect(")"); err != nil {
+		return false, err
+	}
+	switch name {
+	case "attribute_exists":
+		return value != nil, nil
+	case "attribute_not_exists":
+		return value == nil, nil
+	case "attribute_type":
+		return value != nil && argument != nil && attributeType(value) == aws.StringValue(argument.S), nil
+	case "begins_with":
+		if value == nil || argument == nil {
+			return false, nil
+		}
+		if value.S != nil && argument.S != nil {
+			return strings.HasPrefix(*value.S, *argument.S), nil
+		}
+		return value.B != nil && argument.B != nil && bytes.HasPrefix(value.B, argument.B), nil
+	}
+	if value == nil || argument == nil {
+		return false, nil
+	}
+	if value.S != nil && argument.S != nil {
+		return strings.Contains(*value.S, *argument.S), nil
+	}
+	var elements []*dynamodb.AttributeValue
+	elements = append(elements, value.L...)
+	for _, element := range value.SS {
+		elements = append(elements, &dynamodb.AttributeValue{S: element})
+	}
+	for _, element := range value.NS {
+		elements = append(elements, &dynamodb.AttributeValue{N: element})
+	}
+	for _, element := range value.BS {
+		elements = append(elements, &dynamodb.AttributeValue{B: element})
+	}
+	for _, element := range elements {
+		if compare(element, argument) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// operand returns the value of a :placeholder, the value at a path (nil when missing), or the
+// size of the value at a path.
+func (parser *expression) operand() (*dynamodb.AttributeValue, error) {
+	if parser.peek(0) == "size" && parser.peek(1) == "(" {
+		parser.position += 2
+		value, err := parser.operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect(")"); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, nil
+		}
+		size := len(aws.StringValue(value.S)) + len(value.B) + len(value.L) + len(value.M) + len(value.SS) + len(value.NS) + len(value.BS)
+		return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(size))}, nil
+	}
+	if strings.HasPrefix(parser.peek(0), ":") {
+		token := parser.next()
+		value, ok := parser.values[token]
+		if !ok {
+			return nil, parser.invalid("value not given for " + token)
+		}
+		return value, nil
+	}
+	path, err := parser.path()
+	if err != nil {
+		return nil, err
+	}
+	return valueAt(parser.item, path), nil
+}
+
+// path returns the attribute names of a path, with #placeholders replaced.
+func (parser *expression) path() ([]string, error) {
+	token := parser.next()
+	if token == "" || strings.ContainsAny(token, "(),=<>+-") || strings.HasPrefix(token, ":") {
+		return nil, parser.invalid("expected a path, got " + token)
+	}
+	var path []string
+	for _, part := range strings.Split(token, ".") {
+		if strings.HasPrefix(part, "#") {
+			name, ok := parser.names[part]
+			if !ok {
+				return nil, parser.invalid("name not given for " + part)
+			}
+			part = aws.StringValue(name)
+		}
+		path = append(path, part)
+	}
+	parser.paths[path[0]] = true
+	return path, nil
+}
+
+// update applies an update expression to a copy of the item and returns the copy. It understands
+// the SET, REMOVE, ADD and DELETE clauses, + and - between numbers, and the functions if_not_exists
+// and list_append. Like DynamoDB, every operand reads the item as it was before the update.
+func update(text string, item map[string]*dynamodb.AttributeValue, names map[string]*string, values map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	parser := &expression{
+		tokens: tokenize(text),
+		item:   item,
+		names:  names,
+		values: values,
+		paths:  map[string]bool{},
+	}
+	if len(parser.tokens) == 0 {
+		return nil, parser.invalid("the update expression is empty")
+	}
+	updated := map[string]*dynamodb.AttributeValue{}
+	for name, value := range item {
+		updated[name] = value
+	}
+	for parser.position < len(parser.tokens) {
+		clause := strings.ToUpper(parser.next())
+		if clause != "SET" && clause != "REMOVE" && clause != "ADD" && clause != "DELETE" {
+			return nil, parser.invalid("unknown clause " + clause)
+		}
+		for {
+			path, err := parser.path()
+			if err != nil {
+				return nil, err
+			}
+			var value *dynamodb.AttributeValue
+			switch clause {
+			case "SET":
+				if err := parser.expect("="); err != nil {
+					return nil, err
+				}
+				value, err = parser.setValue()
+			case "ADD", "DELETE":
+				var argument *dynamodb.AttributeValue
+				argument, err = parser.operand()
+				if err == nil {
+					value, err = parser.addOrDelete(clause, valueAt(item, path), argument)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := parser.setAt(updated, path, value); err != nil {
+				return nil, err
+			}
+			if !parser.accept(",") {
+				break
+			}
+		}
+	}
+	return updated, nil
+}
+
+// setValue returns the value a SET action assigns: an operand, or the sum or difference of two.
+func (parser *expression) setValue() (*dynamodb.AttributeValue, error) {
+	left, err := parser.setOperand()
+	if err != nil {
+		return nil, err
+	}
+	operator := parser.peek(0)
+	if operator != "+" && operator != "-" {
+		return left, nil
+	}
+	parser.position++
+	right, err := parser.setOperand()
+	if err != nil {
+		return nil, err
+	}
+	x, okX := number(left)
+	y, okY := number(right)
+	if !okX || !okY {
+		return nil, parser.invalid("an operand of " + operator + " is not a number")
+	}
+	if operator == "+" {
+		return numberValue(x.Add(x, y)), nil
+	}
+	return numberValue(x.Sub(x, y)), nil
+}
+
+func (parser *expression) setOperand() (*dynamodb.AttributeValue, error) {
+	function := parser.peek(0)
+	if parser.peek(1) != "(" || (function != "if_not_exists" && function != "list_append") {
+		return parser.operand()
+	}
+	parser.position += 2
+	first, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.expect(","); err != nil {
+		return nil, err
+	}
+	second, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.expect(")"); err != nil {
+		return nil, err
+	}
+	if function == "if_not_exists" {
+		if first == nil {
+			return second, nil
+		}
+		return first, nil
+	}
+	if first == nil || second == nil || first.L == nil || second.L == nil {
+		return nil, parser.invalid("an operand of list_append is not a list")
+	}
+	return &dynamodb.AttributeValue{L: append(append([]*dynamodb.AttributeValue{}, first.L...), second.L...)}, nil
+}
+
+// addOrDelete returns the value an ADD action leaves, adding a number or the elements of a set, or
+// a DELETE action leaves, removing the elements of a set. A set left empty is removed.
+func (parser *expression) addOrDelete(clause string, current *dynamodb.AttributeValue, argument *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if argument == nil {
+		return nil, parser.invalid("the operand of " + clause + " is missing")
+	}
+	if clause == "ADD" && argument.N != nil {
+		if current == nil {
+			return argument, nil
+		}
+		x, okX := number(current)
+		y, _ := number(argument)
+		if !okX {
+			return nil, parser.invalid("ADD of a number to an attribute that is not a number")
+		}
+		return numberValue(x.Add(x, y)), nil
+	}
+	if argument.SS == nil && argument.NS == nil && argument.BS == nil {
+		return nil, parser.invalid("the operand of " + clause + " is not a number or set")
+	}
+	if current == nil {
+		if clause == "DELETE" {
+			return nil, nil
+		}
+		return argument, nil
+	}
+	if attributeType(current) != attributeType(argument) {
+		return nil, parser.invalid(clause + " of a set of another type")
+	}
+	result := &dynamodb.AttributeValue{}
+	result.SS = combine(current.SS, argument.SS, clause == "ADD")
+	result.NS = combine(current.NS, argument.NS, clause == "ADD")
+	for _, element := range current.BS {
+		if !containsBytes(argument.BS, element) || clause == "ADD" {
+			result.BS = append(result.BS, element)
+		}
+	}
+	for _, element := range argument.BS {
+		if clause == "ADD" && !containsBytes(current.BS, element) {
+			result.BS = append(result.BS, element)
+		}
+	}
+	if len(result.SS) == 0 && len(result.NS) == 0 && len(result.BS) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// setAt sets the value at a path of the item, copying the maps along the path, or removes the
+// attribute when the value is nil.
+func (parser *expression) setAt(item map[string]*dynamodb.AttributeValue, path []string, value *dynamodb.AttributeValue) error {
+	if len(path) == 1 {
+		if value == nil {
+			delete(item, path[0])
+		} else {
+			item[path[0]] = value
+		}
+		return nil
+	}
+	parent := item[path[0]]
+	if parent == nil || parent.M == nil {
+		return parser.invalid("the document path " + strings.Join(path, ".") + " is invalid for update")
+	}
+	copied := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}
+	for name, child := range parent.M {
+		copied.M[name] = child
+	}
+	item[path[0]] = copied
+	return parser.setAt(copied.M, path[1:], value)
+}
+
+// valueAt returns the value at a path of the item, or nil when it is missing.
+func valueAt(item map[string]*dynamodb.AttributeValue, path []string) *dynamodb.AttributeValue {
+	value := item[path[0]]
+	for _, part := range path[1:] {
+		if value == nil {
+			return nil
+		}
+		value = value.M[part]
+	}
+	return value
+}
+
+func number(value *dynamodb.AttributeValue) (*big.Rat, bool) {
+	if value == nil || value.N == nil {
+		return nil, false
+	}
+	return new(big.Rat).SetString(*value.N)
+}
+
+func numberValue(value *big.Rat) *dynamodb.AttributeValue {
+	if value.IsInt() {
+		return &dynamodb.AttributeValue{N: aws.String(value.Num().String())}
+	}
+	return &dynamodb.AttributeValue{N: aws.String(strings.TrimRight(value.FloatString(38), "0"))}
+}
+
+// combine returns the union of two string or number sets, or the first without the elements of the second.
+func combine(current []*string, argument []*string, union bool) []*string {
+	var result []*string
+	for _, element := range current {
+		if union || !containsString(argument, *element) {
+			result = append(result, element)
+		}
+	}
+	for _, element := range argument {
+		if union && !containsString(current, *element) {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+func containsString(values []*string, value string) bool {
+	for _, candidate := range values {
+		if aws.StringValue(candidate) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBytes(values [][]byte, value []byte) bool {
+	for _, candidate := range values {
+		if bytes.Equal(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (parser *expression) peek(offset int) string {
+	if parser.position+offset < len(parser.tokens) {
+		return parser.tokens[parser.position+offset]
+	}
+	return ""
+}
+
+func (parser *expression) next() string {
+	token := parser.peek(0)
+	parser.position++
+	return token
+}
+
+func (parser *expression) accept(token string) bool {
+	if strings.EqualFold(parser.peek(0), token) {
+		parser.position++
+		return true
+	}
+	return false
+}
+
+func (parser *expression) expect(token string) error {
+	if !parser.accept(token) {
+		return parser.invalid("expected " + token + ", got " + parser.peek(0))
+	}
+	return nil
+}
+
+func (parser *expression) invalid(message string) error {
+	return awserr.New("ValidationException", "Invalid expression "+strings.Join(parser.tokens, " ")+": "+message, nil)
+}
+
+// compare orders two string, number or binary values of the same type, returning 0 when they
+// are equal. Missing values and values of different types return -2, so never compare equal.
+// Other types only compare equal when they are deeply equal.
+func compare(a, b *dynamodb.AttributeValue) int {
+	switch {
+	case a == nil || b == nil:
+		return -2
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S)
+	case a.N != nil && b.N != nil:
+		x, okX := new(big.Float).SetString(*a.N)
+		y, okY := new(big.Float).SetString(*b.N)
+		if !okX || !okY {
+			return strings.Compare(*a.N, *b.N)
+		}
+		return x.Cmp(y)
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B)
+	case reflect.DeepEqual(a, b):
+		return 0
+	}
+	return -2
+}
+
+func attributeType(value *dynamodb.AttributeValue) string {
+	switch {
+	case value.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case value.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case value.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	case value.BOOL != nil:
+		return "BOOL"
+	case value.NULL != nil:
+		return "NULL"
+	case value.M != nil:
+		return "M"
+	case value.L != nil:
+		return "L"
+	case value.SS != nil:
+		return "SS"
+	case value.NS != nil:
+		return "NS"
+	case value.BS != nil:
+		return "BS"
+	}
+	return ""
+}
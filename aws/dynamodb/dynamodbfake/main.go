@@ -0,0 +1,864 @@
+// Package dynamodbfake is an in-memory stand-in for the parts of the DynamoDB API used by the
+// github.com/PyramidSystemsInc/go/aws/dynamodb package, so it can be unit tested offline.
+package dynamodbfake
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDB keeps table descriptions and their items in memory, keyed by table name, so that
+// tables can be created, written, queried and scanned offline. Tables are ACTIVE as soon as they
+// are created. Calling an operation that is not implemented panics.
+type DynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	mutex     sync.Mutex
+	Region    string
+	AccountID string
+	Tables    map[string]*dynamodb.TableDescription
+	// Items holds the items of each table in the order they were first written.
+	Items map[string][]map[string]*dynamodb.AttributeValue
+	// UnprocessedBatches is the number of upcoming batch calls that leave their last request
+	// unprocessed, as DynamoDB does when throttled.
+	UnprocessedBatches int
+	// PageSize is the number of items Scan returns per page, unless the input has a lower limit.
+	PageSize int
+	// CreatingDescribes is the number of upcoming DescribeTable calls that report the table as
+	// CREATING, so that waiting can be tested.
+	CreatingDescribes   int
+	TimeToLive          map[string]*dynamodb.TimeToLiveDescription
+	PointInTimeRecovery map[string]bool
+	// Backups holds on-demand backups keyed by ARN.
+	Backups    map[string]*dynamodb.BackupDescription
+	backupData map[string]backup
+	counter    int
+}
+
+// backup is what a backup restores: the table as it was and a copy of its items.
+type backup struct {
+	table dynamodb.TableDescription
+	items []map[string]*dynamodb.AttributeValue
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *DynamoDB {
+	return &DynamoDB{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		Tables:    map[string]*dynamodb.TableDescription{},
+		Items:     map[string][]map[string]*dynamodb.AttributeValue{},
+		PageSize:  100,
+
+		TimeToLive:          map[string]*dynamodb.TimeToLiveDescription{},
+		PointInTimeRecovery: map[string]bool{},
+		Backups:             map[string]*dynamodb.BackupDescription{},
+		backupData:          map[string]backup{},
+	}
+}
+
+// CreateTableWithContext creates an active table.
+func (fake *DynamoDB) CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, opts ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.TableName)
+	if _, ok := fake.Tables[name]; ok {
+		return nil, awserr.New(dynamodb.ErrCodeResourceInUseException, "Table already exists: "+name, nil)
+	}
+	if len(input.KeySchema) == 0 {
+		return nil, awserr.New("ValidationException", "No key schema given for table "+name, nil)
+	}
+	table := &dynamodb.TableDescription{
+		AttributeDefinitions:  input.AttributeDefinitions,
+		CreationDateTime:      aws.Time(time.Now()),
+		ItemCount:             aws.Int64(0),
+		KeySchema:             input.KeySchema,
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{},
+		TableArn:              aws.String(fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", fake.Region, fake.AccountID, name)),
+		TableName:             aws.String(name),
+		TableStatus:           aws.String(dynamodb.TableStatusActive),
+	}
+	for _, index := range input.GlobalSecondaryIndexes {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndexDescription{
+			IndexArn:    aws.String(aws.StringValue(table.TableArn) + "/index/" + aws.StringValue(index.IndexName)),
+			IndexName:   index.IndexName,
+			IndexStatus: aws.String(dynamodb.IndexStatusActive),
+			KeySchema:   index.KeySchema,
+			Projection:  index.Projection,
+		})
+	}
+	for _, index := range input.LocalSecondaryIndexes {
+		table.LocalSecondaryIndexes = append(table.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndexDescription{
+			IndexArn:   aws.String(aws.StringValue(table.TableArn) + "/index/" + aws.StringValue(index.IndexName)),
+			IndexName:  index.IndexName,
+			KeySchema:  index.KeySchema,
+			Projection: index.Projection,
+		})
+	}
+	if input.ProvisionedThroughput != nil {
+		table.ProvisionedThroughput.ReadCapacityUnits = input.ProvisionedThroughput.ReadCapacityUnits
+		table.ProvisionedThroughput.WriteCapacityUnits = input.ProvisionedThroughput.WriteCapacityUnits
+	}
+	fake.Tables[name] = table
+	return &dynamodb.CreateTableOutput{
+		TableDescription: table,
+	}, nil
+}
+
+// DeleteTableWithContext deletes a table by name or ARN.
+func (fake *DynamoDB) DeleteTableWithContext(ctx aws.Context, input *dynamodb.DeleteTableInput, opts ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(fake.Tables, aws.StringValue(table.TableName))
+	delete(fake.Items, aws.StringValue(table.TableName))
+	table.TableStatus = aws.String(dynamodb.TableStatusDeleting)
+	return &dynamodb.DeleteTableOutput{
+		TableDescription: table,
+	}, nil
+}
+
+// DescribeTableWithContext describes a table by name or ARN.
+func (fake *DynamoDB) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if fake.CreatingDescribes > 0 {
+		fake.CreatingDescribes--
+		creating := *table
+		creating.TableStatus = aws.String(dynamodb.TableStatusCreating)
+		table = &creating
+	}
+	return &dynamodb.DescribeTableOutput{
+		Table: table,
+	}, nil
+}
+
+// UpdateTableWithContext turns the stream of a table on or off. Other updates are ignored.
+func (fake *DynamoDB) UpdateTableWithContext(ctx aws.Context, input *dynamodb.UpdateTableInput, opts ...request.Option) (*dynamodb.UpdateTableOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if stream := input.StreamSpecification; stream != nil {
+		if aws.BoolValue(stream.StreamEnabled) && table.StreamSpecification != nil && aws.BoolValue(table.StreamSpecification.StreamEnabled) {
+			return nil, awserr.New("ValidationException", "Table already has an enabled stream: "+aws.StringValue(table.TableName), nil)
+		}
+		table.StreamSpecification = stream
+		if aws.BoolValue(stream.StreamEnabled) {
+			label := time.Now().UTC().Format("2006-01-02T15:04:05.000")
+			table.LatestStreamLabel = aws.String(label)
+			table.LatestStreamArn = aws.String(aws.StringValue(table.TableArn) + "/stream/" + label)
+		}
+	}
+	return &dynamodb.UpdateTableOutput{
+		TableDescription: table,
+	}, nil
+}
+
+// DescribeTimeToLiveWithContext reports the time to live of a table, DISABLED by default.
+func (fake *DynamoDB) DescribeTimeToLiveWithContext(ctx aws.Context, input *dynamodb.DescribeTimeToLiveInput, opts ...request.Option) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	description, ok := fake.TimeToLive[aws.StringValue(table.TableName)]
+	if !ok {
+		description = &dynamodb.TimeToLiveDescription{
+			TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusDisabled),
+		}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{
+		TimeToLiveDescription: description,
+	}, nil
+}
+
+// UpdateTimeToLiveWithContext turns the time to live of a table on or off at once. Like DynamoDB,
+// it refuses to turn it on when it already is.
+func (fake *DynamoDB) UpdateTimeToLiveWithContext(ctx aws.Context, input *dynamodb.UpdateTimeToLiveInput, opts ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(table.TableName)
+	enabled := aws.BoolValue(input.TimeToLiveSpecification.Enabled)
+	if current, ok := fake.TimeToLive[name]; ok && enabled && aws.StringValue(current.TimeToLiveStatus) == dynamodb.TimeToLiveStatusEnabled {
+		return nil, awserr.New("ValidationException", "TimeToLive is already enabled", nil)
+	}
+	status := dynamodb.TimeToLiveStatusDisabled
+	if enabled {
+		status = dynamodb.TimeToLiveStatusEnabled
+	}
+	fake.TimeToLive[name] = &dynamodb.TimeToLiveDescription{
+		AttributeName:    input.TimeToLiveSpecification.AttributeName,
+		TimeToLiveStatus: aws.String(status),
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{
+		TimeToLiveSpecification: input.TimeToLiveSpecification,
+	}, nil
+}
+
+// UpdateContinuousBackupsWithContext turns point in time recovery of a table on or off.
+func (fake *DynamoDB) UpdateContinuousBackupsWithContext(ctx aws.Context, input *dynamodb.UpdateContinuousBackupsInput, opts ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	enabled := aws.BoolValue(input.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled)
+	fake.PointInTimeRecovery[aws.StringValue(table.TableName)] = enabled
+	status := dynamodb.PointInTimeRecoveryStatusDisabled
+	if enabled {
+		status = dynamodb.PointInTimeRecoveryStatusEnabled
+	}
+	return &dynamodb.UpdateContinuousBackupsOutput{
+		ContinuousBackupsDescription: &dynamodb.ContinuousBackupsDescription{
+			ContinuousBackupsStatus: aws.String(dynamodb.ContinuousBackupsStatusEnabled),
+			PointInTimeRecoveryDescription: &dynamodb.PointInTimeRecoveryDescription{
+				PointInTimeRecoveryStatus: aws.String(status),
+			},
+		},
+	}, nil
+}
+
+// CreateBackupWithContext copies the items of a table into a backup that is available at once.
+func (fake *DynamoDB) CreateBackupWithContext(ctx aws.Context, input *dynamodb.CreateBackupInput, opts ...request.Option) (*dynamodb.CreateBackupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(table.TableName)
+	fake.counter++
+	backupArn := fmt.Sprintf("%s/backup/%017d-%08d", aws.StringValue(table.TableArn), time.Now().UnixNano()/int64(time.Millisecond), fake.counter)
+	fake.Backups[backupArn] = &dynamodb.BackupDescription{
+		BackupDetails: &dynamodb.BackupDetails{
+			BackupArn:              aws.String(backupArn),
+			BackupCreationDateTime: aws.Time(time.Now()),
+			BackupName:             input.BackupName,
+			BackupSizeBytes:        aws.Int64(0),
+			BackupStatus:           aws.String(dynamodb.BackupStatusAvailable),
+			BackupType:             aws.String(dynamodb.BackupTypeUser),
+		},
+		SourceTableDetails: &dynamodb.SourceTableDetails{
+			ItemCount: table.ItemCount,
+			KeySchema: table.KeySchema,
+			TableArn:  table.TableArn,
+			TableName: table.TableName,
+		},
+	}
+	fake.backupData[backupArn] = backup{
+		table: *table,
+		items: append([]map[string]*dynamodb.AttributeValue{}, fake.Items[name]...),
+	}
+	return &dynamodb.CreateBackupOutput{
+		BackupDetails: fake.Backups[backupArn].BackupDetails,
+	}, nil
+}
+
+// DescribeBackupWithContext describes a backup by ARN.
+func (fake *DynamoDB) DescribeBackupWithContext(ctx aws.Context, input *dynamodb.DescribeBackupInput, opts ...request.Option) (*dynamodb.DescribeBackupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	description, err := fake.backup(input.BackupArn)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeBackupOutput{
+		BackupDescription: description,
+	}, nil
+}
+
+// ListBackupsWithContext lists the backups of a table (or of all tables) one at a time, so that
+// callers have to follow LastEvaluatedBackupArn.
+func (fake *DynamoDB) ListBackupsWithContext(ctx aws.Context, input *dynamodb.ListBackupsInput, opts ...request.Option) (*dynamodb.ListBackupsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var arns []string
+	for backupArn, description := range fake.Backups {
+		if input.TableName == nil || aws.StringValue(description.SourceTableDetails.TableName) == aws.StringValue(input.TableName) {
+			arns = append(arns, backupArn)
+		}
+	}
+	sort.Strings(arns)
+	start := 0
+	if input.ExclusiveStartBackupArn != nil {
+		start = sort.SearchStrings(arns, aws.StringValue(input.ExclusiveStartBackupArn)) + 1
+	}
+	output := &dynamodb.ListBackupsOutput{}
+	if start < len(arns) {
+		details := fake.Backups[arns[start]].BackupDetails
+		source := fake.Backups[arns[start]].SourceTableDetails
+		output.BackupSummaries = []*dynamodb.BackupSummary{
+			{
+				BackupArn:              details.BackupArn,
+				BackupCreationDateTime: details.BackupCreationDateTime,
+				BackupName:             details.BackupName,
+				BackupSizeBytes:        details.BackupSizeBytes,
+				BackupStatus:           details.BackupStatus,
+				BackupType:             details.BackupType,
+				TableArn:               source.TableArn,
+				TableName:              source.TableName,
+			},
+		}
+		if start < len(arns)-1 {
+			output.LastEvaluatedBackupArn = details.BackupArn
+		}
+	}
+	return output, nil
+}
+
+// DeleteBackupWithContext deletes a backup by ARN.
+func (fake *DynamoDB) DeleteBackupWithContext(ctx aws.Context, input *dynamodb.DeleteBackupInput, opts ...request.Option) (*dynamodb.DeleteBackupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	description, err := fake.backup(input.BackupArn)
+	if err != nil {
+		return nil, err
+	}
+	delete(fake.Backups, aws.StringValue(input.BackupArn))
+	delete(fake.backupData, aws.StringValue(input.BackupArn))
+	description.BackupDetails.BackupStatus = aws.String(dynamodb.BackupStatusDeleted)
+	return &dynamodb.DeleteBackupOutput{
+		BackupDescription: description,
+	}, nil
+}
+
+// RestoreTableFromBackupWithContext creates an active table with the key schema and items of a
+// backup.
+func (fake *DynamoDB) RestoreTableFromBackupWithContext(ctx aws.Context, input *dynamodb.RestoreTableFromBackupInput, opts ...request.Option) (*dynamodb.RestoreTableFromBackupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if _, err := fake.backup(input.BackupArn); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.TargetTableName)
+	if _, ok := fake.Tables[name]; ok {
+		return nil, awserr.New(dynamodb.ErrCodeTableAlreadyExistsException, "Table already exists: "+name, nil)
+	}
+	data := fake.backupData[aws.StringValue(input.BackupArn)]
+	table := data.table
+	table.CreationDateTime = aws.Time(time.Now())
+	table.LatestStreamArn = nil
+	table.LatestStreamLabel = nil
+	table.StreamSpecification = nil
+	table.TableArn = aws.String(fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", fake.Region, fake.AccountID, name))
+	table.TableName = aws.String(name)
+	table.TableStatus = aws.String(dynamodb.TableStatusActive)
+	fake.Tables[name] = &table
+	fake.Items[name] = append([]map[string]*dynamodb.AttributeValue{}, data.items...)
+	return &dynamodb.RestoreTableFromBackupOutput{
+		TableDescription: &table,
+	}, nil
+}
+
+// PutItemWithContext writes an item if the condition holds.
+func (fake *DynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := fake.item(table, input.Item)
+	if err != nil {
+		return nil, err
+	}
+	err = fake.checkCondition(table, index, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	fake.put(table, index, input.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// GetItemWithContext reads an item, returning no item when it does not exist.
+func (fake *DynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := fake.item(table, input.Key)
+	if err != nil || index < 0 {
+		return &dynamodb.GetItemOutput{}, err
+	}
+	return &dynamodb.GetItemOutput{
+		Item: fake.Items[aws.StringValue(table.TableName)][index],
+	}, nil
+}
+
+// UpdateItemWithContext applies an update expression to an item if the condition holds, creating
+// the item from its key when it does not exist. It returns the item as updated for ALL_NEW and as
+// it was for ALL_OLD.
+func (fake *DynamoDB) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := fake.item(table, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = fake.checkCondition(table, index, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	item := input.Key
+	if index >= 0 {
+		item = fake.Items[aws.StringValue(table.TableName)][index]
+	}
+	updated, err := update(aws.StringValue(input.UpdateExpression), item, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range table.KeySchema {
+		name := aws.StringValue(element.AttributeName)
+		if compare(updated[name], input.Key[name]) != 0 {
+			return nil, awserr.New("ValidationException", "Cannot update attribute "+name+". This attribute is part of the key", nil)
+		}
+	}
+	fake.put(table, index, updated)
+	output := &dynamodb.UpdateItemOutput{}
+	switch aws.StringValue(input.ReturnValues) {
+	case dynamodb.ReturnValueAllNew:
+		output.Attributes = updated
+	case dynamodb.ReturnValueAllOld:
+		if index >= 0 {
+			output.Attributes = item
+		}
+	}
+	return output, nil
+}
+
+// DeleteItemWithContext deletes an item if the condition holds. Deleting a missing item succeeds.
+func (fake *DynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := fake.item(table, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = fake.checkCondition(table, index, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	fake.delete(table, index)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// ScanWithContext returns a page of the items of a table or index, or of one segment of it, in
+// the order they were first written. Items are split into segments by a hash of their partition
+// key. Like DynamoDB, the limit applies before the filter.
+func (fake *DynamoDB) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	keySchema, err := indexKeySchema(table, input.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]*dynamodb.AttributeValue
+	for _, item := range fake.Items[aws.StringValue(table.TableName)] {
+		if !hasKey(keySchema, item) {
+			continue
+		}
+		if input.TotalSegments == nil || segment(keySchema, item, aws.Int64Value(input.TotalSegments)) == aws.Int64Value(input.Segment) {
+			items = append(items, item)
+		}
+	}
+	page, lastKey := fake.page(table, keySchema, items, input.ExclusiveStartKey, input.Limit)
+	filtered, err := filter(page, input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{
+		Count:            aws.Int64(int64(len(filtered))),
+		Items:            filtered,
+		LastEvaluatedKey: lastKey,
+		ScannedCount:     aws.Int64(int64(len(page))),
+	}, nil
+}
+
+// QueryWithContext returns a page of the items of a table or index matching the key condition,
+// in sort key order. The key condition must read the partition key. Like DynamoDB, the limit
+// applies before the filter.
+func (fake *DynamoDB) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	table, err := fake.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	keySchema, err := indexKeySchema(table, input.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	partitionKey := keyName(keySchema, dynamodb.KeyTypeHash)
+	_, paths, err := evaluate(aws.StringValue(input.KeyConditionExpression), map[string]*dynamodb.AttributeValue{}, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if !paths[partitionKey] {
+		return nil, awserr.New("ValidationException", "Query condition missed key schema element: "+partitionKey, nil)
+	}
+	var items []map[string]*dynamodb.AttributeValue
+	for _, item := range fake.Items[aws.StringValue(table.TableName)] {
+		if !hasKey(keySchema, item) {
+			continue
+		}
+		matches, _, err := evaluate(aws.StringValue(input.KeyConditionExpression), item, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			items = append(items, item)
+		}
+	}
+	sortKey := keyName(keySchema, dynamodb.KeyTypeRange)
+	descending := input.ScanIndexForward != nil && !*input.ScanIndexForward
+	sort.SliceStable(items, func(i, j int) bool {
+		if descending {
+			return compare(items[i][sortKey], items[j][sortKey]) == 1
+		}
+		return compare(items[i][sortKey], items[j][sortKey]) == -1
+	})
+	page, lastKey := fake.page(table, keySchema, items, input.ExclusiveStartKey, input.Limit)
+	filtered, err := filter(page, input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.QueryOutput{
+		Count:            aws.Int64(int64(len(filtered))),
+		Items:            filtered,
+		LastEvaluatedKey: lastKey,
+		ScannedCount:     aws.Int64(int64(len(page))),
+	}, nil
+}
+
+// QueryPagesWithContext calls fn with every page of QueryWithContext until fn returns false.
+func (fake *DynamoDB) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.QueryWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.LastEvaluatedKey == nil) || output.LastEvaluatedKey == nil {
+			return nil
+		}
+		page.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// ScanPagesWithContext calls fn with every page of ScanWithContext until fn returns false.
+func (fake *DynamoDB) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.ScanWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.LastEvaluatedKey == nil) || output.LastEvaluatedKey == nil {
+			return nil
+		}
+		page.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// BatchWriteItemWithContext puts and deletes up to 25 items, leaving the last request
+// unprocessed while UnprocessedBatches is positive.
+func (fake *DynamoDB) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	count := 0
+	for _, requests := range input.RequestItems {
+		count += len(requests)
+	}
+	if count == 0 || count > 25 {
+		return nil, awserr.New("ValidationException", fmt.Sprintf("Batch writes take 1 to 25 requests, got %d", count), nil)
+	}
+	output := &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]*dynamodb.WriteRequest{},
+	}
+	for name, requests := range input.RequestItems {
+		table, err := fake.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		if fake.UnprocessedBatches > 0 {
+			fake.UnprocessedBatches--
+			output.UnprocessedItems[name] = requests[len(requests)-1:]
+			requests = requests[:len(requests)-1]
+		}
+		for _, request := range requests {
+			if request.PutRequest != nil {
+				index, err := fake.item(table, request.PutRequest.Item)
+				if err != nil {
+					return nil, err
+				}
+				fake.put(table, index, request.PutRequest.Item)
+			} else if request.DeleteRequest != nil {
+				index, err := fake.item(table, request.DeleteRequest.Key)
+				if err != nil {
+					return nil, err
+				}
+				fake.delete(table, index)
+			}
+		}
+	}
+	return output, nil
+}
+
+// BatchGetItemWithContext reads up to 100 items, leaving the last key unprocessed while
+// UnprocessedBatches is positive.
+func (fake *DynamoDB) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	count := 0
+	for _, keys := range input.RequestItems {
+		count += len(keys.Keys)
+	}
+	if count == 0 || count > 100 {
+		return nil, awserr.New("ValidationException", fmt.Sprintf("Batch reads take 1 to 100 keys, got %d", count), nil)
+	}
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	for name, keys := range input.RequestItems {
+		table, err := fake.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		requested := keys.Keys
+		if fake.UnprocessedBatches > 0 {
+			fake.UnprocessedBatches--
+			output.UnprocessedKeys[name] = &dynamodb.KeysAndAttributes{
+				Keys: requested[len(requested)-1:],
+			}
+			requested = requested[:len(requested)-1]
+		}
+		for _, key := range requested {
+			index, err := fake.item(table, key)
+			if err != nil {
+				return nil, err
+			}
+			if index >= 0 {
+				output.Responses[name] = append(output.Responses[name], fake.Items[name][index])
+			}
+		}
+	}
+	return output, nil
+}
+
+func (fake *DynamoDB) table(nameOrArn *string) (*dynamodb.TableDescription, error) {
+	name := aws.StringValue(nameOrArn)
+	table, ok := fake.Tables[name[strings.LastIndex(name, "/")+1:]]
+	if !ok {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found: Table: "+name+" not found", nil)
+	}
+	return table, nil
+}
+
+func (fake *DynamoDB) backup(backupArn *string) (*dynamodb.BackupDescription, error) {
+	description, ok := fake.Backups[aws.StringValue(backupArn)]
+	if !ok {
+		return nil, awserr.New(dynamodb.ErrCodeBackupNotFoundException, "Backup not found: "+aws.StringValue(backupArn), nil)
+	}
+	return description, nil
+}
+
+// page returns the items following the start key (or the first ones) up to the page size or
+// limit, and the table and index key of the last item returned when more items follow.
+func (fake *DynamoDB) page(table *dynamodb.TableDescription, keySchema []*dynamodb.KeySchemaElement, items []map[string]*dynamodb.AttributeValue, startKey map[string]*dynamodb.AttributeValue, limit *int64) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue) {
+	offset := 0
+	if startKey != nil {
+		for i, item := range items {
+			if sameKey(table.KeySchema, item, startKey) {
+				offset = i + 1
+				break
+			}
+		}
+	}
+	size := fake.PageSize
+	if limit != nil && int(*limit) < size {
+		size = int(*limit)
+	}
+	end := offset + size
+	if end >= len(items) {
+		if offset >= len(items) {
+			return nil, nil
+		}
+		return items[offset:], nil
+	}
+	lastKey := map[string]*dynamodb.AttributeValue{}
+	for _, element := range append(keySchema, table.KeySchema...) {
+		name := aws.StringValue(element.AttributeName)
+		lastKey[name] = items[end-1][name]
+	}
+	return items[offset:end], lastKey
+}
+
+// filter returns the items for which the filter expression holds.
+func filter(items []map[string]*dynamodb.AttributeValue, expression *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, error) {
+	if expression == nil {
+		return items, nil
+	}
+	var filtered []map[string]*dynamodb.AttributeValue
+	for _, item := range items {
+		holds, _, err := evaluate(aws.StringValue(expression), item, names, values)
+		if err != nil {
+			return nil, err
+		}
+		if holds {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// indexKeySchema returns the key schema of the named index of a table, or of the table itself
+// when no index is named.
+func indexKeySchema(table *dynamodb.TableDescription, indexName *string) ([]*dynamodb.KeySchemaElement, error) {
+	if indexName == nil {
+		return table.KeySchema, nil
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == aws.StringValue(indexName) {
+			return index.KeySchema, nil
+		}
+	}
+	for _, index := range table.LocalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == aws.StringValue(indexName) {
+			return index.KeySchema, nil
+		}
+	}
+	return nil, awserr.New("ValidationException", "The table does not have the specified index: "+aws.StringValue(indexName), nil)
+}
+
+// keyName returns the attribute of the key of the type (HASH or RANGE), or an empty string.
+func keyName(keySchema []*dynamodb.KeySchemaElement, keyType string) string {
+	for _, element := range keySchema {
+		if aws.StringValue(element.KeyType) == keyType {
+			return aws.StringValue(element.AttributeName)
+		}
+	}
+	return ""
+}
+
+// hasKey reports whether an item has every key attribute, as items without them are left out
+// of secondary indexes.
+func hasKey(keySchema []*dynamodb.KeySchemaElement, item map[string]*dynamodb.AttributeValue) bool {
+	for _, element := range keySchema {
+		if item[aws.StringValue(element.AttributeName)] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// segment returns the parallel scan segment of an item, from a hash of its partition key.
+func segment(keySchema []*dynamodb.KeySchemaElement, item map[string]*dynamodb.AttributeValue, totalSegments int64) int64 {
+	hash := fnv.New32a()
+	value := item[keyName(keySchema, dynamodb.KeyTypeHash)]
+	hash.Write([]byte(aws.StringValue(value.S) + aws.StringValue(value.N)))
+	hash.Write(value.B)
+	return int64(hash.Sum32()) % totalSegments
+}
+
+func sameKey(keySchema []*dynamodb.KeySchemaElement, item map[string]*dynamodb.AttributeValue, key map[string]*dynamodb.AttributeValue) bool {
+	for _, element := range keySchema {
+		name := aws.StringValue(element.AttributeName)
+		if compare(item[name], key[name]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// item returns the index of the item with the same key as the given item or key, or -1 when
+// there is none. It fails when a key attribute is missing.
+func (fake *DynamoDB) item(table *dynamodb.TableDescription, key map[string]*dynamodb.AttributeValue) (int, error) {
+	for _, element := range table.KeySchema {
+		if key[aws.StringValue(element.AttributeName)] == nil {
+			return -1, awserr.New("ValidationException", "The provided key element does not match the schema: missing "+aws.StringValue(element.AttributeName), nil)
+		}
+	}
+	for i, item := range fake.Items[aws.StringValue(table.TableName)] {
+		if sameKey(table.KeySchema, item, key) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (fake *DynamoDB) put(table *dynamodb.TableDescription, index int, item map[string]*dynamodb.AttributeValue) {
+	name := aws.StringValue(table.TableName)
+	if index < 0 {
+		fake.Items[name] = append(fake.Items[name], item)
+	} else {
+		fake.Items[name][index] = item
+	}
+	table.ItemCount = aws.Int64(int64(len(fake.Items[name])))
+}
+
+func (fake *DynamoDB) delete(table *dynamodb.TableDescription, index int) {
+	if index < 0 {
+		return
+	}
+	name := aws.StringValue(table.TableName)
+	fake.Items[name] = append(fake.Items[name][:index], fake.Items[name][index+1:]...)
+	table.ItemCount = aws.Int64(int64(len(fake.Items[name])))
+}
+
+// checkCondition evaluates a condition expression against the item at index, or against no
+// attributes when there is no such item.
+func (fake *DynamoDB) checkCondition(table *dynamodb.TableDescription, index int, condition *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) error {
+	item := map[string]*dynamodb.AttributeValue{}
+	if index >= 0 {
+		item = fake.Items[aws.StringValue(table.TableName)][index]
+	}
+	holds, _, err := evaluate(aws.StringValue(condition), item, names, values)
+	if err != nil {
+		return err
+	}
+	if !holds {
+		return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	return nil
+}
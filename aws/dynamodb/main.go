@@ -1,31 +1,1407 @@
 package dynamodb
 
 import (
+  "bufio"
+  "context"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "reflect"
+  "regexp"
+  "sort"
+  "strconv"
   "strings"
+  "sync"
+  "time"
 
   "github.com/PyramidSystemsInc/go/aws/util"
   "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/files"
+  "github.com/PyramidSystemsInc/go/str"
   "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/dynamodb"
+  "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+  "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
+// Client - Manages tables, backups and streams and reads and writes typed items through DynamoDB
+type Client struct {
+  DynamoDB dynamodbiface.DynamoDBAPI
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    DynamoDB: dynamodb.New(awsSession),
+  }
+}
+
+// Expression - A condition, key condition, filter or update expression along with the values of its #name and :value placeholders.
+// Values are marshalled with dynamodbattribute
+type Expression struct {
+  Text    string
+  Names   map[string]string
+  Values  map[string]interface{}
+}
+
+// QueryOptions - Settings for Query and QueryEach
+type QueryOptions struct {
+  // IndexName - Secondary index to query instead of the table
+  IndexName       string
+  // Filter - Drops items after they are read, so they still count towards the read capacity used
+  Filter          Expression
+  // Descending - Returns items from the highest sort key down
+  Descending      bool
+  // Limit - Most items returned. Zero returns every matching item
+  Limit           int64
+  ConsistentRead  bool
+}
+
+// ScanOptions - Settings for Scan and ScanEach
+type ScanOptions struct {
+  // IndexName - Secondary index to scan instead of the table
+  IndexName       string
+  Filter          Expression
+  // Limit - Most items returned. Zero returns every matching item
+  Limit           int64
+  ConsistentRead  bool
+  // Segments - Number of segments of the table scanned in parallel, one when zero
+  Segments        int
+}
+
+// Item - An item as read from DynamoDB
+type Item map[string]*dynamodb.AttributeValue
+
+// Unmarshal - Decodes the item into a struct or map using dynamodbattribute
+func (item Item) Unmarshal(out interface{}) error {
+  return dynamodbattribute.UnmarshalMap(item, out)
+}
+
+// Backup - An on-demand backup of a table
+type Backup struct {
+  Arn        string
+  Name       string
+  CreatedAt  time.Time
+  // Status - CREATING, AVAILABLE or DELETED
+  Status     string
+  SizeBytes  int64
+}
+
+// SeedOptions - Settings for SeedTable
+type SeedOptions struct {
+  // Types - Attribute type (S, N, BOOL, or M and L for JSON) of CSV columns by name. Other columns hold numbers, booleans or strings by their look
+  Types    map[string]string
+  // Workers - Number of batches written at a time, 4 when zero
+  Workers  int
+}
+
+// numberPattern - CSV cells inferred as numbers
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// maxBatchAttempts - Number of times a batch is sent before giving up on its unprocessed items
+const maxBatchAttempts = 10
+
+func BatchGet(tableName string, keys interface{}, out interface{}, awsSession *session.Session) {
+  errors.QuitIfError(BatchGetE(tableName, keys, out, awsSession))
+}
+
+// BatchGetE - Reads the items with the keys (a slice of structs or maps) into out (a pointer to a slice), in any order, returning any error
+func BatchGetE(tableName string, keys interface{}, out interface{}, awsSession *session.Session) error {
+  return BatchGetWithContext(context.Background(), tableName, keys, out, awsSession)
+}
+
+// BatchGetWithContext - BatchGetE with a context to allow cancellation
+func BatchGetWithContext(ctx context.Context, tableName string, keys interface{}, out interface{}, awsSession *session.Session) error {
+  return New(awsSession).BatchGet(ctx, tableName, keys, out)
+}
+
+// BatchGet - Reads the items with the keys (a slice of structs or maps) into out (a pointer to a slice), in any order, returning any error.
+// Keys are read 100 at a time and unprocessed keys are retried with backoff. Missing items are left out
+func (client *Client) BatchGet(ctx context.Context, tableName string, keys interface{}, out interface{}) error {
+  marshalledKeys, err := marshalList(keys)
+  if err != nil {
+    return err
+  }
+  var items []map[string]*dynamodb.AttributeValue
+  for start := 0; start < len(marshalledKeys); start += 100 {
+    end := start + 100
+    if end > len(marshalledKeys) {
+      end = len(marshalledKeys)
+    }
+    requestItems := map[string]*dynamodb.KeysAndAttributes{
+      tableName: &dynamodb.KeysAndAttributes{
+        Keys: marshalledKeys[start:end],
+      },
+    }
+    err = retryBatch(ctx, tableName, func() (int, error) {
+      result, err := client.DynamoDB.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+        RequestItems: requestItems,
+      })
+      if err != nil {
+        return 0, err
+      }
+      items = append(items, result.Responses[tableName]...)
+      requestItems = result.UnprocessedKeys
+      if len(requestItems) == 0 {
+        return 0, nil
+      }
+      return len(requestItems[tableName].Keys), nil
+    })
+    if err != nil {
+      return err
+    }
+  }
+  return dynamodbattribute.UnmarshalListOfMaps(items, out)
+}
+
+func BatchPut(tableName string, items interface{}, awsSession *session.Session) {
+  errors.QuitIfError(BatchPutE(tableName, items, awsSession))
+}
+
+// BatchPutE - Writes the items (a slice of structs or maps), replacing any with the same keys, returning any error
+func BatchPutE(tableName string, items interface{}, awsSession *session.Session) error {
+  return BatchPutWithContext(context.Background(), tableName, items, awsSession)
+}
+
+// BatchPutWithContext - BatchPutE with a context to allow cancellation
+func BatchPutWithContext(ctx context.Context, tableName string, items interface{}, awsSession *session.Session) error {
+  return New(awsSession).BatchPut(ctx, tableName, items)
+}
+
+// BatchPut - Writes the items (a slice of structs or maps), replacing any with the same keys, returning any error.
+// Items are written 25 at a time and unprocessed items are retried with backoff
+func (client *Client) BatchPut(ctx context.Context, tableName string, items interface{}) error {
+  marshalledItems, err := marshalList(items)
+  if err != nil {
+    return err
+  }
+  var requests []*dynamodb.WriteRequest
+  for _, item := range marshalledItems {
+    requests = append(requests, &dynamodb.WriteRequest{
+      PutRequest: &dynamodb.PutRequest{
+        Item: item,
+      },
+    })
+  }
+  return client.batchWrite(ctx, tableName, requests)
+}
+
+func BatchDelete(tableName string, keys interface{}, awsSession *session.Session) {
+  errors.QuitIfError(BatchDeleteE(tableName, keys, awsSession))
+}
+
+// BatchDeleteE - Deletes the items with the keys (a slice of structs or maps), returning any error
+func BatchDeleteE(tableName string, keys interface{}, awsSession *session.Session) error {
+  return BatchDeleteWithContext(context.Background(), tableName, keys, awsSession)
+}
+
+// BatchDeleteWithContext - BatchDeleteE with a context to allow cancellation
+func BatchDeleteWithContext(ctx context.Context, tableName string, keys interface{}, awsSession *session.Session) error {
+  return New(awsSession).BatchDelete(ctx, tableName, keys)
+}
+
+// BatchDelete - Deletes the items with the keys (a slice of structs or maps), returning any error.
+// Keys are deleted 25 at a time and unprocessed keys are retried with backoff
+func (client *Client) BatchDelete(ctx context.Context, tableName string, keys interface{}) error {
+  marshalledKeys, err := marshalList(keys)
+  if err != nil {
+    return err
+  }
+  var requests []*dynamodb.WriteRequest
+  for _, key := range marshalledKeys {
+    requests = append(requests, &dynamodb.WriteRequest{
+      DeleteRequest: &dynamodb.DeleteRequest{
+        Key: key,
+      },
+    })
+  }
+  return client.batchWrite(ctx, tableName, requests)
+}
+
+func DeleteItem(tableName string, key interface{}, condition Expression, awsSession *session.Session) {
+  errors.QuitIfError(DeleteItemE(tableName, key, condition, awsSession))
+}
+
+// DeleteItemE - Deletes the item with the key (a struct or map) if the condition holds, returning any error
+func DeleteItemE(tableName string, key interface{}, condition Expression, awsSession *session.Session) error {
+  return DeleteItemWithContext(context.Background(), tableName, key, condition, awsSession)
+}
+
+// DeleteItemWithContext - DeleteItemE with a context to allow cancellation
+func DeleteItemWithContext(ctx context.Context, tableName string, key interface{}, condition Expression, awsSession *session.Session) error {
+  return New(awsSession).DeleteItem(ctx, tableName, key, condition)
+}
+
+// DeleteItem - Deletes the item with the key (a struct or map) if the condition holds, returning any error.
+// An empty condition always holds. Check a failed condition with IsConditionFailed
+func (client *Client) DeleteItem(ctx context.Context, tableName string, key interface{}, condition Expression) error {
+  marshalledKey, err := dynamodbattribute.MarshalMap(key)
+  if err != nil {
+    return err
+  }
+  names, values, err := expressionAttributes(condition)
+  if err != nil {
+    return err
+  }
+  _, err = client.DynamoDB.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+    ConditionExpression: optionalString(condition.Text),
+    ExpressionAttributeNames: names,
+    ExpressionAttributeValues: values,
+    Key: marshalledKey,
+    TableName: aws.String(tableName),
+  })
+  return err
+}
+
+func DeleteBackup(backupArn string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteBackupE(backupArn, awsSession))
+}
+
+// DeleteBackupE - Deletes an on-demand backup, returning any error
+func DeleteBackupE(backupArn string, awsSession *session.Session) error {
+  return DeleteBackupWithContext(context.Background(), backupArn, awsSession)
+}
+
+// DeleteBackupWithContext - DeleteBackupE with a context to allow cancellation
+func DeleteBackupWithContext(ctx context.Context, backupArn string, awsSession *session.Session) error {
+  return New(awsSession).DeleteBackup(ctx, backupArn)
+}
+
+// DeleteBackup - Deletes an on-demand backup, returning any error
+func (client *Client) DeleteBackup(ctx context.Context, backupArn string) error {
+  _, err := client.DynamoDB.DeleteBackupWithContext(ctx, &dynamodb.DeleteBackupInput{
+    BackupArn: aws.String(backupArn),
+  })
+  return err
+}
+
 // DeleteTable - Deletes an AWS DynamoDB table
 func DeleteTable(arnOrName string, awsSession *session.Session) {
-  tableName := getTableName(arnOrName)
-  dynamoDbClient := dynamodb.New(awsSession)
-  _, err := dynamoDbClient.DeleteTable(&dynamodb.DeleteTableInput{
-    TableName: aws.String(tableName),
+  errors.QuitIfError(DeleteTableE(arnOrName, awsSession))
+}
+
+// DeleteTableE - Deletes an AWS DynamoDB table, returning any error
+func DeleteTableE(arnOrName string, awsSession *session.Session) error {
+  return DeleteTableWithContext(context.Background(), arnOrName, awsSession)
+}
+
+// DeleteTableWithContext - DeleteTableE with a context to allow cancellation
+func DeleteTableWithContext(ctx context.Context, arnOrName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteTable(ctx, arnOrName)
+}
+
+// DeleteTable - Deletes an AWS DynamoDB table, returning any error
+func (client *Client) DeleteTable(ctx context.Context, arnOrName string) error {
+  _, err := client.DynamoDB.DeleteTableWithContext(ctx, &dynamodb.DeleteTableInput{
+    TableName: aws.String(getTableName(arnOrName)),
   })
+  return err
+}
+
+// DeleteTableAndWait - Deletes an AWS DynamoDB table and waits until it is gone
+func DeleteTableAndWait(arnOrName string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteTableAndWaitE(arnOrName, awsSession))
+}
+
+// DeleteTableAndWaitE - Deletes an AWS DynamoDB table and waits until it is gone, returning any error
+func DeleteTableAndWaitE(arnOrName string, awsSession *session.Session) error {
+  return DeleteTableAndWaitWithContext(context.Background(), arnOrName, awsSession)
+}
+
+// DeleteTableAndWaitWithContext - DeleteTableAndWaitE where the context can cancel the wait or give it another deadline
+func DeleteTableAndWaitWithContext(ctx context.Context, arnOrName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteTableAndWait(ctx, arnOrName)
+}
+
+// DeleteTableAndWait - Deletes an AWS DynamoDB table and waits until it is gone, returning any error
+func (client *Client) DeleteTableAndWait(ctx context.Context, arnOrName string) error {
+  err := client.DeleteTable(ctx, arnOrName)
+  if err != nil {
+    return err
+  }
+  return client.WaitForTableDeleted(ctx, getTableName(arnOrName))
+}
+
+// CreateBackup - Takes an on-demand backup of a table and waits until it is available, returning its ARN
+func CreateBackup(tableName string, backupName string, awsSession *session.Session) string {
+  backupArn, err := CreateBackupE(tableName, backupName, awsSession)
   errors.QuitIfError(err)
+  return backupArn
+}
+
+// CreateBackupE - Takes an on-demand backup of a table and waits until it is available, returning its ARN or an error
+func CreateBackupE(tableName string, backupName string, awsSession *session.Session) (string, error) {
+  return CreateBackupWithContext(context.Background(), tableName, backupName, awsSession)
+}
+
+// CreateBackupWithContext - CreateBackupE where the context can cancel the wait or give it another deadline
+func CreateBackupWithContext(ctx context.Context, tableName string, backupName string, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateBackup(ctx, tableName, backupName)
+}
+
+// CreateBackup - Takes an on-demand backup of a table and polls it with backoff until it is available, returning its ARN or an error.
+// Without a deadline on the context, it gives up after 10 minutes
+func (client *Client) CreateBackup(ctx context.Context, tableName string, backupName string) (string, error) {
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 10 * time.Minute)
+    defer cancel()
+  }
+  result, err := client.DynamoDB.CreateBackupWithContext(ctx, &dynamodb.CreateBackupInput{
+    BackupName: aws.String(backupName),
+    TableName: aws.String(getTableName(tableName)),
+  })
+  if err != nil {
+    return "", err
+  }
+  backupArn := aws.StringValue(result.BackupDetails.BackupArn)
+  status := aws.StringValue(result.BackupDetails.BackupStatus)
+  delay := 2 * time.Second
+  for status != dynamodb.BackupStatusAvailable {
+    if status == dynamodb.BackupStatusDeleted {
+      return "", errors.New(str.Concat("The backup ", backupName, " of the DynamoDB table ", tableName, " was deleted before it was available"))
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      return "", errors.New(str.Concat("The backup ", backupName, " of the DynamoDB table ", tableName, " is still ", status, ": ", err.Error()))
+    }
+    delay *= 2
+    if delay > 15 * time.Second {
+      delay = 15 * time.Second
+    }
+    description, err := client.DynamoDB.DescribeBackupWithContext(ctx, &dynamodb.DescribeBackupInput{
+      BackupArn: aws.String(backupArn),
+    })
+    if err != nil {
+      return "", err
+    }
+    status = aws.StringValue(description.BackupDescription.BackupDetails.BackupStatus)
+  }
+  return backupArn, nil
 }
 
 // CreateTable - Creates a new AWS DynamoDB table
 func CreateTable(input *dynamodb.CreateTableInput, awsSession *session.Session) {
-  dynamoDbClient := dynamodb.New(awsSession)
-  _, err := dynamoDbClient.CreateTable(input)
+  errors.QuitIfError(CreateTableE(input, awsSession))
+}
+
+// CreateTableE - Creates a new AWS DynamoDB table, returning any error
+func CreateTableE(input *dynamodb.CreateTableInput, awsSession *session.Session) error {
+  return CreateTableWithContext(context.Background(), input, awsSession)
+}
+
+// CreateTableWithContext - CreateTableE with a context to allow cancellation
+func CreateTableWithContext(ctx context.Context, input *dynamodb.CreateTableInput, awsSession *session.Session) error {
+  return New(awsSession).CreateTable(ctx, input)
+}
+
+// CreateTable - Creates a new AWS DynamoDB table, returning any error. Writes to the table fail until it is active
+func (client *Client) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput) error {
+  _, err := client.DynamoDB.CreateTableWithContext(ctx, input)
+  return err
+}
+
+// CreateTableAndWait - Creates a new AWS DynamoDB table and waits until it and its indexes are active
+func CreateTableAndWait(input *dynamodb.CreateTableInput, awsSession *session.Session) {
+  errors.QuitIfError(CreateTableAndWaitE(input, awsSession))
+}
+
+// CreateTableAndWaitE - Creates a new AWS DynamoDB table and waits until it and its indexes are active, returning any error
+func CreateTableAndWaitE(input *dynamodb.CreateTableInput, awsSession *session.Session) error {
+  return CreateTableAndWaitWithContext(context.Background(), input, awsSession)
+}
+
+// CreateTableAndWaitWithContext - CreateTableAndWaitE where the context can cancel the wait or give it another deadline
+func CreateTableAndWaitWithContext(ctx context.Context, input *dynamodb.CreateTableInput, awsSession *session.Session) error {
+  return New(awsSession).CreateTableAndWait(ctx, input)
+}
+
+// CreateTableAndWait - Creates a new AWS DynamoDB table and waits until it and its indexes are active, returning any error
+func (client *Client) CreateTableAndWait(ctx context.Context, input *dynamodb.CreateTableInput) error {
+  err := client.CreateTable(ctx, input)
+  if err != nil {
+    return err
+  }
+  return client.WaitForTable(ctx, aws.StringValue(input.TableName))
+}
+
+func EnableStream(tableName string, viewType string, awsSession *session.Session) string {
+  streamArn, err := EnableStreamE(tableName, viewType, awsSession)
+  errors.QuitIfError(err)
+  return streamArn
+}
+
+// EnableStreamE - Turns on the stream of a table with the view type (such as NEW_AND_OLD_IMAGES) and returns its ARN, or an error
+func EnableStreamE(tableName string, viewType string, awsSession *session.Session) (string, error) {
+  return EnableStreamWithContext(context.Background(), tableName, viewType, awsSession)
+}
+
+// EnableStreamWithContext - EnableStreamE where the context can cancel the wait or give it another deadline
+func EnableStreamWithContext(ctx context.Context, tableName string, viewType string, awsSession *session.Session) (string, error) {
+  return New(awsSession).EnableStream(ctx, tableName, viewType)
+}
+
+// EnableStream - Turns on the stream of a table with the view type (such as NEW_AND_OLD_IMAGES), waits until the table is active again
+// and returns the stream ARN, or an error. Nothing changes if the stream is already on with the same view type
+func (client *Client) EnableStream(ctx context.Context, tableName string, viewType string) (string, error) {
+  tableName = getTableName(tableName)
+  result, err := client.DynamoDB.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+    TableName: aws.String(tableName),
+  })
+  if err != nil {
+    return "", err
+  }
+  if stream := result.Table.StreamSpecification; stream != nil && aws.BoolValue(stream.StreamEnabled) {
+    if aws.StringValue(stream.StreamViewType) != viewType {
+      return "", errors.New(str.Concat("The stream of the DynamoDB table ", tableName, " is already on with the view type ", aws.StringValue(stream.StreamViewType)))
+    }
+    return aws.StringValue(result.Table.LatestStreamArn), nil
+  }
+  updated, err := client.DynamoDB.UpdateTableWithContext(ctx, &dynamodb.UpdateTableInput{
+    StreamSpecification: &dynamodb.StreamSpecification{
+      StreamEnabled: aws.Bool(true),
+      StreamViewType: aws.String(viewType),
+    },
+    TableName: aws.String(tableName),
+  })
+  if err != nil {
+    return "", err
+  }
+  return aws.StringValue(updated.TableDescription.LatestStreamArn), client.WaitForTable(ctx, tableName)
+}
+
+func EnableTimeToLive(tableName string, attributeName string, awsSession *session.Session) {
+  errors.QuitIfError(EnableTimeToLiveE(tableName, attributeName, awsSession))
+}
+
+// EnableTimeToLiveE - Expires the items of a table once the time in their attribute (in epoch seconds) has passed, returning any error
+func EnableTimeToLiveE(tableName string, attributeName string, awsSession *session.Session) error {
+  return EnableTimeToLiveWithContext(context.Background(), tableName, attributeName, awsSession)
+}
+
+// EnableTimeToLiveWithContext - EnableTimeToLiveE with a context to allow cancellation
+func EnableTimeToLiveWithContext(ctx context.Context, tableName string, attributeName string, awsSession *session.Session) error {
+  return New(awsSession).EnableTimeToLive(ctx, tableName, attributeName)
+}
+
+// EnableTimeToLive - Expires the items of a table once the time in their attribute (in epoch seconds) has passed, returning any error.
+// Nothing changes if it is already on for the same attribute
+func (client *Client) EnableTimeToLive(ctx context.Context, tableName string, attributeName string) error {
+  tableName = getTableName(tableName)
+  result, err := client.DynamoDB.DescribeTimeToLiveWithContext(ctx, &dynamodb.DescribeTimeToLiveInput{
+    TableName: aws.String(tableName),
+  })
+  if err != nil {
+    return err
+  }
+  status := aws.StringValue(result.TimeToLiveDescription.TimeToLiveStatus)
+  currentAttribute := aws.StringValue(result.TimeToLiveDescription.AttributeName)
+  if status == dynamodb.TimeToLiveStatusEnabled || status == dynamodb.TimeToLiveStatusEnabling {
+    if currentAttribute != attributeName {
+      return errors.New(str.Concat("The time to live of the DynamoDB table ", tableName, " is already on for the attribute ", currentAttribute))
+    }
+    return nil
+  }
+  _, err = client.DynamoDB.UpdateTimeToLiveWithContext(ctx, &dynamodb.UpdateTimeToLiveInput{
+    TableName: aws.String(tableName),
+    TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+      AttributeName: aws.String(attributeName),
+      Enabled: aws.Bool(true),
+    },
+  })
+  return err
+}
 
+func ExportTable(tableName string, filePath string, segments int, awsSession *session.Session) int {
+  count, err := ExportTableE(tableName, filePath, segments, awsSession)
   errors.QuitIfError(err)
+  return count
+}
+
+// ExportTableE - Writes every item of a table to a JSON lines file and returns how many were written, or an error
+func ExportTableE(tableName string, filePath string, segments int, awsSession *session.Session) (int, error) {
+  return ExportTableWithContext(context.Background(), tableName, filePath, segments, awsSession)
+}
+
+// ExportTableWithContext - ExportTableE with a context to allow cancellation
+func ExportTableWithContext(ctx context.Context, tableName string, filePath string, segments int, awsSession *session.Session) (int, error) {
+  return New(awsSession).ExportTable(ctx, tableName, filePath, segments)
+}
+
+// ExportTable - Writes every item of a table to a JSON lines file, scanning the segments in parallel, and returns how many were written, or an error.
+// Lines are in no particular order. Numbers keep their precision, binary values are written as base64 strings and sets as lists,
+// so the file can be given back to SeedTable. The file is only written once the whole table is read, so a failed export leaves it as it was
+func (client *Client) ExportTable(ctx context.Context, tableName string, filePath string, segments int) (int, error) {
+  count := 0
+  err := files.WriteAtomically(filePath, func(writer io.Writer) error {
+    return client.ScanEach(ctx, tableName, ScanOptions{Segments: segments}, func(item Item) error {
+      line, err := json.Marshal(attributeToJson(&dynamodb.AttributeValue{M: item}))
+      if err != nil {
+        return err
+      }
+      count++
+      _, err = writer.Write(append(line, '\n'))
+      return err
+    })
+  })
+  if err != nil {
+    return 0, err
+  }
+  return count, nil
+}
+
+func GetItem(tableName string, key interface{}, out interface{}, awsSession *session.Session) bool {
+  found, err := GetItemE(tableName, key, out, awsSession)
+  errors.QuitIfError(err)
+  return found
+}
+
+// GetItemE - Reads the item with the key (a struct or map) into out and reports whether it was found, or returns an error
+func GetItemE(tableName string, key interface{}, out interface{}, awsSession *session.Session) (bool, error) {
+  return GetItemWithContext(context.Background(), tableName, key, out, awsSession)
+}
+
+// GetItemWithContext - GetItemE with a context to allow cancellation
+func GetItemWithContext(ctx context.Context, tableName string, key interface{}, out interface{}, awsSession *session.Session) (bool, error) {
+  return New(awsSession).GetItem(ctx, tableName, key, out)
+}
+
+// GetItem - Reads the item with the key (a struct or map) into out using a strongly consistent read and reports whether it was found, or returns an error
+func (client *Client) GetItem(ctx context.Context, tableName string, key interface{}, out interface{}) (bool, error) {
+  marshalledKey, err := dynamodbattribute.MarshalMap(key)
+  if err != nil {
+    return false, err
+  }
+  result, err := client.DynamoDB.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+    ConsistentRead: aws.Bool(true),
+    Key: marshalledKey,
+    TableName: aws.String(tableName),
+  })
+  if err != nil || result.Item == nil {
+    return false, err
+  }
+  return true, dynamodbattribute.UnmarshalMap(result.Item, out)
+}
+
+func ListBackups(tableName string, awsSession *session.Session) []Backup {
+  backups, err := ListBackupsE(tableName, awsSession)
+  errors.QuitIfError(err)
+  return backups
+}
+
+// ListBackupsE - Returns the on-demand backups of a table, oldest first, or an error
+func ListBackupsE(tableName string, awsSession *session.Session) ([]Backup, error) {
+  return ListBackupsWithContext(context.Background(), tableName, awsSession)
+}
+
+// ListBackupsWithContext - ListBackupsE with a context to allow cancellation
+func ListBackupsWithContext(ctx context.Context, tableName string, awsSession *session.Session) ([]Backup, error) {
+  return New(awsSession).ListBackups(ctx, tableName)
+}
+
+// ListBackups - Returns the on-demand backups of a table across all pages, oldest first, or an error
+func (client *Client) ListBackups(ctx context.Context, tableName string) ([]Backup, error) {
+  var backups []Backup
+  input := &dynamodb.ListBackupsInput{
+    BackupType: aws.String(dynamodb.BackupTypeFilterUser),
+    TableName: aws.String(getTableName(tableName)),
+  }
+  for {
+    result, err := client.DynamoDB.ListBackupsWithContext(ctx, input)
+    if err != nil {
+      return nil, err
+    }
+    for _, summary := range result.BackupSummaries {
+      backups = append(backups, Backup{
+        Arn: aws.StringValue(summary.BackupArn),
+        Name: aws.StringValue(summary.BackupName),
+        CreatedAt: aws.TimeValue(summary.BackupCreationDateTime),
+        Status: aws.StringValue(summary.BackupStatus),
+        SizeBytes: aws.Int64Value(summary.BackupSizeBytes),
+      })
+    }
+    if result.LastEvaluatedBackupArn == nil {
+      break
+    }
+    input.ExclusiveStartBackupArn = result.LastEvaluatedBackupArn
+  }
+  sort.SliceStable(backups, func(i, j int) bool {
+    return backups[i].CreatedAt.Before(backups[j].CreatedAt)
+  })
+  return backups, nil
+}
+
+func PutItem(tableName string, item interface{}, condition Expression, awsSession *session.Session) {
+  errors.QuitIfError(PutItemE(tableName, item, condition, awsSession))
+}
+
+// PutItemE - Writes the item (a struct or map), replacing any with the same key, if the condition holds, returning any error
+func PutItemE(tableName string, item interface{}, condition Expression, awsSession *session.Session) error {
+  return PutItemWithContext(context.Background(), tableName, item, condition, awsSession)
+}
+
+// PutItemWithContext - PutItemE with a context to allow cancellation
+func PutItemWithContext(ctx context.Context, tableName string, item interface{}, condition Expression, awsSession *session.Session) error {
+  return New(awsSession).PutItem(ctx, tableName, item, condition)
+}
+
+// PutItem - Writes the item (a struct or map), replacing any with the same key, if the condition holds, returning any error.
+// An empty condition always holds. For optimistic locking, require the version read earlier, such as #v = :v, and write the next one.
+// Check a failed condition with IsConditionFailed
+func (client *Client) PutItem(ctx context.Context, tableName string, item interface{}, condition Expression) error {
+  marshalledItem, err := dynamodbattribute.MarshalMap(item)
+  if err != nil {
+    return err
+  }
+  names, values, err := expressionAttributes(condition)
+  if err != nil {
+    return err
+  }
+  _, err = client.DynamoDB.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+    ConditionExpression: optionalString(condition.Text),
+    ExpressionAttributeNames: names,
+    ExpressionAttributeValues: values,
+    Item: marshalledItem,
+    TableName: aws.String(tableName),
+  })
+  return err
+}
+
+func Query(tableName string, keyCondition Expression, options QueryOptions, out interface{}, awsSession *session.Session) {
+  errors.QuitIfError(QueryE(tableName, keyCondition, options, out, awsSession))
+}
+
+// QueryE - Reads every item matching the key condition into out (a pointer to a slice), in sort key order, returning any error
+func QueryE(tableName string, keyCondition Expression, options QueryOptions, out interface{}, awsSession *session.Session) error {
+  return QueryWithContext(context.Background(), tableName, keyCondition, options, out, awsSession)
+}
+
+// QueryWithContext - QueryE with a context to allow cancellation
+func QueryWithContext(ctx context.Context, tableName string, keyCondition Expression, options QueryOptions, out interface{}, awsSession *session.Session) error {
+  return New(awsSession).Query(ctx, tableName, keyCondition, options, out)
+}
+
+// Query - Reads every item matching the key condition, such as #pk = :pk AND begins_with(#sk, :prefix), into out (a pointer to a slice),
+// in sort key order and across all pages, returning any error
+func (client *Client) Query(ctx context.Context, tableName string, keyCondition Expression, options QueryOptions, out interface{}) error {
+  var items []map[string]*dynamodb.AttributeValue
+  err := client.QueryEach(ctx, tableName, keyCondition, options, func(item Item) error {
+    items = append(items, item)
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+  return dynamodbattribute.UnmarshalListOfMaps(items, out)
+}
+
+func QueryEach(tableName string, keyCondition Expression, options QueryOptions, handle func(Item) error, awsSession *session.Session) {
+  errors.QuitIfError(QueryEachE(tableName, keyCondition, options, handle, awsSession))
+}
+
+// QueryEachE - Passes every item matching the key condition to handle, in sort key order, returning any error
+func QueryEachE(tableName string, keyCondition Expression, options QueryOptions, handle func(Item) error, awsSession *session.Session) error {
+  return QueryEachWithContext(context.Background(), tableName, keyCondition, options, handle, awsSession)
+}
+
+// QueryEachWithContext - QueryEachE with a context to allow cancellation
+func QueryEachWithContext(ctx context.Context, tableName string, keyCondition Expression, options QueryOptions, handle func(Item) error, awsSession *session.Session) error {
+  return New(awsSession).QueryEach(ctx, tableName, keyCondition, options, handle)
+}
+
+// QueryEach - Passes every item matching the key condition to handle as pages are read, in sort key order, returning any error.
+// Reading stops at the first error returned by handle, which is returned
+func (client *Client) QueryEach(ctx context.Context, tableName string, keyCondition Expression, options QueryOptions, handle func(Item) error) error {
+  names, values, err := expressionAttributes(keyCondition, options.Filter)
+  if err != nil {
+    return err
+  }
+  input := &dynamodb.QueryInput{
+    ConsistentRead: aws.Bool(options.ConsistentRead),
+    ExpressionAttributeNames: names,
+    ExpressionAttributeValues: values,
+    FilterExpression: optionalString(options.Filter.Text),
+    IndexName: optionalString(options.IndexName),
+    KeyConditionExpression: aws.String(keyCondition.Text),
+    ScanIndexForward: aws.Bool(!options.Descending),
+    TableName: aws.String(tableName),
+  }
+  var handleErr error
+  var count int64
+  err = client.DynamoDB.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+    count, handleErr = handleItems(page.Items, count, options.Limit, handle)
+    return handleErr == nil && (options.Limit == 0 || count < options.Limit)
+  })
+  if handleErr != nil {
+    return handleErr
+  }
+  return err
+}
+
+func RestoreTable(backupArn string, tableName string, wait bool, awsSession *session.Session) {
+  errors.QuitIfError(RestoreTableE(backupArn, tableName, wait, awsSession))
+}
+
+// RestoreTableE - Creates a table from an on-demand backup, optionally waiting until it is active, returning any error
+func RestoreTableE(backupArn string, tableName string, wait bool, awsSession *session.Session) error {
+  return RestoreTableWithContext(context.Background(), backupArn, tableName, wait, awsSession)
+}
+
+// RestoreTableWithContext - RestoreTableE where the context can cancel the wait or give it another deadline
+func RestoreTableWithContext(ctx context.Context, backupArn string, tableName string, wait bool, awsSession *session.Session) error {
+  return New(awsSession).RestoreTable(ctx, backupArn, tableName, wait)
+}
+
+// RestoreTable - Creates a table from an on-demand backup, optionally waiting until it is active, returning any error.
+// The table name must not be in use. Restores of large tables can take hours, so give the context a longer deadline when waiting
+func (client *Client) RestoreTable(ctx context.Context, backupArn string, tableName string, wait bool) error {
+  _, err := client.DynamoDB.RestoreTableFromBackupWithContext(ctx, &dynamodb.RestoreTableFromBackupInput{
+    BackupArn: aws.String(backupArn),
+    TargetTableName: aws.String(tableName),
+  })
+  if err != nil || !wait {
+    return err
+  }
+  return client.WaitForTable(ctx, tableName)
+}
+
+func Scan(tableName string, options ScanOptions, out interface{}, awsSession *session.Session) {
+  errors.QuitIfError(ScanE(tableName, options, out, awsSession))
+}
+
+// ScanE - Reads every item of the table (matching the filter, if any) into out (a pointer to a slice), returning any error
+func ScanE(tableName string, options ScanOptions, out interface{}, awsSession *session.Session) error {
+  return ScanWithContext(context.Background(), tableName, options, out, awsSession)
+}
+
+// ScanWithContext - ScanE with a context to allow cancellation
+func ScanWithContext(ctx context.Context, tableName string, options ScanOptions, out interface{}, awsSession *session.Session) error {
+  return New(awsSession).Scan(ctx, tableName, options, out)
+}
+
+// Scan - Reads every item of the table (matching the filter, if any) into out (a pointer to a slice) across all pages, returning any error
+func (client *Client) Scan(ctx context.Context, tableName string, options ScanOptions, out interface{}) error {
+  var items []map[string]*dynamodb.AttributeValue
+  err := client.ScanEach(ctx, tableName, options, func(item Item) error {
+    items = append(items, item)
+    return nil
+  })
+  if err != nil {
+    return err
+  }
+  return dynamodbattribute.UnmarshalListOfMaps(items, out)
+}
+
+func ScanEach(tableName string, options ScanOptions, handle func(Item) error, awsSession *session.Session) {
+  errors.QuitIfError(ScanEachE(tableName, options, handle, awsSession))
+}
+
+// ScanEachE - Passes every item of the table (matching the filter, if any) to handle, returning any error
+func ScanEachE(tableName string, options ScanOptions, handle func(Item) error, awsSession *session.Session) error {
+  return ScanEachWithContext(context.Background(), tableName, options, handle, awsSession)
+}
+
+// ScanEachWithContext - ScanEachE with a context to allow cancellation
+func ScanEachWithContext(ctx context.Context, tableName string, options ScanOptions, handle func(Item) error, awsSession *session.Session) error {
+  return New(awsSession).ScanEach(ctx, tableName, options, handle)
+}
+
+// ScanEach - Passes every item of the table (matching the filter, if any) to handle as pages are read, returning any error.
+// With several segments, they are scanned in parallel but handle is never called concurrently. Reading stops at the first error,
+// which is returned
+func (client *Client) ScanEach(ctx context.Context, tableName string, options ScanOptions, handle func(Item) error) error {
+  names, values, err := expressionAttributes(options.Filter)
+  if err != nil {
+    return err
+  }
+  segments := options.Segments
+  if segments < 1 {
+    segments = 1
+  }
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel()
+  var mutex sync.Mutex
+  var waitGroup sync.WaitGroup
+  var firstErr error
+  var count int64
+  for segment := 0; segment < segments; segment++ {
+    input := &dynamodb.ScanInput{
+      ConsistentRead: aws.Bool(options.ConsistentRead),
+      ExpressionAttributeNames: names,
+      ExpressionAttributeValues: values,
+      FilterExpression: optionalString(options.Filter.Text),
+      IndexName: optionalString(options.IndexName),
+      TableName: aws.String(tableName),
+    }
+    if segments > 1 {
+      input.Segment = aws.Int64(int64(segment))
+      input.TotalSegments = aws.Int64(int64(segments))
+    }
+    waitGroup.Add(1)
+    go func() {
+      defer waitGroup.Done()
+      var handleErr error
+      err := client.DynamoDB.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+        mutex.Lock()
+        defer mutex.Unlock()
+        if firstErr != nil || (options.Limit > 0 && count >= options.Limit) {
+          return false
+        }
+        count, handleErr = handleItems(page.Items, count, options.Limit, handle)
+        return handleErr == nil && (options.Limit == 0 || count < options.Limit)
+      })
+      if handleErr != nil {
+        err = handleErr
+      }
+      mutex.Lock()
+      defer mutex.Unlock()
+      if err != nil && firstErr == nil {
+        firstErr = err
+        cancel()
+      }
+    }()
+  }
+  waitGroup.Wait()
+  return firstErr
+}
+
+func SeedTable(tableName string, filePath string, options SeedOptions, awsSession *session.Session) int {
+  count, err := SeedTableE(tableName, filePath, options, awsSession)
+  errors.QuitIfError(err)
+  return count
+}
+
+// SeedTableE - Writes the items of a JSON lines or CSV file (by its extension) to a table and returns how many were written, or an error
+func SeedTableE(tableName string, filePath string, options SeedOptions, awsSession *session.Session) (int, error) {
+  return SeedTableWithContext(context.Background(), tableName, filePath, options, awsSession)
+}
+
+// SeedTableWithContext - SeedTableE with a context to allow cancellation
+func SeedTableWithContext(ctx context.Context, tableName string, filePath string, options SeedOptions, awsSession *session.Session) (int, error) {
+  return New(awsSession).SeedTable(ctx, tableName, filePath, options)
+}
+
+// SeedTable - Writes the items of a file to a table, replacing any with the same keys, and returns how many were written, or an error.
+// A .csv file has a header row of attribute names, its cells are typed by options.Types or else inferred, and empty cells are left out.
+// Any other file has one JSON object per line. Items are written in batches of 25, several batches at a time
+func (client *Client) SeedTable(ctx context.Context, tableName string, filePath string, options SeedOptions) (int, error) {
+  file, err := os.Open(filePath)
+  if err != nil {
+    return 0, err
+  }
+  defer file.Close()
+  workers := options.Workers
+  if workers < 1 {
+    workers = 4
+  }
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel()
+  batches := make(chan []*dynamodb.WriteRequest)
+  writeErrs := make(chan error, workers)
+  for worker := 0; worker < workers; worker++ {
+    go func() {
+      var writeErr error
+      for batch := range batches {
+        if writeErr == nil {
+          writeErr = client.batchWrite(ctx, tableName, batch)
+          if writeErr != nil {
+            cancel()
+          }
+        }
+      }
+      writeErrs <- writeErr
+    }()
+  }
+  var batch []*dynamodb.WriteRequest
+  count := 0
+  readErr := readItems(file, filepath.Ext(filePath), options.Types, func(item map[string]*dynamodb.AttributeValue) error {
+    batch = append(batch, &dynamodb.WriteRequest{
+      PutRequest: &dynamodb.PutRequest{
+        Item: item,
+      },
+    })
+    count++
+    if len(batch) < 25 {
+      return nil
+    }
+    select {
+    case batches <- batch:
+      batch = nil
+      return nil
+    case <-ctx.Done():
+      return ctx.Err()
+    }
+  })
+  if readErr == nil && len(batch) > 0 {
+    select {
+    case batches <- batch:
+    case <-ctx.Done():
+    }
+  }
+  close(batches)
+  for worker := 0; worker < workers; worker++ {
+    if writeErr := <-writeErrs; writeErr != nil {
+      return 0, writeErr
+    }
+  }
+  if readErr != nil {
+    return 0, errors.New(str.Concat("Could not seed the DynamoDB table ", tableName, " from ", filePath, ": ", readErr.Error()))
+  }
+  return count, ctx.Err()
+}
+
+func SetPointInTimeRecovery(tableName string, enabled bool, awsSession *session.Session) {
+  errors.QuitIfError(SetPointInTimeRecoveryE(tableName, enabled, awsSession))
+}
+
+// SetPointInTimeRecoveryE - Turns continuous backups of a table on or off, returning any error
+func SetPointInTimeRecoveryE(tableName string, enabled bool, awsSession *session.Session) error {
+  return SetPointInTimeRecoveryWithContext(context.Background(), tableName, enabled, awsSession)
+}
+
+// SetPointInTimeRecoveryWithContext - SetPointInTimeRecoveryE with a context to allow cancellation
+func SetPointInTimeRecoveryWithContext(ctx context.Context, tableName string, enabled bool, awsSession *session.Session) error {
+  return New(awsSession).SetPointInTimeRecovery(ctx, tableName, enabled)
+}
+
+// SetPointInTimeRecovery - Turns continuous backups of a table on or off, returning any error. While on, the table can be restored to any second of the last 35 days
+func (client *Client) SetPointInTimeRecovery(ctx context.Context, tableName string, enabled bool) error {
+  _, err := client.DynamoDB.UpdateContinuousBackupsWithContext(ctx, &dynamodb.UpdateContinuousBackupsInput{
+    PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+      PointInTimeRecoveryEnabled: aws.Bool(enabled),
+    },
+    TableName: aws.String(getTableName(tableName)),
+  })
+  return err
+}
+
+func UpdateItem(tableName string, key interface{}, update Expression, condition Expression, out interface{}, awsSession *session.Session) {
+  errors.QuitIfError(UpdateItemE(tableName, key, update, condition, out, awsSession))
+}
+
+// UpdateItemE - Applies the update expression to the item with the key (a struct or map) if the condition holds, reading the updated item into out (when not nil), returning any error
+func UpdateItemE(tableName string, key interface{}, update Expression, condition Expression, out interface{}, awsSession *session.Session) error {
+  return UpdateItemWithContext(context.Background(), tableName, key, update, condition, out, awsSession)
+}
+
+// UpdateItemWithContext - UpdateItemE with a context to allow cancellation
+func UpdateItemWithContext(ctx context.Context, tableName string, key interface{}, update Expression, condition Expression, out interface{}, awsSession *session.Session) error {
+  return New(awsSession).UpdateItem(ctx, tableName, key, update, condition, out)
+}
+
+// UpdateItem - Applies the update expression, such as SET #count = #count + :one, to the item with the key (a struct or map) if the condition holds,
+// reading the updated item into out (when not nil), returning any error. The update and the condition share their placeholders.
+// An empty condition always holds. Check a failed condition with IsConditionFailed
+func (client *Client) UpdateItem(ctx context.Context, tableName string, key interface{}, update Expression, condition Expression, out interface{}) error {
+  marshalledKey, err := dynamodbattribute.MarshalMap(key)
+  if err != nil {
+    return err
+  }
+  names, values, err := expressionAttributes(update, condition)
+  if err != nil {
+    return err
+  }
+  input := &dynamodb.UpdateItemInput{
+    ConditionExpression: optionalString(condition.Text),
+    ExpressionAttributeNames: names,
+    ExpressionAttributeValues: values,
+    Key: marshalledKey,
+    TableName: aws.String(tableName),
+    UpdateExpression: aws.String(update.Text),
+  }
+  if out != nil {
+    input.ReturnValues = aws.String(dynamodb.ReturnValueAllNew)
+  }
+  result, err := client.DynamoDB.UpdateItemWithContext(ctx, input)
+  if err != nil || out == nil {
+    return err
+  }
+  return dynamodbattribute.UnmarshalMap(result.Attributes, out)
+}
+
+func WaitForTable(tableName string, awsSession *session.Session) {
+  errors.QuitIfError(WaitForTableE(tableName, awsSession))
+}
+
+// WaitForTableE - Waits up to 5 minutes until a table and its global secondary indexes are active, returning any error
+func WaitForTableE(tableName string, awsSession *session.Session) error {
+  return WaitForTableWithContext(context.Background(), tableName, awsSession)
+}
+
+// WaitForTableWithContext - WaitForTableE where the context can cancel the wait or give it another deadline
+func WaitForTableWithContext(ctx context.Context, tableName string, awsSession *session.Session) error {
+  return New(awsSession).WaitForTable(ctx, tableName)
+}
+
+// WaitForTable - Polls a table with backoff until it and its global secondary indexes are active, returning any error.
+// Without a deadline on the context, it gives up after 5 minutes
+func (client *Client) WaitForTable(ctx context.Context, tableName string) error {
+  tableName = getTableName(tableName)
+  return client.pollTable(ctx, tableName, func(table *dynamodb.TableDescription) (bool, string) {
+    if table == nil {
+      return false, "missing"
+    }
+    status := aws.StringValue(table.TableStatus)
+    if status != dynamodb.TableStatusActive {
+      return false, status
+    }
+    for _, index := range table.GlobalSecondaryIndexes {
+      indexStatus := aws.StringValue(index.IndexStatus)
+      if indexStatus != dynamodb.IndexStatusActive {
+        return false, str.Concat(status, " with the index ", aws.StringValue(index.IndexName), " ", indexStatus)
+      }
+    }
+    return true, status
+  })
+}
+
+func WaitForTableDeleted(tableName string, awsSession *session.Session) {
+  errors.QuitIfError(WaitForTableDeletedE(tableName, awsSession))
+}
+
+// WaitForTableDeletedE - Waits up to 5 minutes until a table no longer exists, returning any error
+func WaitForTableDeletedE(tableName string, awsSession *session.Session) error {
+  return WaitForTableDeletedWithContext(context.Background(), tableName, awsSession)
+}
+
+// WaitForTableDeletedWithContext - WaitForTableDeletedE where the context can cancel the wait or give it another deadline
+func WaitForTableDeletedWithContext(ctx context.Context, tableName string, awsSession *session.Session) error {
+  return New(awsSession).WaitForTableDeleted(ctx, tableName)
+}
+
+// WaitForTableDeleted - Polls a table with backoff until it no longer exists, returning any error.
+// Without a deadline on the context, it gives up after 5 minutes
+func (client *Client) WaitForTableDeleted(ctx context.Context, tableName string) error {
+  tableName = getTableName(tableName)
+  return client.pollTable(ctx, tableName, func(table *dynamodb.TableDescription) (bool, string) {
+    if table == nil {
+      return true, ""
+    }
+    return false, aws.StringValue(table.TableStatus)
+  })
+}
+
+// IsConditionFailed - Reports whether an error is DynamoDB refusing a write because its condition did not hold, such as a stale version
+func IsConditionFailed(err error) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// batchWrite - Sends the requests 25 at a time, retrying unprocessed ones with backoff
+func (client *Client) batchWrite(ctx context.Context, tableName string, requests []*dynamodb.WriteRequest) error {
+  for start := 0; start < len(requests); start += 25 {
+    end := start + 25
+    if end > len(requests) {
+      end = len(requests)
+    }
+    requestItems := map[string][]*dynamodb.WriteRequest{
+      tableName: requests[start:end],
+    }
+    err := retryBatch(ctx, tableName, func() (int, error) {
+      result, err := client.DynamoDB.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+        RequestItems: requestItems,
+      })
+      if err != nil {
+        return 0, err
+      }
+      requestItems = result.UnprocessedItems
+      return len(requestItems[tableName]), nil
+    })
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// pollTable - Describes a table with backoff until done reports true, passing it nil once the table does not exist.
+// Without a deadline on the context, it gives up after 5 minutes with the last status given by done
+func (client *Client) pollTable(ctx context.Context, tableName string, done func(*dynamodb.TableDescription) (bool, string)) error {
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 5 * time.Minute)
+    defer cancel()
+  }
+  delay := time.Second
+  for {
+    var table *dynamodb.TableDescription
+    result, err := client.DynamoDB.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+      TableName: aws.String(tableName),
+    })
+    if err == nil {
+      table = result.Table
+    } else if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != dynamodb.ErrCodeResourceNotFoundException {
+      return err
+    }
+    finished, status := done(table)
+    if finished {
+      return nil
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      return errors.New(str.Concat("The DynamoDB table ", tableName, " is still ", status, ": ", err.Error()))
+    }
+    delay *= 2
+    if delay > 10 * time.Second {
+      delay = 10 * time.Second
+    }
+  }
+}
+
+// readItems - Passes every item of a JSON lines or CSV file to handle, with the line number in any error
+func readItems(reader io.Reader, extension string, types map[string]string, handle func(map[string]*dynamodb.AttributeValue) error) error {
+  if strings.ToLower(extension) == ".csv" {
+    return readCsvItems(reader, types, handle)
+  }
+  scanner := bufio.NewScanner(reader)
+  scanner.Buffer(make([]byte, 64 * 1024), 1024 * 1024)
+  for line := 1; scanner.Scan(); line++ {
+    if strings.TrimSpace(scanner.Text()) == "" {
+      continue
+    }
+    decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+    decoder.UseNumber()
+    var value interface{}
+    err := decoder.Decode(&value)
+    if err != nil {
+      return errors.New(str.Concat("line ", strconv.Itoa(line), ": ", err.Error()))
+    }
+    item := jsonToAttribute(value)
+    if item.M == nil {
+      return errors.New(str.Concat("line ", strconv.Itoa(line), ": expected a JSON object"))
+    }
+    err = handle(item.M)
+    if err != nil {
+      return err
+    }
+  }
+  return scanner.Err()
+}
+
+func readCsvItems(reader io.Reader, types map[string]string, handle func(map[string]*dynamodb.AttributeValue) error) error {
+  csvReader := csv.NewReader(reader)
+  header, err := csvReader.Read()
+  if err != nil {
+    return err
+  }
+  for line := 2; ; line++ {
+    record, err := csvReader.Read()
+    if err == io.EOF {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    item := map[string]*dynamodb.AttributeValue{}
+    for i, cell := range record {
+      if cell == "" {
+        continue
+      }
+      value, err := csvToAttribute(cell, types[header[i]])
+      if err != nil {
+        return errors.New(str.Concat("line ", strconv.Itoa(line), ", column ", header[i], ": ", err.Error()))
+      }
+      item[header[i]] = value
+    }
+    err = handle(item)
+    if err != nil {
+      return err
+    }
+  }
+}
+
+// csvToAttribute - Converts a CSV cell to the type given (S, N, BOOL, or M and L for JSON), or else infers a number, a boolean or a string.
+// Numbers with leading zeros, such as zip codes, are kept as strings
+func csvToAttribute(cell string, attributeType string) (*dynamodb.AttributeValue, error) {
+  switch attributeType {
+  case "":
+    if numberPattern.MatchString(cell) {
+      return &dynamodb.AttributeValue{N: aws.String(cell)}, nil
+    }
+    if cell == "true" || cell == "false" {
+      return &dynamodb.AttributeValue{BOOL: aws.Bool(cell == "true")}, nil
+    }
+    return &dynamodb.AttributeValue{S: aws.String(cell)}, nil
+  case dynamodb.ScalarAttributeTypeS:
+    return &dynamodb.AttributeValue{S: aws.String(cell)}, nil
+  case dynamodb.ScalarAttributeTypeN:
+    if _, err := strconv.ParseFloat(cell, 64); err != nil {
+      return nil, errors.New(str.Concat(cell, " is not a number"))
+    }
+    return &dynamodb.AttributeValue{N: aws.String(cell)}, nil
+  case "BOOL":
+    value, err := strconv.ParseBool(cell)
+    if err != nil {
+      return nil, errors.New(str.Concat(cell, " is not a boolean"))
+    }
+    return &dynamodb.AttributeValue{BOOL: aws.Bool(value)}, nil
+  case "M", "L":
+    decoder := json.NewDecoder(strings.NewReader(cell))
+    decoder.UseNumber()
+    var value interface{}
+    err := decoder.Decode(&value)
+    if err != nil {
+      return nil, err
+    }
+    return jsonToAttribute(value), nil
+  }
+  return nil, errors.New(str.Concat("Unknown attribute type ", attributeType))
+}
+
+// jsonToAttribute - Converts a value decoded from JSON with UseNumber, keeping the precision of numbers
+func jsonToAttribute(value interface{}) *dynamodb.AttributeValue {
+  switch typed := value.(type) {
+  case nil:
+    return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+  case bool:
+    return &dynamodb.AttributeValue{BOOL: aws.Bool(typed)}
+  case json.Number:
+    return &dynamodb.AttributeValue{N: aws.String(typed.String())}
+  case string:
+    return &dynamodb.AttributeValue{S: aws.String(typed)}
+  case []interface{}:
+    list := []*dynamodb.AttributeValue{}
+    for _, element := range typed {
+      list = append(list, jsonToAttribute(element))
+    }
+    return &dynamodb.AttributeValue{L: list}
+  case map[string]interface{}:
+    attributes := map[string]*dynamodb.AttributeValue{}
+    for name, element := range typed {
+      attributes[name] = jsonToAttribute(element)
+    }
+    return &dynamodb.AttributeValue{M: attributes}
+  }
+  return &dynamodb.AttributeValue{S: aws.String(fmt.Sprint(value))}
+}
+
+// attributeToJson - Converts an attribute value to a value for json.Marshal, keeping the precision of numbers
+func attributeToJson(value *dynamodb.AttributeValue) interface{} {
+  switch {
+  case value.S != nil:
+    return *value.S
+  case value.N != nil:
+    return json.Number(*value.N)
+  case value.BOOL != nil:
+    return *value.BOOL
+  case value.B != nil:
+    return value.B
+  case value.M != nil:
+    attributes := map[string]interface{}{}
+    for name, element := range value.M {
+      attributes[name] = attributeToJson(element)
+    }
+    return attributes
+  case value.L != nil:
+    list := []interface{}{}
+    for _, element := range value.L {
+      list = append(list, attributeToJson(element))
+    }
+    return list
+  case value.SS != nil:
+    return aws.StringValueSlice(value.SS)
+  case value.NS != nil:
+    list := []json.Number{}
+    for _, number := range value.NS {
+      list = append(list, json.Number(aws.StringValue(number)))
+    }
+    return list
+  case value.BS != nil:
+    return value.BS
+  }
+  return nil
+}
+
+// retryBatch - Calls send, which returns the number of items left unprocessed, until every item is processed,
+// backing off from 50 milliseconds up to 5 seconds between attempts
+func retryBatch(ctx context.Context, tableName string, send func() (int, error)) error {
+  delay := 50 * time.Millisecond
+  for attempt := 1; ; attempt++ {
+    unprocessed, err := send()
+    if err != nil || unprocessed == 0 {
+      return err
+    }
+    if attempt == maxBatchAttempts {
+      return errors.New(str.Concat(strconv.Itoa(unprocessed), " items of the DynamoDB table ", tableName, " were still unprocessed after ", strconv.Itoa(maxBatchAttempts), " attempts"))
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      return err
+    }
+    delay *= 2
+    if delay > 5 * time.Second {
+      delay = 5 * time.Second
+    }
+  }
+}
+
+// handleItems - Passes the items of a page to handle until the limit (if any) is reached, returning the number of items handled so far
+func handleItems(items []map[string]*dynamodb.AttributeValue, count int64, limit int64, handle func(Item) error) (int64, error) {
+  for _, item := range items {
+    if limit > 0 && count >= limit {
+      break
+    }
+    err := handle(item)
+    if err != nil {
+      return count, err
+    }
+    count++
+  }
+  return count, nil
+}
+
+// expressionAttributes - Merges the placeholders of expressions used in the same request, marshalling the values
+func expressionAttributes(expressions ...Expression) (map[string]*string, map[string]*dynamodb.AttributeValue, error) {
+  var names map[string]*string
+  var values map[string]*dynamodb.AttributeValue
+  for _, expression := range expressions {
+    for placeholder, name := range expression.Names {
+      if names == nil {
+        names = map[string]*string{}
+      }
+      names[placeholder] = aws.String(name)
+    }
+    for placeholder, value := range expression.Values {
+      marshalledValue, err := dynamodbattribute.Marshal(value)
+      if err != nil {
+        return nil, nil, err
+      }
+      if values == nil {
+        values = map[string]*dynamodb.AttributeValue{}
+      }
+      values[placeholder] = marshalledValue
+    }
+  }
+  return names, values, nil
+}
+
+// marshalList - Marshals every element of a slice of structs or maps
+func marshalList(list interface{}) ([]map[string]*dynamodb.AttributeValue, error) {
+  value := reflect.ValueOf(list)
+  if value.Kind() != reflect.Slice {
+    return nil, errors.New(str.Concat("Expected a slice of items or keys, got a ", value.Kind().String()))
+  }
+  var marshalled []map[string]*dynamodb.AttributeValue
+  for i := 0; i < value.Len(); i++ {
+    item, err := dynamodbattribute.MarshalMap(value.Index(i).Interface())
+    if err != nil {
+      return nil, err
+    }
+    marshalled = append(marshalled, item)
+  }
+  return marshalled, nil
+}
+
+func optionalString(value string) *string {
+  if value == "" {
+    return nil
+  }
+  return aws.String(value)
 }
 
 func getTableName(arnOrName string) string {
@@ -1,19 +1,26 @@
 package dynamodb
 
 import (
+  "context"
+  "io/ioutil"
   "log"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
   "testing"
   "time"
 
-  pacaws "github.com/PyramidSystemsInc/go/aws"
+  "github.com/PyramidSystemsInc/go/aws/dynamodb/dynamodbfake"
+  "github.com/PyramidSystemsInc/go/str"
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/service/dynamodb"
+  "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 func TestCreateTable(t *testing.T) {
-  session := pacaws.CreateAwsSession("us-east-2")
-
-  svc := dynamodb.New(session)
+  ctx := context.Background()
+  var svc dynamodbiface.DynamoDBAPI = dynamodbfake.New()
   name := "test-dynamodb-table"
 
   input := &dynamodb.CreateTableInput{
@@ -36,21 +43,17 @@ func TestCreateTable(t *testing.T) {
     TableName: aws.String(name),
   }
 
-  _, err := svc.CreateTable(input)
+  _, err := svc.CreateTableWithContext(ctx, input)
 
   if err != nil {
     log.Fatal("can't create table", err)
   }
 
-  // waiting 10 seconds for table to be created otherwise we'll get an error when we attempt to destroy it
-
-  time.Sleep(10 * time.Second)
-
   describe := &dynamodb.DescribeTableInput{
     TableName: aws.String(name),
   }
 
-  _, err = svc.DescribeTable(describe)
+  _, err = svc.DescribeTableWithContext(ctx, describe)
   if err != nil {
     log.Fatal(err)
   }
@@ -59,8 +62,763 @@ func TestCreateTable(t *testing.T) {
     TableName: aws.String(name),
   }
 
-  _, err = svc.DeleteTable(delete)
+  _, err = svc.DeleteTableWithContext(ctx, delete)
   if err != nil {
     log.Fatal(err)
   }
 }
+
+func newFakeClient() (*Client, *dynamodbfake.DynamoDB) {
+  fake := dynamodbfake.New()
+  return &Client{DynamoDB: fake}, fake
+}
+
+// TestClientCreateTable creates a table through the client and checks it is active with the key it was given.
+func TestClientCreateTable(t *testing.T) {
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+
+  createLockTable(t, client, name)
+  table, ok := fake.Tables[name]
+  if !ok {
+    t.Fatal("table was not created")
+  }
+  if *table.TableStatus != dynamodb.TableStatusActive || *table.KeySchema[0].AttributeName != "LockID" {
+    t.Errorf("unexpected table %v", table)
+  }
+}
+
+// TestClientDeleteTableByArn deletes a table by its ARN, the way the resourcegroups package deletes tables.
+func TestClientDeleteTableByArn(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  err := client.DeleteTable(ctx, *fake.Tables[name].TableArn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := fake.Tables[name]; ok {
+    t.Error("table was not deleted")
+  }
+}
+
+type lock struct {
+  LockID   string
+  Owner    string
+  Version  int
+}
+
+// TestPutItemNotExists checks that a put conditioned on the item not existing does not replace an item.
+func TestPutItemNotExists(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  notExists := Expression{
+    Text: "attribute_not_exists(LockID)",
+  }
+
+  err := client.PutItem(ctx, name, lock{LockID: "a", Owner: "first", Version: 1}, notExists)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.PutItem(ctx, name, lock{LockID: "a", Owner: "second", Version: 1}, notExists)
+  if !IsConditionFailed(err) {
+    t.Fatalf("expected the second put to fail its condition, got %v", err)
+  }
+  var found lock
+  ok, err := client.GetItem(ctx, name, map[string]string{"LockID": "a"}, &found)
+  if err != nil || !ok || found.Owner != "first" {
+    t.Errorf("unexpected item %+v (found %v, error %v)", found, ok, err)
+  }
+}
+
+// TestPutItemVersion locks optimistically with a version condition: a put of the version read succeeds and then a
+// delete of that stale version fails.
+func TestPutItemVersion(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  err := client.PutItem(ctx, name, lock{LockID: "a", Owner: "first", Version: 1}, Expression{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  sameVersion := Expression{
+    Text: "#version = :version",
+    Names: map[string]string{"#version": "Version"},
+    Values: map[string]interface{}{":version": 1},
+  }
+
+  err = client.PutItem(ctx, name, lock{LockID: "a", Owner: "second", Version: 2}, sameVersion)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.DeleteItem(ctx, name, map[string]string{"LockID": "a"}, sameVersion)
+  if !IsConditionFailed(err) {
+    t.Fatalf("expected a stale delete to fail its condition, got %v", err)
+  }
+}
+
+// TestGetItemMissing checks that reading an item that is not there is not an error.
+func TestGetItemMissing(t *testing.T) {
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  var found lock
+  ok, err := client.GetItem(context.Background(), name, map[string]string{"LockID": "missing"}, &found)
+  if err != nil || ok {
+    t.Errorf("expected a missing item, got found %v and error %v", ok, err)
+  }
+}
+
+// TestBatchPut writes more items than fit in one batch and checks that the unprocessed ones are retried.
+func TestBatchPut(t *testing.T) {
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  locks, _ := batchOfLocks(60)
+
+  fake.UnprocessedBatches = 2
+  err := client.BatchPut(context.Background(), name, locks)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fake.Items[name]) != 60 || fake.UnprocessedBatches != 0 {
+    t.Errorf("expected 60 items after retrying unprocessed ones, got %d", len(fake.Items[name]))
+  }
+}
+
+// TestBatchGet reads more items than fit in one batch, retrying the unprocessed keys and skipping a missing one.
+func TestBatchGet(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  locks, keys := batchOfLocks(60)
+  err := client.BatchPut(ctx, name, locks)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var read []lock
+  fake.UnprocessedBatches = 1
+  err = client.BatchGet(ctx, name, append(keys, map[string]string{"LockID": "missing"}), &read)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(read) != 60 {
+    t.Errorf("expected 60 items to be read, got %d", len(read))
+  }
+}
+
+// TestBatchDelete deletes more items than fit in one batch and leaves the others.
+func TestBatchDelete(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  locks, keys := batchOfLocks(60)
+  err := client.BatchPut(ctx, name, append(locks, lock{LockID: "kept", Owner: "first", Version: 1}))
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.BatchDelete(ctx, name, keys)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fake.Items[name]) != 1 {
+    t.Errorf("expected 1 item after the batch delete, got %d", len(fake.Items[name]))
+  }
+}
+
+// TestBatchPutUnprocessed checks that a batch whose items stay unprocessed fails once the context is done.
+func TestBatchPutUnprocessed(t *testing.T) {
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  locks, _ := batchOfLocks(1)
+
+  fake.UnprocessedBatches = maxBatchAttempts
+  ctx, cancel := context.WithTimeout(context.Background(), 500 * time.Millisecond)
+  defer cancel()
+  err := client.BatchPut(ctx, name, locks)
+  if err == nil {
+    t.Error("expected an error when items stay unprocessed")
+  }
+}
+
+// batchOfLocks returns count locks and their keys.
+func batchOfLocks(count int) ([]lock, []map[string]string) {
+  var locks []lock
+  var keys []map[string]string
+  for i := 0; i < count; i++ {
+    id := strconv.Itoa(i)
+    locks = append(locks, lock{LockID: id, Owner: "batch", Version: 1})
+    keys = append(keys, map[string]string{"LockID": id})
+  }
+  return locks, keys
+}
+
+// TestUpdateItem takes over a lock by bumping its version only while the version read is current, as optimistic
+// locking does, and reads the updated item back.
+func TestUpdateItem(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  err := client.PutItem(ctx, name, lock{LockID: "a", Owner: "first", Version: 1}, Expression{})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  takeOver := Expression{
+    Text: "SET #owner = :owner, #version = #version + :one",
+    Names: map[string]string{"#owner": "Owner", "#version": "Version"},
+    Values: map[string]interface{}{":owner": "second", ":one": 1, ":version": 1},
+  }
+  current := Expression{
+    Text: "#version = :version",
+  }
+  var updated lock
+  err = client.UpdateItem(ctx, name, map[string]string{"LockID": "a"}, takeOver, current, &updated)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if updated != (lock{LockID: "a", Owner: "second", Version: 2}) {
+    t.Errorf("unexpected updated item %+v", updated)
+  }
+
+  err = client.UpdateItem(ctx, name, map[string]string{"LockID": "a"}, takeOver, current, nil)
+  if !IsConditionFailed(err) {
+    t.Fatalf("expected an update with a stale version to fail its condition, got %v", err)
+  }
+  var found lock
+  _, err = client.GetItem(ctx, name, map[string]string{"LockID": "a"}, &found)
+  if err != nil || found.Version != 2 {
+    t.Errorf("expected the stale update to leave version 2, got %+v (%v)", found, err)
+  }
+
+  release := Expression{
+    Text: "REMOVE #owner ADD #version :one",
+    Names: map[string]string{"#owner": "Owner", "#version": "Version"},
+    Values: map[string]interface{}{":one": 1},
+  }
+  var released lock
+  err = client.UpdateItem(ctx, name, map[string]string{"LockID": "a"}, release, Expression{}, &released)
+  if err != nil || released != (lock{LockID: "a", Version: 3}) {
+    t.Errorf("expected the owner to be removed and the version added to, got %+v (%v)", released, err)
+  }
+}
+
+func createLockTable(t *testing.T, client *Client, name string) {
+  err := client.CreateTableAndWait(context.Background(), &dynamodb.CreateTableInput{
+    AttributeDefinitions: []*dynamodb.AttributeDefinition{
+      {
+        AttributeName: aws.String("LockID"),
+        AttributeType: aws.String("S"),
+      },
+    },
+    KeySchema: []*dynamodb.KeySchemaElement{
+      {
+        AttributeName: aws.String("LockID"),
+        KeyType:       aws.String("HASH"),
+      },
+    },
+    TableName: aws.String(name),
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+}
+
+// TestCreateTableAndWait checks that CreateTableAndWait waits for a table that is still being created to be active.
+func TestCreateTableAndWait(t *testing.T) {
+  client, fake := newFakeClient()
+  fake.CreatingDescribes = 1
+
+  createLockTable(t, client, "test-dynamodb-table")
+  if fake.CreatingDescribes != 0 {
+    t.Error("CreateTableAndWait did not wait for the table to be active")
+  }
+}
+
+// TestEnableTimeToLive turns time to live on twice for the same attribute, which is allowed, and then for another.
+func TestEnableTimeToLive(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  err := client.EnableTimeToLive(ctx, name, "ExpiresAt")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.EnableTimeToLive(ctx, name, "ExpiresAt")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.EnableTimeToLive(ctx, name, "Other")
+  if err == nil {
+    t.Error("expected an error turning on time to live for another attribute")
+  }
+}
+
+// TestEnableStream turns the stream on twice with the same view type, getting the same stream, and then with another.
+func TestEnableStream(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  streamArn, err := client.EnableStream(ctx, name, dynamodb.StreamViewTypeNewAndOldImages)
+  if err != nil || streamArn == "" {
+    t.Fatalf("unexpected stream %q and error %v", streamArn, err)
+  }
+  again, err := client.EnableStream(ctx, name, dynamodb.StreamViewTypeNewAndOldImages)
+  if err != nil || again != streamArn {
+    t.Fatalf("expected the same stream %q, got %q and error %v", streamArn, again, err)
+  }
+  _, err = client.EnableStream(ctx, name, dynamodb.StreamViewTypeKeysOnly)
+  if err == nil {
+    t.Error("expected an error turning on the stream with another view type")
+  }
+}
+
+// TestSetPointInTimeRecovery turns point in time recovery on.
+func TestSetPointInTimeRecovery(t *testing.T) {
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  err := client.SetPointInTimeRecovery(context.Background(), name, true)
+  if err != nil || !fake.PointInTimeRecovery[name] {
+    t.Errorf("point in time recovery is not on (error %v)", err)
+  }
+}
+
+// TestListBackups creates two backups of a table and lists them in the order they were made.
+func TestListBackups(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+
+  backupArn, err := client.CreateBackup(ctx, name, "before")
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.CreateBackup(ctx, name, "after")
+  if err != nil {
+    t.Fatal(err)
+  }
+  backups, err := client.ListBackups(ctx, name)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(backups) != 2 || backups[0].Arn != backupArn || backups[0].Status != dynamodb.BackupStatusAvailable {
+    t.Errorf("unexpected backups %+v", backups)
+  }
+}
+
+// TestRestoreTable restores a backup into a new table, reads the backed up item from it, and deletes the backup and
+// the restored table.
+func TestRestoreTable(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  name := "test-dynamodb-table"
+  createLockTable(t, client, name)
+  err := client.PutItem(ctx, name, lock{LockID: "a", Owner: "first", Version: 1}, Expression{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  backupArn, err := client.CreateBackup(ctx, name, "before")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.RestoreTable(ctx, backupArn, "restored", true)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var restored lock
+  found, err := client.GetItem(ctx, "restored", map[string]string{"LockID": "a"}, &restored)
+  if err != nil || !found || restored.Owner != "first" {
+    t.Fatalf("unexpected restored item %+v (found %v, error %v)", restored, found, err)
+  }
+
+  err = client.DeleteBackup(ctx, backupArn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.DeleteTableAndWait(ctx, "restored")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := fake.Tables["restored"]; ok {
+    t.Error("the restored table was not deleted")
+  }
+}
+
+// TestSeedTableCsv seeds a table from a CSV file, whose cells are typed by their look or by the types given, and
+// whose empty cells are left out.
+func TestSeedTableCsv(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  createLockTable(t, client, "seeded")
+  directory, err := ioutil.TempDir("", "dynamodb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  csvLines := []string{"LockID,Owner,Version,Zip,Active,Tags"}
+  for i := 0; i < 40; i++ {
+    csvLines = append(csvLines, str.Concat("csv-", strconv.Itoa(i), ",batch,", strconv.Itoa(i), ",02134,true,\"[\"\"a\"\"]\""))
+  }
+  csvLines = append(csvLines, "csv-empty,,1,,,")
+  csvPath := filepath.Join(directory, "locks.csv")
+  writeLines(t, csvPath, csvLines)
+
+  count, err := client.SeedTable(ctx, "seeded", csvPath, SeedOptions{Types: map[string]string{"Tags": "L"}})
+  if err != nil || count != 41 {
+    t.Fatalf("expected 41 items seeded from CSV, got %d and error %v", count, err)
+  }
+  var item map[string]interface{}
+  _, err = client.GetItem(ctx, "seeded", map[string]string{"LockID": "csv-3"}, &item)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if item["Version"] != float64(3) || item["Zip"] != "02134" || item["Active"] != true || len(item["Tags"].([]interface{})) != 1 {
+    t.Errorf("unexpected types in %v", item)
+  }
+  item = nil
+  _, err = client.GetItem(ctx, "seeded", map[string]string{"LockID": "csv-empty"}, &item)
+  if _, ok := item["Owner"]; err != nil || ok {
+    t.Errorf("expected empty cells to be left out of %v (error %v)", item, err)
+  }
+}
+
+// TestSeedTableJsonLines seeds a table from a JSON lines file with a blank line, keeping the precision of numbers.
+func TestSeedTableJsonLines(t *testing.T) {
+  client, fake := newFakeClient()
+  createLockTable(t, client, "seeded")
+  directory, err := ioutil.TempDir("", "dynamodb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  jsonPath := filepath.Join(directory, "locks.jsonl")
+  writeLines(t, jsonPath, []string{
+    `{"LockID": "json-1", "Big": 12345678901234567890, "Nested": {"List": [1, "two", null]}}`,
+    ``,
+    `{"LockID": "json-2", "Owner": "json"}`,
+  })
+
+  count, err := client.SeedTable(context.Background(), "seeded", jsonPath, SeedOptions{})
+  if err != nil || count != 2 {
+    t.Fatalf("expected 2 items seeded from JSON lines, got %d and error %v", count, err)
+  }
+  if big := fakeItem(fake, "seeded", "json-1")["Big"]; big == nil || aws.StringValue(big.N) != "12345678901234567890" {
+    t.Errorf("the precision of a number was lost: %v", big)
+  }
+}
+
+// TestSeedTableInvalidLine checks that an error seeding from JSON lines names the line that is not an object.
+func TestSeedTableInvalidLine(t *testing.T) {
+  client, _ := newFakeClient()
+  createLockTable(t, client, "seeded")
+  directory, err := ioutil.TempDir("", "dynamodb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  badPath := filepath.Join(directory, "bad.jsonl")
+  writeLines(t, badPath, []string{`{"LockID": "ok"}`, `[1, 2]`})
+
+  _, err = client.SeedTable(context.Background(), "seeded", badPath, SeedOptions{})
+  if err == nil || !strings.Contains(err.Error(), "line 2") {
+    t.Errorf("expected an error on line 2, got %v", err)
+  }
+}
+
+// TestExportTable exports a table over several pages with a parallel scan and seeds another table from the export.
+func TestExportTable(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  fake.PageSize = 7
+  createLockTable(t, client, "exported")
+  createLockTable(t, client, "copied")
+  locks, _ := batchOfLocks(42)
+  err := client.BatchPut(ctx, "exported", locks)
+  if err != nil {
+    t.Fatal(err)
+  }
+  directory, err := ioutil.TempDir("", "dynamodb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  jsonPath := filepath.Join(directory, "big.jsonl")
+  writeLines(t, jsonPath, []string{`{"LockID": "big", "Big": 12345678901234567890}`})
+  _, err = client.SeedTable(ctx, "exported", jsonPath, SeedOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  exportPath := filepath.Join(directory, "export.jsonl")
+  count, err := client.ExportTable(ctx, "exported", exportPath, 3)
+  if err != nil || count != 43 {
+    t.Fatalf("expected 43 items exported, got %d and error %v", count, err)
+  }
+  count, err = client.SeedTable(ctx, "copied", exportPath, SeedOptions{})
+  if err != nil || count != 43 {
+    t.Fatalf("expected 43 items seeded from the export, got %d and error %v", count, err)
+  }
+  if big := fakeItem(fake, "copied", "big")["Big"]; big == nil || aws.StringValue(big.N) != "12345678901234567890" {
+    t.Errorf("the precision of a number was lost in the export: %v", big)
+  }
+}
+
+// TestScanLimit checks that a parallel scan stops at its limit however many segments return items.
+func TestScanLimit(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  fake.PageSize = 7
+  createLockTable(t, client, "scanned")
+  locks, _ := batchOfLocks(43)
+  err := client.BatchPut(ctx, "scanned", locks)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var scanned []lock
+  err = client.Scan(ctx, "scanned", ScanOptions{Segments: 4, Limit: 10}, &scanned)
+  if err != nil || len(scanned) != 10 {
+    t.Errorf("expected a scan limited to 10 items, got %d and error %v", len(scanned), err)
+  }
+}
+
+// TestExportTableFailure checks that an export that fails leaves the file of an earlier export as it was, rather than
+// a partial export that SeedTable would load.
+func TestExportTableFailure(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  createLockTable(t, client, "exported")
+  err := client.PutItem(ctx, "exported", lock{LockID: "a", Owner: "first", Version: 1}, Expression{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  directory, err := ioutil.TempDir("", "dynamodb")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  exportPath := filepath.Join(directory, "export.jsonl")
+  _, err = client.ExportTable(ctx, "exported", exportPath, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  before, _ := ioutil.ReadFile(exportPath)
+
+  _, err = client.ExportTable(ctx, "missing", exportPath, 1)
+  if err == nil {
+    t.Fatal("expected exporting a missing table to fail")
+  }
+  after, _ := ioutil.ReadFile(exportPath)
+  entries, _ := ioutil.ReadDir(directory)
+  if string(after) != string(before) || len(entries) != 1 {
+    t.Errorf("expected the earlier export alone to be left, got %q and %d files", after, len(entries))
+  }
+}
+
+// fakeItem returns the item of a lock table of the fake by its LockID.
+func fakeItem(fake *dynamodbfake.DynamoDB, table string, lockId string) map[string]*dynamodb.AttributeValue {
+  for _, item := range fake.Items[table] {
+    if aws.StringValue(item["LockID"].S) == lockId {
+      return item
+    }
+  }
+  return nil
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+  err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+}
+
+type reading struct {
+  Device  string
+  At      string
+  Kind    string
+  Value   float64
+}
+
+// createReadingsTable makes a readings table, keyed by device and time and indexed by kind and time, holding six
+// readings, in a fake that returns two items a page.
+func createReadingsTable(t *testing.T) (*Client, string) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  fake.PageSize = 2
+  name := "readings"
+  err := client.CreateTableAndWait(ctx, &dynamodb.CreateTableInput{
+    AttributeDefinitions: []*dynamodb.AttributeDefinition{
+      {
+        AttributeName: aws.String("Device"),
+        AttributeType: aws.String("S"),
+      },
+      {
+        AttributeName: aws.String("At"),
+        AttributeType: aws.String("S"),
+      },
+      {
+        AttributeName: aws.String("Kind"),
+        AttributeType: aws.String("S"),
+      },
+    },
+    GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+      {
+        IndexName: aws.String("by-kind"),
+        KeySchema: []*dynamodb.KeySchemaElement{
+          {
+            AttributeName: aws.String("Kind"),
+            KeyType:       aws.String("HASH"),
+          },
+          {
+            AttributeName: aws.String("At"),
+            KeyType:       aws.String("RANGE"),
+          },
+        },
+      },
+    },
+    KeySchema: []*dynamodb.KeySchemaElement{
+      {
+        AttributeName: aws.String("Device"),
+        KeyType:       aws.String("HASH"),
+      },
+      {
+        AttributeName: aws.String("At"),
+        KeyType:       aws.String("RANGE"),
+      },
+    },
+    TableName: aws.String(name),
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.BatchPut(ctx, name, []reading{
+    {Device: "a", At: "2019-06-03", Kind: "temperature", Value: 21},
+    {Device: "a", At: "2019-06-01", Kind: "temperature", Value: 19},
+    {Device: "a", At: "2019-07-01", Kind: "humidity", Value: 40},
+    {Device: "a", At: "2019-06-02", Kind: "temperature", Value: 25},
+    {Device: "b", At: "2019-06-01", Kind: "temperature", Value: 18},
+    {Device: "b", At: "2019-06-05"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  return client, name
+}
+
+// TestQueryBeginsWith queries the readings of a device for a month and gets them in time order.
+func TestQueryBeginsWith(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var june []reading
+  err := client.Query(context.Background(), name, Expression{
+    Text: "Device = :device AND begins_with(#at, :month)",
+    Names: map[string]string{"#at": "At"},
+    Values: map[string]interface{}{":device": "a", ":month": "2019-06"},
+  }, QueryOptions{}, &june)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(june) != 3 || june[0].At != "2019-06-01" || june[2].At != "2019-06-03" {
+    t.Errorf("unexpected readings %+v", june)
+  }
+}
+
+// TestQueryDescending queries the latest two readings of a device in a time range.
+func TestQueryDescending(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var latest []reading
+  err := client.Query(context.Background(), name, Expression{
+    Text: "Device = :device AND At BETWEEN :from AND :to",
+    Values: map[string]interface{}{":device": "a", ":from": "2019-06-02", ":to": "2019-12-31"},
+  }, QueryOptions{Descending: true, Limit: 2}, &latest)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(latest) != 2 || latest[0].At != "2019-07-01" || latest[1].At != "2019-06-03" {
+    t.Errorf("unexpected readings %+v", latest)
+  }
+}
+
+// TestQueryIndex queries a global secondary index with a filter on an attribute outside its key.
+func TestQueryIndex(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var warm []reading
+  err := client.Query(context.Background(), name, Expression{
+    Text: "Kind = :kind AND At >= :from",
+    Values: map[string]interface{}{":kind": "temperature", ":from": "2019-06-01"},
+  }, QueryOptions{IndexName: "by-kind", Filter: Expression{
+    Text: "#value > :value",
+    Names: map[string]string{"#value": "Value"},
+    Values: map[string]interface{}{":value": 18.5},
+  }}, &warm)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(warm) != 3 || warm[0].Value != 19 || warm[2].Value != 21 {
+    t.Errorf("unexpected readings %+v", warm)
+  }
+}
+
+// TestQueryWithoutPartitionKey checks that a key condition has to name the partition key.
+func TestQueryWithoutPartitionKey(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var readings []reading
+  err := client.Query(context.Background(), name, Expression{
+    Text: "At = :at",
+    Values: map[string]interface{}{":at": "2019-06-01"},
+  }, QueryOptions{}, &readings)
+  if err == nil {
+    t.Error("expected an error for a key condition without the partition key")
+  }
+}
+
+// TestScanFilter scans for the readings without a kind or of another kind than temperature.
+func TestScanFilter(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var unlabelled []reading
+  err := client.Scan(context.Background(), name, ScanOptions{Filter: Expression{
+    Text: "attribute_not_exists(Kind) OR NOT (Kind IN (:kind))",
+    Values: map[string]interface{}{":kind": "temperature"},
+  }}, &unlabelled)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(unlabelled) != 2 {
+    t.Errorf("unexpected readings %+v", unlabelled)
+  }
+}
+
+// TestParallelScan scans every reading across three segments.
+func TestParallelScan(t *testing.T) {
+  client, name := createReadingsTable(t)
+
+  var all []reading
+  err := client.Scan(context.Background(), name, ScanOptions{Segments: 3}, &all)
+  if err != nil || len(all) != 6 {
+    t.Errorf("expected 6 readings from a parallel scan, got %d and error %v", len(all), err)
+  }
+}
@@ -0,0 +1,148 @@
+// Package ec2fake is an in-memory stand-in for the parts of the EC2 API used by the
+// github.com/PyramidSystemsInc/go/aws packages, so they can be unit tested offline.
+package ec2fake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// EC2 holds the VPCs, subnets, security groups and network interfaces returned by its Describe calls.
+// Seed the exported fields before use. Calling an operation that is not implemented panics.
+type EC2 struct {
+	ec2iface.EC2API
+
+	mutex             sync.Mutex
+	Vpcs              []*ec2.Vpc
+	Subnets           []*ec2.Subnet
+	SecurityGroups    []*ec2.SecurityGroup
+	NetworkInterfaces []*ec2.NetworkInterface
+}
+
+// New returns an empty fake.
+func New() *EC2 {
+	return &EC2{}
+}
+
+// DescribeVpcsWithContext returns the VPCs matching the isDefault and vpc-id filters.
+func (fake *EC2) DescribeVpcsWithContext(ctx aws.Context, input *ec2.DescribeVpcsInput, opts ...request.Option) (*ec2.DescribeVpcsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var vpcs []*ec2.Vpc
+	for _, vpc := range fake.Vpcs {
+		if matches(input.Filters, map[string]string{
+			"isDefault": fmt.Sprint(aws.BoolValue(vpc.IsDefault)),
+			"vpc-id":    aws.StringValue(vpc.VpcId),
+		}) {
+			vpcs = append(vpcs, vpc)
+		}
+	}
+	return &ec2.DescribeVpcsOutput{
+		Vpcs: vpcs,
+	}, nil
+}
+
+// DescribeSubnetsWithContext returns the subnets matching input.SubnetIds and the vpc-id filter.
+func (fake *EC2) DescribeSubnetsWithContext(ctx aws.Context, input *ec2.DescribeSubnetsInput, opts ...request.Option) (*ec2.DescribeSubnetsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var subnets []*ec2.Subnet
+	for _, subnet := range fake.Subnets {
+		if len(input.SubnetIds) > 0 && !contains(input.SubnetIds, aws.StringValue(subnet.SubnetId)) {
+			continue
+		}
+		if matches(input.Filters, map[string]string{
+			"vpc-id": aws.StringValue(subnet.VpcId),
+		}) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	if len(subnets) < len(input.SubnetIds) {
+		return nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID does not exist", nil)
+	}
+	return &ec2.DescribeSubnetsOutput{
+		Subnets: subnets,
+	}, nil
+}
+
+// DescribeSecurityGroupsWithContext returns the security groups matching input.GroupNames, or the
+// group-name and vpc-id filters when no names are given.
+func (fake *EC2) DescribeSecurityGroupsWithContext(ctx aws.Context, input *ec2.DescribeSecurityGroupsInput, opts ...request.Option) (*ec2.DescribeSecurityGroupsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var securityGroups []*ec2.SecurityGroup
+	if len(input.GroupNames) == 0 {
+		for _, securityGroup := range fake.SecurityGroups {
+			if matches(input.Filters, map[string]string{
+				"group-name": aws.StringValue(securityGroup.GroupName),
+				"vpc-id":     aws.StringValue(securityGroup.VpcId),
+			}) {
+				securityGroups = append(securityGroups, securityGroup)
+			}
+		}
+	}
+	for _, name := range input.GroupNames {
+		found := false
+		for _, securityGroup := range fake.SecurityGroups {
+			if aws.StringValue(securityGroup.GroupName) == aws.StringValue(name) {
+				securityGroups = append(securityGroups, securityGroup)
+				found = true
+			}
+		}
+		if !found {
+			return nil, awserr.New("InvalidGroup.NotFound", "The security group '"+aws.StringValue(name)+"' does not exist", nil)
+		}
+	}
+	return &ec2.DescribeSecurityGroupsOutput{
+		SecurityGroups: securityGroups,
+	}, nil
+}
+
+// DescribeNetworkInterfacesWithContext returns the network interfaces matching input.NetworkInterfaceIds.
+func (fake *EC2) DescribeNetworkInterfacesWithContext(ctx aws.Context, input *ec2.DescribeNetworkInterfacesInput, opts ...request.Option) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var networkInterfaces []*ec2.NetworkInterface
+	for _, id := range input.NetworkInterfaceIds {
+		found := false
+		for _, networkInterface := range fake.NetworkInterfaces {
+			if aws.StringValue(networkInterface.NetworkInterfaceId) == aws.StringValue(id) {
+				networkInterfaces = append(networkInterfaces, networkInterface)
+				found = true
+			}
+		}
+		if !found {
+			return nil, awserr.New("InvalidNetworkInterfaceID.NotFound", "The networkInterface ID '"+aws.StringValue(id)+"' does not exist", nil)
+		}
+	}
+	return &ec2.DescribeNetworkInterfacesOutput{
+		NetworkInterfaces: networkInterfaces,
+	}, nil
+}
+
+// matches reports whether a resource with the given filterable values passes every filter. Filters on
+// names missing from values never match.
+func matches(filters []*ec2.Filter, values map[string]string) bool {
+	for _, filter := range filters {
+		value, ok := values[aws.StringValue(filter.Name)]
+		if !ok || !contains(filter.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []*string, value string) bool {
+	for _, item := range list {
+		if aws.StringValue(item) == value {
+			return true
+		}
+	}
+	return false
+}
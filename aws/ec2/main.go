@@ -1,32 +1,102 @@
 package ec2
 
 import (
+	"context"
 	"strconv"
 
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/ec2"
+  "github.com/aws/aws-sdk-go/service/ec2/ec2iface"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Looks up VPCs, subnets, security groups and network interfaces for the other packages through EC2
+type Client struct {
+  EC2 ec2iface.EC2API
+}
+
+// NetworkConfig - Where ECS tasks and load balancers are placed. Fields left empty are filled in by ResolveNetworkConfig
+type NetworkConfig struct {
+  // VpcId - Defaults to the VPC of the first subnet, or to the default VPC of the region
+  VpcId              string
+  // SubnetIds - Defaults to every subnet of the VPC
+  SubnetIds          []string
+  SecurityGroupIds   []string
+  // SecurityGroupNames - Looked up in the VPC and added to SecurityGroupIds
+  SecurityGroupNames []string
+  // AssignPublicIp - PublicIpEnabled or PublicIpDisabled. Defaults to PublicIpEnabled
+  AssignPublicIp     string
+}
+
+const (
+  PublicIpEnabled = "ENABLED"
+  PublicIpDisabled = "DISABLED"
+)
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    EC2: ec2.New(awsSession),
+  }
+}
+
 // GetAllVpcCidrBlocks - Returns all CIDR blocks in use by VPCs
 func GetAllVpcCidrBlocks(awsSession *session.Session) []string {
-  ec2Client := ec2.New(awsSession)
-  result, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{})
-  errors.LogIfError(err)
+  cidrBlocks, err := GetAllVpcCidrBlocksE(awsSession)
+  errors.QuitIfError(err)
+  return cidrBlocks
+}
+
+// GetAllVpcCidrBlocksE - Returns all CIDR blocks in use by VPCs, or an error if none are found
+func GetAllVpcCidrBlocksE(awsSession *session.Session) ([]string, error) {
+  return GetAllVpcCidrBlocksWithContext(context.Background(), awsSession)
+}
+
+// GetAllVpcCidrBlocksWithContext - GetAllVpcCidrBlocksE with a context to allow cancellation
+func GetAllVpcCidrBlocksWithContext(ctx context.Context, awsSession *session.Session) ([]string, error) {
+  return New(awsSession).GetAllVpcCidrBlocks(ctx)
+}
+
+// GetAllVpcCidrBlocks - Returns all CIDR blocks in use by VPCs, or an error if none are found
+func (client *Client) GetAllVpcCidrBlocks(ctx context.Context) ([]string, error) {
+  result, err := client.EC2.DescribeVpcsWithContext(ctx, &ec2.DescribeVpcsInput{})
+  if err != nil {
+    return nil, err
+  }
   if len(result.Vpcs) == 0 {
-    errors.LogAndQuit("ERROR: VPC information was queried, but no VPCs were found")
+    return nil, errors.New("ERROR: VPC information was queried, but no VPCs were found")
   }
   var cidrBlocks []string
   for _, vpc := range result.Vpcs {
     cidrBlocks = append(cidrBlocks, *vpc.CidrBlock)
   }
-  return cidrBlocks
+  return cidrBlocks, nil
 }
 
 func FindAvailableVpcCidrBlocks(numberToFind int, awsSession *session.Session) []string {
-	usedVpcCidrBlocks := GetAllVpcCidrBlocks(awsSession)
+	freeVpcCidrBlocks, err := FindAvailableVpcCidrBlocksE(numberToFind, awsSession)
+	errors.QuitIfError(err)
+	return freeVpcCidrBlocks
+}
+
+// FindAvailableVpcCidrBlocksE - Returns `numberToFind` 10.x.0.0/16 CIDR blocks not yet used by a VPC
+func FindAvailableVpcCidrBlocksE(numberToFind int, awsSession *session.Session) ([]string, error) {
+	return FindAvailableVpcCidrBlocksWithContext(context.Background(), numberToFind, awsSession)
+}
+
+// FindAvailableVpcCidrBlocksWithContext - FindAvailableVpcCidrBlocksE with a context to allow cancellation
+func FindAvailableVpcCidrBlocksWithContext(ctx context.Context, numberToFind int, awsSession *session.Session) ([]string, error) {
+	return New(awsSession).FindAvailableVpcCidrBlocks(ctx, numberToFind)
+}
+
+// FindAvailableVpcCidrBlocks - Returns `numberToFind` 10.x.0.0/16 CIDR blocks not yet used by a VPC
+func (client *Client) FindAvailableVpcCidrBlocks(ctx context.Context, numberToFind int) ([]string, error) {
+	usedVpcCidrBlocks, err := client.GetAllVpcCidrBlocks(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var freeVpcCidrBlocks []string
 	var secondPartDigits []string
 	for i := 0; i < numberToFind; i++ {
@@ -36,7 +106,7 @@ func FindAvailableVpcCidrBlocks(numberToFind int, awsSession *session.Session) [
 		} else {
 			lastValue, err := strconv.Atoi(secondPartDigits[i - 1])
 			if err != nil {
-				errors.LogAndQuit(cidrBlockError + err.Error())
+				return nil, errors.New(cidrBlockError + err.Error())
 			}
 			secondPartDigits = append(secondPartDigits, strconv.Itoa(lastValue + 1))
 		}
@@ -48,7 +118,7 @@ func FindAvailableVpcCidrBlocks(numberToFind int, awsSession *session.Session) [
 				if usedCidrBlock == testCidrBlock {
 					numberDigit, err := strconv.Atoi(secondPartDigits[i])
 					if err != nil {
-						errors.LogAndQuit(cidrBlockError + err.Error())
+						return nil, errors.New(cidrBlockError + err.Error())
 					}
 					numberDigit++
 					secondPartDigits[i] = strconv.Itoa(numberDigit)
@@ -59,52 +129,244 @@ func FindAvailableVpcCidrBlocks(numberToFind int, awsSession *session.Session) [
 		}
 		freeVpcCidrBlocks = append(freeVpcCidrBlocks, "10."+secondPartDigits[i]+".0.0/16")
 	}
-	return freeVpcCidrBlocks
+	return freeVpcCidrBlocks, nil
 }
 
 // FindPublicIpOfNetworkInterface - Given a network interface ID, returns the public IP associated with it
 func FindPublicIpOfNetworkInterface(networkInterfaceId string, awsSession *session.Session) string {
-  ec2Client := ec2.New(awsSession)
-  result, err := ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+  publicIp, err := FindPublicIpOfNetworkInterfaceE(networkInterfaceId, awsSession)
+  errors.QuitIfError(err)
+  return publicIp
+}
+
+// FindPublicIpOfNetworkInterfaceE - Given a network interface ID, returns the public IP associated with it or an error
+func FindPublicIpOfNetworkInterfaceE(networkInterfaceId string, awsSession *session.Session) (string, error) {
+  return FindPublicIpOfNetworkInterfaceWithContext(context.Background(), networkInterfaceId, awsSession)
+}
+
+// FindPublicIpOfNetworkInterfaceWithContext - FindPublicIpOfNetworkInterfaceE with a context to allow cancellation
+func FindPublicIpOfNetworkInterfaceWithContext(ctx context.Context, networkInterfaceId string, awsSession *session.Session) (string, error) {
+  return New(awsSession).FindPublicIpOfNetworkInterface(ctx, networkInterfaceId)
+}
+
+// FindPublicIpOfNetworkInterface - Given a network interface ID, returns the public IP associated with it or an error
+func (client *Client) FindPublicIpOfNetworkInterface(ctx context.Context, networkInterfaceId string) (string, error) {
+  result, err := client.EC2.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
     NetworkInterfaceIds: []*string{
       aws.String(networkInterfaceId),
     },
   })
-  errors.LogIfError(err)
+  if err != nil {
+    return "", err
+  }
   if len(result.NetworkInterfaces) == 0 {
-    notFoundError := str.Concat("A network interface with ID ", networkInterfaceId, " was not found")
-    errors.LogAndQuit(notFoundError)
+    return "", errors.New(str.Concat("A network interface with ID ", networkInterfaceId, " was not found"))
+  }
+  association := result.NetworkInterfaces[0].Association
+  if association == nil || association.PublicIp == nil {
+    return "", errors.New(str.Concat("The network interface with ID ", networkInterfaceId, " does not have a public IP"))
   }
-  return *result.NetworkInterfaces[0].Association.PublicIp
+  return *association.PublicIp, nil
 }
 
 // ListAllSubnetIds - Given a VPC ID, returns all the IDs of the subnets within it
 func ListAllSubnetIds(vpcId string, awsSession *session.Session) []*string {
-  ec2Client := ec2.New(awsSession)
-  result, err := ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+  subnets, err := ListAllSubnetIdsE(vpcId, awsSession)
   errors.LogIfError(err)
+  return subnets
+}
+
+// ListAllSubnetIdsE - Given a VPC ID, returns all the IDs of the subnets within it or an error
+func ListAllSubnetIdsE(vpcId string, awsSession *session.Session) ([]*string, error) {
+  return ListAllSubnetIdsWithContext(context.Background(), vpcId, awsSession)
+}
+
+// ListAllSubnetIdsWithContext - ListAllSubnetIdsE with a context to allow cancellation
+func ListAllSubnetIdsWithContext(ctx context.Context, vpcId string, awsSession *session.Session) ([]*string, error) {
+  return New(awsSession).ListAllSubnetIds(ctx, vpcId)
+}
+
+// ListAllSubnetIds - Given a VPC ID, returns all the IDs of the subnets within it or an error
+func (client *Client) ListAllSubnetIds(ctx context.Context, vpcId string) ([]*string, error) {
+  result, err := client.EC2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{})
   subnets := make([]*string, 0)
+  if err != nil {
+    return subnets, err
+  }
   for _, subnet := range result.Subnets {
     if *subnet.VpcId == vpcId {
       subnets = append(subnets, subnet.SubnetId)
     }
   }
-  return subnets
+  return subnets, nil
 }
 
 // GetSecurityGroupId - Given the name of a security group, returns the ID of that security group
 func GetSecurityGroupId(securityGroupName string, awsSession *session.Session) *string {
-  ec2Client := ec2.New(awsSession)
-  result, err := ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+  securityGroupId, err := GetSecurityGroupIdE(securityGroupName, awsSession)
+  errors.LogIfError(err)
+  return aws.String(securityGroupId)
+}
+
+// GetSecurityGroupIdE - Given the name of a security group, returns the ID of that security group or an error
+func GetSecurityGroupIdE(securityGroupName string, awsSession *session.Session) (string, error) {
+  return GetSecurityGroupIdWithContext(context.Background(), securityGroupName, awsSession)
+}
+
+// GetSecurityGroupIdWithContext - GetSecurityGroupIdE with a context to allow cancellation
+func GetSecurityGroupIdWithContext(ctx context.Context, securityGroupName string, awsSession *session.Session) (string, error) {
+  return New(awsSession).GetSecurityGroupId(ctx, securityGroupName)
+}
+
+// GetSecurityGroupId - Given the name of a security group, returns the ID of that security group or an error
+func (client *Client) GetSecurityGroupId(ctx context.Context, securityGroupName string) (string, error) {
+  result, err := client.EC2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
     GroupNames: []*string{
       aws.String(securityGroupName),
     },
   })
-  errors.LogIfError(err)
-  if len(result.SecurityGroups) == 1 {
-    return result.SecurityGroups[0].GroupId
-  } else {
-    notFound := ""
-    return &notFound
+  if err != nil {
+    return "", err
+  }
+  if len(result.SecurityGroups) != 1 {
+    return "", errors.New(str.Concat("A security group named ", securityGroupName, " was not found"))
+  }
+  return *result.SecurityGroups[0].GroupId, nil
+}
+
+// FindDefaultVpcId - Returns the ID of the default VPC of the region
+func FindDefaultVpcId(awsSession *session.Session) string {
+  vpcId, err := FindDefaultVpcIdE(awsSession)
+  errors.QuitIfError(err)
+  return vpcId
+}
+
+// FindDefaultVpcIdE - Returns the ID of the default VPC of the region, or an error if there is none
+func FindDefaultVpcIdE(awsSession *session.Session) (string, error) {
+  return FindDefaultVpcIdWithContext(context.Background(), awsSession)
+}
+
+// FindDefaultVpcIdWithContext - FindDefaultVpcIdE with a context to allow cancellation
+func FindDefaultVpcIdWithContext(ctx context.Context, awsSession *session.Session) (string, error) {
+  return New(awsSession).FindDefaultVpcId(ctx)
+}
+
+// FindDefaultVpcId - Returns the ID of the default VPC of the region, or an error if there is none
+func (client *Client) FindDefaultVpcId(ctx context.Context) (string, error) {
+  result, err := client.EC2.DescribeVpcsWithContext(ctx, &ec2.DescribeVpcsInput{
+    Filters: []*ec2.Filter{
+      {
+        Name: aws.String("isDefault"),
+        Values: []*string{
+          aws.String("true"),
+        },
+      },
+    },
+  })
+  if err != nil {
+    return "", err
+  }
+  if len(result.Vpcs) == 0 {
+    return "", errors.New("This region does not have a default VPC. Set the VPC ID of the network configuration instead")
+  }
+  return *result.Vpcs[0].VpcId, nil
+}
+
+// ResolveNetworkConfig - Fills in the VPC, subnets, security group IDs and public IP policy left empty in `network`
+func ResolveNetworkConfig(network NetworkConfig, awsSession *session.Session) NetworkConfig {
+  resolved, err := ResolveNetworkConfigE(network, awsSession)
+  errors.QuitIfError(err)
+  return resolved
+}
+
+// ResolveNetworkConfigE - Fills in the VPC, subnets, security group IDs and public IP policy left empty in `network`, or returns an error
+func ResolveNetworkConfigE(network NetworkConfig, awsSession *session.Session) (NetworkConfig, error) {
+  return ResolveNetworkConfigWithContext(context.Background(), network, awsSession)
+}
+
+// ResolveNetworkConfigWithContext - ResolveNetworkConfigE with a context to allow cancellation
+func ResolveNetworkConfigWithContext(ctx context.Context, network NetworkConfig, awsSession *session.Session) (NetworkConfig, error) {
+  return New(awsSession).ResolveNetworkConfig(ctx, network)
+}
+
+// ResolveNetworkConfig - Fills in the VPC, subnets, security group IDs and public IP policy left empty in `network`, or returns an error.
+// Security group names are replaced by their IDs
+func (client *Client) ResolveNetworkConfig(ctx context.Context, network NetworkConfig) (NetworkConfig, error) {
+  resolved := NetworkConfig{
+    VpcId: network.VpcId,
+    SubnetIds: network.SubnetIds,
+    SecurityGroupIds: append([]string{}, network.SecurityGroupIds...),
+    AssignPublicIp: network.AssignPublicIp,
+  }
+  var err error
+  if resolved.VpcId == "" && len(resolved.SubnetIds) > 0 {
+    resolved.VpcId, err = client.findVpcIdOfSubnet(ctx, resolved.SubnetIds[0])
+  } else if resolved.VpcId == "" {
+    resolved.VpcId, err = client.FindDefaultVpcId(ctx)
+  }
+  if err != nil {
+    return resolved, err
+  }
+  if len(resolved.SubnetIds) == 0 {
+    subnetIds, err := client.ListAllSubnetIds(ctx, resolved.VpcId)
+    if err != nil {
+      return resolved, err
+    }
+    if len(subnetIds) == 0 {
+      return resolved, errors.New(str.Concat("The VPC ", resolved.VpcId, " does not have any subnets"))
+    }
+    resolved.SubnetIds = aws.StringValueSlice(subnetIds)
+  }
+  for _, securityGroupName := range network.SecurityGroupNames {
+    securityGroupId, err := client.findSecurityGroupIdInVpc(ctx, securityGroupName, resolved.VpcId)
+    if err != nil {
+      return resolved, err
+    }
+    resolved.SecurityGroupIds = append(resolved.SecurityGroupIds, securityGroupId)
+  }
+  if resolved.AssignPublicIp == "" {
+    resolved.AssignPublicIp = PublicIpEnabled
+  }
+  return resolved, nil
+}
+
+func (client *Client) findVpcIdOfSubnet(ctx context.Context, subnetId string) (string, error) {
+  result, err := client.EC2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{
+    SubnetIds: []*string{
+      aws.String(subnetId),
+    },
+  })
+  if err != nil {
+    return "", err
+  }
+  if len(result.Subnets) == 0 {
+    return "", errors.New(str.Concat("A subnet with ID ", subnetId, " was not found"))
+  }
+  return *result.Subnets[0].VpcId, nil
+}
+
+func (client *Client) findSecurityGroupIdInVpc(ctx context.Context, securityGroupName string, vpcId string) (string, error) {
+  result, err := client.EC2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+    Filters: []*ec2.Filter{
+      {
+        Name: aws.String("group-name"),
+        Values: []*string{
+          aws.String(securityGroupName),
+        },
+      },
+      {
+        Name: aws.String("vpc-id"),
+        Values: []*string{
+          aws.String(vpcId),
+        },
+      },
+    },
+  })
+  if err != nil {
+    return "", err
+  }
+  if len(result.SecurityGroups) != 1 {
+    return "", errors.New(str.Concat("A security group named ", securityGroupName, " was not found in the VPC ", vpcId))
   }
+  return *result.SecurityGroups[0].GroupId, nil
 }
@@ -0,0 +1,95 @@
+package ec2
+
+import (
+  "context"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/ec2/ec2fake"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func newFakeClient() *Client {
+  fake := ec2fake.New()
+  fake.Vpcs = []*ec2.Vpc{
+    {
+      CidrBlock: aws.String("172.31.0.0/16"),
+      IsDefault: aws.Bool(true),
+      VpcId: aws.String("vpc-default"),
+    },
+    {
+      CidrBlock: aws.String("10.1.0.0/16"),
+      IsDefault: aws.Bool(false),
+      VpcId: aws.String("vpc-project"),
+    },
+  }
+  fake.Subnets = []*ec2.Subnet{
+    {
+      SubnetId: aws.String("subnet-default-a"),
+      VpcId: aws.String("vpc-default"),
+    },
+    {
+      SubnetId: aws.String("subnet-default-b"),
+      VpcId: aws.String("vpc-default"),
+    },
+    {
+      SubnetId: aws.String("subnet-project-a"),
+      VpcId: aws.String("vpc-project"),
+    },
+  }
+  fake.SecurityGroups = []*ec2.SecurityGroup{
+    {
+      GroupId: aws.String("sg-default-web"),
+      GroupName: aws.String("web"),
+      VpcId: aws.String("vpc-default"),
+    },
+    {
+      GroupId: aws.String("sg-project-web"),
+      GroupName: aws.String("web"),
+      VpcId: aws.String("vpc-project"),
+    },
+  }
+  return &Client{EC2: fake}
+}
+
+// TestResolveNetworkConfig checks that an empty network configuration resolves to the default VPC and its
+// subnets, and that security group names are looked up in the VPC of the given subnets.
+func TestResolveNetworkConfig(t *testing.T) {
+  ctx := context.Background()
+  client := newFakeClient()
+
+  network, err := client.ResolveNetworkConfig(ctx, NetworkConfig{
+    SecurityGroupNames: []string{"web"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if network.VpcId != "vpc-default" || len(network.SubnetIds) != 2 || network.AssignPublicIp != PublicIpEnabled {
+    t.Errorf("unexpected default network %+v", network)
+  }
+  if len(network.SecurityGroupIds) != 1 || network.SecurityGroupIds[0] != "sg-default-web" {
+    t.Errorf("expected the web security group of the default VPC, got %v", network.SecurityGroupIds)
+  }
+
+  network, err = client.ResolveNetworkConfig(ctx, NetworkConfig{
+    SubnetIds: []string{"subnet-project-a"},
+    SecurityGroupNames: []string{"web"},
+    AssignPublicIp: PublicIpDisabled,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if network.VpcId != "vpc-project" || network.AssignPublicIp != PublicIpDisabled {
+    t.Errorf("unexpected project network %+v", network)
+  }
+  if len(network.SecurityGroupIds) != 1 || network.SecurityGroupIds[0] != "sg-project-web" {
+    t.Errorf("expected the web security group of the project VPC, got %v", network.SecurityGroupIds)
+  }
+
+  _, err = client.ResolveNetworkConfig(ctx, NetworkConfig{
+    SecurityGroupNames: []string{"missing"},
+  })
+  if err == nil {
+    t.Error("expected an error for a missing security group")
+  }
+}
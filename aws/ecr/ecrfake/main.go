@@ -0,0 +1,367 @@
+// Package ecrfake is an in-memory stand-in for the parts of the ECR API used by the
+// github.com/PyramidSystemsInc/go/aws/ecr package, so it can be unit tested offline.
+package ecrfake
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// ECR keeps the repositories and images of the registry of one account in memory, keyed by repository name.
+// Calling an operation that is not implemented panics.
+type ECR struct {
+	ecriface.ECRAPI
+
+	mutex     sync.Mutex
+	Region    string
+	AccountID string
+	// Password is the password of the AWS user in the tokens.
+	Password          string
+	Repositories      map[string]*ecr.Repository
+	Images            map[string][]*ecr.ImageDetail
+	LifecyclePolicies map[string]string
+	// Vulnerabilities are what a scan finds in an image, keyed by image digest. Scans complete as soon as they start.
+	Vulnerabilities map[string][]*ecr.ImageScanFinding
+	// PageSize is the number of images or findings DescribeImages and DescribeImageScanFindings return per page.
+	PageSize int
+	scanned  map[string]time.Time
+}
+
+// tagPattern is the form ECR accepts image tags in.
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
+// New returns an empty registry in us-east-1 for account 123456789012, paging every 100 images.
+func New() *ECR {
+	return &ECR{
+		Region:            "us-east-1",
+		AccountID:         "123456789012",
+		Password:          "fake-password",
+		Repositories:      map[string]*ecr.Repository{},
+		Images:            map[string][]*ecr.ImageDetail{},
+		LifecyclePolicies: map[string]string{},
+		Vulnerabilities:   map[string][]*ecr.ImageScanFinding{},
+		PageSize:          100,
+		scanned:           map[string]time.Time{},
+	}
+}
+
+// PushImage adds an image to a repository, moving the tags from any image that had them.
+func (fake *ECR) PushImage(repositoryName string, digest string, pushedAt time.Time, tags ...string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	for _, image := range fake.Images[repositoryName] {
+		var kept []*string
+		for _, tag := range image.ImageTags {
+			if !contains(tags, aws.StringValue(tag)) {
+				kept = append(kept, tag)
+			}
+		}
+		image.ImageTags = kept
+	}
+	fake.Images[repositoryName] = append(fake.Images[repositoryName], &ecr.ImageDetail{
+		ImageDigest:      aws.String(digest),
+		ImagePushedAt:    aws.Time(pushedAt),
+		ImageSizeInBytes: aws.Int64(1024),
+		ImageTags:        aws.StringSlice(tags),
+		RegistryId:       aws.String(fake.AccountID),
+		RepositoryName:   aws.String(repositoryName),
+	})
+}
+
+// CreateRepositoryWithContext creates an empty repository.
+func (fake *ECR) CreateRepositoryWithContext(ctx aws.Context, input *ecr.CreateRepositoryInput, opts ...request.Option) (*ecr.CreateRepositoryOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := fake.Repositories[name]; ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryAlreadyExistsException, "The repository with name '"+name+"' already exists in the registry with id '"+fake.AccountID+"'", nil)
+	}
+	repository := &ecr.Repository{
+		CreatedAt:                  aws.Time(time.Now()),
+		ImageScanningConfiguration: input.ImageScanningConfiguration,
+		ImageTagMutability:         input.ImageTagMutability,
+		RegistryId:                 aws.String(fake.AccountID),
+		RepositoryArn:              aws.String(fmt.Sprintf("arn:aws:ecr:%s:%s:repository/%s", fake.Region, fake.AccountID, name)),
+		RepositoryName:             aws.String(name),
+		RepositoryUri:              aws.String(fake.registry() + "/" + name),
+	}
+	fake.Repositories[name] = repository
+	return &ecr.CreateRepositoryOutput{
+		Repository: repository,
+	}, nil
+}
+
+// DescribeRepositoriesWithContext returns the requested repositories, or all of them.
+func (fake *ECR) DescribeRepositoriesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, opts ...request.Option) (*ecr.DescribeRepositoriesOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	output := &ecr.DescribeRepositoriesOutput{}
+	if len(input.RepositoryNames) == 0 {
+		for _, repository := range fake.Repositories {
+			output.Repositories = append(output.Repositories, repository)
+		}
+		return output, nil
+	}
+	for _, name := range input.RepositoryNames {
+		repository, err := fake.repository(name)
+		if err != nil {
+			return nil, err
+		}
+		output.Repositories = append(output.Repositories, repository)
+	}
+	return output, nil
+}
+
+// DeleteRepositoryWithContext deletes a repository, refusing if it still has images unless forced.
+func (fake *ECR) DeleteRepositoryWithContext(ctx aws.Context, input *ecr.DeleteRepositoryInput, opts ...request.Option) (*ecr.DeleteRepositoryOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	repository, err := fake.repository(input.RepositoryName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.RepositoryName)
+	if len(fake.Images[name]) > 0 && !aws.BoolValue(input.Force) {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotEmptyException, "The repository with name '"+name+"' cannot be deleted because it still contains images", nil)
+	}
+	delete(fake.Repositories, name)
+	delete(fake.Images, name)
+	delete(fake.LifecyclePolicies, name)
+	return &ecr.DeleteRepositoryOutput{
+		Repository: repository,
+	}, nil
+}
+
+// PutLifecyclePolicyWithContext stores the policy text of a repository.
+func (fake *ECR) PutLifecyclePolicyWithContext(ctx aws.Context, input *ecr.PutLifecyclePolicyInput, opts ...request.Option) (*ecr.PutLifecyclePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if _, err := fake.repository(input.RepositoryName); err != nil {
+		return nil, err
+	}
+	fake.LifecyclePolicies[aws.StringValue(input.RepositoryName)] = aws.StringValue(input.LifecyclePolicyText)
+	return &ecr.PutLifecyclePolicyOutput{
+		LifecyclePolicyText: input.LifecyclePolicyText,
+		RepositoryName:      input.RepositoryName,
+	}, nil
+}
+
+// DescribeImagesWithContext returns a page of the images of a repository, in the order they were pushed. The
+// next token is the offset of the following page.
+func (fake *ECR) DescribeImagesWithContext(ctx aws.Context, input *ecr.DescribeImagesInput, opts ...request.Option) (*ecr.DescribeImagesOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if _, err := fake.repository(input.RepositoryName); err != nil {
+		return nil, err
+	}
+	images := fake.Images[aws.StringValue(input.RepositoryName)]
+	offset := 0
+	if input.NextToken != nil {
+		offset, _ = strconv.Atoi(*input.NextToken)
+	}
+	output := &ecr.DescribeImagesOutput{}
+	end := offset + fake.PageSize
+	if end < len(images) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(images)
+	}
+	if offset < end {
+		output.ImageDetails = images[offset:end]
+	}
+	return output, nil
+}
+
+// DescribeImagesPagesWithContext calls fn with every page of DescribeImagesWithContext until fn returns false.
+func (fake *ECR) DescribeImagesPagesWithContext(ctx aws.Context, input *ecr.DescribeImagesInput, fn func(*ecr.DescribeImagesOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.DescribeImagesWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.NextToken == nil) || output.NextToken == nil {
+			return nil
+		}
+		page.NextToken = output.NextToken
+	}
+}
+
+// BatchDeleteImageWithContext deletes images by digest, reporting unknown digests as failures.
+func (fake *ECR) BatchDeleteImageWithContext(ctx aws.Context, input *ecr.BatchDeleteImageInput, opts ...request.Option) (*ecr.BatchDeleteImageOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if _, err := fake.repository(input.RepositoryName); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.RepositoryName)
+	output := &ecr.BatchDeleteImageOutput{}
+	for _, imageId := range input.ImageIds {
+		found := false
+		images := fake.Images[name]
+		for i, image := range images {
+			if aws.StringValue(image.ImageDigest) == aws.StringValue(imageId.ImageDigest) {
+				fake.Images[name] = append(images[:i], images[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if found {
+			output.ImageIds = append(output.ImageIds, imageId)
+		} else {
+			output.Failures = append(output.Failures, &ecr.ImageFailure{
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+				FailureReason: aws.String("Requested image not found"),
+				ImageId:       imageId,
+			})
+		}
+	}
+	return output, nil
+}
+
+// GetAuthorizationTokenWithContext returns a token valid for 12 hours.
+func (fake *ECR) GetAuthorizationTokenWithContext(ctx aws.Context, input *ecr.GetAuthorizationTokenInput, opts ...request.Option) (*ecr.GetAuthorizationTokenOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			{
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:" + fake.Password))),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				ProxyEndpoint:      aws.String("https://" + fake.registry()),
+			},
+		},
+	}, nil
+}
+
+// StartImageScanWithContext scans an image, refusing to scan it again within 24 hours like ECR, and refusing
+// tags ECR would not accept.
+func (fake *ECR) StartImageScanWithContext(ctx aws.Context, input *ecr.StartImageScanInput, opts ...request.Option) (*ecr.StartImageScanOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if input.ImageId != nil && input.ImageId.ImageTag != nil && !tagPattern.MatchString(*input.ImageId.ImageTag) {
+		return nil, awserr.New(ecr.ErrCodeValidationException, "1 validation error detected: Value '"+*input.ImageId.ImageTag+"' at 'imageId.imageTag' failed to satisfy constraint: Member must satisfy regular expression pattern: "+tagPattern.String(), nil)
+	}
+	image, err := fake.image(input.RepositoryName, input.ImageId)
+	if err != nil {
+		return nil, err
+	}
+	digest := aws.StringValue(image.ImageDigest)
+	if scannedAt, ok := fake.scanned[digest]; ok && time.Since(scannedAt) < 24*time.Hour {
+		return nil, awserr.New(ecr.ErrCodeLimitExceededException, "The scan quota per image has been exceeded. Wait and try again.", nil)
+	}
+	fake.scanned[digest] = time.Now()
+	return &ecr.StartImageScanOutput{
+		ImageId: input.ImageId,
+		ImageScanStatus: &ecr.ImageScanStatus{
+			Status: aws.String(ecr.ScanStatusInProgress),
+		},
+		RepositoryName: input.RepositoryName,
+	}, nil
+}
+
+// DescribeImageScanFindingsWithContext returns a page of the findings of the latest scan of an image. The next
+// token is the offset of the following page.
+func (fake *ECR) DescribeImageScanFindingsWithContext(ctx aws.Context, input *ecr.DescribeImageScanFindingsInput, opts ...request.Option) (*ecr.DescribeImageScanFindingsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	image, err := fake.image(input.RepositoryName, input.ImageId)
+	if err != nil {
+		return nil, err
+	}
+	digest := aws.StringValue(image.ImageDigest)
+	scannedAt, ok := fake.scanned[digest]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeScanNotFoundException, "Image scan does not exist for the image with '"+digest+"'", nil)
+	}
+	findings := fake.Vulnerabilities[digest]
+	counts := map[string]*int64{}
+	for _, finding := range findings {
+		severity := aws.StringValue(finding.Severity)
+		counts[severity] = aws.Int64(aws.Int64Value(counts[severity]) + 1)
+	}
+	offset := 0
+	if input.NextToken != nil {
+		offset, _ = strconv.Atoi(*input.NextToken)
+	}
+	output := &ecr.DescribeImageScanFindingsOutput{
+		ImageId: input.ImageId,
+		ImageScanFindings: &ecr.ImageScanFindings{
+			FindingSeverityCounts: counts,
+			ImageScanCompletedAt:  aws.Time(scannedAt),
+		},
+		ImageScanStatus: &ecr.ImageScanStatus{
+			Status: aws.String(ecr.ScanStatusComplete),
+		},
+		RepositoryName: input.RepositoryName,
+	}
+	end := offset + fake.PageSize
+	if end < len(findings) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(findings)
+	}
+	if offset < end {
+		output.ImageScanFindings.Findings = findings[offset:end]
+	}
+	return output, nil
+}
+
+// DescribeImageScanFindingsPagesWithContext calls fn with every page of DescribeImageScanFindingsWithContext until fn returns false.
+func (fake *ECR) DescribeImageScanFindingsPagesWithContext(ctx aws.Context, input *ecr.DescribeImageScanFindingsInput, fn func(*ecr.DescribeImageScanFindingsOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.DescribeImageScanFindingsWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.NextToken == nil) || output.NextToken == nil {
+			return nil
+		}
+		page.NextToken = output.NextToken
+	}
+}
+
+func (fake *ECR) repository(name *string) (*ecr.Repository, error) {
+	repository, ok := fake.Repositories[aws.StringValue(name)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "The repository with name '"+aws.StringValue(name)+"' does not exist in the registry with id '"+fake.AccountID+"'", nil)
+	}
+	return repository, nil
+}
+
+// image returns an image of a repository by digest or tag.
+func (fake *ECR) image(repositoryName *string, imageId *ecr.ImageIdentifier) (*ecr.ImageDetail, error) {
+	if _, err := fake.repository(repositoryName); err != nil {
+		return nil, err
+	}
+	for _, image := range fake.Images[aws.StringValue(repositoryName)] {
+		if aws.StringValue(image.ImageDigest) == aws.StringValue(imageId.ImageDigest) || (imageId.ImageTag != nil && contains(aws.StringValueSlice(image.ImageTags), *imageId.ImageTag)) {
+			return image, nil
+		}
+	}
+	return nil, awserr.New(ecr.ErrCodeImageNotFoundException, "The image requested does not exist in the specified repository.", nil)
+}
+
+func (fake *ECR) registry() string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", fake.AccountID, fake.Region)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,28 +1,695 @@
 package ecr
 
 import (
+  "context"
+  "encoding/base64"
+  "encoding/json"
+  "sort"
+  "strconv"
   "strings"
+  "time"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
+  "github.com/aws/aws-sdk-go/aws/session"
+  "github.com/aws/aws-sdk-go/service/ecr"
+  "github.com/aws/aws-sdk-go/service/ecr/ecriface"
   "github.com/PyramidSystemsInc/go/commands"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Manages ECR repositories and their images, scans and lifecycle policies, and logs docker in to them
+type Client struct {
+  ECR ecriface.ECRAPI
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    ECR: ecr.New(awsSession),
+  }
+}
+
+// AuthorizationToken - Credentials Docker can log in to the registry of the account with
+type AuthorizationToken struct {
+  // Url - Host of the registry, such as 123456789012.dkr.ecr.us-east-1.amazonaws.com
+  Url        string
+  Username   string
+  Password   string
+  ExpiresAt  time.Time
+}
+
+// RepositoryOptions - Settings for CreateRepository
+type RepositoryOptions struct {
+  // ScanOnPush - Scans every pushed image for vulnerabilities
+  ScanOnPush     bool
+  // ImmutableTags - Refuses pushes that would move an existing tag to another image
+  ImmutableTags  bool
+}
+
+// LifecyclePolicy - Rules ECR applies to expire old images. Zero fields add no rule
+type LifecyclePolicy struct {
+  // KeepLastTagged - Number of tagged images kept, newest first
+  KeepLastTagged           int
+  // TagPrefixes - Limits KeepLastTagged to the images with a tag starting with one of the prefixes. Empty counts every tagged image
+  TagPrefixes              []string
+  // ExpireUntaggedAfterDays - Age in days after which untagged images are expired
+  ExpireUntaggedAfterDays  int
+}
+
+// Image - An image of a repository
+type Image struct {
+  Digest     string
+  Tags       []string
+  PushedAt   time.Time
+  SizeBytes  int64
+}
+
+// ImageFilter - Selects the images DeleteImages deletes. Images must match every non-zero field
+type ImageFilter struct {
+  // Untagged - Matches only images without tags
+  Untagged      bool
+  // TagPrefix - Matches only images with a tag starting with the prefix
+  TagPrefix     string
+  // PushedBefore - Matches only images pushed before the time
+  PushedBefore  time.Time
+}
+
+// ScanFindings - The vulnerabilities found by the scan of an image
+type ScanFindings struct {
+  CompletedAt     time.Time
+  // SeverityCounts - Number of findings per severity, such as CRITICAL or HIGH
+  SeverityCounts  map[string]int64
+  Findings        []Finding
+}
+
+// Finding - One vulnerability of a scanned image
+type Finding struct {
+  // Name - The CVE, such as CVE-2019-5436
+  Name            string
+  Severity        string
+  Description     string
+  Uri             string
+  Package         string
+  PackageVersion  string
+}
+
+// severityUntriaged - Severity of the enhanced scanning findings that Amazon Inspector has not rated yet
+const severityUntriaged = "UNTRIAGED"
+
+// severities - Finding severities from least to most severe. Findings whose severity is not known yet rank lowest
+var severities = []string{
+  ecr.FindingSeverityUndefined,
+  severityUntriaged,
+  ecr.FindingSeverityInformational,
+  ecr.FindingSeverityLow,
+  ecr.FindingSeverityMedium,
+  ecr.FindingSeverityHigh,
+  ecr.FindingSeverityCritical,
+}
+
+// CheckSeverity - Returns an error counting the findings at or above the threshold severity (such as HIGH, which includes CRITICAL),
+// or nil when there are none. Use it to stop a deployment after ScanImage. UNDEFINED and UNTRIAGED findings, whose severity is not
+// known, rank lowest, so only those thresholds count them
+func CheckSeverity(findings ScanFindings, threshold string) error {
+  thresholdRank := severityRank(threshold)
+  if thresholdRank < 0 {
+    return errors.New(str.Concat("The severity threshold ", threshold, " is not one of ", strings.Join(severities, ", ")))
+  }
+  var counts []string
+  for rank := len(severities) - 1; rank >= thresholdRank; rank-- {
+    if count := findings.SeverityCounts[severities[rank]]; count > 0 {
+      counts = append(counts, str.Concat(strconv.FormatInt(count, 10), " ", severities[rank]))
+    }
+  }
+  if len(counts) == 0 {
+    return nil
+  }
+  var names []string
+  for _, finding := range findings.Findings {
+    if severityRank(finding.Severity) >= thresholdRank {
+      names = append(names, finding.Name)
+    }
+  }
+  return errors.New(str.Concat("The image has ", strings.Join(counts, ", "), " vulnerabilities: ", strings.Join(names, ", ")))
+}
+
+// CreateRepository - Creates a repository (if it does not exist yet) and returns its URI
+func CreateRepository(repositoryName string, options RepositoryOptions, awsSession *session.Session) string {
+  repositoryUri, err := CreateRepositoryE(repositoryName, options, awsSession)
+  errors.QuitIfError(err)
+  return repositoryUri
+}
+
+// CreateRepositoryE - Creates a repository (if it does not exist yet) and returns its URI or an error
+func CreateRepositoryE(repositoryName string, options RepositoryOptions, awsSession *session.Session) (string, error) {
+  return CreateRepositoryWithContext(context.Background(), repositoryName, options, awsSession)
+}
+
+// CreateRepositoryWithContext - CreateRepositoryE with a context to allow cancellation
+func CreateRepositoryWithContext(ctx context.Context, repositoryName string, options RepositoryOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateRepository(ctx, repositoryName, options)
+}
+
+// CreateRepository - Creates a repository and returns its URI, such as 123456789012.dkr.ecr.us-east-1.amazonaws.com/name, or an error.
+// If the repository already exists, its URI is returned and its settings are left unchanged
+func (client *Client) CreateRepository(ctx context.Context, repositoryName string, options RepositoryOptions) (string, error) {
+  tagMutability := ecr.ImageTagMutabilityMutable
+  if options.ImmutableTags {
+    tagMutability = ecr.ImageTagMutabilityImmutable
+  }
+  result, err := client.ECR.CreateRepositoryWithContext(ctx, &ecr.CreateRepositoryInput{
+    ImageScanningConfiguration: &ecr.ImageScanningConfiguration{
+      ScanOnPush: aws.Bool(options.ScanOnPush),
+    },
+    ImageTagMutability: aws.String(tagMutability),
+    RepositoryName: aws.String(repositoryName),
+  })
+  if isErrorCode(err, ecr.ErrCodeRepositoryAlreadyExistsException) {
+    repositories, err := client.ECR.DescribeRepositoriesWithContext(ctx, &ecr.DescribeRepositoriesInput{
+      RepositoryNames: []*string{
+        aws.String(repositoryName),
+      },
+    })
+    if err != nil {
+      return "", err
+    }
+    return aws.StringValue(repositories.Repositories[0].RepositoryUri), nil
+  }
+  if err != nil {
+    return "", err
+  }
+  return aws.StringValue(result.Repository.RepositoryUri), nil
+}
+
+// DeleteImages - Deletes the images of a repository matching the filter and returns how many were deleted
+func DeleteImages(repositoryName string, filter ImageFilter, awsSession *session.Session) int {
+  deleted, err := DeleteImagesE(repositoryName, filter, awsSession)
+  errors.QuitIfError(err)
+  return deleted
+}
+
+// DeleteImagesE - Deletes the images of a repository matching the filter and returns how many were deleted, or an error
+func DeleteImagesE(repositoryName string, filter ImageFilter, awsSession *session.Session) (int, error) {
+  return DeleteImagesWithContext(context.Background(), repositoryName, filter, awsSession)
+}
+
+// DeleteImagesWithContext - DeleteImagesE with a context to allow cancellation
+func DeleteImagesWithContext(ctx context.Context, repositoryName string, filter ImageFilter, awsSession *session.Session) (int, error) {
+  return New(awsSession).DeleteImages(ctx, repositoryName, filter)
+}
+
+// DeleteImages - Deletes the images of a repository matching the filter and returns how many were deleted, or an error.
+// An empty filter is refused rather than deleting every image. Use DeleteRepository with force for that
+func (client *Client) DeleteImages(ctx context.Context, repositoryName string, filter ImageFilter) (int, error) {
+  if !filter.Untagged && filter.TagPrefix == "" && filter.PushedBefore.IsZero() {
+    return 0, errors.New("The filter of the images to delete is empty")
+  }
+  images, err := client.ListImages(ctx, repositoryName)
+  if err != nil {
+    return 0, err
+  }
+  var imageIds []*ecr.ImageIdentifier
+  for _, image := range images {
+    if filter.matches(image) {
+      imageIds = append(imageIds, &ecr.ImageIdentifier{
+        ImageDigest: aws.String(image.Digest),
+      })
+    }
+  }
+  deleted := 0
+  for start := 0; start < len(imageIds); start += 100 {
+    end := start + 100
+    if end > len(imageIds) {
+      end = len(imageIds)
+    }
+    result, err := client.ECR.BatchDeleteImageWithContext(ctx, &ecr.BatchDeleteImageInput{
+      ImageIds: imageIds[start:end],
+      RepositoryName: aws.String(repositoryName),
+    })
+    if err != nil {
+      return deleted, err
+    }
+    deleted += len(result.ImageIds)
+    if len(result.Failures) > 0 {
+      failure := result.Failures[0]
+      return deleted, errors.New(str.Concat("Could not delete ", strconv.Itoa(len(result.Failures)), " images of ", repositoryName, ", such as ", aws.StringValue(failure.ImageId.ImageDigest), ": ", aws.StringValue(failure.FailureReason)))
+    }
+  }
+  return deleted, nil
+}
+
+// DeleteRepository - Deletes a repository. Unless forced, a repository that still has images is not deleted
+func DeleteRepository(repositoryNameOrArn string, force bool, awsSession *session.Session) {
+  errors.QuitIfError(DeleteRepositoryE(repositoryNameOrArn, force, awsSession))
+}
+
+// DeleteRepositoryE - Deletes a repository, returning any error. Unless forced, a repository that still has images is not deleted
+func DeleteRepositoryE(repositoryNameOrArn string, force bool, awsSession *session.Session) error {
+  return DeleteRepositoryWithContext(context.Background(), repositoryNameOrArn, force, awsSession)
+}
+
+// DeleteRepositoryWithContext - DeleteRepositoryE with a context to allow cancellation
+func DeleteRepositoryWithContext(ctx context.Context, repositoryNameOrArn string, force bool, awsSession *session.Session) error {
+  return New(awsSession).DeleteRepository(ctx, repositoryNameOrArn, force)
+}
+
+// DeleteRepository - Deletes a repository given its name or ARN, returning any error. Unless forced, a repository that still has images is not deleted
+func (client *Client) DeleteRepository(ctx context.Context, repositoryNameOrArn string, force bool) error {
+  name, err := repositoryName(repositoryNameOrArn)
+  if err != nil {
+    return err
+  }
+  _, err = client.ECR.DeleteRepositoryWithContext(ctx, &ecr.DeleteRepositoryInput{
+    Force: aws.Bool(force),
+    RepositoryName: aws.String(name),
+  })
+  return err
+}
+
+// GetAuthorizationToken - Returns the registry URL and Docker credentials of the account the session is signed in to, valid for 12 hours
+func GetAuthorizationToken(awsSession *session.Session) AuthorizationToken {
+  token, err := GetAuthorizationTokenE(awsSession)
+  errors.QuitIfError(err)
+  return token
+}
+
+// GetAuthorizationTokenE - Returns the registry URL and Docker credentials of the account the session is signed in to, valid for 12 hours, or an error
+func GetAuthorizationTokenE(awsSession *session.Session) (AuthorizationToken, error) {
+  return GetAuthorizationTokenWithContext(context.Background(), awsSession)
+}
+
+// GetAuthorizationTokenWithContext - GetAuthorizationTokenE with a context to allow cancellation
+func GetAuthorizationTokenWithContext(ctx context.Context, awsSession *session.Session) (AuthorizationToken, error) {
+  return New(awsSession).GetAuthorizationToken(ctx)
+}
+
+// GetAuthorizationToken - Returns the registry URL and Docker credentials of the account the client is signed in to, valid for 12 hours, or an error
+func (client *Client) GetAuthorizationToken(ctx context.Context) (AuthorizationToken, error) {
+  result, err := client.ECR.GetAuthorizationTokenWithContext(ctx, &ecr.GetAuthorizationTokenInput{})
+  if err != nil {
+    return AuthorizationToken{}, err
+  }
+  if len(result.AuthorizationData) == 0 {
+    return AuthorizationToken{}, errors.New("ECR did not return an authorization token. Are your AWS credentials configured?")
+  }
+  data := result.AuthorizationData[0]
+  decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+  if err != nil {
+    return AuthorizationToken{}, err
+  }
+  credentials := strings.SplitN(string(decoded), ":", 2)
+  if len(credentials) != 2 {
+    return AuthorizationToken{}, errors.New("The ECR authorization token is not of the form <username>:<password>")
+  }
+  return AuthorizationToken{
+    ExpiresAt: aws.TimeValue(data.ExpiresAt),
+    Password: credentials[1],
+    Url: strings.TrimPrefix(aws.StringValue(data.ProxyEndpoint), "https://"),
+    Username: credentials[0],
+  }, nil
+}
+
 // GetUrl - Returns the URL of your ECR repository
 func GetUrl() (string, error) {
-  output, err := commands.Run("aws ecr get-login", "")
-  errors.LogIfError(err)
-  words := strings.Split(output, " ")
-  url := words[len(words) - 1]
-  if strings.HasPrefix(url, "https://") {
-    return strings.TrimLeft(url, "https://"), nil
-  } else {
-    return "", errors.New("URL not found. Are your AWS credentials configured?")
+  return GetUrlWithContext(context.Background())
+}
+
+// GetUrlWithContext - GetUrl with a context to allow cancellation
+func GetUrlWithContext(ctx context.Context) (string, error) {
+  awsSession, err := sharedConfigSession("")
+  if err != nil {
+    return "", err
+  }
+  return New(awsSession).GetUrl(ctx)
+}
+
+// GetUrl - Returns the host of the registry of the account the client is signed in to, such as 123456789012.dkr.ecr.us-east-1.amazonaws.com
+func (client *Client) GetUrl(ctx context.Context) (string, error) {
+  token, err := client.GetAuthorizationToken(ctx)
+  if err != nil {
+    return "", err
   }
+  return token.Url, nil
+}
+
+// ListImages - Returns the images of a repository, most recently pushed first
+func ListImages(repositoryName string, awsSession *session.Session) []Image {
+  images, err := ListImagesE(repositoryName, awsSession)
+  errors.QuitIfError(err)
+  return images
+}
+
+// ListImagesE - Returns the images of a repository, most recently pushed first, or an error
+func ListImagesE(repositoryName string, awsSession *session.Session) ([]Image, error) {
+  return ListImagesWithContext(context.Background(), repositoryName, awsSession)
+}
+
+// ListImagesWithContext - ListImagesE with a context to allow cancellation
+func ListImagesWithContext(ctx context.Context, repositoryName string, awsSession *session.Session) ([]Image, error) {
+  return New(awsSession).ListImages(ctx, repositoryName)
+}
+
+// ListImages - Returns the images of a repository with their tags, digests and push dates, most recently pushed first, or an error
+func (client *Client) ListImages(ctx context.Context, repositoryName string) ([]Image, error) {
+  var images []Image
+  err := client.ECR.DescribeImagesPagesWithContext(ctx, &ecr.DescribeImagesInput{
+    RepositoryName: aws.String(repositoryName),
+  }, func(page *ecr.DescribeImagesOutput, lastPage bool) bool {
+    for _, detail := range page.ImageDetails {
+      images = append(images, Image{
+        Digest: aws.StringValue(detail.ImageDigest),
+        PushedAt: aws.TimeValue(detail.ImagePushedAt),
+        SizeBytes: aws.Int64Value(detail.ImageSizeInBytes),
+        Tags: aws.StringValueSlice(detail.ImageTags),
+      })
+    }
+    return true
+  })
+  if err != nil {
+    return nil, err
+  }
+  sort.SliceStable(images, func(i, j int) bool {
+    return images[i].PushedAt.After(images[j].PushedAt)
+  })
+  return images, nil
 }
 
 // Login - 
 func Login(region string) {
-  output, err := commands.Run(str.Concat("aws ecr get-login --no-include-email --region " + region), "")
-  errors.LogIfError(err)
-  commands.Run(output, "")
+  errors.LogIfError(LoginE(region))
+}
+
+// LoginE - Logs Docker in to ECR for the given region, returning any error
+func LoginE(region string) error {
+  return LoginWithContext(context.Background(), region)
+}
+
+// LoginWithContext - LoginE with a context to allow cancellation
+func LoginWithContext(ctx context.Context, region string) error {
+  awsSession, err := sharedConfigSession(region)
+  if err != nil {
+    return err
+  }
+  return New(awsSession).Login(ctx)
+}
+
+// Login - Logs Docker in to the registry of the account the client is signed in to, returning any error.
+// The password is piped to `docker login --password-stdin` so it never shows up in the process list
+func (client *Client) Login(ctx context.Context) error {
+  token, err := client.GetAuthorizationToken(ctx)
+  if err != nil {
+    return err
+  }
+  _, err = commands.RunWithStdinContext(ctx, str.Concat("docker login --username ", token.Username, " --password-stdin ", token.Url), token.Password, "")
+  if err != nil {
+    return errors.New(str.Concat("Docker could not log in to ", token.Url, ": ", err.Error()))
+  }
+  return nil
+}
+
+// PutLifecyclePolicy - Replaces the lifecycle policy of a repository
+func PutLifecyclePolicy(repositoryName string, policy LifecyclePolicy, awsSession *session.Session) {
+  errors.QuitIfError(PutLifecyclePolicyE(repositoryName, policy, awsSession))
+}
+
+// PutLifecyclePolicyE - Replaces the lifecycle policy of a repository, returning any error
+func PutLifecyclePolicyE(repositoryName string, policy LifecyclePolicy, awsSession *session.Session) error {
+  return PutLifecyclePolicyWithContext(context.Background(), repositoryName, policy, awsSession)
+}
+
+// PutLifecyclePolicyWithContext - PutLifecyclePolicyE with a context to allow cancellation
+func PutLifecyclePolicyWithContext(ctx context.Context, repositoryName string, policy LifecyclePolicy, awsSession *session.Session) error {
+  return New(awsSession).PutLifecyclePolicy(ctx, repositoryName, policy)
+}
+
+// PutLifecyclePolicy - Replaces the lifecycle policy of a repository, returning any error. A policy without rules is refused
+func (client *Client) PutLifecyclePolicy(ctx context.Context, repositoryName string, policy LifecyclePolicy) error {
+  text, err := policy.text()
+  if err != nil {
+    return err
+  }
+  _, err = client.ECR.PutLifecyclePolicyWithContext(ctx, &ecr.PutLifecyclePolicyInput{
+    LifecyclePolicyText: aws.String(text),
+    RepositoryName: aws.String(repositoryName),
+  })
+  return err
+}
+
+// ScanImage - Scans an image for vulnerabilities, waits up to 10 minutes for the scan to complete and returns the findings
+func ScanImage(repositoryName string, tagOrDigest string, awsSession *session.Session) ScanFindings {
+  findings, err := ScanImageE(repositoryName, tagOrDigest, awsSession)
+  errors.QuitIfError(err)
+  return findings
+}
+
+// ScanImageE - Scans an image for vulnerabilities, waits up to 10 minutes for the scan to complete and returns the findings or an error
+func ScanImageE(repositoryName string, tagOrDigest string, awsSession *session.Session) (ScanFindings, error) {
+  return ScanImageWithContext(context.Background(), repositoryName, tagOrDigest, awsSession)
+}
+
+// ScanImageWithContext - ScanImageE where the context can cancel the wait or give it another deadline
+func ScanImageWithContext(ctx context.Context, repositoryName string, tagOrDigest string, awsSession *session.Session) (ScanFindings, error) {
+  return New(awsSession).ScanImage(ctx, repositoryName, tagOrDigest)
+}
+
+// ScanImage - Scans an image, given its tag or sha256: digest, polls with backoff until the scan completes and returns the findings or an error.
+// Images already scanned in the last 24 hours, and repositories using enhanced scanning, return their latest findings. Any other error starting the scan,
+// such as an invalid tag, is returned. Without a deadline on the context, it waits up to 10 minutes
+func (client *Client) ScanImage(ctx context.Context, repositoryName string, tagOrDigest string) (ScanFindings, error) {
+  imageId := &ecr.ImageIdentifier{
+    ImageTag: aws.String(tagOrDigest),
+  }
+  if strings.HasPrefix(tagOrDigest, "sha256:") {
+    imageId = &ecr.ImageIdentifier{
+      ImageDigest: aws.String(tagOrDigest),
+    }
+  }
+  _, err := client.ECR.StartImageScanWithContext(ctx, &ecr.StartImageScanInput{
+    ImageId: imageId,
+    RepositoryName: aws.String(repositoryName),
+  })
+  if err != nil && !scanNotNeeded(err) {
+    return ScanFindings{}, err
+  }
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 10 * time.Minute)
+    defer cancel()
+  }
+  input := &ecr.DescribeImageScanFindingsInput{
+    ImageId: imageId,
+    RepositoryName: aws.String(repositoryName),
+  }
+  delay := 2 * time.Second
+  for {
+    result, err := client.ECR.DescribeImageScanFindingsWithContext(ctx, input)
+    if err != nil && !isErrorCode(err, ecr.ErrCodeScanNotFoundException) {
+      return ScanFindings{}, err
+    }
+    status := ecr.ScanStatusPending
+    if err == nil {
+      status = aws.StringValue(result.ImageScanStatus.Status)
+    }
+    switch status {
+    case ecr.ScanStatusComplete, ecr.ScanStatusActive:
+      return client.scanFindings(ctx, input)
+    case ecr.ScanStatusInProgress, ecr.ScanStatusPending:
+      err = aws.SleepWithContext(ctx, delay)
+      if err != nil {
+        return ScanFindings{}, errors.New(str.Concat("The scan of ", repositoryName, ":", tagOrDigest, " did not complete: ", err.Error()))
+      }
+      delay *= 2
+      if delay > 15 * time.Second {
+        delay = 15 * time.Second
+      }
+    default:
+      return ScanFindings{}, errors.New(str.Concat("The scan of ", repositoryName, ":", tagOrDigest, " ended with ", status, ": ", aws.StringValue(result.ImageScanStatus.Description)))
+    }
+  }
+}
+
+// lifecycleRule - One rule of the JSON document ECR expects for a lifecycle policy
+type lifecycleRule struct {
+  RulePriority  int                 `json:"rulePriority"`
+  Description   string              `json:"description"`
+  Selection     lifecycleSelection  `json:"selection"`
+  Action        lifecycleAction     `json:"action"`
+}
+
+type lifecycleSelection struct {
+  TagStatus      string    `json:"tagStatus"`
+  TagPrefixList  []string  `json:"tagPrefixList,omitempty"`
+  TagPatternList []string  `json:"tagPatternList,omitempty"`
+  CountType      string    `json:"countType"`
+  CountUnit      string    `json:"countUnit,omitempty"`
+  CountNumber    int       `json:"countNumber"`
+}
+
+type lifecycleAction struct {
+  Type  string  `json:"type"`
+}
+
+// text - Returns the policy as the JSON document ECR expects, expiring untagged images first
+func (policy LifecyclePolicy) text() (string, error) {
+  var rules []lifecycleRule
+  if policy.ExpireUntaggedAfterDays > 0 {
+    rules = append(rules, lifecycleRule{
+      Description: str.Concat("Expire untagged images after ", strconv.Itoa(policy.ExpireUntaggedAfterDays), " days"),
+      Selection: lifecycleSelection{
+        TagStatus: "untagged",
+        CountType: "sinceImagePushed",
+        CountUnit: "days",
+        CountNumber: policy.ExpireUntaggedAfterDays,
+      },
+    })
+  }
+  if policy.KeepLastTagged > 0 {
+    selection := lifecycleSelection{
+      TagStatus: "tagged",
+      TagPrefixList: policy.TagPrefixes,
+      CountType: "imageCountMoreThan",
+      CountNumber: policy.KeepLastTagged,
+    }
+    if len(policy.TagPrefixes) == 0 {
+      selection.TagPatternList = []string{"*"}
+    }
+    rules = append(rules, lifecycleRule{
+      Description: str.Concat("Keep the last ", strconv.Itoa(policy.KeepLastTagged), " tagged images"),
+      Selection: selection,
+    })
+  }
+  if len(rules) == 0 {
+    return "", errors.New("The lifecycle policy has no rules")
+  }
+  for i := range rules {
+    rules[i].RulePriority = i + 1
+    rules[i].Action.Type = "expire"
+  }
+  text, err := json.Marshal(map[string][]lifecycleRule{
+    "rules": rules,
+  })
+  return string(text), err
+}
+
+func (filter ImageFilter) matches(image Image) bool {
+  if filter.Untagged && len(image.Tags) > 0 {
+    return false
+  }
+  if filter.TagPrefix != "" {
+    found := false
+    for _, tag := range image.Tags {
+      found = found || strings.HasPrefix(tag, filter.TagPrefix)
+    }
+    if !found {
+      return false
+    }
+  }
+  return filter.PushedBefore.IsZero() || image.PushedAt.Before(filter.PushedBefore)
+}
+
+// scanFindings - Reads every page of the findings of a completed scan, basic or enhanced
+func (client *Client) scanFindings(ctx context.Context, input *ecr.DescribeImageScanFindingsInput) (ScanFindings, error) {
+  findings := ScanFindings{
+    SeverityCounts: map[string]int64{},
+  }
+  err := client.ECR.DescribeImageScanFindingsPagesWithContext(ctx, input, func(page *ecr.DescribeImageScanFindingsOutput, lastPage bool) bool {
+    if page.ImageScanFindings == nil {
+      return true
+    }
+    findings.CompletedAt = aws.TimeValue(page.ImageScanFindings.ImageScanCompletedAt)
+    for severity, count := range page.ImageScanFindings.FindingSeverityCounts {
+      findings.SeverityCounts[severity] = aws.Int64Value(count)
+    }
+    for _, finding := range page.ImageScanFindings.Findings {
+      result := Finding{
+        Description: aws.StringValue(finding.Description),
+        Name: aws.StringValue(finding.Name),
+        Severity: aws.StringValue(finding.Severity),
+        Uri: aws.StringValue(finding.Uri),
+      }
+      for _, attribute := range finding.Attributes {
+        switch aws.StringValue(attribute.Key) {
+        case "package_name":
+          result.Package = aws.StringValue(attribute.Value)
+        case "package_version":
+          result.PackageVersion = aws.StringValue(attribute.Value)
+        }
+      }
+      findings.Findings = append(findings.Findings, result)
+    }
+    for _, finding := range page.ImageScanFindings.EnhancedFindings {
+      result := Finding{
+        Description: aws.StringValue(finding.Description),
+        Name: aws.StringValue(finding.Title),
+        Severity: aws.StringValue(finding.Severity),
+      }
+      if details := finding.PackageVulnerabilityDetails; details != nil {
+        result.Name = aws.StringValue(details.VulnerabilityId)
+        result.Uri = aws.StringValue(details.SourceUrl)
+        if len(details.VulnerablePackages) > 0 {
+          result.Package = aws.StringValue(details.VulnerablePackages[0].Name)
+          result.PackageVersion = aws.StringValue(details.VulnerablePackages[0].Version)
+        }
+      }
+      findings.Findings = append(findings.Findings, result)
+    }
+    return true
+  })
+  return findings, err
+}
+
+func severityRank(severity string) int {
+  for rank, candidate := range severities {
+    if candidate == severity {
+      return rank
+    }
+  }
+  return -1
+}
+
+// scanNotNeeded - Checks whether a scan failed to start only because the image already has findings to return: it was scanned in the
+// last 24 hours, which ECR reports as its scan quota being exceeded, or the registry uses enhanced scanning, which scans continuously
+func scanNotNeeded(err error) bool {
+  awsErr, ok := err.(awserr.Error)
+  if !ok {
+    return false
+  }
+  message := strings.ToLower(awsErr.Message())
+  switch awsErr.Code() {
+  case ecr.ErrCodeLimitExceededException:
+    return strings.Contains(message, "scan quota")
+  case ecr.ErrCodeValidationException:
+    return strings.Contains(message, "enhanced") || strings.Contains(message, "scan quota")
+  }
+  return false
+}
+
+func isErrorCode(err error, code string) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == code
+}
+
+// repositoryName - Returns the name of a repository given its name or ARN (arn:aws:ecr:<region>:<account>:repository/<name>),
+// or an error for an ARN of anything else
+func repositoryName(nameOrArn string) (string, error) {
+  if !strings.HasPrefix(nameOrArn, "arn:") {
+    return nameOrArn, nil
+  }
+  index := strings.Index(nameOrArn, ":repository/")
+  if index < 0 {
+    return "", errors.New(str.Concat("The ARN ", nameOrArn, " is not the ARN of an ECR repository"))
+  }
+  return nameOrArn[index + len(":repository/"):], nil
+}
+
+// sharedConfigSession - Returns a session configured like the AWS CLI, in the given region when not empty
+func sharedConfigSession(region string) (*session.Session, error) {
+  options := session.Options{
+    SharedConfigState: session.SharedConfigEnable,
+  }
+  if region != "" {
+    options.Config.Region = aws.String(region)
+  }
+  return session.NewSessionWithOptions(options)
 }
@@ -0,0 +1,167 @@
+package ecr
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  "github.com/PyramidSystemsInc/go/aws/ecr/ecrfake"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
+  awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// TestGetAuthorizationToken decodes the token of the in-memory fake into the registry URL and credentials.
+func TestGetAuthorizationToken(t *testing.T) {
+  client := &Client{ECR: ecrfake.New()}
+
+  token, err := client.GetAuthorizationToken(context.Background())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if token.Url != "123456789012.dkr.ecr.us-east-1.amazonaws.com" || token.Username != "AWS" || token.Password != "fake-password" {
+    t.Errorf("expected the registry of the account and the AWS user, got %s and %s", token.Url, token.Username)
+  }
+  if token.ExpiresAt.Before(time.Now()) {
+    t.Errorf("expected a token that has not expired, got %s", token.ExpiresAt)
+  }
+  url, err := client.GetUrl(context.Background())
+  if err != nil || url != token.Url {
+    t.Errorf("expected GetUrl to return %s, got %s (%v)", token.Url, url, err)
+  }
+}
+
+// TestRepositoryLifecycle creates a repository twice, applies a lifecycle policy, deletes old untagged images
+// and force deletes the repository against the in-memory fake.
+func TestRepositoryLifecycle(t *testing.T) {
+  ctx := context.Background()
+  fake := ecrfake.New()
+  fake.PageSize = 2
+  client := &Client{ECR: fake}
+
+  uri, err := client.CreateRepository(ctx, "test-app", RepositoryOptions{
+    ImmutableTags: true,
+    ScanOnPush: true,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  again, err := client.CreateRepository(ctx, "test-app", RepositoryOptions{})
+  if err != nil || again != uri || uri != "123456789012.dkr.ecr.us-east-1.amazonaws.com/test-app" {
+    t.Errorf("expected the same URI twice, got %s and %s (%v)", uri, again, err)
+  }
+  if repository := fake.Repositories["test-app"]; *repository.ImageTagMutability != "IMMUTABLE" || !*repository.ImageScanningConfiguration.ScanOnPush {
+    t.Errorf("expected an immutable repository scanned on push, got %+v", repository)
+  }
+
+  err = client.PutLifecyclePolicy(ctx, "test-app", LifecyclePolicy{
+    ExpireUntaggedAfterDays: 14,
+    KeepLastTagged: 10,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  expected := `{"rules":[` +
+    `{"rulePriority":1,"description":"Expire untagged images after 14 days","selection":{"tagStatus":"untagged","countType":"sinceImagePushed","countUnit":"days","countNumber":14},"action":{"type":"expire"}},` +
+    `{"rulePriority":2,"description":"Keep the last 10 tagged images","selection":{"tagStatus":"tagged","tagPatternList":["*"],"countType":"imageCountMoreThan","countNumber":10},"action":{"type":"expire"}}]}`
+  if fake.LifecyclePolicies["test-app"] != expected {
+    t.Errorf("expected the policy %s, got %s", expected, fake.LifecyclePolicies["test-app"])
+  }
+  if client.PutLifecyclePolicy(ctx, "test-app", LifecyclePolicy{}) == nil {
+    t.Error("expected a policy without rules to be refused")
+  }
+
+  now := time.Now()
+  fake.PushImage("test-app", "sha256:1", now.Add(-72 * time.Hour), "v1")
+  fake.PushImage("test-app", "sha256:2", now.Add(-48 * time.Hour), "latest")
+  fake.PushImage("test-app", "sha256:3", now.Add(-24 * time.Hour), "v2", "latest")
+  fake.PushImage("test-app", "sha256:4", now)
+  images, err := client.ListImages(ctx, "test-app")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(images) != 4 || images[0].Digest != "sha256:4" || len(images[1].Tags) != 2 || len(images[2].Tags) != 0 {
+    t.Errorf("expected 4 images, newest first, with latest moved to sha256:3, got %+v", images)
+  }
+  if _, err = client.DeleteImages(ctx, "test-app", ImageFilter{}); err == nil {
+    t.Error("expected an empty filter to be refused")
+  }
+  deleted, err := client.DeleteImages(ctx, "test-app", ImageFilter{
+    PushedBefore: now.Add(-time.Hour),
+    Untagged: true,
+  })
+  if err != nil || deleted != 1 || len(fake.Images["test-app"]) != 3 {
+    t.Errorf("expected only sha256:2 to be deleted, deleted %d (%v)", deleted, err)
+  }
+
+  err = client.DeleteRepository(ctx, "arn:aws:ecr:us-east-1:123456789012:test-app", true)
+  if err == nil || len(fake.Repositories) != 1 {
+    t.Errorf("expected an ARN that is not a repository's to be refused, got %v", err)
+  }
+  err = client.DeleteRepository(ctx, "arn:aws:ecr:us-east-1:123456789012:repository/test-app", true)
+  if err != nil || len(fake.Repositories) != 0 {
+    t.Errorf("expected the repository to be deleted by ARN, got %v", err)
+  }
+}
+
+// TestScanImage scans an image twice against the in-memory fake and gates it on HIGH findings.
+func TestScanImage(t *testing.T) {
+  ctx := context.Background()
+  fake := ecrfake.New()
+  fake.PageSize = 1
+  client := &Client{ECR: fake}
+  _, err := client.CreateRepository(ctx, "test-app", RepositoryOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  fake.PushImage("test-app", "sha256:1", time.Now(), "v1")
+  fake.Vulnerabilities["sha256:1"] = []*awsecr.ImageScanFinding{
+    {
+      Attributes: []*awsecr.Attribute{
+        {Key: aws.String("package_name"), Value: aws.String("curl")},
+        {Key: aws.String("package_version"), Value: aws.String("7.64.0")},
+      },
+      Name: aws.String("CVE-2019-5436"),
+      Severity: aws.String("HIGH"),
+    },
+    {
+      Name: aws.String("CVE-2019-3823"),
+      Severity: aws.String("MEDIUM"),
+    },
+  }
+
+  findings, err := client.ScanImage(ctx, "test-app", "v1")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(findings.Findings) != 2 || findings.SeverityCounts["HIGH"] != 1 || findings.Findings[0].Package != "curl" || findings.Findings[0].PackageVersion != "7.64.0" {
+    t.Errorf("expected both findings with the package of the first, got %+v", findings)
+  }
+  again, err := client.ScanImage(ctx, "test-app", "sha256:1")
+  if err != nil || len(again.Findings) != 2 {
+    t.Errorf("expected an image scanned today to return its latest findings, got %+v (%v)", again, err)
+  }
+
+  if err = CheckSeverity(findings, "CRITICAL"); err != nil {
+    t.Errorf("expected no CRITICAL findings, got %v", err)
+  }
+  err = CheckSeverity(findings, "MEDIUM")
+  if err == nil || err.Error() != "The image has 1 HIGH, 1 MEDIUM vulnerabilities: CVE-2019-5436, CVE-2019-3823" {
+    t.Errorf("expected the HIGH and MEDIUM findings, got %v", err)
+  }
+  _, err = client.ScanImage(ctx, "test-app", "v1:latest")
+  if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != awsecr.ErrCodeValidationException {
+    t.Errorf("expected the validation error of an invalid tag, got %v", err)
+  }
+
+  untriaged := ScanFindings{
+    SeverityCounts: map[string]int64{"UNTRIAGED": 1},
+    Findings: []Finding{{Name: "CVE-2024-0001", Severity: "UNTRIAGED"}},
+  }
+  if CheckSeverity(untriaged, "INFORMATIONAL") != nil || CheckSeverity(untriaged, "UNTRIAGED") == nil {
+    t.Error("expected UNTRIAGED findings to count only at the UNTRIAGED and UNDEFINED thresholds")
+  }
+  if CheckSeverity(findings, "SEVERE") == nil {
+    t.Error("expected an unknown threshold to be refused")
+  }
+}
@@ -0,0 +1,454 @@
+// Package ecsfake is an in-memory stand-in for the parts of the ECS API used by the
+// github.com/PyramidSystemsInc/go/aws/ecs package, so it can be unit tested offline.
+package ecsfake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+)
+
+// ECS keeps clusters, task definitions, tasks and services in memory. Tasks started with RunTask are
+// immediately RUNNING with an ENI named eni-<n>, and services settle on their desired count as soon as
+// they are created or updated. Calling an operation that is not implemented panics.
+type ECS struct {
+	ecsiface.ECSAPI
+
+	mutex           sync.Mutex
+	counter         int
+	Region          string
+	AccountID       string
+	Clusters        map[string]*ecs.Cluster
+	TaskDefinitions map[string]*ecs.TaskDefinition
+	Tasks           map[string]*ecs.Task
+	Tags            map[string][]*ecs.Tag
+	// Services are keyed by service ARN.
+	Services map[string]*ecs.Service
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *ECS {
+	return &ECS{
+		Region:          "us-east-1",
+		AccountID:       "123456789012",
+		Clusters:        map[string]*ecs.Cluster{},
+		TaskDefinitions: map[string]*ecs.TaskDefinition{},
+		Tasks:           map[string]*ecs.Task{},
+		Tags:            map[string][]*ecs.Tag{},
+		Services:        map[string]*ecs.Service{},
+	}
+}
+
+// CreateClusterWithContext creates (or returns the existing) cluster.
+func (fake *ECS) CreateClusterWithContext(ctx aws.Context, input *ecs.CreateClusterInput, opts ...request.Option) (*ecs.CreateClusterOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.ClusterName)
+	cluster, ok := fake.Clusters[name]
+	if !ok {
+		cluster = &ecs.Cluster{
+			ClusterArn:  aws.String(fake.arn("cluster/" + name)),
+			ClusterName: aws.String(name),
+			Status:      aws.String("ACTIVE"),
+		}
+		fake.Clusters[name] = cluster
+	}
+	return &ecs.CreateClusterOutput{
+		Cluster: cluster,
+	}, nil
+}
+
+// DeleteClusterWithContext deletes a cluster that has no running tasks.
+func (fake *ECS) DeleteClusterWithContext(ctx aws.Context, input *ecs.DeleteClusterInput, opts ...request.Option) (*ecs.DeleteClusterOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	cluster, err := fake.cluster(input.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range fake.Tasks {
+		if aws.StringValue(task.ClusterArn) == aws.StringValue(cluster.ClusterArn) && aws.StringValue(task.LastStatus) != "STOPPED" {
+			return nil, awserr.New(ecs.ErrCodeClusterContainsTasksException, "The Cluster cannot be deleted while Tasks are active.", nil)
+		}
+	}
+	delete(fake.Clusters, aws.StringValue(cluster.ClusterName))
+	cluster.Status = aws.String("INACTIVE")
+	return &ecs.DeleteClusterOutput{
+		Cluster: cluster,
+	}, nil
+}
+
+// ListClustersWithContext returns the ARNs of every cluster.
+func (fake *ECS) ListClustersWithContext(ctx aws.Context, input *ecs.ListClustersInput, opts ...request.Option) (*ecs.ListClustersOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var arns []*string
+	for _, cluster := range fake.Clusters {
+		arns = append(arns, cluster.ClusterArn)
+	}
+	return &ecs.ListClustersOutput{
+		ClusterArns: arns,
+	}, nil
+}
+
+// RegisterTaskDefinitionWithContext stores a new revision of the task definition family.
+func (fake *ECS) RegisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.RegisterTaskDefinitionInput, opts ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	family := aws.StringValue(input.Family)
+	var revision int64 = 1
+	for _, taskDefinition := range fake.TaskDefinitions {
+		if aws.StringValue(taskDefinition.Family) == family && aws.Int64Value(taskDefinition.Revision) >= revision {
+			revision = aws.Int64Value(taskDefinition.Revision) + 1
+		}
+	}
+	taskDefinition := &ecs.TaskDefinition{
+		ContainerDefinitions:    input.ContainerDefinitions,
+		Cpu:                     input.Cpu,
+		ExecutionRoleArn:        input.ExecutionRoleArn,
+		Family:                  input.Family,
+		Memory:                  input.Memory,
+		NetworkMode:             input.NetworkMode,
+		RequiresCompatibilities: input.RequiresCompatibilities,
+		Revision:                aws.Int64(revision),
+		Status:                  aws.String("ACTIVE"),
+		TaskDefinitionArn:       aws.String(fake.arn(fmt.Sprintf("task-definition/%s:%d", family, revision))),
+		TaskRoleArn:             input.TaskRoleArn,
+	}
+	fake.TaskDefinitions[aws.StringValue(taskDefinition.TaskDefinitionArn)] = taskDefinition
+	return &ecs.RegisterTaskDefinitionOutput{
+		TaskDefinition: taskDefinition,
+	}, nil
+}
+
+// DeregisterTaskDefinitionWithContext marks a task definition revision INACTIVE.
+func (fake *ECS) DeregisterTaskDefinitionWithContext(ctx aws.Context, input *ecs.DeregisterTaskDefinitionInput, opts ...request.Option) (*ecs.DeregisterTaskDefinitionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	taskDefinition, err := fake.taskDefinition(input.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	taskDefinition.Status = aws.String("INACTIVE")
+	return &ecs.DeregisterTaskDefinitionOutput{
+		TaskDefinition: taskDefinition,
+	}, nil
+}
+
+// DescribeTaskDefinitionWithContext returns a task definition by ARN, family:revision or family (the latest active revision).
+func (fake *ECS) DescribeTaskDefinitionWithContext(ctx aws.Context, input *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	taskDefinition, err := fake.taskDefinition(input.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	return &ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: taskDefinition,
+	}, nil
+}
+
+// RunTaskWithContext starts one task of the task definition in the cluster.
+func (fake *ECS) RunTaskWithContext(ctx aws.Context, input *ecs.RunTaskInput, opts ...request.Option) (*ecs.RunTaskOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	cluster, err := fake.cluster(input.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	taskDefinition, err := fake.taskDefinition(input.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	fake.counter++
+	task := &ecs.Task{
+		Attachments: []*ecs.Attachment{
+			{
+				Details: []*ecs.KeyValuePair{
+					{
+						Name:  aws.String("networkInterfaceId"),
+						Value: aws.String(fmt.Sprintf("eni-%d", fake.counter)),
+					},
+					{
+						Name:  aws.String("privateIPv4Address"),
+						Value: aws.String(fmt.Sprintf("10.0.0.%d", fake.counter)),
+					},
+				},
+				Status: aws.String("ATTACHED"),
+				Type:   aws.String("ElasticNetworkInterface"),
+			},
+		},
+		ClusterArn:        cluster.ClusterArn,
+		DesiredStatus:     aws.String("RUNNING"),
+		LastStatus:        aws.String("RUNNING"),
+		LaunchType:        input.LaunchType,
+		TaskArn:           aws.String(fake.arn(fmt.Sprintf("task/%s/%d", aws.StringValue(cluster.ClusterName), fake.counter))),
+		TaskDefinitionArn: taskDefinition.TaskDefinitionArn,
+	}
+	fake.Tasks[aws.StringValue(task.TaskArn)] = task
+	return &ecs.RunTaskOutput{
+		Tasks: []*ecs.Task{
+			task,
+		},
+	}, nil
+}
+
+// DescribeTasksWithContext returns the requested tasks, reporting unknown ones as failures.
+func (fake *ECS) DescribeTasksWithContext(ctx aws.Context, input *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	output := &ecs.DescribeTasksOutput{}
+	for _, arn := range input.Tasks {
+		task, ok := fake.Tasks[aws.StringValue(arn)]
+		if ok {
+			output.Tasks = append(output.Tasks, task)
+		} else {
+			output.Failures = append(output.Failures, &ecs.Failure{
+				Arn:    arn,
+				Reason: aws.String("MISSING"),
+			})
+		}
+	}
+	return output, nil
+}
+
+// ListTasksWithContext returns the ARNs of the tasks in the cluster that are not stopped.
+func (fake *ECS) ListTasksWithContext(ctx aws.Context, input *ecs.ListTasksInput, opts ...request.Option) (*ecs.ListTasksOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	cluster, err := fake.cluster(input.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	var arns []*string
+	for arn, task := range fake.Tasks {
+		if aws.StringValue(task.ClusterArn) == aws.StringValue(cluster.ClusterArn) && aws.StringValue(task.LastStatus) != "STOPPED" {
+			arns = append(arns, aws.String(arn))
+		}
+	}
+	return &ecs.ListTasksOutput{
+		TaskArns: arns,
+	}, nil
+}
+
+// StopTaskWithContext stops a task, recording the reason.
+func (fake *ECS) StopTaskWithContext(ctx aws.Context, input *ecs.StopTaskInput, opts ...request.Option) (*ecs.StopTaskOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	task, ok := fake.Tasks[aws.StringValue(input.Task)]
+	if !ok {
+		return nil, awserr.New(ecs.ErrCodeInvalidParameterException, "The referenced task was not found.", nil)
+	}
+	task.DesiredStatus = aws.String("STOPPED")
+	task.LastStatus = aws.String("STOPPED")
+	task.StoppedReason = input.Reason
+	return &ecs.StopTaskOutput{
+		Task: task,
+	}, nil
+}
+
+// TagResourceWithContext adds tags to any ARN.
+func (fake *ECS) TagResourceWithContext(ctx aws.Context, input *ecs.TagResourceInput, opts ...request.Option) (*ecs.TagResourceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	arn := aws.StringValue(input.ResourceArn)
+	fake.Tags[arn] = append(fake.Tags[arn], input.Tags...)
+	return &ecs.TagResourceOutput{}, nil
+}
+
+// CreateServiceWithContext creates an ACTIVE service already running its desired number of tasks.
+func (fake *ECS) CreateServiceWithContext(ctx aws.Context, input *ecs.CreateServiceInput, opts ...request.Option) (*ecs.CreateServiceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	cluster, err := fake.cluster(input.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	taskDefinition, err := fake.taskDefinition(input.TaskDefinition)
+	if err != nil {
+		return nil, err
+	}
+	arn := fake.arn("service/" + aws.StringValue(cluster.ClusterName) + "/" + aws.StringValue(input.ServiceName))
+	if service, ok := fake.Services[arn]; ok && aws.StringValue(service.Status) != "INACTIVE" {
+		return nil, awserr.New(ecs.ErrCodeInvalidParameterException, "Creation of service was not idempotent.", nil)
+	}
+	service := &ecs.Service{
+		ClusterArn:                    cluster.ClusterArn,
+		DesiredCount:                  input.DesiredCount,
+		HealthCheckGracePeriodSeconds: input.HealthCheckGracePeriodSeconds,
+		LaunchType:                    input.LaunchType,
+		LoadBalancers:                 input.LoadBalancers,
+		NetworkConfiguration:          input.NetworkConfiguration,
+		ServiceArn:                    aws.String(arn),
+		ServiceName:                   input.ServiceName,
+		Status:                        aws.String("ACTIVE"),
+		TaskDefinition:                taskDefinition.TaskDefinitionArn,
+	}
+	fake.deploy(service)
+	fake.Services[arn] = service
+	return &ecs.CreateServiceOutput{
+		Service: service,
+	}, nil
+}
+
+// UpdateServiceWithContext changes the desired count and/or task definition of a service.
+func (fake *ECS) UpdateServiceWithContext(ctx aws.Context, input *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	service, err := fake.service(input.Cluster, input.Service)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(service.Status) != "ACTIVE" {
+		return nil, awserr.New(ecs.ErrCodeServiceNotActiveException, "Service was not ACTIVE.", nil)
+	}
+	if input.DesiredCount != nil {
+		service.DesiredCount = input.DesiredCount
+	}
+	if input.TaskDefinition != nil {
+		taskDefinition, err := fake.taskDefinition(input.TaskDefinition)
+		if err != nil {
+			return nil, err
+		}
+		service.TaskDefinition = taskDefinition.TaskDefinitionArn
+	}
+	fake.deploy(service)
+	return &ecs.UpdateServiceOutput{
+		Service: service,
+	}, nil
+}
+
+// DescribeServicesWithContext describes services, reporting the missing ones as failures.
+func (fake *ECS) DescribeServicesWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	output := &ecs.DescribeServicesOutput{}
+	for _, name := range input.Services {
+		service, err := fake.service(input.Cluster, name)
+		if err != nil {
+			output.Failures = append(output.Failures, &ecs.Failure{
+				Arn:    name,
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		output.Services = append(output.Services, service)
+	}
+	return output, nil
+}
+
+// DeleteServiceWithContext marks a service scaled to zero (or deleted with Force) INACTIVE.
+func (fake *ECS) DeleteServiceWithContext(ctx aws.Context, input *ecs.DeleteServiceInput, opts ...request.Option) (*ecs.DeleteServiceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	service, err := fake.service(input.Cluster, input.Service)
+	if err != nil {
+		return nil, err
+	}
+	if aws.Int64Value(service.DesiredCount) > 0 && !aws.BoolValue(input.Force) {
+		return nil, awserr.New(ecs.ErrCodeInvalidParameterException, "The service cannot be stopped while it is scaled above 0.", nil)
+	}
+	service.DesiredCount = aws.Int64(0)
+	fake.deploy(service)
+	service.Status = aws.String("INACTIVE")
+	return &ecs.DeleteServiceOutput{
+		Service: service,
+	}, nil
+}
+
+// WaitUntilServicesStableWithContext succeeds when every service is ACTIVE with one deployment running its desired count.
+func (fake *ECS) WaitUntilServicesStableWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.WaiterOption) error {
+	return fake.waitForServices(input, func(service *ecs.Service) bool {
+		return aws.StringValue(service.Status) == "ACTIVE" && len(service.Deployments) == 1 && aws.Int64Value(service.RunningCount) == aws.Int64Value(service.DesiredCount)
+	})
+}
+
+// WaitUntilServicesInactiveWithContext succeeds when every service is INACTIVE.
+func (fake *ECS) WaitUntilServicesInactiveWithContext(ctx aws.Context, input *ecs.DescribeServicesInput, opts ...request.WaiterOption) error {
+	return fake.waitForServices(input, func(service *ecs.Service) bool {
+		return aws.StringValue(service.Status) == "INACTIVE"
+	})
+}
+
+func (fake *ECS) waitForServices(input *ecs.DescribeServicesInput, ready func(*ecs.Service) bool) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	for _, name := range input.Services {
+		service, err := fake.service(input.Cluster, name)
+		if err != nil || !ready(service) {
+			return awserr.New(request.WaiterResourceNotReadyErrorCode, "failed waiting for successful resource state", err)
+		}
+	}
+	return nil
+}
+
+// deploy replaces the deployments of a service with one that already runs the desired count.
+func (fake *ECS) deploy(service *ecs.Service) {
+	fake.counter++
+	service.RunningCount = service.DesiredCount
+	service.PendingCount = aws.Int64(0)
+	service.Deployments = []*ecs.Deployment{
+		{
+			DesiredCount:   service.DesiredCount,
+			Id:             aws.String(fmt.Sprintf("ecs-svc/%d", fake.counter)),
+			RolloutState:   aws.String(ecs.DeploymentRolloutStateCompleted),
+			RunningCount:   service.DesiredCount,
+			Status:         aws.String("PRIMARY"),
+			TaskDefinition: service.TaskDefinition,
+		},
+	}
+}
+
+func (fake *ECS) arn(resource string) string {
+	return fmt.Sprintf("arn:aws:ecs:%s:%s:%s", fake.Region, fake.AccountID, resource)
+}
+
+func (fake *ECS) cluster(nameOrArn *string) (*ecs.Cluster, error) {
+	name := aws.StringValue(nameOrArn)
+	if name == "" {
+		name = "default"
+	}
+	cluster, ok := fake.Clusters[name[strings.LastIndex(name, "/")+1:]]
+	if !ok {
+		return nil, awserr.New(ecs.ErrCodeClusterNotFoundException, "Cluster not found.", nil)
+	}
+	return cluster, nil
+}
+
+func (fake *ECS) taskDefinition(familyOrArn *string) (*ecs.TaskDefinition, error) {
+	name := aws.StringValue(familyOrArn)
+	var latest *ecs.TaskDefinition
+	for arn, taskDefinition := range fake.TaskDefinitions {
+		if arn == name || strings.HasSuffix(arn, "/"+name) {
+			return taskDefinition, nil
+		}
+		if aws.StringValue(taskDefinition.Family) == name && aws.StringValue(taskDefinition.Status) == "ACTIVE" {
+			if latest == nil || aws.Int64Value(taskDefinition.Revision) > aws.Int64Value(latest.Revision) {
+				latest = taskDefinition
+			}
+		}
+	}
+	if latest == nil {
+		return nil, awserr.New(ecs.ErrCodeClientException, "Unable to describe task definition.", nil)
+	}
+	return latest, nil
+}
+
+func (fake *ECS) service(clusterNameOrArn *string, serviceNameOrArn *string) (*ecs.Service, error) {
+	cluster, err := fake.cluster(clusterNameOrArn)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(serviceNameOrArn)
+	service, ok := fake.Services[fake.arn("service/"+aws.StringValue(cluster.ClusterName)+"/"+name[strings.LastIndex(name, "/")+1:])]
+	if !ok {
+		return nil, awserr.New(ecs.ErrCodeServiceNotFoundException, "Service not found.", nil)
+	}
+	return service, nil
+}
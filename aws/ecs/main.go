@@ -1,205 +1,1105 @@
 package ecs
 
 import (
+  "context"
+  "sort"
+  "strconv"
   "strings"
   "time"
   "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/request"
   "github.com/aws/aws-sdk-go/aws/session"
+  awsec2 "github.com/aws/aws-sdk-go/service/ec2"
   "github.com/aws/aws-sdk-go/service/ecs"
+  "github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+  "github.com/PyramidSystemsInc/go/aws/cloudwatchlogs"
   "github.com/PyramidSystemsInc/go/aws/ec2"
   "github.com/PyramidSystemsInc/go/aws/ecr"
+  "github.com/PyramidSystemsInc/go/aws/iam"
   "github.com/PyramidSystemsInc/go/aws/util"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/logger"
   "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Registers Fargate task definitions and runs tasks and services on ECS. Networks are resolved through EC2,
+// images through ECR, the execution role through IAM and task logs through Logs
+type Client struct {
+  ECS ecsiface.ECSAPI
+  EC2 *ec2.Client
+  ECR *ecr.Client
+  IAM *iam.Client
+  Logs *cloudwatchlogs.Client
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    ECS: ecs.New(awsSession),
+    EC2: ec2.New(awsSession),
+    ECR: ecr.New(awsSession),
+    IAM: iam.New(awsSession),
+    Logs: cloudwatchlogs.New(awsSession),
+  }
+}
+
 type Container struct {
-  EnvironmentVars  map[string]string
-  Essential        bool
-  ImageName        string
-  Name             string
+  EnvironmentVars    map[string]string
+  Essential          bool
+  // ImageName - Name of an image in your ECR registry, or a fully-qualified image such as docker.io/library/nginx:1.17
+  ImageName          string
+  Name               string
+  // Cpu - CPU units reserved for the container. Zero leaves it unreserved
+  Cpu                int64
+  // Memory - Hard memory limit in MiB. Zero leaves the container limited by the task only
+  Memory             int64
+  // MemoryReservation - Soft memory limit in MiB
+  MemoryReservation  int64
+  PortMappings       []PortMapping
+  Command            []string
+  EntryPoint         []string
+  // Secrets - Environment variable names mapped to the ARN (or SSM parameter name) of the secret holding their value
+  Secrets            map[string]string
+  HealthCheck        *HealthCheck
+  // DependsOn - Containers that must reach a condition before this one starts
+  DependsOn          []ContainerDependency
+  // Logs - Overrides the log configuration of the task definition options for this container
+  Logs               *AwsLogs
+}
+
+// PortMapping - A port of the container. With Fargate the host port always equals the container port
+type PortMapping struct {
+  ContainerPort  int64
+  // Protocol - tcp or udp. Defaults to tcp
+  Protocol       string
+}
+
+// HealthCheck - Command Docker runs in the container to decide whether it is healthy
+type HealthCheck struct {
+  // Command - Such as []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"}
+  Command      []string
+  // Interval, Timeout, StartPeriod - Rounded down to whole seconds. Zero keeps the ECS default
+  Interval     time.Duration
+  Timeout      time.Duration
+  StartPeriod  time.Duration
+  // Retries - Zero keeps the ECS default
+  Retries      int64
+}
+
+// ContainerDependency - A container that must reach Condition (START, COMPLETE, SUCCESS or HEALTHY) first
+type ContainerDependency struct {
+  ContainerName  string
+  Condition      string
+}
+
+// AwsLogs - Sends the output of a container to CloudWatch Logs using the awslogs driver
+type AwsLogs struct {
+  Group         string
+  // Region - Defaults to the region of the client
+  Region        string
+  // StreamPrefix - Streams are named <prefix>/<container name>/<task ID>. Defaults to the task definition name
+  StreamPrefix  string
+  // CreateGroup - Lets the driver create the group if it does not exist
+  CreateGroup   bool
+}
+
+// TaskDefinitionOptions - Settings for RegisterCustomFargateTaskDefinition. Empty fields keep the defaults of RegisterFargateTaskDefinition
+type TaskDefinitionOptions struct {
+  // Cpu - CPU units of the task, such as 256, 512, 1024, 2048 or 4096. Defaults to 2048
+  Cpu               int64
+  // Memory - Memory of the task in MiB, which must be valid for the CPU units. Defaults to twice the CPU units,
+  // or to 16384 when the CPU units are not set either
+  Memory            int64
+  // ExecutionRoleArn - Defaults to the ecsTaskExecutionRole of the account, which is created if it does not exist
+  ExecutionRoleArn  string
+  // TaskRoleArn - Role the containers call AWS as, such as one from iam.EnsureRole with iam.TrustPolicy(iam.ServiceEcsTasks).
+  // Without one the containers have no AWS permissions
+  TaskRoleArn       string
+  // Logs - Log configuration of every container without its own
+  Logs              *AwsLogs
+}
+
+// ServiceOptions - Settings for CreateService
+type ServiceOptions struct {
+  // DesiredCount - Number of tasks to keep running. Zero creates the service without tasks
+  DesiredCount                 int64
+  // Network - Empty fields are discovered, starting from the default VPC
+  Network                      ec2.NetworkConfig
+  // LoadBalancer - Registers the tasks with an elbv2 target group when set
+  LoadBalancer                 *ServiceLoadBalancer
+  // HealthCheckGracePeriod - Time load balancer health checks are ignored after a task starts
+  HealthCheckGracePeriod       time.Duration
+}
+
+// ServiceLoadBalancer - The target group of an application load balancer and the container port registered with it.
+// The target group must use the ip target type and be attached to a load balancer
+type ServiceLoadBalancer struct {
+  TargetGroupArn  string
+  ContainerName   string
+  ContainerPort   int64
+}
+
+// LaunchOptions - Settings for LaunchCustomFargateContainer
+type LaunchOptions struct {
+  // Network - Empty fields are discovered, starting from the default VPC
+  Network  ec2.NetworkConfig
+  // Timeout - Time to wait for the task to start. Defaults to 5 minutes
+  Timeout  time.Duration
+}
+
+// LaunchedTask - A running task and the IPs of its network interface. PublicIp is empty when no public IP was assigned
+type LaunchedTask struct {
+  TaskArn    string
+  PrivateIp  string
+  PublicIp   string
+}
+
+func CreateService(serviceName string, clusterName string, taskDefinition string, options ServiceOptions, awsSession *session.Session) string {
+  serviceArn, err := CreateServiceE(serviceName, clusterName, taskDefinition, options, awsSession)
+  errors.QuitIfError(err)
+  return serviceArn
+}
+
+// CreateServiceE - Creates a Fargate service running the task definition (creating the cluster if needed) and returns its ARN or an error
+func CreateServiceE(serviceName string, clusterName string, taskDefinition string, options ServiceOptions, awsSession *session.Session) (string, error) {
+  return CreateServiceWithContext(context.Background(), serviceName, clusterName, taskDefinition, options, awsSession)
+}
+
+// CreateServiceWithContext - CreateServiceE with a context to allow cancellation
+func CreateServiceWithContext(ctx context.Context, serviceName string, clusterName string, taskDefinition string, options ServiceOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateService(ctx, serviceName, clusterName, taskDefinition, options)
+}
+
+// CreateService - Creates a Fargate service running the task definition (creating the cluster if needed) and returns its ARN or an error
+func (client *Client) CreateService(ctx context.Context, serviceName string, clusterName string, taskDefinition string, options ServiceOptions) (string, error) {
+  clusterArn, err := client.findCluster(ctx, clusterName)
+  if err != nil {
+    return "", err
+  }
+  if clusterArn == "" {
+    err = client.createClusterIfDoesNotExist(ctx, clusterName)
+    if err != nil {
+      return "", err
+    }
+  }
+  network, err := client.EC2.ResolveNetworkConfig(ctx, options.Network)
+  if err != nil {
+    return "", err
+  }
+  input := &ecs.CreateServiceInput{
+    Cluster: aws.String(clusterName),
+    DesiredCount: aws.Int64(options.DesiredCount),
+    LaunchType: aws.String("FARGATE"),
+    NetworkConfiguration: &ecs.NetworkConfiguration{
+      AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+        AssignPublicIp: aws.String(network.AssignPublicIp),
+        SecurityGroups: aws.StringSlice(network.SecurityGroupIds),
+        Subnets: aws.StringSlice(network.SubnetIds),
+      },
+    },
+    ServiceName: aws.String(serviceName),
+    TaskDefinition: aws.String(taskDefinition),
+  }
+  if options.LoadBalancer != nil {
+    input.LoadBalancers = []*ecs.LoadBalancer{
+      {
+        ContainerName: aws.String(options.LoadBalancer.ContainerName),
+        ContainerPort: aws.Int64(options.LoadBalancer.ContainerPort),
+        TargetGroupArn: aws.String(options.LoadBalancer.TargetGroupArn),
+      },
+    }
+    if options.HealthCheckGracePeriod > 0 {
+      input.HealthCheckGracePeriodSeconds = aws.Int64(int64(options.HealthCheckGracePeriod / time.Second))
+    }
+  }
+  result, err := client.ECS.CreateServiceWithContext(ctx, input)
+  if err != nil {
+    return "", err
+  }
+  return *result.Service.ServiceArn, nil
 }
 
 func DeleteCluster(arnOrName string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  _, err := ecsClient.DeleteCluster(&ecs.DeleteClusterInput{
+  errors.QuitIfError(DeleteClusterE(arnOrName, awsSession))
+}
+
+// DeleteClusterE - Deletes an ECS cluster, returning any error
+func DeleteClusterE(arnOrName string, awsSession *session.Session) error {
+  return DeleteClusterWithContext(context.Background(), arnOrName, awsSession)
+}
+
+// DeleteClusterWithContext - DeleteClusterE with a context to allow cancellation
+func DeleteClusterWithContext(ctx context.Context, arnOrName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteCluster(ctx, arnOrName)
+}
+
+// DeleteCluster - Deletes an ECS cluster, returning any error
+func (client *Client) DeleteCluster(ctx context.Context, arnOrName string) error {
+  _, err := client.ECS.DeleteClusterWithContext(ctx, &ecs.DeleteClusterInput{
     Cluster: aws.String(arnOrName),
   })
-  errors.QuitIfError(err)
+  return err
+}
+
+func DeleteService(serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteServiceE(serviceNameOrArn, clusterArnOrName, awsSession))
+}
+
+// DeleteServiceE - Scales a service down to zero tasks, waits for them to drain and deletes the service, returning any error
+func DeleteServiceE(serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return DeleteServiceWithContext(context.Background(), serviceNameOrArn, clusterArnOrName, awsSession)
+}
+
+// DeleteServiceWithContext - DeleteServiceE with a context to allow cancellation
+func DeleteServiceWithContext(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteService(ctx, serviceNameOrArn, clusterArnOrName)
+}
+
+// DeleteService - Scales a service down to zero tasks, waits for them to drain and deletes the service, returning any error
+func (client *Client) DeleteService(ctx context.Context, serviceNameOrArn string, clusterArnOrName string) error {
+  err := client.ScaleService(ctx, serviceNameOrArn, clusterArnOrName, 0)
+  if err != nil {
+    return err
+  }
+  err = client.WaitForServiceStable(ctx, serviceNameOrArn, clusterArnOrName)
+  if err != nil {
+    return err
+  }
+  _, err = client.ECS.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
+    Cluster: aws.String(clusterArnOrName),
+    Service: aws.String(serviceNameOrArn),
+  })
+  if err != nil {
+    return err
+  }
+  return client.ECS.WaitUntilServicesInactiveWithContext(ctx, &ecs.DescribeServicesInput{
+    Cluster: aws.String(clusterArnOrName),
+    Services: []*string{
+      aws.String(serviceNameOrArn),
+    },
+  })
 }
 
 func DeregisterTaskDefinition(arn string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  _, err := ecsClient.DeregisterTaskDefinition(&ecs.DeregisterTaskDefinitionInput{
+  errors.QuitIfError(DeregisterTaskDefinitionE(arn, awsSession))
+}
+
+// DeregisterTaskDefinitionE - Deregisters an ECS task definition, returning any error
+func DeregisterTaskDefinitionE(arn string, awsSession *session.Session) error {
+  return DeregisterTaskDefinitionWithContext(context.Background(), arn, awsSession)
+}
+
+// DeregisterTaskDefinitionWithContext - DeregisterTaskDefinitionE with a context to allow cancellation
+func DeregisterTaskDefinitionWithContext(ctx context.Context, arn string, awsSession *session.Session) error {
+  return New(awsSession).DeregisterTaskDefinition(ctx, arn)
+}
+
+// DeregisterTaskDefinition - Deregisters an ECS task definition, returning any error
+func (client *Client) DeregisterTaskDefinition(ctx context.Context, arn string) error {
+  _, err := client.ECS.DeregisterTaskDefinitionWithContext(ctx, &ecs.DeregisterTaskDefinitionInput{
     TaskDefinition: aws.String(arn),
   })
+  return err
+}
+
+func FetchTaskLogs(taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) []cloudwatchlogs.LogEvent {
+  events, err := FetchTaskLogsE(taskArn, clusterArnOrName, options, awsSession)
+  errors.QuitIfError(err)
+  return events
+}
+
+// FetchTaskLogsE - Returns the awslogs events of the containers of a task within the time range of the options, oldest first, or an error
+func FetchTaskLogsE(taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) ([]cloudwatchlogs.LogEvent, error) {
+  return FetchTaskLogsWithContext(context.Background(), taskArn, clusterArnOrName, options, awsSession)
+}
+
+// FetchTaskLogsWithContext - FetchTaskLogsE with a context to allow cancellation
+func FetchTaskLogsWithContext(ctx context.Context, taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) ([]cloudwatchlogs.LogEvent, error) {
+  return New(awsSession).FetchTaskLogs(ctx, taskArn, clusterArnOrName, options)
+}
+
+// FetchTaskLogs - Returns the awslogs events of the containers of a task within the time range of the options, oldest first, or an error.
+// The log group and streams are read from the task definition, so options.Streams is ignored
+func (client *Client) FetchTaskLogs(ctx context.Context, taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions) ([]cloudwatchlogs.LogEvent, error) {
+  logGroup, streams, err := client.findTaskLogStreams(ctx, taskArn, clusterArnOrName)
+  if err != nil {
+    return nil, err
+  }
+  options.Streams = streams
+  return client.Logs.FetchLogs(ctx, logGroup, options)
+}
+
+func LaunchFargateContainer(taskDefinitionName string, clusterName string, securityGroupName string, awsSession *session.Session) LaunchedTask {
+  task, err := LaunchFargateContainerE(taskDefinitionName, clusterName, securityGroupName, awsSession)
+  errors.QuitIfError(err)
+  return task
+}
+
+// LaunchFargateContainerE - Runs a Fargate task in the default VPC (creating the cluster if needed), waits up to 5 minutes for it to start and returns its ARN and IPs or an error
+func LaunchFargateContainerE(taskDefinitionName string, clusterName string, securityGroupName string, awsSession *session.Session) (LaunchedTask, error) {
+  return LaunchFargateContainerWithContext(context.Background(), taskDefinitionName, clusterName, securityGroupName, awsSession)
+}
+
+// LaunchFargateContainerWithContext - LaunchFargateContainerE with a context to allow cancellation
+func LaunchFargateContainerWithContext(ctx context.Context, taskDefinitionName string, clusterName string, securityGroupName string, awsSession *session.Session) (LaunchedTask, error) {
+  return New(awsSession).LaunchFargateContainer(ctx, taskDefinitionName, clusterName, securityGroupName)
+}
+
+// LaunchFargateContainer - Runs a Fargate task in the default VPC (creating the cluster if needed), waits up to 5 minutes for it to start and returns its ARN and IPs or an error
+func (client *Client) LaunchFargateContainer(ctx context.Context, taskDefinitionName string, clusterName string, securityGroupName string) (LaunchedTask, error) {
+  return client.LaunchCustomFargateContainer(ctx, taskDefinitionName, clusterName, LaunchOptions{
+    Network: ec2.NetworkConfig{
+      SecurityGroupNames: []string{
+        securityGroupName,
+      },
+    },
+  })
+}
+
+func LaunchCustomFargateContainer(taskDefinitionName string, clusterName string, options LaunchOptions, awsSession *session.Session) LaunchedTask {
+  task, err := LaunchCustomFargateContainerE(taskDefinitionName, clusterName, options, awsSession)
   errors.QuitIfError(err)
+  return task
+}
+
+// LaunchCustomFargateContainerE - Runs a Fargate task in the given network (creating the cluster if needed), waits for it to start and returns its ARN and IPs or an error
+func LaunchCustomFargateContainerE(taskDefinitionName string, clusterName string, options LaunchOptions, awsSession *session.Session) (LaunchedTask, error) {
+  return LaunchCustomFargateContainerWithContext(context.Background(), taskDefinitionName, clusterName, options, awsSession)
 }
 
-func LaunchFargateContainer(taskDefinitionName string, clusterName string, securityGroupName string, awsSession *session.Session) string {
-  clusterArn := findCluster(clusterName, awsSession)
+// LaunchCustomFargateContainerWithContext - LaunchCustomFargateContainerE with a context to allow cancellation
+func LaunchCustomFargateContainerWithContext(ctx context.Context, taskDefinitionName string, clusterName string, options LaunchOptions, awsSession *session.Session) (LaunchedTask, error) {
+  return New(awsSession).LaunchCustomFargateContainer(ctx, taskDefinitionName, clusterName, options)
+}
+
+// LaunchCustomFargateContainer - Runs a Fargate task in the given network (creating the cluster if needed), waits for it to start and returns its ARN and IPs or an error.
+// Empty fields of the network configuration are discovered, starting from the default VPC
+func (client *Client) LaunchCustomFargateContainer(ctx context.Context, taskDefinitionName string, clusterName string, options LaunchOptions) (LaunchedTask, error) {
+  clusterArn, err := client.findCluster(ctx, clusterName)
+  if err != nil {
+    return LaunchedTask{}, err
+  }
   if clusterArn == "" {
-    createClusterIfDoesNotExist(clusterName, awsSession)
+    err = client.createClusterIfDoesNotExist(ctx, clusterName)
+    if err != nil {
+      return LaunchedTask{}, err
+    }
+  }
+  taskArn, err := client.runTask(ctx, taskDefinitionName, clusterName, options.Network)
+  if err != nil {
+    return LaunchedTask{}, err
   }
-  taskArn := runTask(taskDefinitionName, clusterName, securityGroupName, awsSession)
-  publicIp := findPublicIpOfTask(clusterName, taskArn, awsSession)
-  return publicIp
+  return client.WaitForTaskRunning(ctx, taskArn, clusterName, options.Timeout)
 }
 
 func RegisterFargateTaskDefinition(taskName string, awsSession *session.Session, containers []Container) string {
-  ecsClient := ecs.New(awsSession)
-  ecrUrl, err := ecr.GetUrl()
+  taskDefinitionArn, err := RegisterFargateTaskDefinitionE(taskName, awsSession, containers)
   errors.LogIfError(err)
-  // TODO: Remove hardcoded ecsTaskExecutionRole ARN
-  // TODO: Add CPU and Memory as parameters
+  return taskDefinitionArn
+}
+
+// RegisterFargateTaskDefinitionE - Registers a Fargate task definition and returns its ARN or an error
+func RegisterFargateTaskDefinitionE(taskName string, awsSession *session.Session, containers []Container) (string, error) {
+  return RegisterFargateTaskDefinitionWithContext(context.Background(), taskName, awsSession, containers)
+}
+
+// RegisterFargateTaskDefinitionWithContext - RegisterFargateTaskDefinitionE with a context to allow cancellation
+func RegisterFargateTaskDefinitionWithContext(ctx context.Context, taskName string, awsSession *session.Session, containers []Container) (string, error) {
+  return New(awsSession).RegisterFargateTaskDefinition(ctx, taskName, containers)
+}
+
+// RegisterFargateTaskDefinition - Registers a Fargate task definition with 2048 CPU units and 16384 MiB of memory and returns its ARN or an error
+func (client *Client) RegisterFargateTaskDefinition(ctx context.Context, taskName string, containers []Container) (string, error) {
+  return client.RegisterCustomFargateTaskDefinition(ctx, taskName, containers, TaskDefinitionOptions{})
+}
+
+func RegisterCustomFargateTaskDefinition(taskName string, containers []Container, options TaskDefinitionOptions, awsSession *session.Session) string {
+  taskDefinitionArn, err := RegisterCustomFargateTaskDefinitionE(taskName, containers, options, awsSession)
+  errors.QuitIfError(err)
+  return taskDefinitionArn
+}
+
+// RegisterCustomFargateTaskDefinitionE - Registers a Fargate task definition using the given options and returns its ARN or an error
+func RegisterCustomFargateTaskDefinitionE(taskName string, containers []Container, options TaskDefinitionOptions, awsSession *session.Session) (string, error) {
+  return RegisterCustomFargateTaskDefinitionWithContext(context.Background(), taskName, containers, options, awsSession)
+}
+
+// RegisterCustomFargateTaskDefinitionWithContext - RegisterCustomFargateTaskDefinitionE with a context to allow cancellation
+func RegisterCustomFargateTaskDefinitionWithContext(ctx context.Context, taskName string, containers []Container, options TaskDefinitionOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).RegisterCustomFargateTaskDefinition(ctx, taskName, containers, options)
+}
+
+// RegisterCustomFargateTaskDefinition - Registers a Fargate task definition using the given options and returns its ARN or an error
+func (client *Client) RegisterCustomFargateTaskDefinition(ctx context.Context, taskName string, containers []Container, options TaskDefinitionOptions) (string, error) {
+  err := validateContainers(containers)
+  if err != nil {
+    return "", err
+  }
+  if options.Cpu == 0 && options.Memory == 0 {
+    options.Cpu = 2048
+    options.Memory = 16384
+  } else if options.Cpu == 0 {
+    return "", errors.New("The CPU units of the task must be set along with its memory")
+  } else if options.Memory == 0 {
+    options.Memory = options.Cpu * 2
+  }
+  if options.ExecutionRoleArn == "" {
+    options.ExecutionRoleArn, err = client.executionRoleArn(ctx)
+    if err != nil {
+      return "", err
+    }
+  }
+  var ecrUrl string
   var containerDefinitions []*ecs.ContainerDefinition
   for _, container := range containers {
-    var environmentVariables []*ecs.KeyValuePair
-    for name, value := range container.EnvironmentVars {
-      environmentVariables = append(environmentVariables, &ecs.KeyValuePair{
-        Name: aws.String(name),
-        Value: aws.String(value),
-      })
+    image := container.ImageName
+    if !isFullyQualifiedImage(image) {
+      if ecrUrl == "" {
+        ecrUrl, err = client.ECR.GetUrl(ctx)
+        if err != nil {
+          return "", err
+        }
+      }
+      image = str.Concat(ecrUrl, "/", image)
+    }
+    logs := container.Logs
+    if logs == nil {
+      logs = options.Logs
+    }
+    logConfiguration, err := client.logConfiguration(logs, taskName)
+    if err != nil {
+      return "", err
     }
     containerDefinitions = append(containerDefinitions, &ecs.ContainerDefinition{
-      Environment: environmentVariables,
+      Command: optionalStrings(container.Command),
+      Cpu: optionalInt64(container.Cpu),
+      DependsOn: dependsOn(container.DependsOn),
+      EntryPoint: optionalStrings(container.EntryPoint),
+      Environment: environment(container.EnvironmentVars),
       Essential: aws.Bool(container.Essential),
-      Image: aws.String(str.Concat(ecrUrl, "/", container.ImageName)),
+      HealthCheck: healthCheck(container.HealthCheck),
+      Image: aws.String(image),
+      LogConfiguration: logConfiguration,
+      Memory: optionalInt64(container.Memory),
+      MemoryReservation: optionalInt64(container.MemoryReservation),
       Name: aws.String(container.Name),
+      PortMappings: portMappings(container.PortMappings),
+      Secrets: secrets(container.Secrets),
     })
   }
-  result, err := ecsClient.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+  result, err := client.ECS.RegisterTaskDefinitionWithContext(ctx, &ecs.RegisterTaskDefinitionInput{
     ContainerDefinitions: containerDefinitions,
-    Cpu: aws.String("2048"),
-    ExecutionRoleArn: aws.String("arn:aws:iam::118104210923:role/ecsTaskExecutionRole"),
+    Cpu: aws.String(strconv.FormatInt(options.Cpu, 10)),
+    ExecutionRoleArn: aws.String(options.ExecutionRoleArn),
     Family: aws.String(taskName),
     RequiresCompatibilities: []*string{
       aws.String("FARGATE"),
     },
-    Memory: aws.String("16384"),
+    Memory: aws.String(strconv.FormatInt(options.Memory, 10)),
     NetworkMode: aws.String("awsvpc"),
-    TaskRoleArn: aws.String("jenkins_instance"),
+    TaskRoleArn: optionalString(options.TaskRoleArn),
   })
-  errors.LogIfError(err)
-  if result != nil {
-    return *result.TaskDefinition.TaskDefinitionArn
+  if err != nil {
+    return "", err
   }
-  return ""
+  return *result.TaskDefinition.TaskDefinitionArn, nil
+}
+
+func ScaleService(serviceNameOrArn string, clusterArnOrName string, desiredCount int64, awsSession *session.Session) {
+  errors.QuitIfError(ScaleServiceE(serviceNameOrArn, clusterArnOrName, desiredCount, awsSession))
+}
+
+// ScaleServiceE - Changes the number of tasks a service keeps running, returning any error. Use WaitForServiceStable to wait for the change
+func ScaleServiceE(serviceNameOrArn string, clusterArnOrName string, desiredCount int64, awsSession *session.Session) error {
+  return ScaleServiceWithContext(context.Background(), serviceNameOrArn, clusterArnOrName, desiredCount, awsSession)
+}
+
+// ScaleServiceWithContext - ScaleServiceE with a context to allow cancellation
+func ScaleServiceWithContext(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, desiredCount int64, awsSession *session.Session) error {
+  return New(awsSession).ScaleService(ctx, serviceNameOrArn, clusterArnOrName, desiredCount)
+}
+
+// ScaleService - Changes the number of tasks a service keeps running, returning any error. Use WaitForServiceStable to wait for the change
+func (client *Client) ScaleService(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, desiredCount int64) error {
+  _, err := client.ECS.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+    Cluster: aws.String(clusterArnOrName),
+    DesiredCount: aws.Int64(desiredCount),
+    Service: aws.String(serviceNameOrArn),
+  })
+  return err
 }
 
 func StopAllTasksInCluster(clusterArnOrName string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  tasksInCluster, err := ecsClient.ListTasks(&ecs.ListTasksInput{
+  errors.QuitIfError(StopAllTasksInClusterE(clusterArnOrName, awsSession))
+}
+
+// StopAllTasksInClusterE - Stops every task running in an ECS cluster, returning the first error
+func StopAllTasksInClusterE(clusterArnOrName string, awsSession *session.Session) error {
+  return StopAllTasksInClusterWithContext(context.Background(), clusterArnOrName, awsSession)
+}
+
+// StopAllTasksInClusterWithContext - StopAllTasksInClusterE with a context to allow cancellation
+func StopAllTasksInClusterWithContext(ctx context.Context, clusterArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).StopAllTasksInCluster(ctx, clusterArnOrName)
+}
+
+// StopAllTasksInCluster - Stops every task running in an ECS cluster, returning the first error
+func (client *Client) StopAllTasksInCluster(ctx context.Context, clusterArnOrName string) error {
+  tasksInCluster, err := client.ECS.ListTasksWithContext(ctx, &ecs.ListTasksInput{
     Cluster: aws.String(clusterArnOrName),
   })
-  errors.QuitIfError(err)
+  if err != nil {
+    return err
+  }
   for _, taskArn := range tasksInCluster.TaskArns {
-    StopTask(*taskArn, clusterArnOrName, awsSession)
+    err = client.StopTask(ctx, *taskArn, clusterArnOrName)
+    if err != nil {
+      return err
+    }
   }
+  return nil
 }
 
 func StopTask(taskIdOrArn string, clusterArnOrName string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  _, err := ecsClient.StopTask(&ecs.StopTaskInput{
+  errors.QuitIfError(StopTaskE(taskIdOrArn, clusterArnOrName, awsSession))
+}
+
+// StopTaskE - Stops a single ECS task, returning any error
+func StopTaskE(taskIdOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return StopTaskWithContext(context.Background(), taskIdOrArn, clusterArnOrName, awsSession)
+}
+
+// StopTaskWithContext - StopTaskE with a context to allow cancellation
+func StopTaskWithContext(ctx context.Context, taskIdOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).StopTask(ctx, taskIdOrArn, clusterArnOrName)
+}
+
+// StopTask - Stops a single ECS task, returning any error
+func (client *Client) StopTask(ctx context.Context, taskIdOrArn string, clusterArnOrName string) error {
+  _, err := client.ECS.StopTaskWithContext(ctx, &ecs.StopTaskInput{
     Cluster: aws.String(clusterArnOrName),
     Reason: aws.String("Stopped by github.com/PyramidSystemsInc/aws/ecs package"),
     Task: aws.String(taskIdOrArn),
   })
-  errors.QuitIfError(err)
+  return err
+}
+
+func TailTaskLogs(taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) {
+  errors.QuitIfError(TailTaskLogsE(taskArn, clusterArnOrName, options, func(event cloudwatchlogs.LogEvent) {
+    logger.Info(event.Message)
+  }, awsSession))
+}
+
+// TailTaskLogsE - Passes the awslogs events of the containers of a task to handle as they are read, oldest first, returning any error.
+// When following, it keeps polling for new events until the context is cancelled or the end of the time range is reached
+func TailTaskLogsE(taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent), awsSession *session.Session) error {
+  return TailTaskLogsWithContext(context.Background(), taskArn, clusterArnOrName, options, handle, awsSession)
+}
+
+// TailTaskLogsWithContext - TailTaskLogsE where cancelling the context stops following without an error
+func TailTaskLogsWithContext(ctx context.Context, taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent), awsSession *session.Session) error {
+  return New(awsSession).TailTaskLogs(ctx, taskArn, clusterArnOrName, options, handle)
+}
+
+// TailTaskLogs - Passes the awslogs events of the containers of a task to handle as they are read, oldest first, returning any error.
+// The log group and streams are read from the task definition, so options.Streams is ignored
+func (client *Client) TailTaskLogs(ctx context.Context, taskArn string, clusterArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent)) error {
+  logGroup, streams, err := client.findTaskLogStreams(ctx, taskArn, clusterArnOrName)
+  if err != nil {
+    return err
+  }
+  options.Streams = streams
+  return client.Logs.TailLogs(ctx, logGroup, options, handle)
 }
 
 func TagCluster(nameOrArn string, key string, value string, awsSession *session.Session) {
+  errors.LogIfError(TagClusterE(nameOrArn, key, value, awsSession))
+}
+
+// TagClusterE - Adds a tag to an ECS cluster found by name or ARN, returning any error
+func TagClusterE(nameOrArn string, key string, value string, awsSession *session.Session) error {
+  return TagClusterWithContext(context.Background(), nameOrArn, key, value, awsSession)
+}
+
+// TagClusterWithContext - TagClusterE with a context to allow cancellation
+func TagClusterWithContext(ctx context.Context, nameOrArn string, key string, value string, awsSession *session.Session) error {
+  return New(awsSession).TagCluster(ctx, nameOrArn, key, value)
+}
+
+// TagCluster - Adds a tag to an ECS cluster found by name or ARN, returning any error
+func (client *Client) TagCluster(ctx context.Context, nameOrArn string, key string, value string) error {
   var arn string
   if util.IsArn(nameOrArn) {
     arn = nameOrArn
   } else {
-    arn = findCluster(nameOrArn, awsSession)
+    var err error
+    arn, err = client.findCluster(ctx, nameOrArn)
+    if err != nil {
+      return err
+    }
   }
-  if arn != "" {
-    tag(arn, key, value, awsSession)
-  } else {
-    logger.Err("Cluster tagging failed. The cluster could not be found by either name or ARN")
+  if arn == "" {
+    return errors.New("Cluster tagging failed. The cluster could not be found by either name or ARN")
   }
+  return client.tag(ctx, arn, key, value)
 }
 
 func TagTaskDefinition(arn string, key string, value string, awsSession *session.Session) {
-  tag(arn, key, value, awsSession)
+  errors.LogIfError(TagTaskDefinitionE(arn, key, value, awsSession))
+}
+
+// TagTaskDefinitionE - Adds a tag to an ECS task definition, returning any error
+func TagTaskDefinitionE(arn string, key string, value string, awsSession *session.Session) error {
+  return TagTaskDefinitionWithContext(context.Background(), arn, key, value, awsSession)
+}
+
+// TagTaskDefinitionWithContext - TagTaskDefinitionE with a context to allow cancellation
+func TagTaskDefinitionWithContext(ctx context.Context, arn string, key string, value string, awsSession *session.Session) error {
+  return New(awsSession).TagTaskDefinition(ctx, arn, key, value)
+}
+
+// TagTaskDefinition - Adds a tag to an ECS task definition, returning any error
+func (client *Client) TagTaskDefinition(ctx context.Context, arn string, key string, value string) error {
+  return client.tag(ctx, arn, key, value)
+}
+
+func UpdateServiceTaskDefinition(serviceNameOrArn string, clusterArnOrName string, taskDefinition string, awsSession *session.Session) {
+  errors.QuitIfError(UpdateServiceTaskDefinitionE(serviceNameOrArn, clusterArnOrName, taskDefinition, awsSession))
+}
+
+// UpdateServiceTaskDefinitionE - Starts a deployment of a service to another task definition revision, returning any error. Use WaitForServiceStable to wait for it
+func UpdateServiceTaskDefinitionE(serviceNameOrArn string, clusterArnOrName string, taskDefinition string, awsSession *session.Session) error {
+  return UpdateServiceTaskDefinitionWithContext(context.Background(), serviceNameOrArn, clusterArnOrName, taskDefinition, awsSession)
+}
+
+// UpdateServiceTaskDefinitionWithContext - UpdateServiceTaskDefinitionE with a context to allow cancellation
+func UpdateServiceTaskDefinitionWithContext(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, taskDefinition string, awsSession *session.Session) error {
+  return New(awsSession).UpdateServiceTaskDefinition(ctx, serviceNameOrArn, clusterArnOrName, taskDefinition)
+}
+
+// UpdateServiceTaskDefinition - Starts a deployment of a service to another task definition revision, returning any error. Use WaitForServiceStable to wait for it
+func (client *Client) UpdateServiceTaskDefinition(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, taskDefinition string) error {
+  _, err := client.ECS.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+    Cluster: aws.String(clusterArnOrName),
+    Service: aws.String(serviceNameOrArn),
+    TaskDefinition: aws.String(taskDefinition),
+  })
+  return err
+}
+
+func WaitForServiceStable(serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) {
+  errors.QuitIfError(WaitForServiceStableE(serviceNameOrArn, clusterArnOrName, awsSession))
+}
+
+// WaitForServiceStableE - Waits up to 10 minutes until a service has a single deployment running its desired number of tasks, returning any error
+func WaitForServiceStableE(serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return WaitForServiceStableWithContext(context.Background(), serviceNameOrArn, clusterArnOrName, awsSession)
+}
+
+// WaitForServiceStableWithContext - WaitForServiceStableE where the context can cancel the wait or give it another deadline
+func WaitForServiceStableWithContext(ctx context.Context, serviceNameOrArn string, clusterArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).WaitForServiceStable(ctx, serviceNameOrArn, clusterArnOrName)
 }
 
-func createClusterIfDoesNotExist(clusterName string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  _, err := ecsClient.CreateCluster(&ecs.CreateClusterInput{
+// WaitForServiceStable - Waits until a service has a single deployment running its desired number of tasks, returning any error.
+// Without a deadline on the context, it gives up after 10 minutes
+func (client *Client) WaitForServiceStable(ctx context.Context, serviceNameOrArn string, clusterArnOrName string) error {
+  input := &ecs.DescribeServicesInput{
+    Cluster: aws.String(clusterArnOrName),
+    Services: []*string{
+      aws.String(serviceNameOrArn),
+    },
+  }
+  if deadline, ok := ctx.Deadline(); ok {
+    attempts := int(time.Until(deadline) / (15 * time.Second)) + 1
+    return client.ECS.WaitUntilServicesStableWithContext(ctx, input, request.WithWaiterMaxAttempts(attempts))
+  }
+  return client.ECS.WaitUntilServicesStableWithContext(ctx, input)
+}
+
+func WaitForTaskRunning(taskArn string, clusterArnOrName string, timeout time.Duration, awsSession *session.Session) LaunchedTask {
+  task, err := WaitForTaskRunningE(taskArn, clusterArnOrName, timeout, awsSession)
+  errors.QuitIfError(err)
+  return task
+}
+
+// WaitForTaskRunningE - Polls a task until it is running and returns its ARN and IPs, or an error if it stopped or did not start within the timeout (5 minutes when zero)
+func WaitForTaskRunningE(taskArn string, clusterArnOrName string, timeout time.Duration, awsSession *session.Session) (LaunchedTask, error) {
+  return WaitForTaskRunningWithContext(context.Background(), taskArn, clusterArnOrName, timeout, awsSession)
+}
+
+// WaitForTaskRunningWithContext - WaitForTaskRunningE with a context to allow cancellation
+func WaitForTaskRunningWithContext(ctx context.Context, taskArn string, clusterArnOrName string, timeout time.Duration, awsSession *session.Session) (LaunchedTask, error) {
+  return New(awsSession).WaitForTaskRunning(ctx, taskArn, clusterArnOrName, timeout)
+}
+
+// WaitForTaskRunning - Polls a task, backing off from 1 up to 15 seconds between attempts, until it is running and returns its ARN and IPs.
+// Returns the reason as an error if the task stopped, or an error if it did not start within the timeout (5 minutes when zero)
+func (client *Client) WaitForTaskRunning(ctx context.Context, taskArn string, clusterArnOrName string, timeout time.Duration) (LaunchedTask, error) {
+  if timeout == 0 {
+    timeout = 5 * time.Minute
+  }
+  ctx, cancel := context.WithTimeout(ctx, timeout)
+  defer cancel()
+  delay := time.Second
+  lastStatus := "UNKNOWN"
+  for {
+    result, err := client.ECS.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+      Cluster: aws.String(clusterArnOrName),
+      Tasks: []*string{
+        aws.String(taskArn),
+      },
+    })
+    if err != nil && ctx.Err() == nil {
+      return LaunchedTask{}, err
+    }
+    if err == nil {
+      if len(result.Tasks) == 0 {
+        return LaunchedTask{}, errors.New(str.Concat("The ECS task ", taskArn, " was not found"))
+      }
+      task := result.Tasks[0]
+      lastStatus = aws.StringValue(task.LastStatus)
+      if lastStatus == ecs.DesiredStatusStopped {
+        return LaunchedTask{}, errors.New(str.Concat("The ECS task ", taskArn, " stopped: ", stoppedReason(task)))
+      }
+      if lastStatus == ecs.DesiredStatusRunning {
+        launchedTask, ready, err := client.launchedTask(ctx, task)
+        if err != nil || ready {
+          return launchedTask, err
+        }
+      }
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      if ctx.Err() == context.DeadlineExceeded {
+        return LaunchedTask{}, errors.New(str.Concat("The ECS task ", taskArn, " did not start within ", timeout.String(), " (last status ", lastStatus, ")"))
+      }
+      return LaunchedTask{}, err
+    }
+    delay *= 2
+    if delay > 15 * time.Second {
+      delay = 15 * time.Second
+    }
+  }
+}
+
+func (client *Client) createClusterIfDoesNotExist(ctx context.Context, clusterName string) error {
+  _, err := client.ECS.CreateClusterWithContext(ctx, &ecs.CreateClusterInput{
     ClusterName: &clusterName,
   })
-  errors.LogIfError(err)
+  return err
 }
 
-func findCluster(clusterName string, awsSession *session.Session) string {
-  ecsClient := ecs.New(awsSession)
-  result, err := ecsClient.ListClusters(&ecs.ListClustersInput{})
-  errors.LogIfError(err)
-  for _, arn := range result.ClusterArns {
-    if strings.HasSuffix(*arn, "/" + clusterName) {
-      return *arn
+func validateContainers(containers []Container) error {
+  names := make(map[string]bool)
+  for _, container := range containers {
+    if container.Name == "" || container.ImageName == "" {
+      return errors.New("Every container of a task definition needs a name and an image")
     }
+    if names[container.Name] {
+      return errors.New(str.Concat("The container name ", container.Name, " is used more than once"))
+    }
+    names[container.Name] = true
+  }
+  for _, container := range containers {
+    for _, dependency := range container.DependsOn {
+      if !names[dependency.ContainerName] {
+        return errors.New(str.Concat("The container ", container.Name, " depends on ", dependency.ContainerName, ", which is not part of the task definition"))
+      }
+    }
+  }
+  return nil
+}
+
+// isFullyQualifiedImage - Reports whether the image starts with a registry host, such as docker.io/ or localhost:5000/
+func isFullyQualifiedImage(image string) bool {
+  slash := strings.Index(image, "/")
+  if slash < 0 {
+    return false
+  }
+  registry := image[:slash]
+  return strings.ContainsAny(registry, ".:") || registry == "localhost"
+}
+
+func (client *Client) logConfiguration(logs *AwsLogs, taskName string) (*ecs.LogConfiguration, error) {
+  if logs == nil {
+    return nil, nil
+  }
+  region := logs.Region
+  if region == "" {
+    region = client.region()
+  }
+  if logs.Group == "" || region == "" {
+    return nil, errors.New("The awslogs configuration needs a log group and a region")
+  }
+  streamPrefix := logs.StreamPrefix
+  if streamPrefix == "" {
+    streamPrefix = taskName
+  }
+  options := map[string]*string{
+    "awslogs-group": aws.String(logs.Group),
+    "awslogs-region": aws.String(region),
+    "awslogs-stream-prefix": aws.String(streamPrefix),
+  }
+  if logs.CreateGroup {
+    options["awslogs-create-group"] = aws.String("true")
+  }
+  return &ecs.LogConfiguration{
+    LogDriver: aws.String(ecs.LogDriverAwslogs),
+    Options: options,
+  }, nil
+}
+
+// region - Returns the region of the ECS client, or an empty string when it is not talking to AWS
+func (client *Client) region() string {
+  if service, ok := client.ECS.(*ecs.ECS); ok {
+    return aws.StringValue(service.Config.Region)
   }
   return ""
 }
 
-func findPublicIpOfTask(clusterName string, taskArn string, awsSession *session.Session) string {
-  time.Sleep(7 * time.Second)
-  networkInterfaceId := findNetworkInterfaceIdOfTask(clusterName, taskArn, awsSession)
-  return ec2.FindPublicIpOfNetworkInterface(networkInterfaceId, awsSession)
+func environment(environmentVars map[string]string) []*ecs.KeyValuePair {
+  var environmentVariables []*ecs.KeyValuePair
+  for _, name := range sortedKeys(environmentVars) {
+    environmentVariables = append(environmentVariables, &ecs.KeyValuePair{
+      Name: aws.String(name),
+      Value: aws.String(environmentVars[name]),
+    })
+  }
+  return environmentVariables
 }
 
-func findNetworkInterfaceIdOfTask(clusterName string, taskArn string, awsSession *session.Session) string {
-  ecsClient := ecs.New(awsSession)
-  result, err := ecsClient.DescribeTasks(&ecs.DescribeTasksInput{
-    Cluster: aws.String(clusterName),
+func secrets(secretRefs map[string]string) []*ecs.Secret {
+  var ecsSecrets []*ecs.Secret
+  for _, name := range sortedKeys(secretRefs) {
+    ecsSecrets = append(ecsSecrets, &ecs.Secret{
+      Name: aws.String(name),
+      ValueFrom: aws.String(secretRefs[name]),
+    })
+  }
+  return ecsSecrets
+}
+
+func portMappings(ports []PortMapping) []*ecs.PortMapping {
+  var mappings []*ecs.PortMapping
+  for _, port := range ports {
+    protocol := port.Protocol
+    if protocol == "" {
+      protocol = ecs.TransportProtocolTcp
+    }
+    mappings = append(mappings, &ecs.PortMapping{
+      ContainerPort: aws.Int64(port.ContainerPort),
+      HostPort: aws.Int64(port.ContainerPort),
+      Protocol: aws.String(protocol),
+    })
+  }
+  return mappings
+}
+
+func healthCheck(check *HealthCheck) *ecs.HealthCheck {
+  if check == nil {
+    return nil
+  }
+  return &ecs.HealthCheck{
+    Command: aws.StringSlice(check.Command),
+    Interval: optionalInt64(int64(check.Interval / time.Second)),
+    Retries: optionalInt64(check.Retries),
+    StartPeriod: optionalInt64(int64(check.StartPeriod / time.Second)),
+    Timeout: optionalInt64(int64(check.Timeout / time.Second)),
+  }
+}
+
+func dependsOn(dependencies []ContainerDependency) []*ecs.ContainerDependency {
+  var ecsDependencies []*ecs.ContainerDependency
+  for _, dependency := range dependencies {
+    ecsDependencies = append(ecsDependencies, &ecs.ContainerDependency{
+      Condition: aws.String(dependency.Condition),
+      ContainerName: aws.String(dependency.ContainerName),
+    })
+  }
+  return ecsDependencies
+}
+
+func optionalInt64(value int64) *int64 {
+  if value == 0 {
+    return nil
+  }
+  return aws.Int64(value)
+}
+
+func optionalString(value string) *string {
+  if value == "" {
+    return nil
+  }
+  return aws.String(value)
+}
+
+func optionalStrings(values []string) []*string {
+  if len(values) == 0 {
+    return nil
+  }
+  return aws.StringSlice(values)
+}
+
+func sortedKeys(values map[string]string) []string {
+  keys := make([]string, 0, len(values))
+  for key := range values {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+// executionRoleArn - Returns the ARN of the ecsTaskExecutionRole of the account the client is signed in to, creating the role
+// as the ECS console does if it does not exist. An existing role is used as it is, since other task definitions of the account
+// rely on its trust policy and permissions
+func (client *Client) executionRoleArn(ctx context.Context) (string, error) {
+  arn, err := client.IAM.GetRoleArn(ctx, "ecsTaskExecutionRole")
+  if err != nil || arn != "" {
+    return arn, err
+  }
+  return client.IAM.EnsureRole(ctx, "ecsTaskExecutionRole", iam.TrustPolicy(iam.ServiceEcsTasks), iam.RoleOptions{
+    ManagedPolicyArns: []string{iam.ManagedPolicyEcsTaskExecution},
+  })
+}
+
+func (client *Client) findCluster(ctx context.Context, clusterName string) (string, error) {
+  result, err := client.ECS.ListClustersWithContext(ctx, &ecs.ListClustersInput{})
+  if err != nil {
+    return "", err
+  }
+  for _, arn := range result.ClusterArns {
+    if strings.HasSuffix(*arn, "/" + clusterName) {
+      return *arn, nil
+    }
+  }
+  return "", nil
+}
+
+// findTaskLogStreams - Returns the log group of a task and the <prefix>/<container>/<task id> streams of its containers using the awslogs driver
+func (client *Client) findTaskLogStreams(ctx context.Context, taskArn string, clusterArnOrName string) (string, []string, error) {
+  tasks, err := client.ECS.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+    Cluster: aws.String(clusterArnOrName),
     Tasks: []*string{
       aws.String(taskArn),
     },
   })
-  errors.LogIfError(err)
-  networkDetails := result.Tasks[0].Attachments[0].Details
+  if err != nil {
+    return "", nil, err
+  }
+  if len(tasks.Tasks) == 0 {
+    return "", nil, errors.New(str.Concat("The ECS task ", taskArn, " was not found"))
+  }
+  task := tasks.Tasks[0]
+  result, err := client.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+    TaskDefinition: task.TaskDefinitionArn,
+  })
+  if err != nil {
+    return "", nil, err
+  }
+  taskId := aws.StringValue(task.TaskArn)
+  taskId = taskId[strings.LastIndex(taskId, "/") + 1:]
+  var logGroup string
+  var streams []string
+  for _, container := range result.TaskDefinition.ContainerDefinitions {
+    logConfiguration := container.LogConfiguration
+    if logConfiguration == nil || aws.StringValue(logConfiguration.LogDriver) != ecs.LogDriverAwslogs {
+      continue
+    }
+    group := aws.StringValue(logConfiguration.Options["awslogs-group"])
+    if logGroup != "" && group != logGroup {
+      return "", nil, errors.New(str.Concat("The containers of the ECS task ", taskArn, " log to more than one log group"))
+    }
+    logGroup = group
+    streams = append(streams, str.Concat(aws.StringValue(logConfiguration.Options["awslogs-stream-prefix"]), "/", aws.StringValue(container.Name), "/", taskId))
+  }
+  if logGroup == "" {
+    return "", nil, errors.New(str.Concat("No container of the ECS task ", taskArn, " uses the awslogs log driver"))
+  }
+  return logGroup, streams, nil
+}
+
+// launchedTask - Reads the IPs of a running task from its network interface, reporting whether the interface is attached yet
+func (client *Client) launchedTask(ctx context.Context, task *ecs.Task) (LaunchedTask, bool, error) {
+  launchedTask := LaunchedTask{
+    TaskArn: aws.StringValue(task.TaskArn),
+  }
   var networkInterfaceId string
-  for _, networkDetail := range networkDetails {
-    if *networkDetail.Name == "networkInterfaceId" {
-      networkInterfaceId = *networkDetail.Value
+  for _, attachment := range task.Attachments {
+    if aws.StringValue(attachment.Type) != "ElasticNetworkInterface" {
+      continue
+    }
+    for _, detail := range attachment.Details {
+      switch aws.StringValue(detail.Name) {
+      case "networkInterfaceId":
+        networkInterfaceId = aws.StringValue(detail.Value)
+      case "privateIPv4Address":
+        launchedTask.PrivateIp = aws.StringValue(detail.Value)
+      }
+    }
+  }
+  if networkInterfaceId == "" {
+    return launchedTask, false, nil
+  }
+  result, err := client.EC2.EC2.DescribeNetworkInterfacesWithContext(ctx, &awsec2.DescribeNetworkInterfacesInput{
+    NetworkInterfaceIds: []*string{
+      aws.String(networkInterfaceId),
+    },
+  })
+  if err != nil {
+    return launchedTask, false, err
+  }
+  for _, networkInterface := range result.NetworkInterfaces {
+    if networkInterface.Association != nil {
+      launchedTask.PublicIp = aws.StringValue(networkInterface.Association.PublicIp)
     }
   }
-  return networkInterfaceId
+  return launchedTask, true, nil
 }
 
-func runTask(taskDefinitionName string, clusterName string, securityGroupName string, awsSession *session.Session) string {
-  ecsClient := ecs.New(awsSession)
-  vpcId := "vpc-76cf681f"
-  result, err := ecsClient.RunTask(&ecs.RunTaskInput{
+func (client *Client) runTask(ctx context.Context, taskDefinitionName string, clusterName string, network ec2.NetworkConfig) (string, error) {
+  network, err := client.EC2.ResolveNetworkConfig(ctx, network)
+  if err != nil {
+    return "", err
+  }
+  result, err := client.ECS.RunTaskWithContext(ctx, &ecs.RunTaskInput{
     Cluster: &clusterName,
     LaunchType: aws.String("FARGATE"),
     NetworkConfiguration: &ecs.NetworkConfiguration{
       AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
-        AssignPublicIp: aws.String("ENABLED"),
-        SecurityGroups: []*string{
-          ec2.GetSecurityGroupId(securityGroupName, awsSession),
-        },
-        Subnets: ec2.ListAllSubnetIds(vpcId, awsSession),
+        AssignPublicIp: aws.String(network.AssignPublicIp),
+        SecurityGroups: aws.StringSlice(network.SecurityGroupIds),
+        Subnets: aws.StringSlice(network.SubnetIds),
       },
     },
     TaskDefinition: &taskDefinitionName,
   })
-  errors.LogIfError(err)
-  if len(result.Failures) > 0 {
-    err = errors.New(str.Concat("The ECS task named ", taskDefinitionName, " had a failure. Did you reach the max number of ECS tasks you are allowed to run?"))
-    errors.QuitIfError(err)
+  if err != nil {
+    return "", err
+  }
+  if len(result.Failures) > 0 || len(result.Tasks) == 0 {
+    return "", errors.New(str.Concat("The ECS task named ", taskDefinitionName, " had a failure. Did you reach the max number of ECS tasks you are allowed to run?"))
   }
-  return *result.Tasks[0].TaskArn
+  return *result.Tasks[0].TaskArn, nil
 }
 
-func tag(arn string, key string, value string, awsSession *session.Session) {
-  ecsClient := ecs.New(awsSession)
-  _, err := ecsClient.TagResource(&ecs.TagResourceInput{
+// stoppedReason - The reason ECS gave for stopping a task, followed by the reasons of its containers
+func stoppedReason(task *ecs.Task) string {
+  reasons := []string{
+    aws.StringValue(task.StoppedReason),
+  }
+  for _, container := range task.Containers {
+    if container.Reason != nil {
+      reasons = append(reasons, str.Concat(aws.StringValue(container.Name), ": ", *container.Reason))
+    } else if container.ExitCode != nil && *container.ExitCode != 0 {
+      reasons = append(reasons, str.Concat(aws.StringValue(container.Name), ": exited with code ", strconv.FormatInt(*container.ExitCode, 10)))
+    }
+  }
+  return strings.Join(reasons, "; ")
+}
+
+func (client *Client) tag(ctx context.Context, arn string, key string, value string) error {
+  _, err := client.ECS.TagResourceWithContext(ctx, &ecs.TagResourceInput{
     ResourceArn: aws.String(arn),
     Tags: []*ecs.Tag{
       &ecs.Tag{
@@ -208,5 +1108,5 @@ func tag(arn string, key string, value string, awsSession *session.Session) {
       },
     },
   })
-  errors.LogIfError(err)
+  return err
 }
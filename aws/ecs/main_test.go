@@ -0,0 +1,348 @@
+package ecs
+
+import (
+  "context"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/PyramidSystemsInc/go/aws/cloudwatchlogs"
+  "github.com/PyramidSystemsInc/go/aws/cloudwatchlogs/cloudwatchlogsfake"
+  "github.com/PyramidSystemsInc/go/aws/ec2"
+  "github.com/PyramidSystemsInc/go/aws/ec2/ec2fake"
+  "github.com/PyramidSystemsInc/go/aws/ecr"
+  "github.com/PyramidSystemsInc/go/aws/ecr/ecrfake"
+  "github.com/PyramidSystemsInc/go/aws/ecs/ecsfake"
+  "github.com/PyramidSystemsInc/go/aws/iam"
+  "github.com/PyramidSystemsInc/go/aws/iam/iamfake"
+  "github.com/aws/aws-sdk-go/aws"
+  awsec2 "github.com/aws/aws-sdk-go/service/ec2"
+  awsiam "github.com/aws/aws-sdk-go/service/iam"
+  "github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func newFakeClient() (*Client, *ecsfake.ECS) {
+  fake := ecsfake.New()
+  ec2Fake := ec2fake.New()
+  ec2Fake.Vpcs = []*awsec2.Vpc{
+    {
+      IsDefault: aws.Bool(true),
+      VpcId: aws.String("vpc-default"),
+    },
+  }
+  ec2Fake.Subnets = []*awsec2.Subnet{
+    {
+      SubnetId: aws.String("subnet-default-a"),
+      VpcId: aws.String("vpc-default"),
+    },
+  }
+  return &Client{
+    ECS: fake,
+    EC2: &ec2.Client{EC2: ec2Fake},
+    ECR: &ecr.Client{ECR: ecrfake.New()},
+    IAM: &iam.Client{IAM: iamfake.New()},
+    Logs: &cloudwatchlogs.Client{CloudWatchLogs: cloudwatchlogsfake.New()},
+  }, fake
+}
+
+// TestRegisterCustomFargateTaskDefinition registers a two container task definition against the in-memory
+// fake and checks the options made it into the container definitions.
+func TestRegisterCustomFargateTaskDefinition(t *testing.T) {
+  client, fake := newFakeClient()
+
+  arn, err := client.RegisterCustomFargateTaskDefinition(context.Background(), "test-task", []Container{
+    {
+      Command: []string{"/migrate"},
+      Essential: false,
+      ImageName: "docker.io/library/postgres:11",
+      Name: "migrate",
+    },
+    {
+      DependsOn: []ContainerDependency{
+        {
+          ContainerName: "migrate",
+          Condition: "SUCCESS",
+        },
+      },
+      EnvironmentVars: map[string]string{
+        "PORT": "8080",
+        "MODE": "test",
+      },
+      Essential: true,
+      HealthCheck: &HealthCheck{
+        Command: []string{"CMD-SHELL", "curl -f http://localhost:8080/ || exit 1"},
+        Interval: 30 * time.Second,
+      },
+      ImageName: "localhost:5000/api:latest",
+      Name: "api",
+      PortMappings: []PortMapping{
+        {
+          ContainerPort: 8080,
+        },
+      },
+      Secrets: map[string]string{
+        "DB_PASSWORD": "arn:aws:ssm:us-east-2:123456789012:parameter/test/db-password",
+      },
+    },
+  }, TaskDefinitionOptions{
+    Cpu: 512,
+    Logs: &AwsLogs{
+      Group: "/pac/test",
+      Region: "us-east-2",
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  taskDefinition := fake.TaskDefinitions[arn]
+  if *taskDefinition.Cpu != "512" || *taskDefinition.Memory != "1024" {
+    t.Errorf("expected 512 CPU units and 1024 MiB, got %s and %s", *taskDefinition.Cpu, *taskDefinition.Memory)
+  }
+  if *taskDefinition.ExecutionRoleArn != "arn:aws:iam::123456789012:role/ecsTaskExecutionRole" {
+    t.Errorf("unexpected execution role %s", *taskDefinition.ExecutionRoleArn)
+  }
+  if taskDefinition.TaskRoleArn != nil {
+    t.Errorf("expected no task role, got %s", *taskDefinition.TaskRoleArn)
+  }
+  api := taskDefinition.ContainerDefinitions[1]
+  if *api.Image != "localhost:5000/api:latest" {
+    t.Errorf("a fully-qualified image was changed to %s", *api.Image)
+  }
+  if *api.Environment[0].Name != "MODE" || *api.Environment[1].Name != "PORT" {
+    t.Error("expected the environment variables sorted by name")
+  }
+  if *api.PortMappings[0].HostPort != 8080 || *api.PortMappings[0].Protocol != "tcp" {
+    t.Errorf("unexpected port mapping %v", api.PortMappings[0])
+  }
+  if *api.HealthCheck.Interval != 30 || api.HealthCheck.Timeout != nil {
+    t.Errorf("unexpected health check %v", api.HealthCheck)
+  }
+  if *api.LogConfiguration.Options["awslogs-stream-prefix"] != "test-task" {
+    t.Errorf("unexpected log configuration %v", api.LogConfiguration)
+  }
+  if *api.Secrets[0].Name != "DB_PASSWORD" || *api.DependsOn[0].ContainerName != "migrate" {
+    t.Error("expected the secret and the dependency on the migrate container")
+  }
+
+  _, err = client.RegisterCustomFargateTaskDefinition(context.Background(), "test-task", []Container{
+    {
+      DependsOn: []ContainerDependency{
+        {
+          ContainerName: "missing",
+          Condition: "START",
+        },
+      },
+      ImageName: "docker.io/library/nginx:1.17",
+      Name: "web",
+    },
+  }, TaskDefinitionOptions{})
+  if err == nil {
+    t.Error("expected an error for a dependency on a missing container")
+  }
+}
+
+// TestExecutionRole checks that the ecsTaskExecutionRole is created with the ECS task execution policy when it is
+// missing, and that a role the account already has is used without being changed.
+func TestExecutionRole(t *testing.T) {
+  client, fake := newFakeClient()
+  iamFake := client.IAM.IAM.(*iamfake.IAM)
+  containers := []Container{
+    {
+      ImageName: "docker.io/library/nginx:1.17",
+      Name: "web",
+    },
+  }
+
+  arn, err := client.RegisterCustomFargateTaskDefinition(context.Background(), "created", containers, TaskDefinitionOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  policies := iamFake.AttachedPolicies["ecsTaskExecutionRole"]
+  if len(policies) != 1 || policies[0] != iam.ManagedPolicyEcsTaskExecution {
+    t.Errorf("expected the created role to have the ECS task execution policy, got %v", policies)
+  }
+  if *fake.TaskDefinitions[arn].ExecutionRoleArn != *iamFake.Roles["ecsTaskExecutionRole"].Arn {
+    t.Errorf("unexpected execution role %s", *fake.TaskDefinitions[arn].ExecutionRoleArn)
+  }
+
+  client, fake = newFakeClient()
+  iamFake = client.IAM.IAM.(*iamfake.IAM)
+  trustPolicy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":["ecs-tasks.amazonaws.com","events.amazonaws.com"]},"Action":"sts:AssumeRole"}]}`
+  iamFake.Roles["ecsTaskExecutionRole"] = &awsiam.Role{
+    Arn: aws.String("arn:aws:iam::123456789012:role/service-role/ecsTaskExecutionRole"),
+    AssumeRolePolicyDocument: aws.String(trustPolicy),
+    Path: aws.String("/service-role/"),
+    RoleName: aws.String("ecsTaskExecutionRole"),
+  }
+  arn, err = client.RegisterCustomFargateTaskDefinition(context.Background(), "existing", containers, TaskDefinitionOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *fake.TaskDefinitions[arn].ExecutionRoleArn != "arn:aws:iam::123456789012:role/service-role/ecsTaskExecutionRole" {
+    t.Errorf("expected the existing role to be used, got %s", *fake.TaskDefinitions[arn].ExecutionRoleArn)
+  }
+  if *iamFake.Roles["ecsTaskExecutionRole"].AssumeRolePolicyDocument != trustPolicy {
+    t.Error("expected the trust policy of the existing role to be left alone")
+  }
+  if len(iamFake.AttachedPolicies["ecsTaskExecutionRole"]) != 0 {
+    t.Errorf("expected no policies attached to the existing role, got %v", iamFake.AttachedPolicies["ecsTaskExecutionRole"])
+  }
+}
+
+// TestServiceLifecycle creates, deploys, scales and deletes a service against the in-memory fake.
+func TestServiceLifecycle(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  containers := []Container{
+    {
+      Essential: true,
+      ImageName: "docker.io/library/nginx:1.17",
+      Name: "web",
+    },
+  }
+  firstRevision, err := client.RegisterFargateTaskDefinition(ctx, "test-web", containers)
+  if err != nil {
+    t.Fatal(err)
+  }
+  secondRevision, err := client.RegisterFargateTaskDefinition(ctx, "test-web", containers)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  serviceArn, err := client.CreateService(ctx, "web", "test-cluster", firstRevision, ServiceOptions{
+    DesiredCount: 2,
+    LoadBalancer: &ServiceLoadBalancer{
+      TargetGroupArn: "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/web/0000000000000001",
+      ContainerName: "web",
+      ContainerPort: 80,
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  service := fake.Services[serviceArn]
+  if *service.NetworkConfiguration.AwsvpcConfiguration.Subnets[0] != "subnet-default-a" {
+    t.Error("expected the service in the subnets of the default VPC")
+  }
+
+  err = client.UpdateServiceTaskDefinition(ctx, "web", "test-cluster", secondRevision)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.ScaleService(ctx, "web", "test-cluster", 3)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.WaitForServiceStable(ctx, "web", "test-cluster")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *service.TaskDefinition != secondRevision || *service.RunningCount != 3 {
+    t.Errorf("expected 3 tasks of %s, got %d of %s", secondRevision, *service.RunningCount, *service.TaskDefinition)
+  }
+
+  err = client.DeleteService(ctx, serviceArn, "test-cluster")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *service.Status != "INACTIVE" || *service.DesiredCount != 0 {
+    t.Errorf("expected an inactive service scaled to 0, got %s with %d", *service.Status, *service.DesiredCount)
+  }
+}
+
+// TestLaunchCustomFargateContainer launches a task against the in-memory fake, then checks a stopped task
+// surfaces its reasons and a task that never starts times out.
+func TestLaunchCustomFargateContainer(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  client.EC2.EC2.(*ec2fake.EC2).NetworkInterfaces = []*awsec2.NetworkInterface{
+    {
+      Association: &awsec2.NetworkInterfaceAssociation{
+        PublicIp: aws.String("203.0.113.10"),
+      },
+      NetworkInterfaceId: aws.String("eni-1"),
+    },
+  }
+  taskDefinition, err := client.RegisterFargateTaskDefinition(ctx, "test-launch", []Container{
+    {
+      Essential: true,
+      ImageName: "docker.io/library/nginx:1.17",
+      Name: "web",
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  task, err := client.LaunchCustomFargateContainer(ctx, taskDefinition, "test-cluster", LaunchOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if task.TaskArn == "" || task.PrivateIp != "10.0.0.1" || task.PublicIp != "203.0.113.10" {
+    t.Errorf("expected the task ARN, 10.0.0.1 and 203.0.113.10, got %+v", task)
+  }
+
+  fake.Tasks[task.TaskArn].LastStatus = aws.String("STOPPED")
+  fake.Tasks[task.TaskArn].StoppedReason = aws.String("Essential container in task exited")
+  fake.Tasks[task.TaskArn].Containers = []*ecs.Container{
+    {
+      Name: aws.String("web"),
+      Reason: aws.String("CannotPullContainerError"),
+    },
+  }
+  _, err = client.WaitForTaskRunning(ctx, task.TaskArn, "test-cluster", time.Second)
+  if err == nil || !strings.Contains(err.Error(), "Essential container in task exited; web: CannotPullContainerError") {
+    t.Errorf("expected the stop reasons in the error, got %v", err)
+  }
+
+  fake.Tasks[task.TaskArn].LastStatus = aws.String("PROVISIONING")
+  _, err = client.WaitForTaskRunning(ctx, task.TaskArn, "test-cluster", 1500 * time.Millisecond)
+  if err == nil || !strings.Contains(err.Error(), "last status PROVISIONING") {
+    t.Errorf("expected a timeout while provisioning, got %v", err)
+  }
+}
+
+// TestFetchTaskLogs finds the awslogs streams of a launched task from its task definition and reads only their events.
+func TestFetchTaskLogs(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  logsFake := client.Logs.CloudWatchLogs.(*cloudwatchlogsfake.CloudWatchLogs)
+  client.EC2.EC2.(*ec2fake.EC2).NetworkInterfaces = []*awsec2.NetworkInterface{
+    {
+      NetworkInterfaceId: aws.String("eni-1"),
+    },
+  }
+  taskDefinition, err := client.RegisterCustomFargateTaskDefinition(ctx, "test-logs", []Container{
+    {
+      Essential: true,
+      ImageName: "docker.io/library/nginx:1.17",
+      Name: "web",
+    },
+  }, TaskDefinitionOptions{
+    Logs: &AwsLogs{
+      Group: "/ecs/test",
+      Region: "us-east-1",
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  task, err := client.LaunchCustomFargateContainer(ctx, taskDefinition, "test-cluster", LaunchOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if task.PublicIp != "" {
+    t.Errorf("expected no public IP, got %s", task.PublicIp)
+  }
+
+  logsFake.AddEvent("/ecs/test", "test-logs/web/1", 1000, "listening on 80")
+  logsFake.AddEvent("/ecs/test", "test-logs/web/2", 1000, "another task")
+  events, err := client.FetchTaskLogs(ctx, task.TaskArn, "test-cluster", cloudwatchlogs.LogOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(events) != 1 || events[0].Message != "listening on 80" {
+    t.Errorf("expected only the event of the task, got %+v", events)
+  }
+}
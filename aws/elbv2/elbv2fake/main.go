@@ -0,0 +1,282 @@
+// Package elbv2fake is an in-memory stand-in for the parts of the Elastic Load Balancing v2 API used by the
+// github.com/PyramidSystemsInc/go/aws/elbv2 package, so it can be unit tested offline.
+package elbv2fake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// ELBV2 keeps load balancers, listeners, rules, target groups and tags in memory, keyed by ARN. Calling an operation that is
+// not implemented panics.
+type ELBV2 struct {
+	elbv2iface.ELBV2API
+
+	mutex         sync.Mutex
+	counter       int
+	Region        string
+	AccountID     string
+	LoadBalancers map[string]*elbv2.LoadBalancer
+	Listeners     map[string]*elbv2.Listener
+	Rules         map[string]*elbv2.Rule
+	TargetGroups  map[string]*elbv2.TargetGroup
+	Tags          map[string][]*elbv2.Tag
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *ELBV2 {
+	return &ELBV2{
+		Region:        "us-east-1",
+		AccountID:     "123456789012",
+		LoadBalancers: map[string]*elbv2.LoadBalancer{},
+		Listeners:     map[string]*elbv2.Listener{},
+		Rules:         map[string]*elbv2.Rule{},
+		TargetGroups:  map[string]*elbv2.TargetGroup{},
+		Tags:          map[string][]*elbv2.Tag{},
+	}
+}
+
+// CreateLoadBalancerWithContext creates an active application load balancer.
+func (fake *ELBV2) CreateLoadBalancerWithContext(ctx aws.Context, input *elbv2.CreateLoadBalancerInput, opts ...request.Option) (*elbv2.CreateLoadBalancerOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	if fake.byName(name) != nil {
+		return nil, awserr.New(elbv2.ErrCodeDuplicateLoadBalancerNameException, "A load balancer with the same name '"+name+"' exists", nil)
+	}
+	fake.counter++
+	var availabilityZones []*elbv2.AvailabilityZone
+	for _, subnetId := range input.Subnets {
+		availabilityZones = append(availabilityZones, &elbv2.AvailabilityZone{
+			SubnetId: subnetId,
+		})
+	}
+	loadBalancerType := aws.StringValue(input.Type)
+	if loadBalancerType == "" {
+		loadBalancerType = elbv2.LoadBalancerTypeEnumApplication
+	}
+	scheme := aws.StringValue(input.Scheme)
+	if scheme == "" {
+		scheme = elbv2.LoadBalancerSchemeEnumInternetFacing
+	}
+	loadBalancer := &elbv2.LoadBalancer{
+		AvailabilityZones: availabilityZones,
+		DNSName:           aws.String(fmt.Sprintf("%s-%d.%s.elb.amazonaws.com", name, fake.counter, fake.Region)),
+		LoadBalancerArn:   aws.String(fake.arn(fmt.Sprintf("loadbalancer/app/%s/%016x", name, fake.counter))),
+		LoadBalancerName:  aws.String(name),
+		Scheme:            aws.String(scheme),
+		SecurityGroups:    input.SecurityGroups,
+		State: &elbv2.LoadBalancerState{
+			Code: aws.String(elbv2.LoadBalancerStateEnumActive),
+		},
+		Type: aws.String(loadBalancerType),
+	}
+	fake.LoadBalancers[aws.StringValue(loadBalancer.LoadBalancerArn)] = loadBalancer
+	fake.Tags[aws.StringValue(loadBalancer.LoadBalancerArn)] = input.Tags
+	return &elbv2.CreateLoadBalancerOutput{
+		LoadBalancers: []*elbv2.LoadBalancer{
+			loadBalancer,
+		},
+	}, nil
+}
+
+// DeleteLoadBalancerWithContext deletes a load balancer and its listeners.
+func (fake *ELBV2) DeleteLoadBalancerWithContext(ctx aws.Context, input *elbv2.DeleteLoadBalancerInput, opts ...request.Option) (*elbv2.DeleteLoadBalancerOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	arn := aws.StringValue(input.LoadBalancerArn)
+	delete(fake.LoadBalancers, arn)
+	delete(fake.Tags, arn)
+	for listenerArn, listener := range fake.Listeners {
+		if aws.StringValue(listener.LoadBalancerArn) == arn {
+			delete(fake.Listeners, listenerArn)
+		}
+	}
+	return &elbv2.DeleteLoadBalancerOutput{}, nil
+}
+
+// DescribeLoadBalancersWithContext returns the load balancers matching input.LoadBalancerArns or
+// input.Names, or every load balancer when neither is set.
+func (fake *ELBV2) DescribeLoadBalancersWithContext(ctx aws.Context, input *elbv2.DescribeLoadBalancersInput, opts ...request.Option) (*elbv2.DescribeLoadBalancersOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var loadBalancers []*elbv2.LoadBalancer
+	for _, arn := range input.LoadBalancerArns {
+		loadBalancer, ok := fake.LoadBalancers[aws.StringValue(arn)]
+		if !ok {
+			return nil, notFound()
+		}
+		loadBalancers = append(loadBalancers, loadBalancer)
+	}
+	for _, name := range input.Names {
+		loadBalancer := fake.byName(aws.StringValue(name))
+		if loadBalancer == nil {
+			return nil, notFound()
+		}
+		loadBalancers = append(loadBalancers, loadBalancer)
+	}
+	if len(input.LoadBalancerArns) == 0 && len(input.Names) == 0 {
+		for _, loadBalancer := range fake.LoadBalancers {
+			loadBalancers = append(loadBalancers, loadBalancer)
+		}
+	}
+	return &elbv2.DescribeLoadBalancersOutput{
+		LoadBalancers: loadBalancers,
+	}, nil
+}
+
+// CreateListenerWithContext adds a listener to a load balancer.
+func (fake *ELBV2) CreateListenerWithContext(ctx aws.Context, input *elbv2.CreateListenerInput, opts ...request.Option) (*elbv2.CreateListenerOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	loadBalancer, ok := fake.LoadBalancers[aws.StringValue(input.LoadBalancerArn)]
+	if !ok {
+		return nil, notFound()
+	}
+	fake.counter++
+	listener := &elbv2.Listener{
+		DefaultActions:  input.DefaultActions,
+		ListenerArn:     aws.String(fake.arn(fmt.Sprintf("listener/app/%s/%016x", aws.StringValue(loadBalancer.LoadBalancerName), fake.counter))),
+		LoadBalancerArn: input.LoadBalancerArn,
+		Port:            input.Port,
+		Protocol:        input.Protocol,
+	}
+	fake.Listeners[aws.StringValue(listener.ListenerArn)] = listener
+	return &elbv2.CreateListenerOutput{
+		Listeners: []*elbv2.Listener{
+			listener,
+		},
+	}, nil
+}
+
+// CreateRuleWithContext adds a rule to a listener. Priorities must be unique per listener.
+func (fake *ELBV2) CreateRuleWithContext(ctx aws.Context, input *elbv2.CreateRuleInput, opts ...request.Option) (*elbv2.CreateRuleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	listener, ok := fake.Listeners[aws.StringValue(input.ListenerArn)]
+	if !ok {
+		return nil, awserr.New(elbv2.ErrCodeListenerNotFoundException, "One or more listeners not found", nil)
+	}
+	priority := fmt.Sprint(aws.Int64Value(input.Priority))
+	for _, rule := range fake.Rules {
+		if aws.StringValue(rule.Priority) == priority && strings.HasPrefix(aws.StringValue(rule.RuleArn), fake.ruleArnPrefix(listener)) {
+			return nil, awserr.New(elbv2.ErrCodePriorityInUseException, "Priority '"+priority+"' is currently in use", nil)
+		}
+	}
+	for _, action := range input.Actions {
+		if action.TargetGroupArn == nil {
+			continue
+		}
+		targetGroup, ok := fake.TargetGroups[aws.StringValue(action.TargetGroupArn)]
+		if !ok {
+			return nil, awserr.New(elbv2.ErrCodeTargetGroupNotFoundException, "One or more target groups not found", nil)
+		}
+		targetGroup.LoadBalancerArns = append(targetGroup.LoadBalancerArns, listener.LoadBalancerArn)
+	}
+	fake.counter++
+	rule := &elbv2.Rule{
+		Actions:    input.Actions,
+		Conditions: input.Conditions,
+		IsDefault:  aws.Bool(false),
+		Priority:   aws.String(priority),
+		RuleArn:    aws.String(fmt.Sprintf("%s%016x", fake.ruleArnPrefix(listener), fake.counter)),
+	}
+	fake.Rules[aws.StringValue(rule.RuleArn)] = rule
+	return &elbv2.CreateRuleOutput{
+		Rules: []*elbv2.Rule{
+			rule,
+		},
+	}, nil
+}
+
+// CreateTargetGroupWithContext creates a target group with the given settings.
+func (fake *ELBV2) CreateTargetGroupWithContext(ctx aws.Context, input *elbv2.CreateTargetGroupInput, opts ...request.Option) (*elbv2.CreateTargetGroupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	for _, targetGroup := range fake.TargetGroups {
+		if aws.StringValue(targetGroup.TargetGroupName) == name {
+			return nil, awserr.New(elbv2.ErrCodeDuplicateTargetGroupNameException, "A target group with the same name '"+name+"' exists", nil)
+		}
+	}
+	fake.counter++
+	targetGroup := &elbv2.TargetGroup{
+		HealthCheckPath: input.HealthCheckPath,
+		Port:            input.Port,
+		Protocol:        input.Protocol,
+		TargetGroupArn:  aws.String(fake.arn(fmt.Sprintf("targetgroup/%s/%016x", name, fake.counter))),
+		TargetGroupName: aws.String(name),
+		TargetType:      input.TargetType,
+		VpcId:           input.VpcId,
+	}
+	fake.TargetGroups[aws.StringValue(targetGroup.TargetGroupArn)] = targetGroup
+	return &elbv2.CreateTargetGroupOutput{
+		TargetGroups: []*elbv2.TargetGroup{
+			targetGroup,
+		},
+	}, nil
+}
+
+// DeleteTargetGroupWithContext deletes a target group that no rule forwards to.
+func (fake *ELBV2) DeleteTargetGroupWithContext(ctx aws.Context, input *elbv2.DeleteTargetGroupInput, opts ...request.Option) (*elbv2.DeleteTargetGroupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	arn := aws.StringValue(input.TargetGroupArn)
+	for _, rule := range fake.Rules {
+		for _, action := range rule.Actions {
+			if aws.StringValue(action.TargetGroupArn) == arn {
+				return nil, awserr.New(elbv2.ErrCodeResourceInUseException, "Target group '"+arn+"' is currently in use by a listener or a rule", nil)
+			}
+		}
+	}
+	delete(fake.TargetGroups, arn)
+	return &elbv2.DeleteTargetGroupOutput{}, nil
+}
+
+// AddTagsWithContext adds or overwrites tags of the given resources.
+func (fake *ELBV2) AddTagsWithContext(ctx aws.Context, input *elbv2.AddTagsInput, opts ...request.Option) (*elbv2.AddTagsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	for _, arn := range input.ResourceArns {
+		var tags []*elbv2.Tag
+		for _, tag := range fake.Tags[aws.StringValue(arn)] {
+			overwritten := false
+			for _, added := range input.Tags {
+				overwritten = overwritten || aws.StringValue(added.Key) == aws.StringValue(tag.Key)
+			}
+			if !overwritten {
+				tags = append(tags, tag)
+			}
+		}
+		fake.Tags[aws.StringValue(arn)] = append(tags, input.Tags...)
+	}
+	return &elbv2.AddTagsOutput{}, nil
+}
+
+func (fake *ELBV2) arn(resource string) string {
+	return fmt.Sprintf("arn:aws:elasticloadbalancing:%s:%s:%s", fake.Region, fake.AccountID, resource)
+}
+
+func (fake *ELBV2) ruleArnPrefix(listener *elbv2.Listener) string {
+	return strings.Replace(aws.StringValue(listener.ListenerArn), ":listener/", ":listener-rule/", 1) + "/"
+}
+
+func (fake *ELBV2) byName(name string) *elbv2.LoadBalancer {
+	for _, loadBalancer := range fake.LoadBalancers {
+		if aws.StringValue(loadBalancer.LoadBalancerName) == name {
+			return loadBalancer
+		}
+	}
+	return nil
+}
+
+func notFound() error {
+	return awserr.New(elbv2.ErrCodeLoadBalancerNotFoundException, "One or more load balancers not found", nil)
+}
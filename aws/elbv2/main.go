@@ -1,62 +1,291 @@
 package elbv2
 
 import (
+  "context"
   "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/elbv2"
+  "github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
   "github.com/PyramidSystemsInc/go/aws/ec2"
+  "github.com/PyramidSystemsInc/go/aws/util"
   "github.com/PyramidSystemsInc/go/errors"
 )
 
+// Client - Manages application load balancers, target groups and forwarding rules through ELBv2
+type Client struct {
+  ELBV2 elbv2iface.ELBV2API
+  EC2 *ec2.Client
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    ELBV2: elbv2.New(awsSession),
+    EC2: ec2.New(awsSession),
+  }
+}
+
 func Create(name string, awsSession *session.Session) (string, string, string) {
-  elbv2Client := elbv2.New(awsSession)
-  vpcId := "vpc-76cf681f"
-  loadBalancer, err := elbv2Client.CreateLoadBalancer(&elbv2.CreateLoadBalancerInput{
-    Name: aws.String(name),
-    Subnets: ec2.ListAllSubnetIds(vpcId, awsSession),
-  })
+  loadBalancerArn, listenerArn, loadBalancerUrl, err := CreateE(name, awsSession)
+  errors.QuitIfError(err)
+  return loadBalancerArn, listenerArn, loadBalancerUrl
+}
+
+// CreateE - Creates a load balancer with a default listener in the default VPC and returns its ARN, listener ARN and URL, or an error
+func CreateE(name string, awsSession *session.Session) (string, string, string, error) {
+  return CreateWithContext(context.Background(), name, awsSession)
+}
+
+// CreateWithContext - CreateE with a context to allow cancellation
+func CreateWithContext(ctx context.Context, name string, awsSession *session.Session) (string, string, string, error) {
+  return New(awsSession).Create(ctx, name)
+}
+
+// Create - Creates a load balancer with a default listener in the default VPC and returns its ARN, listener ARN and URL, or an error
+func (client *Client) Create(ctx context.Context, name string) (string, string, string, error) {
+  return client.CreateInNetwork(ctx, name, ec2.NetworkConfig{})
+}
+
+func CreateInNetwork(name string, network ec2.NetworkConfig, awsSession *session.Session) (string, string, string) {
+  loadBalancerArn, listenerArn, loadBalancerUrl, err := CreateInNetworkE(name, network, awsSession)
   errors.QuitIfError(err)
+  return loadBalancerArn, listenerArn, loadBalancerUrl
+}
+
+// CreateInNetworkE - Creates a load balancer with a default listener in the given network and returns its ARN, listener ARN and URL, or an error
+func CreateInNetworkE(name string, network ec2.NetworkConfig, awsSession *session.Session) (string, string, string, error) {
+  return CreateInNetworkWithContext(context.Background(), name, network, awsSession)
+}
+
+// CreateInNetworkWithContext - CreateInNetworkE with a context to allow cancellation
+func CreateInNetworkWithContext(ctx context.Context, name string, network ec2.NetworkConfig, awsSession *session.Session) (string, string, string, error) {
+  return New(awsSession).CreateInNetwork(ctx, name, network)
+}
+
+// CreateInNetwork - Creates a load balancer with a default listener in the given network and returns its ARN, listener ARN and URL, or an error.
+// Empty fields of the network configuration are discovered, starting from the default VPC. A load balancer without public IPs is internal
+func (client *Client) CreateInNetwork(ctx context.Context, name string, network ec2.NetworkConfig) (string, string, string, error) {
+  network, err := client.EC2.ResolveNetworkConfig(ctx, network)
+  if err != nil {
+    return "", "", "", err
+  }
+  input := &elbv2.CreateLoadBalancerInput{
+    Name: aws.String(name),
+    Subnets: aws.StringSlice(network.SubnetIds),
+  }
+  if len(network.SecurityGroupIds) > 0 {
+    input.SecurityGroups = aws.StringSlice(network.SecurityGroupIds)
+  }
+  if network.AssignPublicIp == ec2.PublicIpDisabled {
+    input.Scheme = aws.String(elbv2.LoadBalancerSchemeEnumInternal)
+  }
+  loadBalancer, err := client.ELBV2.CreateLoadBalancerWithContext(ctx, input)
+  if err != nil {
+    return "", "", "", err
+  }
   loadBalancerArn := loadBalancer.LoadBalancers[0].LoadBalancerArn
   loadBalancerUrl := loadBalancer.LoadBalancers[0].DNSName
-  listenerArn := createDefaultListener(loadBalancerArn, elbv2Client)
-  return *loadBalancerArn, *listenerArn, *loadBalancerUrl
+  listenerArn, err := client.createDefaultListener(ctx, loadBalancerArn)
+  if err != nil {
+    return *loadBalancerArn, "", *loadBalancerUrl, err
+  }
+  return *loadBalancerArn, *listenerArn, *loadBalancerUrl, nil
+}
+
+func CreateForwardRule(listenerArn string, pathPattern string, priority int64, targetGroupArn string, awsSession *session.Session) string {
+  ruleArn, err := CreateForwardRuleE(listenerArn, pathPattern, priority, targetGroupArn, awsSession)
+  errors.QuitIfError(err)
+  return ruleArn
+}
+
+// CreateForwardRuleE - Adds a listener rule forwarding requests matching the path pattern (such as /api/*) to a target group and returns its ARN, or an error
+func CreateForwardRuleE(listenerArn string, pathPattern string, priority int64, targetGroupArn string, awsSession *session.Session) (string, error) {
+  return CreateForwardRuleWithContext(context.Background(), listenerArn, pathPattern, priority, targetGroupArn, awsSession)
+}
+
+// CreateForwardRuleWithContext - CreateForwardRuleE with a context to allow cancellation
+func CreateForwardRuleWithContext(ctx context.Context, listenerArn string, pathPattern string, priority int64, targetGroupArn string, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateForwardRule(ctx, listenerArn, pathPattern, priority, targetGroupArn)
+}
+
+// CreateForwardRule - Adds a listener rule forwarding requests matching the path pattern (such as /api/*) to a target group and returns its ARN, or an error.
+// Rules with a lower priority are evaluated first
+func (client *Client) CreateForwardRule(ctx context.Context, listenerArn string, pathPattern string, priority int64, targetGroupArn string) (string, error) {
+  result, err := client.ELBV2.CreateRuleWithContext(ctx, &elbv2.CreateRuleInput{
+    Actions: []*elbv2.Action{
+      {
+        TargetGroupArn: aws.String(targetGroupArn),
+        Type: aws.String(elbv2.ActionTypeEnumForward),
+      },
+    },
+    Conditions: []*elbv2.RuleCondition{
+      {
+        Field: aws.String("path-pattern"),
+        PathPatternConfig: &elbv2.PathPatternConditionConfig{
+          Values: []*string{
+            aws.String(pathPattern),
+          },
+        },
+      },
+    },
+    ListenerArn: aws.String(listenerArn),
+    Priority: aws.Int64(priority),
+  })
+  if err != nil {
+    return "", err
+  }
+  return *result.Rules[0].RuleArn, nil
+}
+
+func CreateTargetGroup(name string, vpcId string, port int64, healthCheckPath string, awsSession *session.Session) string {
+  targetGroupArn, err := CreateTargetGroupE(name, vpcId, port, healthCheckPath, awsSession)
+  errors.QuitIfError(err)
+  return targetGroupArn
+}
+
+// CreateTargetGroupE - Creates an HTTP target group of IP addresses, as used by Fargate services, and returns its ARN or an error
+func CreateTargetGroupE(name string, vpcId string, port int64, healthCheckPath string, awsSession *session.Session) (string, error) {
+  return CreateTargetGroupWithContext(context.Background(), name, vpcId, port, healthCheckPath, awsSession)
+}
+
+// CreateTargetGroupWithContext - CreateTargetGroupE with a context to allow cancellation
+func CreateTargetGroupWithContext(ctx context.Context, name string, vpcId string, port int64, healthCheckPath string, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateTargetGroup(ctx, name, vpcId, port, healthCheckPath)
+}
+
+// CreateTargetGroup - Creates an HTTP target group of IP addresses, as used by Fargate services, and returns its ARN or an error.
+// An empty VPC ID uses the default VPC and an empty health check path uses /
+func (client *Client) CreateTargetGroup(ctx context.Context, name string, vpcId string, port int64, healthCheckPath string) (string, error) {
+  var err error
+  if vpcId == "" {
+    vpcId, err = client.EC2.FindDefaultVpcId(ctx)
+    if err != nil {
+      return "", err
+    }
+  }
+  if healthCheckPath == "" {
+    healthCheckPath = "/"
+  }
+  result, err := client.ELBV2.CreateTargetGroupWithContext(ctx, &elbv2.CreateTargetGroupInput{
+    HealthCheckPath: aws.String(healthCheckPath),
+    Name: aws.String(name),
+    Port: aws.Int64(port),
+    Protocol: aws.String(elbv2.ProtocolEnumHttp),
+    TargetType: aws.String(elbv2.TargetTypeEnumIp),
+    VpcId: aws.String(vpcId),
+  })
+  if err != nil {
+    return "", err
+  }
+  return *result.TargetGroups[0].TargetGroupArn, nil
 }
 
 func Delete(arn string, awsSession *session.Session) {
-  elbv2Client := elbv2.New(awsSession)
-  _, err := elbv2Client.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{
+  errors.QuitIfError(DeleteE(arn, awsSession))
+}
+
+// DeleteE - Deletes a load balancer, returning any error
+func DeleteE(arn string, awsSession *session.Session) error {
+  return DeleteWithContext(context.Background(), arn, awsSession)
+}
+
+// DeleteWithContext - DeleteE with a context to allow cancellation
+func DeleteWithContext(ctx context.Context, arn string, awsSession *session.Session) error {
+  return New(awsSession).Delete(ctx, arn)
+}
+
+// Delete - Deletes a load balancer, returning any error
+func (client *Client) Delete(ctx context.Context, arn string) error {
+  _, err := client.ELBV2.DeleteLoadBalancerWithContext(ctx, &elbv2.DeleteLoadBalancerInput{
     LoadBalancerArn: aws.String(arn),
   })
-  errors.QuitIfError(err)
+  return err
+}
+
+func DeleteTargetGroup(arn string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteTargetGroupE(arn, awsSession))
+}
+
+// DeleteTargetGroupE - Deletes a target group that is no longer used by a listener rule or service, returning any error
+func DeleteTargetGroupE(arn string, awsSession *session.Session) error {
+  return DeleteTargetGroupWithContext(context.Background(), arn, awsSession)
+}
+
+// DeleteTargetGroupWithContext - DeleteTargetGroupE with a context to allow cancellation
+func DeleteTargetGroupWithContext(ctx context.Context, arn string, awsSession *session.Session) error {
+  return New(awsSession).DeleteTargetGroup(ctx, arn)
+}
+
+// DeleteTargetGroup - Deletes a target group that is no longer used by a listener rule or service, returning any error
+func (client *Client) DeleteTargetGroup(ctx context.Context, arn string) error {
+  _, err := client.ELBV2.DeleteTargetGroupWithContext(ctx, &elbv2.DeleteTargetGroupInput{
+    TargetGroupArn: aws.String(arn),
+  })
+  return err
 }
 
 func Exists(nameOrArn string, awsSession *session.Session) bool {
-  loadBalancer := getLoadBalancer(nameOrArn, awsSession)
-  return loadBalancer != nil
+  exists, _ := ExistsE(nameOrArn, awsSession)
+  return exists
+}
+
+// ExistsE - Checks if a load balancer exists. An error is only returned when the lookup itself fails
+func ExistsE(nameOrArn string, awsSession *session.Session) (bool, error) {
+  return ExistsWithContext(context.Background(), nameOrArn, awsSession)
+}
+
+// ExistsWithContext - ExistsE with a context to allow cancellation
+func ExistsWithContext(ctx context.Context, nameOrArn string, awsSession *session.Session) (bool, error) {
+  return New(awsSession).Exists(ctx, nameOrArn)
+}
+
+// Exists - Checks if a load balancer exists. An error is only returned when the lookup itself fails
+func (client *Client) Exists(ctx context.Context, nameOrArn string) (bool, error) {
+  loadBalancer, err := client.getLoadBalancer(ctx, nameOrArn)
+  return loadBalancer != nil, err
 }
 
 func Tag(nameOrArn string, key string, value string, awsSession *session.Session) {
-  loadBalancer := getLoadBalancer(nameOrArn, awsSession)
-  if loadBalancer != nil {
-    arn := getArn(loadBalancer)
-    elbv2Client := elbv2.New(awsSession)
-    _, err := elbv2Client.AddTags(&elbv2.AddTagsInput{
-      ResourceArns: []*string{
-        aws.String(arn),
-      },
-      Tags: []*elbv2.Tag{
-        &elbv2.Tag{
-          Key: aws.String(key),
-          Value: aws.String(value),
-        },
-      },
-    })
-    errors.LogIfError(err)
+  errors.LogIfError(TagE(nameOrArn, key, value, awsSession))
+}
+
+// TagE - Adds a tag to a load balancer found by name or ARN, returning any error
+func TagE(nameOrArn string, key string, value string, awsSession *session.Session) error {
+  return TagWithContext(context.Background(), nameOrArn, key, value, awsSession)
+}
+
+// TagWithContext - TagE with a context to allow cancellation
+func TagWithContext(ctx context.Context, nameOrArn string, key string, value string, awsSession *session.Session) error {
+  return New(awsSession).Tag(ctx, nameOrArn, key, value)
+}
+
+// Tag - Adds a tag to a load balancer found by name or ARN, returning any error
+func (client *Client) Tag(ctx context.Context, nameOrArn string, key string, value string) error {
+  loadBalancer, err := client.getLoadBalancer(ctx, nameOrArn)
+  if err != nil {
+    return err
   }
+  if loadBalancer == nil {
+    return errors.New("Load balancer tagging failed. The load balancer could not be found by either name or ARN")
+  }
+  arn := getArn(loadBalancer)
+  _, err = client.ELBV2.AddTagsWithContext(ctx, &elbv2.AddTagsInput{
+    ResourceArns: []*string{
+      aws.String(arn),
+    },
+    Tags: []*elbv2.Tag{
+      &elbv2.Tag{
+        Key: aws.String(key),
+        Value: aws.String(value),
+      },
+    },
+  })
+  return err
 }
 
-func createDefaultListener(loadBalancerArn *string, elbv2Client *elbv2.ELBV2) *string {
-  listener, err := elbv2Client.CreateListener(&elbv2.CreateListenerInput{
+func (client *Client) createDefaultListener(ctx context.Context, loadBalancerArn *string) (*string, error) {
+  listener, err := client.ELBV2.CreateListenerWithContext(ctx, &elbv2.CreateListenerInput{
     DefaultActions: []*elbv2.Action{
       {
         Order: aws.Int64(1),
@@ -75,8 +304,10 @@ func createDefaultListener(loadBalancerArn *string, elbv2Client *elbv2.ELBV2) *s
     Port: aws.Int64(80),
     Protocol: aws.String("HTTP"),
   })
-  errors.QuitIfError(err)
-  return listener.Listeners[0].ListenerArn
+  if err != nil {
+    return nil, err
+  }
+  return listener.Listeners[0].ListenerArn, nil
 }
 
 func getArn(loadBalancer *elbv2.LoadBalancer) string {
@@ -86,29 +317,33 @@ func getArn(loadBalancer *elbv2.LoadBalancer) string {
   return ""
 }
 
-func getLoadBalancer(nameOrArn string, awsSession *session.Session) *elbv2.LoadBalancer {
-  elbv2Client := elbv2.New(awsSession)
-  result, err := elbv2Client.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
-    Names: []*string{
+func (client *Client) getLoadBalancer(ctx context.Context, nameOrArn string) (*elbv2.LoadBalancer, error) {
+  input := &elbv2.DescribeLoadBalancersInput{}
+  if util.IsArn(nameOrArn) {
+    input.LoadBalancerArns = []*string{
       aws.String(nameOrArn),
-    },
-  })
-  if loadBalancerFound(result, err) {
-    return result.LoadBalancers[0]
+    }
   } else {
-    result, err := elbv2Client.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
-      LoadBalancerArns: []*string {
-        aws.String(nameOrArn),
-      },
-    })
-    if loadBalancerFound(result, err) {
-      return result.LoadBalancers[0]
-    } else {
-      return nil
+    input.Names = []*string{
+      aws.String(nameOrArn),
     }
   }
+  result, err := client.ELBV2.DescribeLoadBalancersWithContext(ctx, input)
+  if isLoadBalancerNotFound(err) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  if len(result.LoadBalancers) == 0 {
+    return nil, nil
+  }
+  return result.LoadBalancers[0], nil
 }
 
-func loadBalancerFound(result *elbv2.DescribeLoadBalancersOutput, err error) bool {
-  return err == nil && len(result.LoadBalancers) > 0
+func isLoadBalancerNotFound(err error) bool {
+  if awsErr, ok := err.(awserr.Error); ok {
+    return awsErr.Code() == elbv2.ErrCodeLoadBalancerNotFoundException
+  }
+  return false
 }
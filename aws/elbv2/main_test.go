@@ -0,0 +1,169 @@
+package elbv2
+
+import (
+  "context"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/ec2"
+  "github.com/PyramidSystemsInc/go/aws/ec2/ec2fake"
+  "github.com/PyramidSystemsInc/go/aws/elbv2/elbv2fake"
+  "github.com/aws/aws-sdk-go/aws"
+  awsec2 "github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func newFakeClient() (*Client, *elbv2fake.ELBV2) {
+  fake := elbv2fake.New()
+  ec2Fake := ec2fake.New()
+  ec2Fake.Vpcs = []*awsec2.Vpc{
+    {
+      IsDefault: aws.Bool(true),
+      VpcId: aws.String("vpc-default"),
+    },
+  }
+  ec2Fake.Subnets = []*awsec2.Subnet{
+    {
+      SubnetId: aws.String("subnet-default-a"),
+      VpcId: aws.String("vpc-default"),
+    },
+  }
+  return &Client{
+    ELBV2: fake,
+    EC2: &ec2.Client{EC2: ec2Fake},
+  }, fake
+}
+
+// TestCreate creates a load balancer with its default listener in the default VPC.
+func TestCreate(t *testing.T) {
+  client, fake := newFakeClient()
+
+  arn, listenerArn, url, err := client.Create(context.Background(), "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  loadBalancer, found := fake.LoadBalancers[arn]
+  if !found || aws.StringValue(loadBalancer.DNSName) != url {
+    t.Fatalf("expected the load balancer %s with the URL %s, got %v", arn, url, loadBalancer)
+  }
+  if aws.StringValue(loadBalancer.Scheme) != "internet-facing" {
+    t.Error("expected an internet facing load balancer")
+  }
+  if fake.Listeners[listenerArn] == nil {
+    t.Errorf("the listener %s was not created", listenerArn)
+  }
+}
+
+// TestCreateInNetworkInternal creates a load balancer without public IPs as an internal one.
+func TestCreateInNetworkInternal(t *testing.T) {
+  client, fake := newFakeClient()
+
+  arn, _, _, err := client.CreateInNetwork(context.Background(), "example", ec2.NetworkConfig{AssignPublicIp: ec2.PublicIpDisabled})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if aws.StringValue(fake.LoadBalancers[arn].Scheme) != "internal" {
+    t.Errorf("expected an internal load balancer, got %v", fake.LoadBalancers[arn])
+  }
+}
+
+// TestCreateTargetGroup creates a target group in the default VPC with the default health check path.
+func TestCreateTargetGroup(t *testing.T) {
+  client, fake := newFakeClient()
+
+  arn, err := client.CreateTargetGroup(context.Background(), "example", "", 8080, "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  targetGroup := fake.TargetGroups[arn]
+  if targetGroup == nil || aws.StringValue(targetGroup.VpcId) != "vpc-default" || aws.Int64Value(targetGroup.Port) != 8080 {
+    t.Errorf("unexpected target group %v", targetGroup)
+  }
+}
+
+// TestCreateForwardRule forwards a path pattern of a listener to a target group.
+func TestCreateForwardRule(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  _, listenerArn, _, err := client.Create(ctx, "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  targetGroupArn, err := client.CreateTargetGroup(ctx, "example", "", 8080, "/health")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  ruleArn, err := client.CreateForwardRule(ctx, listenerArn, "/api/*", 10, targetGroupArn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  rule := fake.Rules[ruleArn]
+  if rule == nil || aws.StringValue(rule.Actions[0].TargetGroupArn) != targetGroupArn {
+    t.Errorf("unexpected rule %v", rule)
+  }
+}
+
+// TestExists finds a load balancer by its name and by its ARN.
+func TestExists(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  arn, _, _, err := client.Create(ctx, "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for _, nameOrArn := range []string{"example", arn} {
+    exists, err := client.Exists(ctx, nameOrArn)
+    if err != nil || !exists {
+      t.Errorf("expected %s to exist, got %v, %v", nameOrArn, exists, err)
+    }
+  }
+  exists, err := client.Exists(ctx, "missing")
+  if err != nil || exists {
+    t.Errorf("expected a missing load balancer not to exist, got %v, %v", exists, err)
+  }
+}
+
+// TestTag tags a load balancer found by its name.
+func TestTag(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  arn, _, _, err := client.Create(ctx, "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.Tag(ctx, "example", "pac-project", "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  tags := fake.Tags[arn]
+  if len(tags) != 1 || aws.StringValue(tags[0].Value) != "example" {
+    t.Errorf("unexpected tags %v", tags)
+  }
+}
+
+// TestDelete deletes a load balancer and a target group.
+func TestDelete(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  arn, _, _, err := client.Create(ctx, "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  targetGroupArn, err := client.CreateTargetGroup(ctx, "example", "", 8080, "")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.Delete(ctx, arn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.DeleteTargetGroup(ctx, targetGroupArn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fake.LoadBalancers) != 0 || len(fake.TargetGroups) != 0 {
+    t.Errorf("expected nothing to be left, got %v and %v", fake.LoadBalancers, fake.TargetGroups)
+  }
+}
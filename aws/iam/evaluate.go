@@ -0,0 +1,273 @@
+package iam
+
+import (
+  "net"
+  "regexp"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Request is a call that Evaluate decides on.
+type Request struct {
+  // Principal makes the call: an IAM or STS ARN, an account id, or a service such as ecs-tasks.amazonaws.com. It is
+  // only compared with the principals of resource policies
+  Principal string
+  // Action is a single action, such as s3:GetObject
+  Action string
+  // Resource is the ARN acted on. It may be empty for trust policies, which have no resources
+  Resource string
+  // Context holds the values of condition keys, such as aws:SecureTransport or kms:ViaService
+  Context map[string]string
+}
+
+// Decision is the outcome of Evaluate.
+type Decision string
+
+const (
+  // Allowed means a statement allows the request and none denies it
+  Allowed Decision = "Allowed"
+  // ExplicitDeny means a statement denies the request, whatever others allow
+  ExplicitDeny Decision = "ExplicitDeny"
+  // ImplicitDeny means no statement matches the request, so it is denied by default
+  ImplicitDeny Decision = "ImplicitDeny"
+)
+
+// Evaluate decides on a request offline against the policies together, the way AWS combines the identity and resource
+// policies of one account: a matching Deny statement wins, then a matching Allow statement, and otherwise the request
+// is denied. It is meant for checking simple cases in tests and before deploying. Service control policies, permissions
+// boundaries and session policies are not considered, policy variables such as ${aws:username} are not substituted,
+// and every condition key has a single value.
+func Evaluate(request Request, documents ...PolicyDocument) Decision {
+  decision := ImplicitDeny
+  for _, document := range documents {
+    for _, statement := range document.Statement {
+      if !statement.matches(request) {
+        continue
+      }
+      if statement.Effect == "Deny" {
+        return ExplicitDeny
+      }
+      if statement.Effect == "Allow" {
+        decision = Allowed
+      }
+    }
+  }
+  return decision
+}
+
+// Evaluate decides on a request offline against this policy alone, as the Evaluate function does.
+func (document PolicyDocument) Evaluate(request Request) Decision {
+  return Evaluate(request, document)
+}
+
+// IsAllowed reports whether the policy alone allows the request.
+func (document PolicyDocument) IsAllowed(request Request) bool {
+  return Evaluate(request, document) == Allowed
+}
+
+// matches reports whether the statement applies to the request, whatever its effect.
+func (statement Statement) matches(request Request) bool {
+  if len(statement.Principal) > 0 && !principalMatches(statement.Principal, request.Principal) {
+    return false
+  }
+  if len(statement.NotPrincipal) > 0 && principalMatches(statement.NotPrincipal, request.Principal) {
+    return false
+  }
+  if len(statement.Action) > 0 && !anyMatches(statement.Action, request.Action, true) {
+    return false
+  }
+  if len(statement.NotAction) > 0 && anyMatches(statement.NotAction, request.Action, true) {
+    return false
+  }
+  if len(statement.Resource) > 0 && !anyMatches(statement.Resource, request.Resource, false) {
+    return false
+  }
+  if len(statement.NotResource) > 0 && anyMatches(statement.NotResource, request.Resource, false) {
+    return false
+  }
+  for operator, keys := range statement.Condition {
+    for key, values := range keys {
+      if !conditionHolds(operator, key, values, request.Context) {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+// principalMatches reports whether the caller is one of the principals. An account, by id or root ARN, covers every
+// principal of the account, and a role covers the sessions of the role.
+func principalMatches(principals Principals, caller string) bool {
+  for principalType, values := range principals {
+    for _, value := range values {
+      if value == "*" || value == caller {
+        return true
+      }
+      if principalType != "AWS" {
+        continue
+      }
+      account := ""
+      if isAccountId(value) {
+        account = value
+      } else if strings.HasPrefix(value, "arn:") && strings.HasSuffix(value, ":root") {
+        account = arnField(value, 4)
+      }
+      if account != "" && (caller == account || arnField(caller, 4) == account) {
+        return true
+      }
+      if arnField(caller, 2) == "sts" && strings.HasPrefix(arnField(caller, 5), "assumed-role/") && arnField(value, 4) == arnField(caller, 4) &&
+        strings.HasPrefix(arnField(value, 5), "role/") {
+        roleName := value[strings.LastIndex(value, "/") + 1:]
+        if strings.Split(arnField(caller, 5), "/")[1] == roleName {
+          return true
+        }
+      }
+    }
+  }
+  return false
+}
+
+// conditionHolds evaluates one condition key of a statement. A key missing from the context fails the condition,
+// except with IfExists, ForAllValues:, Null and the negated operators, such as StringNotEquals.
+func conditionHolds(operator string, key string, values StringList, context map[string]string) bool {
+  base, known := baseOperator(operator)
+  if !known {
+    return false
+  }
+  actual, present := "", false
+  for contextKey, value := range context {
+    if strings.EqualFold(contextKey, key) {
+      actual, present = value, true
+    }
+  }
+  if base == "Null" {
+    for _, value := range values {
+      if strings.EqualFold(value, "true") != present {
+        return true
+      }
+    }
+    return false
+  }
+  negated := strings.Contains(base, "Not")
+  if !present {
+    return strings.HasSuffix(operator, "IfExists") || strings.HasPrefix(operator, "ForAllValues:") || negated
+  }
+  positive := strings.Replace(base, "Not", "", 1)
+  matched := false
+  for _, value := range values {
+    matched = matched || compareCondition(positive, actual, value)
+  }
+  return matched != negated
+}
+
+// compareCondition reports whether the actual value of a key satisfies a positive operator for one policy value.
+func compareCondition(operator string, actual string, expected string) bool {
+  switch operator {
+  case "StringEquals", "BinaryEquals":
+    return actual == expected
+  case "StringEqualsIgnoreCase", "Bool":
+    return strings.EqualFold(actual, expected)
+  case "StringLike", "ArnEquals", "ArnLike":
+    return wildcardMatches(expected, actual, false)
+  case "IpAddress":
+    if strings.Contains(expected, ":") && !strings.Contains(expected, "/") {
+      expected += "/128"
+    } else if !strings.Contains(expected, "/") {
+      expected += "/32"
+    }
+    _, network, err := net.ParseCIDR(expected)
+    ip := net.ParseIP(actual)
+    return err == nil && ip != nil && network.Contains(ip)
+  }
+  var order int
+  if strings.HasPrefix(operator, "Numeric") {
+    a, errA := strconv.ParseFloat(actual, 64)
+    b, errB := strconv.ParseFloat(expected, 64)
+    if errA != nil || errB != nil {
+      return false
+    }
+    order = compareFloats(a, b)
+    operator = strings.TrimPrefix(operator, "Numeric")
+  } else {
+    a, okA := parseDate(actual)
+    b, okB := parseDate(expected)
+    if !okA || !okB {
+      return false
+    }
+    order = compareFloats(float64(a.UnixNano()), float64(b.UnixNano()))
+    operator = strings.TrimPrefix(operator, "Date")
+  }
+  switch operator {
+  case "Equals":
+    return order == 0
+  case "LessThan":
+    return order < 0
+  case "LessThanEquals":
+    return order <= 0
+  case "GreaterThan":
+    return order > 0
+  case "GreaterThanEquals":
+    return order >= 0
+  }
+  return false
+}
+
+func anyMatches(patterns StringList, value string, ignoreCase bool) bool {
+  for _, pattern := range patterns {
+    if wildcardMatches(pattern, value, ignoreCase) {
+      return true
+    }
+  }
+  return false
+}
+
+// wildcardMatches reports whether a value matches a pattern in which * matches any characters and ? any one.
+func wildcardMatches(pattern string, value string, ignoreCase bool) bool {
+  expression := regexp.QuoteMeta(pattern)
+  expression = strings.Replace(expression, `\*`, ".*", -1)
+  expression = strings.Replace(expression, `\?`, ".", -1)
+  if ignoreCase {
+    expression = "(?i)" + expression
+  }
+  matched, err := regexp.MatchString("^" + expression + "$", value)
+  return err == nil && matched
+}
+
+// arnField returns a field of an ARN, such as 2 for the service or 4 for the account, or "" for anything else.
+func arnField(arn string, index int) string {
+  fields := strings.SplitN(arn, ":", 6)
+  if len(fields) < 6 || fields[0] != "arn" {
+    return ""
+  }
+  return fields[index]
+}
+
+func isAccountId(value string) bool {
+  if len(value) != 12 {
+    return false
+  }
+  _, err := strconv.ParseUint(value, 10, 64)
+  return err == nil
+}
+
+// parseDate reads a date as AWS takes it in conditions: RFC 3339 or seconds since the epoch.
+func parseDate(value string) (time.Time, bool) {
+  if date, err := time.Parse(time.RFC3339, value); err == nil {
+    return date, true
+  }
+  if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+    return time.Unix(seconds, 0), true
+  }
+  return time.Time{}, false
+}
+
+func compareFloats(a float64, b float64) int {
+  if a < b {
+    return -1
+  }
+  if a > b {
+    return 1
+  }
+  return 0
+}
@@ -0,0 +1,444 @@
+// Package iamfake is an in-memory stand-in for the parts of the IAM API used by the
+// github.com/PyramidSystemsInc/go/aws/iam package, so it can be unit tested offline.
+package iamfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// IAM keeps roles, their policies and instance profiles in memory, keyed by name. Trust policies
+// are kept as given rather than URL encoded as IAM returns them. Calling an operation that is not
+// implemented panics.
+type IAM struct {
+	iamiface.IAMAPI
+
+	mutex     sync.Mutex
+	AccountID string
+	Roles     map[string]*iam.Role
+	// AttachedPolicies holds the managed policy ARNs of each role, and InlinePolicies the policy
+	// documents of each role by policy name.
+	AttachedPolicies map[string][]string
+	InlinePolicies   map[string]map[string]string
+	InstanceProfiles map[string]*iam.InstanceProfile
+	// PageSize is the number of entries the list operations return per page.
+	PageSize int
+}
+
+// New returns an empty fake for account 123456789012.
+func New() *IAM {
+	return &IAM{
+		AccountID:        "123456789012",
+		Roles:            map[string]*iam.Role{},
+		AttachedPolicies: map[string][]string{},
+		InlinePolicies:   map[string]map[string]string{},
+		InstanceProfiles: map[string]*iam.InstanceProfile{},
+		PageSize:         100,
+	}
+}
+
+// AddRoleToInstanceProfileWithContext puts a role in an instance profile, which holds at most one.
+func (fake *IAM) AddRoleToInstanceProfileWithContext(ctx aws.Context, input *iam.AddRoleToInstanceProfileInput, opts ...request.Option) (*iam.AddRoleToInstanceProfileOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := fake.InstanceProfiles[aws.StringValue(input.InstanceProfileName)]
+	if !ok {
+		return nil, noSuchEntity("instance profile", aws.StringValue(input.InstanceProfileName))
+	}
+	if len(profile.Roles) > 0 {
+		return nil, awserr.New(iam.ErrCodeLimitExceededException, "Cannot exceed quota for InstanceSessionsPerInstanceProfile: 1", nil)
+	}
+	profile.Roles = []*iam.Role{role}
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+// AttachRolePolicyWithContext attaches a managed policy to a role, once.
+func (fake *IAM) AttachRolePolicyWithContext(ctx aws.Context, input *iam.AttachRolePolicyInput, opts ...request.Option) (*iam.AttachRolePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(role.RoleName)
+	for _, policyArn := range fake.AttachedPolicies[name] {
+		if policyArn == aws.StringValue(input.PolicyArn) {
+			return &iam.AttachRolePolicyOutput{}, nil
+		}
+	}
+	fake.AttachedPolicies[name] = append(fake.AttachedPolicies[name], aws.StringValue(input.PolicyArn))
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+// CreateInstanceProfileWithContext creates an empty instance profile.
+func (fake *IAM) CreateInstanceProfileWithContext(ctx aws.Context, input *iam.CreateInstanceProfileInput, opts ...request.Option) (*iam.CreateInstanceProfileOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.InstanceProfileName)
+	if _, ok := fake.InstanceProfiles[name]; ok {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "Instance Profile "+name+" already exists.", nil)
+	}
+	path := pathOrRoot(input.Path)
+	profile := &iam.InstanceProfile{
+		Arn:                 aws.String(fmt.Sprintf("arn:aws:iam::%s:instance-profile%s%s", fake.AccountID, path, name)),
+		CreateDate:          aws.Time(time.Now()),
+		InstanceProfileName: aws.String(name),
+		Path:                aws.String(path),
+	}
+	fake.InstanceProfiles[name] = profile
+	return &iam.CreateInstanceProfileOutput{
+		InstanceProfile: profile,
+	}, nil
+}
+
+// CreateRoleWithContext creates a role with a trust policy, which must be valid JSON.
+func (fake *IAM) CreateRoleWithContext(ctx aws.Context, input *iam.CreateRoleInput, opts ...request.Option) (*iam.CreateRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.RoleName)
+	if _, ok := fake.Roles[name]; ok {
+		return nil, awserr.New(iam.ErrCodeEntityAlreadyExistsException, "Role with name "+name+" already exists.", nil)
+	}
+	if err := validPolicy(input.AssumeRolePolicyDocument); err != nil {
+		return nil, err
+	}
+	path := pathOrRoot(input.Path)
+	role := &iam.Role{
+		Arn:                      aws.String(fmt.Sprintf("arn:aws:iam::%s:role%s%s", fake.AccountID, path, name)),
+		AssumeRolePolicyDocument: input.AssumeRolePolicyDocument,
+		CreateDate:               aws.Time(time.Now()),
+		Description:              input.Description,
+		Path:                     aws.String(path),
+		RoleId:                   aws.String(fmt.Sprintf("AROA%016d", len(fake.Roles)+1)),
+		RoleName:                 aws.String(name),
+		Tags:                     input.Tags,
+	}
+	fake.Roles[name] = role
+	return &iam.CreateRoleOutput{
+		Role: role,
+	}, nil
+}
+
+// DeleteInstanceProfileWithContext deletes an instance profile without roles.
+func (fake *IAM) DeleteInstanceProfileWithContext(ctx aws.Context, input *iam.DeleteInstanceProfileInput, opts ...request.Option) (*iam.DeleteInstanceProfileOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.InstanceProfileName)
+	profile, ok := fake.InstanceProfiles[name]
+	if !ok {
+		return nil, noSuchEntity("instance profile", name)
+	}
+	if len(profile.Roles) > 0 {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "Cannot delete entity, must remove roles from instance profile first.", nil)
+	}
+	delete(fake.InstanceProfiles, name)
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+// DeleteRoleWithContext deletes a role without policies or instance profiles, as IAM requires.
+func (fake *IAM) DeleteRoleWithContext(ctx aws.Context, input *iam.DeleteRoleInput, opts ...request.Option) (*iam.DeleteRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(role.RoleName)
+	if len(fake.AttachedPolicies[name]) > 0 {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "Cannot delete entity, must detach all policies first.", nil)
+	}
+	if len(fake.InlinePolicies[name]) > 0 {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "Cannot delete entity, must delete policies first.", nil)
+	}
+	if len(fake.profilesOf(name)) > 0 {
+		return nil, awserr.New(iam.ErrCodeDeleteConflictException, "Cannot delete entity, must remove roles from instance profile first.", nil)
+	}
+	delete(fake.Roles, name)
+	delete(fake.AttachedPolicies, name)
+	delete(fake.InlinePolicies, name)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+// DeleteRolePolicyWithContext deletes an inline policy of a role.
+func (fake *IAM) DeleteRolePolicyWithContext(ctx aws.Context, input *iam.DeleteRolePolicyInput, opts ...request.Option) (*iam.DeleteRolePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	policies := fake.InlinePolicies[aws.StringValue(role.RoleName)]
+	if _, ok := policies[aws.StringValue(input.PolicyName)]; !ok {
+		return nil, noSuchEntity("role policy", aws.StringValue(input.PolicyName))
+	}
+	delete(policies, aws.StringValue(input.PolicyName))
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+// DetachRolePolicyWithContext detaches a managed policy from a role.
+func (fake *IAM) DetachRolePolicyWithContext(ctx aws.Context, input *iam.DetachRolePolicyInput, opts ...request.Option) (*iam.DetachRolePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(role.RoleName)
+	for i, policyArn := range fake.AttachedPolicies[name] {
+		if policyArn == aws.StringValue(input.PolicyArn) {
+			fake.AttachedPolicies[name] = append(fake.AttachedPolicies[name][:i], fake.AttachedPolicies[name][i+1:]...)
+			return &iam.DetachRolePolicyOutput{}, nil
+		}
+	}
+	return nil, noSuchEntity("policy", aws.StringValue(input.PolicyArn))
+}
+
+// GetInstanceProfileWithContext returns an instance profile by name.
+func (fake *IAM) GetInstanceProfileWithContext(ctx aws.Context, input *iam.GetInstanceProfileInput, opts ...request.Option) (*iam.GetInstanceProfileOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	profile, ok := fake.InstanceProfiles[aws.StringValue(input.InstanceProfileName)]
+	if !ok {
+		return nil, noSuchEntity("instance profile", aws.StringValue(input.InstanceProfileName))
+	}
+	copied := *profile
+	return &iam.GetInstanceProfileOutput{
+		InstanceProfile: &copied,
+	}, nil
+}
+
+// GetRoleWithContext returns a copy of a role by name.
+func (fake *IAM) GetRoleWithContext(ctx aws.Context, input *iam.GetRoleInput, opts ...request.Option) (*iam.GetRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	copied := *role
+	return &iam.GetRoleOutput{
+		Role: &copied,
+	}, nil
+}
+
+// ListAttachedRolePoliciesPagesWithContext calls fn with pages of the managed policies of a role,
+// in the order they were attached, until fn returns false.
+func (fake *IAM) ListAttachedRolePoliciesPagesWithContext(ctx aws.Context, input *iam.ListAttachedRolePoliciesInput, fn func(*iam.ListAttachedRolePoliciesOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		fake.mutex.Unlock()
+		return err
+	}
+	var policies []*iam.AttachedPolicy
+	for _, policyArn := range fake.AttachedPolicies[aws.StringValue(role.RoleName)] {
+		policies = append(policies, &iam.AttachedPolicy{
+			PolicyArn:  aws.String(policyArn),
+			PolicyName: aws.String(policyArn[strings.LastIndex(policyArn, "/")+1:]),
+		})
+	}
+	fake.mutex.Unlock()
+	return fake.pages(len(policies), func(start, end int, last bool) bool {
+		return fn(&iam.ListAttachedRolePoliciesOutput{
+			AttachedPolicies: policies[start:end],
+			IsTruncated:      aws.Bool(!last),
+		}, last)
+	})
+}
+
+// ListInstanceProfilesForRolePagesWithContext calls fn with pages of the instance profiles holding
+// a role, sorted by name, until fn returns false.
+func (fake *IAM) ListInstanceProfilesForRolePagesWithContext(ctx aws.Context, input *iam.ListInstanceProfilesForRoleInput, fn func(*iam.ListInstanceProfilesForRoleOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		fake.mutex.Unlock()
+		return err
+	}
+	profiles := fake.profilesOf(aws.StringValue(role.RoleName))
+	fake.mutex.Unlock()
+	return fake.pages(len(profiles), func(start, end int, last bool) bool {
+		return fn(&iam.ListInstanceProfilesForRoleOutput{
+			InstanceProfiles: profiles[start:end],
+			IsTruncated:      aws.Bool(!last),
+		}, last)
+	})
+}
+
+// ListRolePoliciesPagesWithContext calls fn with pages of the inline policy names of a role,
+// sorted, until fn returns false.
+func (fake *IAM) ListRolePoliciesPagesWithContext(ctx aws.Context, input *iam.ListRolePoliciesInput, fn func(*iam.ListRolePoliciesOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		fake.mutex.Unlock()
+		return err
+	}
+	var names []string
+	for name := range fake.InlinePolicies[aws.StringValue(role.RoleName)] {
+		names = append(names, name)
+	}
+	fake.mutex.Unlock()
+	sort.Strings(names)
+	return fake.pages(len(names), func(start, end int, last bool) bool {
+		return fn(&iam.ListRolePoliciesOutput{
+			IsTruncated: aws.Bool(!last),
+			PolicyNames: aws.StringSlice(names[start:end]),
+		}, last)
+	})
+}
+
+// PutRolePolicyWithContext adds or replaces an inline policy of a role, which must be valid JSON.
+func (fake *IAM) PutRolePolicyWithContext(ctx aws.Context, input *iam.PutRolePolicyInput, opts ...request.Option) (*iam.PutRolePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := validPolicy(input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(role.RoleName)
+	if fake.InlinePolicies[name] == nil {
+		fake.InlinePolicies[name] = map[string]string{}
+	}
+	fake.InlinePolicies[name][aws.StringValue(input.PolicyName)] = aws.StringValue(input.PolicyDocument)
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+// RemoveRoleFromInstanceProfileWithContext empties an instance profile holding the role.
+func (fake *IAM) RemoveRoleFromInstanceProfileWithContext(ctx aws.Context, input *iam.RemoveRoleFromInstanceProfileInput, opts ...request.Option) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	profile, ok := fake.InstanceProfiles[aws.StringValue(input.InstanceProfileName)]
+	if !ok || len(profile.Roles) == 0 || aws.StringValue(profile.Roles[0].RoleName) != aws.StringValue(input.RoleName) {
+		return nil, noSuchEntity("role in instance profile", aws.StringValue(input.RoleName))
+	}
+	profile.Roles = nil
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
+
+// TagRoleWithContext adds tags to a role, replacing the values of existing keys.
+func (fake *IAM) TagRoleWithContext(ctx aws.Context, input *iam.TagRoleInput, opts ...request.Option) (*iam.TagRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range input.Tags {
+		replaced := false
+		for _, existing := range role.Tags {
+			if aws.StringValue(existing.Key) == aws.StringValue(tag.Key) {
+				existing.Value = tag.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			role.Tags = append(role.Tags, &iam.Tag{Key: tag.Key, Value: tag.Value})
+		}
+	}
+	return &iam.TagRoleOutput{}, nil
+}
+
+// UpdateAssumeRolePolicyWithContext replaces the trust policy of a role.
+func (fake *IAM) UpdateAssumeRolePolicyWithContext(ctx aws.Context, input *iam.UpdateAssumeRolePolicyInput, opts ...request.Option) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := validPolicy(input.PolicyDocument); err != nil {
+		return nil, err
+	}
+	role.AssumeRolePolicyDocument = input.PolicyDocument
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+// UpdateRoleWithContext changes the description of a role.
+func (fake *IAM) UpdateRoleWithContext(ctx aws.Context, input *iam.UpdateRoleInput, opts ...request.Option) (*iam.UpdateRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	role, err := fake.role(input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	if input.Description != nil {
+		role.Description = input.Description
+	}
+	return &iam.UpdateRoleOutput{}, nil
+}
+
+// pages calls page with the bounds of each page of PageSize out of count entries, always at least
+// once, until page returns false.
+func (fake *IAM) pages(count int, page func(start, end int, last bool) bool) error {
+	size := fake.PageSize
+	if size <= 0 {
+		size = count + 1
+	}
+	for start := 0; ; start += size {
+		end := start + size
+		if end > count {
+			end = count
+		}
+		if !page(start, end, end == count) || end == count {
+			return nil
+		}
+	}
+}
+
+// profilesOf returns the instance profiles holding a role, sorted by name.
+func (fake *IAM) profilesOf(roleName string) []*iam.InstanceProfile {
+	var profiles []*iam.InstanceProfile
+	for _, profile := range fake.InstanceProfiles {
+		if len(profile.Roles) > 0 && aws.StringValue(profile.Roles[0].RoleName) == roleName {
+			profiles = append(profiles, profile)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return *profiles[i].InstanceProfileName < *profiles[j].InstanceProfileName
+	})
+	return profiles
+}
+
+func (fake *IAM) role(roleName *string) (*iam.Role, error) {
+	role, ok := fake.Roles[aws.StringValue(roleName)]
+	if !ok {
+		return nil, noSuchEntity("role", aws.StringValue(roleName))
+	}
+	return role, nil
+}
+
+func noSuchEntity(kind string, name string) error {
+	return awserr.New(iam.ErrCodeNoSuchEntityException, "The "+kind+" with name "+name+" cannot be found.", nil)
+}
+
+func pathOrRoot(path *string) string {
+	if aws.StringValue(path) == "" {
+		return "/"
+	}
+	return aws.StringValue(path)
+}
+
+func validPolicy(document *string) error {
+	if !json.Valid([]byte(aws.StringValue(document))) {
+		return awserr.New(iam.ErrCodeMalformedPolicyDocumentException, "Syntax errors in policy.", nil)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package iam
+
+import (
+  "context"
+  "sort"
+  "strings"
+
+  "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/str"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
+  "github.com/aws/aws-sdk-go/aws/session"
+  "github.com/aws/aws-sdk-go/service/iam"
+  "github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// Client sets up and deletes IAM roles with their policies and instance profiles.
+type Client struct {
+  IAM iamiface.IAMAPI
+}
+
+// RoleOptions holds the optional settings of a role made or updated by EnsureRole.
+type RoleOptions struct {
+  Description string
+  // Path groups roles, such as /pac/. Defaults to /. It is only used when the role is created
+  Path string
+  Tags map[string]string
+  // ManagedPolicyArns are attached to the role, such as ManagedPolicyEcsTaskExecution
+  ManagedPolicyArns []string
+  // InlinePolicies are embedded in the role by policy name
+  InlinePolicies map[string]PolicyDocument
+  // InstanceProfile puts the role in an instance profile of the same name, which EC2 instances need to use it
+  InstanceProfile bool
+}
+
+// AWS managed policies that roles are commonly made with.
+const (
+  ManagedPolicyEcsTaskExecution = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+  ManagedPolicyLambdaBasicExecution = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+)
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    IAM: iam.New(awsSession),
+  }
+}
+
+// AttachManagedPolicy attaches a managed policy to a role, or exits if it cannot be attached.
+func AttachManagedPolicy(roleName string, policyArn string, awsSession *session.Session) {
+  errors.QuitIfError(AttachManagedPolicyE(roleName, policyArn, awsSession))
+}
+
+// AttachManagedPolicyE is AttachManagedPolicy returning an error instead of exiting.
+func AttachManagedPolicyE(roleName string, policyArn string, awsSession *session.Session) error {
+  return AttachManagedPolicyWithContext(context.Background(), roleName, policyArn, awsSession)
+}
+
+// AttachManagedPolicyWithContext is AttachManagedPolicyE with a context to allow cancellation.
+func AttachManagedPolicyWithContext(ctx context.Context, roleName string, policyArn string, awsSession *session.Session) error {
+  return New(awsSession).AttachManagedPolicy(ctx, roleName, policyArn)
+}
+
+// AttachManagedPolicy attaches a managed policy, AWS or customer managed, to a role given by name or ARN. Attaching a
+// policy that is already attached is not an error.
+func (client *Client) AttachManagedPolicy(ctx context.Context, roleName string, policyArn string) error {
+  _, err := client.IAM.AttachRolePolicyWithContext(ctx, &iam.AttachRolePolicyInput{
+    PolicyArn: aws.String(policyArn),
+    RoleName: aws.String(toRoleName(roleName)),
+  })
+  return err
+}
+
+// DeleteRole deletes a role along with its policies and instance profile, or exits if it cannot be deleted.
+func DeleteRole(roleName string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteRoleE(roleName, awsSession))
+}
+
+// DeleteRoleE is DeleteRole returning an error instead of exiting.
+func DeleteRoleE(roleName string, awsSession *session.Session) error {
+  return DeleteRoleWithContext(context.Background(), roleName, awsSession)
+}
+
+// DeleteRoleWithContext is DeleteRoleE with a context to allow cancellation.
+func DeleteRoleWithContext(ctx context.Context, roleName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteRole(ctx, roleName)
+}
+
+// DeleteRole deletes a role, given by name or ARN, after doing what IAM requires first: detaching its managed policies,
+// deleting its inline policies and removing it from instance profiles. An instance profile named after the role, as
+// EnsureRole makes, is deleted too. Deleting a role that does not exist is not an error.
+func (client *Client) DeleteRole(ctx context.Context, roleName string) error {
+  roleName = toRoleName(roleName)
+  var policyArns []string
+  err := client.IAM.ListAttachedRolePoliciesPagesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{
+    RoleName: aws.String(roleName),
+  }, func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+    for _, policy := range page.AttachedPolicies {
+      policyArns = append(policyArns, aws.StringValue(policy.PolicyArn))
+    }
+    return true
+  })
+  if isErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+    return nil
+  }
+  if err != nil {
+    return err
+  }
+  for _, policyArn := range policyArns {
+    _, err = client.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
+      PolicyArn: aws.String(policyArn),
+      RoleName: aws.String(roleName),
+    })
+    if err != nil {
+      return err
+    }
+  }
+  var policyNames []string
+  err = client.IAM.ListRolePoliciesPagesWithContext(ctx, &iam.ListRolePoliciesInput{
+    RoleName: aws.String(roleName),
+  }, func(page *iam.ListRolePoliciesOutput, lastPage bool) bool {
+    policyNames = append(policyNames, aws.StringValueSlice(page.PolicyNames)...)
+    return true
+  })
+  if err != nil {
+    return err
+  }
+  for _, policyName := range policyNames {
+    _, err = client.IAM.DeleteRolePolicyWithContext(ctx, &iam.DeleteRolePolicyInput{
+      PolicyName: aws.String(policyName),
+      RoleName: aws.String(roleName),
+    })
+    if err != nil {
+      return err
+    }
+  }
+  var profileNames []string
+  err = client.IAM.ListInstanceProfilesForRolePagesWithContext(ctx, &iam.ListInstanceProfilesForRoleInput{
+    RoleName: aws.String(roleName),
+  }, func(page *iam.ListInstanceProfilesForRoleOutput, lastPage bool) bool {
+    for _, profile := range page.InstanceProfiles {
+      profileNames = append(profileNames, aws.StringValue(profile.InstanceProfileName))
+    }
+    return true
+  })
+  if err != nil {
+    return err
+  }
+  for _, profileName := range profileNames {
+    _, err = client.IAM.RemoveRoleFromInstanceProfileWithContext(ctx, &iam.RemoveRoleFromInstanceProfileInput{
+      InstanceProfileName: aws.String(profileName),
+      RoleName: aws.String(roleName),
+    })
+    if err != nil {
+      return err
+    }
+    if profileName == roleName {
+      _, err = client.IAM.DeleteInstanceProfileWithContext(ctx, &iam.DeleteInstanceProfileInput{
+        InstanceProfileName: aws.String(profileName),
+      })
+      if err != nil {
+        return err
+      }
+    }
+  }
+  _, err = client.IAM.DeleteRoleWithContext(ctx, &iam.DeleteRoleInput{
+    RoleName: aws.String(roleName),
+  })
+  if isErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+    return nil
+  }
+  return err
+}
+
+// EnsureRole creates a role, or updates the one of that name, and returns its ARN, or exits if it cannot be set up.
+func EnsureRole(roleName string, trustPolicy PolicyDocument, options RoleOptions, awsSession *session.Session) string {
+  arn, err := EnsureRoleE(roleName, trustPolicy, options, awsSession)
+  errors.QuitIfError(err)
+  return arn
+}
+
+// EnsureRoleE is EnsureRole returning an error instead of exiting.
+func EnsureRoleE(roleName string, trustPolicy PolicyDocument, options RoleOptions, awsSession *session.Session) (string, error) {
+  return EnsureRoleWithContext(context.Background(), roleName, trustPolicy, options, awsSession)
+}
+
+// EnsureRoleWithContext is EnsureRoleE with a context to allow cancellation.
+func EnsureRoleWithContext(ctx context.Context, roleName string, trustPolicy PolicyDocument, options RoleOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).EnsureRole(ctx, roleName, trustPolicy, options)
+}
+
+// EnsureRole creates a role with the trust policy, such as TrustPolicy(ServiceEcsTasks), and options, and returns its
+// ARN. When the role already exists it is reused: its trust policy is replaced, and the tags, managed policies and
+// inline policies of the options are added, leaving any others it has in place. The trust policy and inline policies
+// are validated before anything is changed.
+func (client *Client) EnsureRole(ctx context.Context, roleName string, trustPolicy PolicyDocument, options RoleOptions) (string, error) {
+  err := trustPolicy.ValidateResourcePolicy()
+  if err != nil {
+    return "", err
+  }
+  for _, policy := range options.InlinePolicies {
+    err = policy.ValidateIdentityPolicy()
+    if err != nil {
+      return "", err
+    }
+  }
+  trustJson, err := trustPolicy.Json()
+  if err != nil {
+    return "", err
+  }
+  tags := toTags(options.Tags)
+  var arn string
+  result, err := client.IAM.GetRoleWithContext(ctx, &iam.GetRoleInput{
+    RoleName: aws.String(roleName),
+  })
+  if isErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+    input := &iam.CreateRoleInput{
+      AssumeRolePolicyDocument: aws.String(trustJson),
+      RoleName: aws.String(roleName),
+      Tags: tags,
+    }
+    if options.Description != "" {
+      input.Description = aws.String(options.Description)
+    }
+    if options.Path != "" {
+      input.Path = aws.String(options.Path)
+    }
+    created, err := client.IAM.CreateRoleWithContext(ctx, input)
+    if err != nil {
+      return "", errors.New(str.Concat("Could not create the role ", roleName, ": ", err.Error()))
+    }
+    arn = aws.StringValue(created.Role.Arn)
+  } else if err != nil {
+    return "", err
+  } else {
+    arn = aws.StringValue(result.Role.Arn)
+    _, err = client.IAM.UpdateAssumeRolePolicyWithContext(ctx, &iam.UpdateAssumeRolePolicyInput{
+      PolicyDocument: aws.String(trustJson),
+      RoleName: aws.String(roleName),
+    })
+    if err != nil {
+      return "", errors.New(str.Concat("Could not update the trust policy of the role ", roleName, ": ", err.Error()))
+    }
+    if options.Description != "" && options.Description != aws.StringValue(result.Role.Description) {
+      _, err = client.IAM.UpdateRoleWithContext(ctx, &iam.UpdateRoleInput{
+        Description: aws.String(options.Description),
+        RoleName: aws.String(roleName),
+      })
+      if err != nil {
+        return "", err
+      }
+    }
+    if len(tags) > 0 {
+      err = client.TagRole(ctx, roleName, options.Tags)
+      if err != nil {
+        return "", err
+      }
+    }
+  }
+  for _, policyArn := range options.ManagedPolicyArns {
+    err = client.AttachManagedPolicy(ctx, roleName, policyArn)
+    if err != nil {
+      return "", errors.New(str.Concat("Could not attach ", policyArn, " to the role ", roleName, ": ", err.Error()))
+    }
+  }
+  policyNames := make([]string, 0, len(options.InlinePolicies))
+  for policyName := range options.InlinePolicies {
+    policyNames = append(policyNames, policyName)
+  }
+  sort.Strings(policyNames)
+  for _, policyName := range policyNames {
+    err = client.PutInlinePolicy(ctx, roleName, policyName, options.InlinePolicies[policyName])
+    if err != nil {
+      return "", errors.New(str.Concat("Could not put the policy ", policyName, " in the role ", roleName, ": ", err.Error()))
+    }
+  }
+  if options.InstanceProfile {
+    err = client.ensureInstanceProfile(ctx, roleName, options.Path)
+    if err != nil {
+      return "", err
+    }
+  }
+  return arn, nil
+}
+
+// GetRoleArn returns the ARN of a role, or an empty string if there is no role of that name, or exits if it cannot be
+// looked up.
+func GetRoleArn(roleName string, awsSession *session.Session) string {
+  arn, err := GetRoleArnE(roleName, awsSession)
+  errors.QuitIfError(err)
+  return arn
+}
+
+// GetRoleArnE is GetRoleArn returning an error instead of exiting.
+func GetRoleArnE(roleName string, awsSession *session.Session) (string, error) {
+  return GetRoleArnWithContext(context.Background(), roleName, awsSession)
+}
+
+// GetRoleArnWithContext is GetRoleArnE with a context to allow cancellation.
+func GetRoleArnWithContext(ctx context.Context, roleName string, awsSession *session.Session) (string, error) {
+  return New(awsSession).GetRoleArn(ctx, roleName)
+}
+
+// GetRoleArn returns the ARN of a role, or an empty string if there is no role of that name. Unlike EnsureRole it
+// never changes the role.
+func (client *Client) GetRoleArn(ctx context.Context, roleName string) (string, error) {
+  result, err := client.IAM.GetRoleWithContext(ctx, &iam.GetRoleInput{
+    RoleName: aws.String(roleName),
+  })
+  if isErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+    return "", nil
+  } else if err != nil {
+    return "", errors.New(str.Concat("Could not look up the role ", roleName, ": ", err.Error()))
+  }
+  return aws.StringValue(result.Role.Arn), nil
+}
+
+// PutInlinePolicy embeds a policy in a role, or exits if it cannot be put.
+func PutInlinePolicy(roleName string, policyName string, policy PolicyDocument, awsSession *session.Session) {
+  errors.QuitIfError(PutInlinePolicyE(roleName, policyName, policy, awsSession))
+}
+
+// PutInlinePolicyE is PutInlinePolicy returning an error instead of exiting.
+func PutInlinePolicyE(roleName string, policyName string, policy PolicyDocument, awsSession *session.Session) error {
+  return PutInlinePolicyWithContext(context.Background(), roleName, policyName, policy, awsSession)
+}
+
+// PutInlinePolicyWithContext is PutInlinePolicyE with a context to allow cancellation.
+func PutInlinePolicyWithContext(ctx context.Context, roleName string, policyName string, policy PolicyDocument, awsSession *session.Session) error {
+  return New(awsSession).PutInlinePolicy(ctx, roleName, policyName, policy)
+}
+
+// PutInlinePolicy embeds a policy in a role, given by name or ARN, replacing any policy of that name it already has. The
+// policy is validated first.
+func (client *Client) PutInlinePolicy(ctx context.Context, roleName string, policyName string, policy PolicyDocument) error {
+  err := policy.ValidateIdentityPolicy()
+  if err != nil {
+    return err
+  }
+  policyJson, err := policy.Json()
+  if err != nil {
+    return err
+  }
+  _, err = client.IAM.PutRolePolicyWithContext(ctx, &iam.PutRolePolicyInput{
+    PolicyDocument: aws.String(policyJson),
+    PolicyName: aws.String(policyName),
+    RoleName: aws.String(toRoleName(roleName)),
+  })
+  return err
+}
+
+// TagRole adds tags to a role, or exits if it cannot be tagged.
+func TagRole(roleName string, tags map[string]string, awsSession *session.Session) {
+  errors.QuitIfError(TagRoleE(roleName, tags, awsSession))
+}
+
+// TagRoleE is TagRole returning an error instead of exiting.
+func TagRoleE(roleName string, tags map[string]string, awsSession *session.Session) error {
+  return TagRoleWithContext(context.Background(), roleName, tags, awsSession)
+}
+
+// TagRoleWithContext is TagRoleE with a context to allow cancellation.
+func TagRoleWithContext(ctx context.Context, roleName string, tags map[string]string, awsSession *session.Session) error {
+  return New(awsSession).TagRole(ctx, roleName, tags)
+}
+
+// TagRole adds tags to a role, given by name or ARN, replacing the values of tags it already has, so that it can be
+// found in a resource group.
+func (client *Client) TagRole(ctx context.Context, roleName string, tags map[string]string) error {
+  _, err := client.IAM.TagRoleWithContext(ctx, &iam.TagRoleInput{
+    RoleName: aws.String(toRoleName(roleName)),
+    Tags: toTags(tags),
+  })
+  return err
+}
+
+// ensureInstanceProfile creates an instance profile named after the role, unless there is one, and puts the role in it.
+func (client *Client) ensureInstanceProfile(ctx context.Context, roleName string, path string) error {
+  result, err := client.IAM.GetInstanceProfileWithContext(ctx, &iam.GetInstanceProfileInput{
+    InstanceProfileName: aws.String(roleName),
+  })
+  var profile *iam.InstanceProfile
+  if isErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+    input := &iam.CreateInstanceProfileInput{
+      InstanceProfileName: aws.String(roleName),
+    }
+    if path != "" {
+      input.Path = aws.String(path)
+    }
+    created, err := client.IAM.CreateInstanceProfileWithContext(ctx, input)
+    if err != nil {
+      return errors.New(str.Concat("Could not create the instance profile ", roleName, ": ", err.Error()))
+    }
+    profile = created.InstanceProfile
+  } else if err != nil {
+    return err
+  } else {
+    profile = result.InstanceProfile
+  }
+  for _, role := range profile.Roles {
+    if aws.StringValue(role.RoleName) == roleName {
+      return nil
+    }
+  }
+  _, err = client.IAM.AddRoleToInstanceProfileWithContext(ctx, &iam.AddRoleToInstanceProfileInput{
+    InstanceProfileName: aws.String(roleName),
+    RoleName: aws.String(roleName),
+  })
+  return err
+}
+
+// toRoleName returns the name of a role given by name or ARN, such as arn:aws:iam::123456789012:role/pac/example.
+func toRoleName(roleName string) string {
+  if strings.HasPrefix(roleName, "arn:") {
+    return roleName[strings.LastIndex(roleName, "/") + 1:]
+  }
+  return roleName
+}
+
+func toTags(tags map[string]string) []*iam.Tag {
+  var iamTags []*iam.Tag
+  keys := make([]string, 0, len(tags))
+  for key := range tags {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  for _, key := range keys {
+    iamTags = append(iamTags, &iam.Tag{
+      Key: aws.String(key),
+      Value: aws.String(tags[key]),
+    })
+  }
+  return iamTags
+}
+
+func isErrorCode(err error, code string) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == code
+}
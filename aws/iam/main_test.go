@@ -0,0 +1,286 @@
+package iam
+
+import (
+  "context"
+  "encoding/json"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/iam/iamfake"
+)
+
+func newFakeClient() (*Client, *iamfake.IAM) {
+  fake := iamfake.New()
+  fake.PageSize = 1
+  return &Client{IAM: fake}, fake
+}
+
+var readSecrets = NewPolicy(Allow([]string{"secretsmanager:GetSecretValue"}, "arn:aws:secretsmanager:us-east-1:123456789012:secret:pac/dev/*"))
+
+// ensureTaskRole sets up the ECS task role pac-dev-task with every option but an instance profile, and returns its ARN.
+func ensureTaskRole(t *testing.T, client *Client) string {
+  arn, err := client.EnsureRole(context.Background(), "pac-dev-task", TrustPolicy(ServiceEcsTasks), RoleOptions{
+    Description: "Task role of the dev environment",
+    Path: "/pac/",
+    Tags: map[string]string{"pac-project": "dev"},
+    ManagedPolicyArns: []string{ManagedPolicyEcsTaskExecution},
+    InlinePolicies: map[string]PolicyDocument{"read-secrets": readSecrets},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  return arn
+}
+
+// TestClientEnsureRole creates an ECS task role and checks its ARN, trust policy and inline policy.
+func TestClientEnsureRole(t *testing.T) {
+  client, fake := newFakeClient()
+
+  arn := ensureTaskRole(t, client)
+  if arn != "arn:aws:iam::123456789012:role/pac/pac-dev-task" {
+    t.Errorf("unexpected ARN %s", arn)
+  }
+  var trust PolicyDocument
+  err := json.Unmarshal([]byte(*fake.Roles["pac-dev-task"].AssumeRolePolicyDocument), &trust)
+  if err != nil || trust.Version != PolicyVersion || trust.Statement[0].Principal["Service"][0] != ServiceEcsTasks || trust.Statement[0].Action[0] != "sts:AssumeRole" {
+    t.Errorf("unexpected trust policy %+v, %v", trust, err)
+  }
+  var inline PolicyDocument
+  err = json.Unmarshal([]byte(fake.InlinePolicies["pac-dev-task"]["read-secrets"]), &inline)
+  if err != nil || inline.Statement[0].Effect != "Allow" || inline.Statement[0].Resource[0] != readSecrets.Statement[0].Resource[0] {
+    t.Errorf("unexpected inline policy %+v, %v", inline, err)
+  }
+}
+
+// TestClientEnsureRoleExisting checks that ensuring a role again reuses it, keeping its policies and tags and adding
+// the new ones.
+func TestClientEnsureRoleExisting(t *testing.T) {
+  client, fake := newFakeClient()
+  arn := ensureTaskRole(t, client)
+
+  reused, err := client.EnsureRole(context.Background(), "pac-dev-task", TrustPolicy(ServiceEcsTasks, ServiceLambda), RoleOptions{
+    Tags: map[string]string{"pac-project": "dev", "owner": "platform"},
+    ManagedPolicyArns: []string{ManagedPolicyEcsTaskExecution, ManagedPolicyLambdaBasicExecution},
+  })
+  if err != nil || reused != arn {
+    t.Fatalf("reused %s, %v", reused, err)
+  }
+  if len(fake.AttachedPolicies["pac-dev-task"]) != 2 || len(fake.Roles["pac-dev-task"].Tags) != 2 || len(fake.InlinePolicies["pac-dev-task"]) != 1 {
+    t.Error("expected the role to keep its policies and gain the new ones and tags")
+  }
+}
+
+// TestClientEnsureRoleInstanceProfile ensures an EC2 role twice and checks it is in one instance profile of the same
+// name.
+func TestClientEnsureRoleInstanceProfile(t *testing.T) {
+  client, fake := newFakeClient()
+
+  for i := 0; i < 2; i++ {
+    _, err := client.EnsureRole(context.Background(), "pac-dev-instance", TrustPolicy(ServiceEc2), RoleOptions{InstanceProfile: true})
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if profile := fake.InstanceProfiles["pac-dev-instance"]; profile == nil || len(profile.Roles) != 1 {
+    t.Error("expected the role in an instance profile of the same name")
+  }
+}
+
+// TestClientGetRoleArn looks up the ARN of a role, and gets no ARN for a role that does not exist.
+func TestClientGetRoleArn(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  arn := ensureTaskRole(t, client)
+
+  found, err := client.GetRoleArn(ctx, "pac-dev-task")
+  if err != nil || found != arn {
+    t.Errorf("expected %s, got %s (%v)", arn, found, err)
+  }
+  found, err = client.GetRoleArn(ctx, "pac-dev-missing")
+  if err != nil || found != "" {
+    t.Errorf("expected no ARN for a missing role, got %s (%v)", found, err)
+  }
+}
+
+// TestClientDeleteRole deletes a role with managed and inline policies by its ARN.
+func TestClientDeleteRole(t *testing.T) {
+  client, fake := newFakeClient()
+  arn := ensureTaskRole(t, client)
+
+  err := client.DeleteRole(context.Background(), arn)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fake.Roles) != 0 {
+    t.Errorf("%d roles were left", len(fake.Roles))
+  }
+}
+
+// TestClientDeleteRoleInstanceProfile deletes a role with its instance profile twice, which is not an error.
+func TestClientDeleteRoleInstanceProfile(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  _, err := client.EnsureRole(ctx, "pac-dev-instance", TrustPolicy(ServiceEc2), RoleOptions{InstanceProfile: true})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for i := 0; i < 2; i++ {
+    err = client.DeleteRole(ctx, "pac-dev-instance")
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if len(fake.Roles) != 0 || len(fake.InstanceProfiles) != 0 {
+    t.Errorf("%d roles and %d instance profiles were left", len(fake.Roles), len(fake.InstanceProfiles))
+  }
+}
+
+// TestPolicyDocument reads, merges, validates and evaluates a role permissions policy, a trust policy, a bucket policy
+// and a key policy, written as AWS writes them.
+func TestPolicyDocument(t *testing.T) {
+  bucketPolicy, err := ParsePolicy(`{
+    "Version": "2012-10-17",
+    "Statement": [
+      {"Sid": "ReadSite", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::pac-site/*"},
+      {"Sid": "DenyInsecure", "Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": ["arn:aws:s3:::pac-site", "arn:aws:s3:::pac-site/*"],
+        "Condition": {"Bool": {"aws:SecureTransport": false}}}
+    ]
+  }`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := bucketPolicy.ValidateResourcePolicy(); err != nil {
+    t.Error(err)
+  }
+  if bucketPolicy.Statement[1].Condition["Bool"]["aws:SecureTransport"][0] != "false" {
+    t.Errorf("unexpected condition %v", bucketPolicy.Statement[1].Condition)
+  }
+  bucketJson, err := bucketPolicy.Json()
+  if err != nil {
+    t.Fatal(err)
+  }
+  var raw map[string][]map[string]interface{}
+  json.Unmarshal([]byte(bucketJson), &raw)
+  if raw["Statement"][0]["Principal"] != "*" || raw["Statement"][0]["Action"] != "s3:GetObject" {
+    t.Errorf("unexpected JSON %s", bucketJson)
+  }
+
+  getObject := Request{Principal: "arn:aws:iam::210987654321:user/visitor", Action: "S3:GetObject", Resource: "arn:aws:s3:::pac-site/index.html",
+    Context: map[string]string{"aws:SecureTransport": "true"}}
+  if decision := bucketPolicy.Evaluate(getObject); decision != Allowed {
+    t.Errorf("reading over TLS is %s", decision)
+  }
+  getObject.Context = map[string]string{"aws:SecureTransport": "false"}
+  if decision := bucketPolicy.Evaluate(getObject); decision != ExplicitDeny {
+    t.Errorf("reading without TLS is %s", decision)
+  }
+  putObject := Request{Principal: "210987654321", Action: "s3:PutObject", Resource: "arn:aws:s3:::pac-site/index.html"}
+  if decision := bucketPolicy.Evaluate(putObject); decision != ImplicitDeny {
+    t.Errorf("writing is %s", decision)
+  }
+
+  trustPolicy, err := ParsePolicy(`{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"Service": "ecs-tasks.amazonaws.com"}, "Action": "sts:AssumeRole"}}`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !trustPolicy.IsAllowed(Request{Principal: ServiceEcsTasks, Action: "sts:AssumeRole"}) || trustPolicy.IsAllowed(Request{Principal: ServiceLambda, Action: "sts:AssumeRole"}) {
+    t.Error("the trust policy should let ECS tasks alone assume the role")
+  }
+
+  keyPolicy := NewPolicy(Statement{
+    Sid: "EnableRoot",
+    Effect: "Allow",
+    Principal: Principals{"AWS": {"arn:aws:iam::123456789012:root"}},
+    Action: StringList{"kms:*"},
+    Resource: StringList{"*"},
+  }, Statement{
+    Sid: "DecryptViaSecretsManager",
+    Effect: "Allow",
+    Principal: Principals{"AWS": {"arn:aws:iam::210987654321:role/pac-dev-task"}},
+    Action: StringList{"kms:Decrypt"},
+    Resource: StringList{"*"},
+    Condition: Conditions{"StringEquals": {"kms:ViaService": {"secretsmanager.us-east-1.amazonaws.com"}}},
+  })
+  key := "arn:aws:kms:us-east-1:123456789012:key/1234abcd"
+  if !keyPolicy.IsAllowed(Request{Principal: "arn:aws:iam::123456789012:user/admin", Action: "kms:ScheduleKeyDeletion", Resource: key}) {
+    t.Error("the key policy should allow every principal of the account")
+  }
+  session := "arn:aws:sts::210987654321:assumed-role/pac-dev-task/ecs-task"
+  if !keyPolicy.IsAllowed(Request{Principal: session, Action: "kms:Decrypt", Resource: key, Context: map[string]string{"kms:viaservice": "secretsmanager.us-east-1.amazonaws.com"}}) {
+    t.Error("the key policy should let the role session decrypt through Secrets Manager")
+  }
+  if keyPolicy.IsAllowed(Request{Principal: session, Action: "kms:Decrypt", Resource: key}) {
+    t.Error("the key policy should not let the role session decrypt directly")
+  }
+
+  fromOffice := NewPolicy(Statement{
+    Effect: "Allow",
+    Action: StringList{"s3:GetObject"},
+    Resource: StringList{"*"},
+    Condition: Conditions{"IpAddress": {"aws:SourceIp": {"203.0.113.7", "2001:db8::7"}}},
+  })
+  for sourceIp, allowed := range map[string]bool{"203.0.113.7": true, "203.0.113.8": false, "2001:db8::7": true, "2001:db8::8": false} {
+    if fromOffice.IsAllowed(Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::pac-site/index.html", Context: map[string]string{"aws:sourceip": sourceIp}}) != allowed {
+      t.Errorf("reading from %s should be allowed: %v", sourceIp, allowed)
+    }
+  }
+
+  permissions := NewPolicy(Allow([]string{"s3:*"}, "arn:aws:s3:::pac-site/*"), Deny([]string{"s3:Delete*"}, "*"))
+  if err := permissions.ValidateIdentityPolicy(); err != nil {
+    t.Error(err)
+  }
+  if decision := permissions.Evaluate(Request{Action: "s3:DeleteObject", Resource: "arn:aws:s3:::pac-site/index.html"}); decision != ExplicitDeny {
+    t.Errorf("deleting is %s", decision)
+  }
+  if decision := Evaluate(Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::other/index.html"}, permissions, NewPolicy(Allow([]string{"s3:Get*"}, "arn:aws:s3:::other/*"))); decision != Allowed {
+    t.Errorf("reading another bucket with both policies is %s", decision)
+  }
+
+  merged, err := MergePolicies(bucketPolicy, NewPolicy(bucketPolicy.Statement[0], Statement{
+    Sid: "WriteSite",
+    Effect: "Allow",
+    Principal: Principals{"AWS": {"arn:aws:iam::123456789012:role/deployer"}},
+    Action: StringList{"s3:PutObject"},
+    Resource: StringList{"arn:aws:s3:::pac-site/*"},
+  }))
+  if err != nil || len(merged.Statement) != 3 {
+    t.Errorf("merged %d statements: %v", len(merged.Statement), err)
+  }
+  conflicting := bucketPolicy.Statement[0]
+  conflicting.Action = StringList{"s3:*"}
+  if _, err := MergePolicies(bucketPolicy, NewPolicy(conflicting)); err == nil {
+    t.Error("expected an error merging different statements with the same Sid")
+  }
+
+  invalid := []PolicyDocument{
+    {Version: "2020-01-01", Statement: permissions.Statement},
+    NewPolicy(),
+    NewPolicy(Statement{Effect: "allow", Action: StringList{"s3:GetObject"}, Resource: StringList{"*"}}),
+    NewPolicy(Statement{Effect: "Allow", Resource: StringList{"*"}}),
+    NewPolicy(Allow([]string{"GetObject"}, "*")),
+    NewPolicy(Statement{Sid: "Read-Site", Effect: "Allow", Action: StringList{"s3:GetObject"}, Resource: StringList{"*"}}),
+    NewPolicy(Statement{Effect: "Allow", Action: StringList{"s3:GetObject"}, Resource: StringList{"*"}, Condition: Conditions{"StringMatches": {"aws:UserAgent": {"x"}}}}),
+  }
+  for i, document := range invalid {
+    if err := document.Validate(); err == nil {
+      t.Errorf("expected policy %d to be invalid", i)
+    }
+  }
+  if err := bucketPolicy.ValidateIdentityPolicy(); err == nil {
+    t.Error("expected a bucket policy to be an invalid identity policy")
+  }
+  if err := permissions.ValidateResourcePolicy(); err == nil {
+    t.Error("expected a permissions policy to be an invalid resource policy")
+  }
+
+  defaultKeyPolicy, err := ParsePolicy(`{"Version": "2012-10-17", "Id": "key-default-1", "Statement": [{"Sid": "Enable IAM User Permissions", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "kms:*", "Resource": "*"}]}`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := defaultKeyPolicy.ValidateResourcePolicy(); err != nil {
+    t.Errorf("expected the default key policy to be a valid resource policy: %v", err)
+  }
+  if err := NewPolicy(Statement{Sid: "Read Site", Effect: "Allow", Action: StringList{"s3:GetObject"}, Resource: StringList{"*"}}).ValidateIdentityPolicy(); err == nil {
+    t.Error("expected a Sid with a space to be invalid in an identity policy")
+  }
+}
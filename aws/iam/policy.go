@@ -0,0 +1,343 @@
+package iam
+
+import (
+  "encoding/json"
+  "reflect"
+  "regexp"
+  "strconv"
+  "strings"
+
+  "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/str"
+)
+
+// PolicyVersion is the current version of the IAM policy language.
+const PolicyVersion = "2012-10-17"
+
+// Services that roles are commonly made for, to give to TrustPolicy.
+const (
+  ServiceEc2 = "ec2.amazonaws.com"
+  ServiceEcsTasks = "ecs-tasks.amazonaws.com"
+  ServiceLambda = "lambda.amazonaws.com"
+)
+
+// PolicyDocument is an IAM policy, such as the permissions or trust policy of a role, an S3 bucket policy or a KMS
+// key policy. It marshals to the JSON those services take and unmarshals any JSON they return.
+type PolicyDocument struct {
+  Version string
+  Id string `json:",omitempty"`
+  Statement []Statement
+}
+
+// Statement is one statement of a PolicyDocument. Principal is only set in resource policies, such as trust, bucket
+// and key policies, and the Not fields match everything except what they list.
+type Statement struct {
+  Sid string `json:",omitempty"`
+  Effect string
+  Principal Principals `json:",omitempty"`
+  NotPrincipal Principals `json:",omitempty"`
+  Action StringList `json:",omitempty"`
+  NotAction StringList `json:",omitempty"`
+  Resource StringList `json:",omitempty"`
+  NotResource StringList `json:",omitempty"`
+  Condition Conditions `json:",omitempty"`
+}
+
+// Principals lists principals by type: AWS (account ids and ARNs), Service, Federated or CanonicalUser, such as
+// {"Service": {"ecs-tasks.amazonaws.com"}}. The "*" principal of the JSON is AnyPrincipal.
+type Principals map[string]StringList
+
+// Conditions maps condition operators, such as StringEquals, to condition keys, such as aws:SourceVpc, and their values.
+type Conditions map[string]map[string]StringList
+
+// StringList is a list of strings that the JSON of policies gives as a single string or an array. Booleans and numbers,
+// as in condition values, are read as strings.
+type StringList []string
+
+// AnyPrincipal is every principal, the "*" of the JSON.
+var AnyPrincipal = Principals{"AWS": {"*"}}
+
+// sidPattern is what a Sid may be made of in any policy. Key policies use spaces, as the default key policy's
+// "Enable IAM User Permissions" does, but identity policies are held to identitySidPattern.
+var sidPattern = regexp.MustCompile(`^[A-Za-z0-9 ]*$`)
+
+var identitySidPattern = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+
+var actionPattern = regexp.MustCompile(`^(\*|[a-z0-9-]+:[A-Za-z0-9*?]+)$`)
+
+// NewPolicy returns a policy document of the current version holding the statements.
+func NewPolicy(statements ...Statement) PolicyDocument {
+  return PolicyDocument{
+    Version: PolicyVersion,
+    Statement: statements,
+  }
+}
+
+// TrustPolicy returns the trust policy of a role that the services, such as ServiceEcsTasks, can assume.
+func TrustPolicy(services ...string) PolicyDocument {
+  return NewPolicy(Statement{
+    Effect: "Allow",
+    Principal: Principals{"Service": services},
+    Action: StringList{"sts:AssumeRole"},
+  })
+}
+
+// Allow returns a statement allowing the actions, such as s3:GetObject, on the resources.
+func Allow(actions []string, resources ...string) Statement {
+  return Statement{
+    Effect: "Allow",
+    Action: actions,
+    Resource: resources,
+  }
+}
+
+// Deny returns a statement denying the actions on the resources, whatever other statements allow.
+func Deny(actions []string, resources ...string) Statement {
+  return Statement{
+    Effect: "Deny",
+    Action: actions,
+    Resource: resources,
+  }
+}
+
+// ParsePolicy reads a policy document from its JSON, such as the policy of a bucket or key.
+func ParsePolicy(policyJson string) (PolicyDocument, error) {
+  var document PolicyDocument
+  err := json.Unmarshal([]byte(policyJson), &document)
+  if err != nil {
+    return PolicyDocument{}, errors.New("The policy is not valid JSON: " + err.Error())
+  }
+  return document, nil
+}
+
+// MergePolicies returns one policy holding the statements of every policy, such as a bucket policy and the statements a
+// deployment adds to it, each once. Statements with the same Sid must be the same statement.
+func MergePolicies(documents ...PolicyDocument) (PolicyDocument, error) {
+  merged := NewPolicy()
+  bySid := map[string]Statement{}
+  for _, document := range documents {
+    if merged.Id == "" {
+      merged.Id = document.Id
+    }
+    for _, statement := range document.Statement {
+      if existing, ok := bySid[statement.Sid]; ok && statement.Sid != "" {
+        if !reflect.DeepEqual(existing, statement) {
+          return PolicyDocument{}, errors.New(str.Concat("The policies have different statements with the Sid ", statement.Sid))
+        }
+        continue
+      }
+      duplicate := false
+      for _, kept := range merged.Statement {
+        duplicate = duplicate || reflect.DeepEqual(kept, statement)
+      }
+      if !duplicate {
+        merged.Statement = append(merged.Statement, statement)
+        bySid[statement.Sid] = statement
+      }
+    }
+  }
+  return merged, nil
+}
+
+// Json returns the policy document as the JSON that IAM, S3 and KMS take.
+func (document PolicyDocument) Json() (string, error) {
+  data, err := json.Marshal(document)
+  if err != nil {
+    return "", err
+  }
+  return string(data), nil
+}
+
+// Validate returns an error describing the first mistake IAM would reject the policy for, whatever kind of policy it
+// is: an unknown version or effect, a statement without actions, an action not written as service:Action, a statement
+// with both a field and its Not field, a duplicate or invalid Sid, or an unknown condition operator.
+func (document PolicyDocument) Validate() error {
+  if document.Version != PolicyVersion && document.Version != "2008-10-17" {
+    return errors.New(str.Concat("The policy version ", document.Version, " is not ", PolicyVersion))
+  }
+  if len(document.Statement) == 0 {
+    return errors.New("The policy has no statements")
+  }
+  sids := map[string]bool{}
+  for i, statement := range document.Statement {
+    name := statement.name(i)
+    if statement.Sid != "" {
+      if !sidPattern.MatchString(statement.Sid) {
+        return errors.New(str.Concat(name, " may only use letters, numbers and spaces in its Sid"))
+      }
+      if sids[statement.Sid] {
+        return errors.New(str.Concat(name, " has a Sid used by an earlier statement"))
+      }
+      sids[statement.Sid] = true
+    }
+    if statement.Effect != "Allow" && statement.Effect != "Deny" {
+      return errors.New(str.Concat(name, " has the effect ", statement.Effect, " rather than Allow or Deny"))
+    }
+    if (len(statement.Action) == 0) == (len(statement.NotAction) == 0) {
+      return errors.New(str.Concat(name, " must have either Action or NotAction"))
+    }
+    for _, action := range append(append(StringList{}, statement.Action...), statement.NotAction...) {
+      if !actionPattern.MatchString(action) {
+        return errors.New(str.Concat(name, " has the action ", action, " which is not written as service:Action"))
+      }
+    }
+    if len(statement.Resource) > 0 && len(statement.NotResource) > 0 {
+      return errors.New(str.Concat(name, " has both Resource and NotResource"))
+    }
+    if len(statement.Principal) > 0 && len(statement.NotPrincipal) > 0 {
+      return errors.New(str.Concat(name, " has both Principal and NotPrincipal"))
+    }
+    for operator := range statement.Condition {
+      if _, ok := baseOperator(operator); !ok {
+        return errors.New(str.Concat(name, " has the unknown condition operator ", operator))
+      }
+    }
+  }
+  return nil
+}
+
+// ValidateIdentityPolicy is Validate for policies attached to roles, users and groups, which name resources and
+// never principals, and whose Sids are letters and numbers alone.
+func (document PolicyDocument) ValidateIdentityPolicy() error {
+  err := document.Validate()
+  if err != nil {
+    return err
+  }
+  for i, statement := range document.Statement {
+    if !identitySidPattern.MatchString(statement.Sid) {
+      return errors.New(str.Concat(statement.name(i), " of an identity policy may only use letters and numbers in its Sid"))
+    }
+    if len(statement.Principal) > 0 || len(statement.NotPrincipal) > 0 {
+      return errors.New(str.Concat(statement.name(i), " of an identity policy has a principal"))
+    }
+    if len(statement.Resource) == 0 && len(statement.NotResource) == 0 {
+      return errors.New(str.Concat(statement.name(i), " of an identity policy has no resources"))
+    }
+  }
+  return nil
+}
+
+// ValidateResourcePolicy is Validate for policies attached to resources, such as trust policies, bucket policies and
+// key policies, which name the principals of every statement.
+func (document PolicyDocument) ValidateResourcePolicy() error {
+  err := document.Validate()
+  if err != nil {
+    return err
+  }
+  for i, statement := range document.Statement {
+    if len(statement.Principal) == 0 && len(statement.NotPrincipal) == 0 {
+      return errors.New(str.Concat(statement.name(i), " of a resource policy has no principal"))
+    }
+  }
+  return nil
+}
+
+// UnmarshalJSON reads a policy whose Statement is a single statement or an array of them.
+func (document *PolicyDocument) UnmarshalJSON(data []byte) error {
+  var raw struct {
+    Version string
+    Id string
+    Statement json.RawMessage
+  }
+  err := json.Unmarshal(data, &raw)
+  if err != nil {
+    return err
+  }
+  document.Version = raw.Version
+  document.Id = raw.Id
+  document.Statement = nil
+  if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+    var statement Statement
+    err = json.Unmarshal(raw.Statement, &statement)
+    document.Statement = []Statement{statement}
+  } else if len(raw.Statement) > 0 {
+    err = json.Unmarshal(raw.Statement, &document.Statement)
+  }
+  return err
+}
+
+// MarshalJSON writes "*" for AnyPrincipal and an object otherwise.
+func (principals Principals) MarshalJSON() ([]byte, error) {
+  if reflect.DeepEqual(principals, AnyPrincipal) {
+    return []byte(`"*"`), nil
+  }
+  return json.Marshal(map[string]StringList(principals))
+}
+
+// UnmarshalJSON reads "*" as AnyPrincipal and an object of principals by type otherwise.
+func (principals *Principals) UnmarshalJSON(data []byte) error {
+  var wildcard string
+  if json.Unmarshal(data, &wildcard) == nil {
+    if wildcard != "*" {
+      return errors.New(str.Concat("The principal ", wildcard, " is neither \"*\" nor an object of principals by type"))
+    }
+    *principals = Principals{"AWS": {"*"}}
+    return nil
+  }
+  var byType map[string]StringList
+  err := json.Unmarshal(data, &byType)
+  if err != nil {
+    return err
+  }
+  *principals = byType
+  return nil
+}
+
+// MarshalJSON writes a single string for a list of one, as AWS does, and an array otherwise.
+func (list StringList) MarshalJSON() ([]byte, error) {
+  if len(list) == 1 {
+    return json.Marshal(list[0])
+  }
+  return json.Marshal([]string(list))
+}
+
+// UnmarshalJSON reads a string, boolean, number or an array of them.
+func (list *StringList) UnmarshalJSON(data []byte) error {
+  var values []interface{}
+  if json.Unmarshal(data, &values) != nil {
+    var value interface{}
+    err := json.Unmarshal(data, &value)
+    if err != nil {
+      return err
+    }
+    values = []interface{}{value}
+  }
+  *list = make(StringList, 0, len(values))
+  for _, value := range values {
+    switch typed := value.(type) {
+    case string:
+      *list = append(*list, typed)
+    case bool:
+      *list = append(*list, strconv.FormatBool(typed))
+    case float64:
+      *list = append(*list, strconv.FormatFloat(typed, 'f', -1, 64))
+    default:
+      return errors.New("A policy value is neither a string, boolean nor number")
+    }
+  }
+  return nil
+}
+
+// name returns how errors refer to the statement: by Sid, or by its position when it has none.
+func (statement Statement) name(index int) string {
+  if statement.Sid != "" {
+    return str.Concat("The statement ", statement.Sid)
+  }
+  return str.Concat("Statement ", strconv.Itoa(index + 1))
+}
+
+// baseOperator returns a condition operator without its ForAllValues: or ForAnyValue: prefix and IfExists suffix, and
+// whether it is one Evaluate understands.
+func baseOperator(operator string) (string, bool) {
+  base := strings.TrimSuffix(operator, "IfExists")
+  base = strings.TrimPrefix(strings.TrimPrefix(base, "ForAllValues:"), "ForAnyValue:")
+  switch base {
+  case "StringEquals", "StringNotEquals", "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase", "StringLike",
+    "StringNotLike", "ArnEquals", "ArnNotEquals", "ArnLike", "ArnNotLike", "Bool", "NumericEquals", "NumericNotEquals",
+    "NumericLessThan", "NumericLessThanEquals", "NumericGreaterThan", "NumericGreaterThanEquals", "DateEquals",
+    "DateNotEquals", "DateLessThan", "DateLessThanEquals", "DateGreaterThan", "DateGreaterThanEquals", "IpAddress",
+    "NotIpAddress", "BinaryEquals", "Null":
+    return base, true
+  }
+  return base, false
+}
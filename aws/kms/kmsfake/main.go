@@ -0,0 +1,425 @@
+// Package kmsfake is an in-memory stand-in for the parts of the KMS API used by the
+// github.com/PyramidSystemsInc/go/aws/kms package, so it can be unit tested offline.
+package kmsfake
+
+import (
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// KMS keeps keys, their tags and aliases in memory. Keys are keyed by id. Calling an operation that
+// is not implemented panics.
+type KMS struct {
+	kmsiface.KMSAPI
+
+	mutex     sync.Mutex
+	counter   int
+	Region    string
+	AccountID string
+	Keys      map[string]*kms.KeyMetadata
+	Tags      map[string][]*kms.Tag
+	// Aliases maps alias names, such as alias/pac/example, to key ids.
+	Aliases map[string]string
+	// Policies and Rotations hold the key policy and whether rotation is on by key id.
+	Policies  map[string]string
+	Rotations map[string]bool
+	// PageSize is the number of keys, aliases or tags returned per page.
+	PageSize int
+	// ciphertexts maps the random blobs returned by Encrypt and GenerateDataKey to what they decrypt to.
+	ciphertexts map[string]ciphertext
+}
+
+type ciphertext struct {
+	keyId             string
+	encryptionContext map[string]*string
+	plaintext         []byte
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *KMS {
+	return &KMS{
+		Region:      "us-east-1",
+		AccountID:   "123456789012",
+		Keys:        map[string]*kms.KeyMetadata{},
+		Tags:        map[string][]*kms.Tag{},
+		Aliases:     map[string]string{},
+		Policies:    map[string]string{},
+		Rotations:   map[string]bool{},
+		PageSize:    100,
+		ciphertexts: map[string]ciphertext{},
+	}
+}
+
+// CancelKeyDeletionWithContext leaves a key pending deletion disabled, as KMS does.
+func (fake *KMS) CancelKeyDeletionWithContext(ctx aws.Context, input *kms.CancelKeyDeletionInput, opts ...request.Option) (*kms.CancelKeyDeletionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(key.KeyState) != kms.KeyStatePendingDeletion {
+		return nil, awserr.New(kms.ErrCodeInvalidStateException, aws.StringValue(key.Arn)+" is not pending deletion.", nil)
+	}
+	key.DeletionDate = nil
+	key.KeyState = aws.String(kms.KeyStateDisabled)
+	return &kms.CancelKeyDeletionOutput{
+		KeyId: key.Arn,
+	}, nil
+}
+
+// CreateKeyWithContext creates an enabled customer managed key.
+func (fake *KMS) CreateKeyWithContext(ctx aws.Context, input *kms.CreateKeyInput, opts ...request.Option) (*kms.CreateKeyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.counter++
+	id := fmt.Sprintf("00000000-0000-0000-0000-%012d", fake.counter)
+	key := &kms.KeyMetadata{
+		AWSAccountId: aws.String(fake.AccountID),
+		Arn:          aws.String(fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", fake.Region, fake.AccountID, id)),
+		CreationDate: aws.Time(time.Now()),
+		Description:  input.Description,
+		Enabled:      aws.Bool(true),
+		KeyId:        aws.String(id),
+		KeyManager:   aws.String(kms.KeyManagerTypeCustomer),
+		KeyState:     aws.String(kms.KeyStateEnabled),
+		KeyUsage:     aws.String(kms.KeyUsageTypeEncryptDecrypt),
+	}
+	fake.Keys[id] = key
+	fake.Tags[id] = input.Tags
+	fake.Policies[id] = aws.StringValue(input.Policy)
+	return &kms.CreateKeyOutput{
+		KeyMetadata: key,
+	}, nil
+}
+
+// CreateAliasWithContext points a new alias at a key.
+func (fake *KMS) CreateAliasWithContext(ctx aws.Context, input *kms.CreateAliasInput, opts ...request.Option) (*kms.CreateAliasOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.AliasName)
+	if !strings.HasPrefix(name, "alias/") {
+		return nil, awserr.New("ValidationException", "Alias must start with the prefix \"alias/\"", nil)
+	}
+	if _, ok := fake.Aliases[name]; ok {
+		return nil, awserr.New(kms.ErrCodeAlreadyExistsException, "An alias with the name "+name+" already exists", nil)
+	}
+	key, err := fake.key(input.TargetKeyId)
+	if err != nil {
+		return nil, err
+	}
+	fake.Aliases[name] = aws.StringValue(key.KeyId)
+	return &kms.CreateAliasOutput{}, nil
+}
+
+// DecryptWithContext returns the plaintext of a blob from Encrypt or GenerateDataKey. The encryption context
+// must match and the key must still be enabled.
+func (fake *KMS) DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	stored, ok := fake.ciphertexts[string(input.CiphertextBlob)]
+	if !ok || !equalContexts(stored.encryptionContext, input.EncryptionContext) {
+		return nil, awserr.New(kms.ErrCodeInvalidCiphertextException, "", nil)
+	}
+	if input.KeyId != nil {
+		key, err := fake.key(input.KeyId)
+		if err != nil {
+			return nil, err
+		}
+		if aws.StringValue(key.KeyId) != stored.keyId {
+			return nil, awserr.New(kms.ErrCodeIncorrectKeyException, "The key ID in the request does not identify a key that can decrypt the ciphertext", nil)
+		}
+	}
+	key, err := fake.enabledKey(aws.String(stored.keyId))
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{
+		EncryptionAlgorithm: aws.String(kms.EncryptionAlgorithmSpecSymmetricDefault),
+		KeyId:               key.Arn,
+		Plaintext:           append([]byte{}, stored.plaintext...),
+	}, nil
+}
+
+// DescribeKeyWithContext returns a copy of the metadata of a key.
+func (fake *KMS) DescribeKeyWithContext(ctx aws.Context, input *kms.DescribeKeyInput, opts ...request.Option) (*kms.DescribeKeyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	copied := *key
+	return &kms.DescribeKeyOutput{
+		KeyMetadata: &copied,
+	}, nil
+}
+
+// EnableKeyWithContext enables a disabled key.
+func (fake *KMS) EnableKeyWithContext(ctx aws.Context, input *kms.EnableKeyInput, opts ...request.Option) (*kms.EnableKeyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(key.KeyState) == kms.KeyStatePendingDeletion {
+		return nil, awserr.New(kms.ErrCodeInvalidStateException, aws.StringValue(key.Arn)+" is pending deletion.", nil)
+	}
+	key.Enabled = aws.Bool(true)
+	key.KeyState = aws.String(kms.KeyStateEnabled)
+	return &kms.EnableKeyOutput{}, nil
+}
+
+// EnableKeyRotationWithContext turns on rotation of an enabled key.
+func (fake *KMS) EnableKeyRotationWithContext(ctx aws.Context, input *kms.EnableKeyRotationInput, opts ...request.Option) (*kms.EnableKeyRotationOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.enabledKey(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	fake.Rotations[aws.StringValue(key.KeyId)] = true
+	return &kms.EnableKeyRotationOutput{}, nil
+}
+
+// EncryptWithContext encrypts up to 4096 bytes with an enabled key.
+func (fake *KMS) EncryptWithContext(ctx aws.Context, input *kms.EncryptInput, opts ...request.Option) (*kms.EncryptOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if len(input.Plaintext) == 0 || len(input.Plaintext) > 4096 {
+		return nil, awserr.New("ValidationException", "Plaintext must be between 1 and 4096 bytes", nil)
+	}
+	key, err := fake.enabledKey(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{
+		CiphertextBlob:      fake.encrypt(key, input.Plaintext, input.EncryptionContext),
+		EncryptionAlgorithm: aws.String(kms.EncryptionAlgorithmSpecSymmetricDefault),
+		KeyId:               key.Arn,
+	}, nil
+}
+
+// GenerateDataKeyWithContext returns a random data key and the blob it is encrypted as.
+func (fake *KMS) GenerateDataKeyWithContext(ctx aws.Context, input *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	size := int(aws.Int64Value(input.NumberOfBytes))
+	switch aws.StringValue(input.KeySpec) {
+	case kms.DataKeySpecAes256:
+		size = 32
+	case kms.DataKeySpecAes128:
+		size = 16
+	}
+	if size == 0 {
+		return nil, awserr.New("ValidationException", "Either KeySpec or NumberOfBytes is required", nil)
+	}
+	key, err := fake.enabledKey(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, size)
+	rand.Read(plaintext)
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: fake.encrypt(key, plaintext, input.EncryptionContext),
+		KeyId:          key.Arn,
+		Plaintext:      plaintext,
+	}, nil
+}
+
+// GetKeyRotationStatusWithContext reports whether rotation is on for a key.
+func (fake *KMS) GetKeyRotationStatusWithContext(ctx aws.Context, input *kms.GetKeyRotationStatusInput, opts ...request.Option) (*kms.GetKeyRotationStatusOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(key.KeyState) == kms.KeyStatePendingDeletion {
+		return nil, awserr.New(kms.ErrCodeInvalidStateException, aws.StringValue(key.Arn)+" is pending deletion.", nil)
+	}
+	return &kms.GetKeyRotationStatusOutput{
+		KeyRotationEnabled: aws.Bool(fake.Rotations[aws.StringValue(key.KeyId)]),
+	}, nil
+}
+
+// ListAliasesPagesWithContext calls fn with pages of the aliases, sorted by name, of one key or of
+// every key until fn returns false.
+func (fake *KMS) ListAliasesPagesWithContext(ctx aws.Context, input *kms.ListAliasesInput, fn func(*kms.ListAliasesOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	var aliases []*kms.AliasListEntry
+	keyId := ""
+	if input.KeyId != nil {
+		key, err := fake.key(input.KeyId)
+		if err != nil {
+			fake.mutex.Unlock()
+			return err
+		}
+		keyId = aws.StringValue(key.KeyId)
+	}
+	for name, target := range fake.Aliases {
+		if keyId == "" || target == keyId {
+			aliases = append(aliases, &kms.AliasListEntry{
+				AliasArn:    aws.String(fmt.Sprintf("arn:aws:kms:%s:%s:%s", fake.Region, fake.AccountID, name)),
+				AliasName:   aws.String(name),
+				TargetKeyId: aws.String(target),
+			})
+		}
+	}
+	fake.mutex.Unlock()
+	sort.Slice(aliases, func(i, j int) bool {
+		return *aliases[i].AliasName < *aliases[j].AliasName
+	})
+	return fake.pages(len(aliases), func(start, end int, last bool) bool {
+		return fn(&kms.ListAliasesOutput{
+			Aliases:   aliases[start:end],
+			Truncated: aws.Bool(!last),
+		}, last)
+	})
+}
+
+// ListKeysPagesWithContext calls fn with pages of every key, in the order they were created, until
+// fn returns false.
+func (fake *KMS) ListKeysPagesWithContext(ctx aws.Context, input *kms.ListKeysInput, fn func(*kms.ListKeysOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	var keys []*kms.KeyListEntry
+	for id, key := range fake.Keys {
+		keys = append(keys, &kms.KeyListEntry{
+			KeyArn: key.Arn,
+			KeyId:  aws.String(id),
+		})
+	}
+	fake.mutex.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return *keys[i].KeyId < *keys[j].KeyId
+	})
+	return fake.pages(len(keys), func(start, end int, last bool) bool {
+		return fn(&kms.ListKeysOutput{
+			Keys:      keys[start:end],
+			Truncated: aws.Bool(!last),
+		}, last)
+	})
+}
+
+// ListResourceTagsPagesWithContext calls fn with pages of the tags of a key until fn returns false.
+func (fake *KMS) ListResourceTagsPagesWithContext(ctx aws.Context, input *kms.ListResourceTagsInput, fn func(*kms.ListResourceTagsOutput, bool) bool, opts ...request.Option) error {
+	fake.mutex.Lock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		fake.mutex.Unlock()
+		return err
+	}
+	tags := append([]*kms.Tag{}, fake.Tags[aws.StringValue(key.KeyId)]...)
+	fake.mutex.Unlock()
+	return fake.pages(len(tags), func(start, end int, last bool) bool {
+		return fn(&kms.ListResourceTagsOutput{
+			Tags:      tags[start:end],
+			Truncated: aws.Bool(!last),
+		}, last)
+	})
+}
+
+// ScheduleKeyDeletionWithContext marks a key as pending deletion.
+func (fake *KMS) ScheduleKeyDeletionWithContext(ctx aws.Context, input *kms.ScheduleKeyDeletionInput, opts ...request.Option) (*kms.ScheduleKeyDeletionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	key, err := fake.key(input.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	days := aws.Int64Value(input.PendingWindowInDays)
+	if days == 0 {
+		days = 30
+	}
+	if days < 7 || days > 30 {
+		return nil, awserr.New("ValidationException", "PendingWindowInDays must be between 7 and 30", nil)
+	}
+	if aws.StringValue(key.KeyState) == kms.KeyStatePendingDeletion {
+		return nil, awserr.New(kms.ErrCodeInvalidStateException, aws.StringValue(key.Arn)+" is pending deletion.", nil)
+	}
+	key.DeletionDate = aws.Time(time.Now().AddDate(0, 0, int(days)))
+	key.Enabled = aws.Bool(false)
+	key.KeyState = aws.String(kms.KeyStatePendingDeletion)
+	return &kms.ScheduleKeyDeletionOutput{
+		DeletionDate: key.DeletionDate,
+		KeyId:        key.Arn,
+	}, nil
+}
+
+// encrypt returns a new random blob that decrypts to the plaintext.
+func (fake *KMS) encrypt(key *kms.KeyMetadata, plaintext []byte, encryptionContext map[string]*string) []byte {
+	blob := make([]byte, 64)
+	rand.Read(blob)
+	fake.ciphertexts[string(blob)] = ciphertext{
+		keyId:             aws.StringValue(key.KeyId),
+		encryptionContext: encryptionContext,
+		plaintext:         append([]byte{}, plaintext...),
+	}
+	return blob
+}
+
+// enabledKey finds a key as key does, failing when it is disabled or pending deletion.
+func (fake *KMS) enabledKey(keyId *string) (*kms.KeyMetadata, error) {
+	key, err := fake.key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(key.KeyState) == kms.KeyStateDisabled {
+		return nil, awserr.New(kms.ErrCodeDisabledException, aws.StringValue(key.Arn)+" is disabled.", nil)
+	}
+	if aws.StringValue(key.KeyState) != kms.KeyStateEnabled {
+		return nil, awserr.New(kms.ErrCodeInvalidStateException, aws.StringValue(key.Arn)+" is "+aws.StringValue(key.KeyState)+".", nil)
+	}
+	return key, nil
+}
+
+// pages calls page with the bounds of each page of PageSize out of count entries, always at least
+// once, until page returns false.
+func (fake *KMS) pages(count int, page func(start, end int, last bool) bool) error {
+	size := fake.PageSize
+	if size <= 0 {
+		size = count + 1
+	}
+	for start := 0; ; start += size {
+		end := start + size
+		if end > count {
+			end = count
+		}
+		if !page(start, end, end == count) || end == count {
+			return nil
+		}
+	}
+}
+
+func equalContexts(a, b map[string]*string) bool {
+	return reflect.DeepEqual(aws.StringValueMap(a), aws.StringValueMap(b))
+}
+
+// key finds a key by id, ARN, alias name or alias ARN.
+func (fake *KMS) key(keyId *string) (*kms.KeyMetadata, error) {
+	id := aws.StringValue(keyId)
+	if index := strings.Index(id, ":alias/"); index >= 0 {
+		id = id[index+1:]
+	}
+	if target, ok := fake.Aliases[id]; ok {
+		id = target
+	}
+	id = id[strings.LastIndex(id, "/")+1:]
+	key, ok := fake.Keys[id]
+	if !ok {
+		return nil, awserr.New(kms.ErrCodeNotFoundException, "Key '"+aws.StringValue(keyId)+"' does not exist", nil)
+	}
+	return key, nil
+}
@@ -1,86 +1,842 @@
 package kms
 
 import (
-  "fmt"
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "encoding/binary"
+  "io"
+  "io/ioutil"
   "os"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
 
+  "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/files"
+  "github.com/PyramidSystemsInc/go/str"
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/awserr"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/kms"
+  "github.com/aws/aws-sdk-go/service/kms/kmsiface"
 )
 
+// Client creates and looks up KMS keys and encrypts with them, directly or with data keys.
+type Client struct {
+  KMS kmsiface.KMSAPI
+}
+
+// DefaultAliasPrefix starts the aliases of keys made by CreateEncryptionKey.
+const DefaultAliasPrefix = "alias/pac/"
+
+// MinPendingWindowDays and MaxPendingWindowDays bound how long a key scheduled for deletion can be recovered.
+const (
+  MinPendingWindowDays = 7
+  MaxPendingWindowDays = 30
+)
+
+// Key describes a KMS key with its aliases and, for customer managed keys, its tags and rotation.
+type Key struct {
+  Id string
+  Arn string
+  Description string
+  // State is a kms.KeyState value, such as Enabled or PendingDeletion
+  State string
+  // Manager is CUSTOMER or AWS
+  Manager string
+  CreatedAt time.Time
+  // DeletionDate is zero unless the key is pending deletion
+  DeletionDate time.Time
+  Aliases []string
+  Tags map[string]string
+  Rotation bool
+}
+
+// KeyOptions holds the settings of a key made by CreateKey. All of them are optional.
+type KeyOptions struct {
+  Description string
+  // Alias names the key with any prefix, such as alias/myteam/example. The alias/ KMS requires is added when missing
+  Alias string
+  Tags map[string]string
+  // Policy is the key policy as JSON, such as from iam.PolicyDocument.Json. Without one, KMS gives the account full access to
+  // the key
+  Policy string
+  // Rotation turns on the yearly automatic rotation of the key material
+  Rotation bool
+}
+
+// maxDirectSize is the most bytes KMS encrypts itself.
+const maxDirectSize = 4096
+
+// envelopeChunkSize is the size of the plaintext chunks of an envelope, each sealed on its own.
+const envelopeChunkSize = 64 * 1024
+
+// noncePrefixSize is the size of the random part of the nonces of an envelope. The rest is the chunk counter and last flag.
+const noncePrefixSize = 7
+
+// lastChunkFlag is set in the length of the last chunk of an envelope.
+const lastChunkFlag = 1 << 31
+
+// formatHeader starts everything encrypted by EncryptStream and EncryptFile, followed by the format version and whether
+// the rest is a KMS ciphertext (modeDirect) or an envelope (modeEnvelope).
+var formatHeader = []byte("PACKMS")
+
+const (
+  formatVersion = 1
+  modeDirect = 'D'
+  modeEnvelope = 'E'
+)
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    KMS: kms.New(awsSession),
+  }
+}
+
+// CancelKeyDeletion cancels the scheduled deletion of a key and enables it again, or exits if it cannot be cancelled.
+func CancelKeyDeletion(keyId string, awsSession *session.Session) {
+  errors.QuitIfError(CancelKeyDeletionE(keyId, awsSession))
+}
+
+// CancelKeyDeletionE is CancelKeyDeletion returning an error instead of exiting.
+func CancelKeyDeletionE(keyId string, awsSession *session.Session) error {
+  return CancelKeyDeletionWithContext(context.Background(), keyId, awsSession)
+}
+
+// CancelKeyDeletionWithContext is CancelKeyDeletionE with a context to allow cancellation.
+func CancelKeyDeletionWithContext(ctx context.Context, keyId string, awsSession *session.Session) error {
+  return New(awsSession).CancelKeyDeletion(ctx, keyId)
+}
+
+// CancelKeyDeletion cancels the scheduled deletion of a key, given by id or ARN. KMS leaves a cancelled key disabled,
+// so it is enabled again to decrypt what it encrypted.
+func (client *Client) CancelKeyDeletion(ctx context.Context, keyId string) error {
+  _, err := client.KMS.CancelKeyDeletionWithContext(ctx, &kms.CancelKeyDeletionInput{
+    KeyId: aws.String(keyId),
+  })
+  if err != nil {
+    return err
+  }
+  _, err = client.KMS.EnableKeyWithContext(ctx, &kms.EnableKeyInput{
+    KeyId: aws.String(keyId),
+  })
+  return err
+}
+
 // CreateEncryptionKey creates a customer managed key in the AWS Key Management Service
 // and returns the encryption key id. The session holds the region information, the k and v
-// are key/value pairs used to tag the encryption key for later identification.
+// are key/value pairs used to tag the encryption key for later identification. The key is
+// aliased alias/pac/<v>, while CreateKey lets the caller choose. It exits if the key cannot be created.
 func CreateEncryptionKey(awsSession *session.Session, k string, v string) (key string) {
-  kmsClient := kms.New(awsSession)
-
-  result, err := kmsClient.CreateKey(&kms.CreateKeyInput{
-    Tags: []*kms.Tag{
-      {
-        TagKey:   aws.String(k),
-        TagValue: aws.String(v),
-      },
-    },
+  key, err := CreateEncryptionKeyE(awsSession, k, v)
+  errors.QuitIfError(err)
+  return key
+}
+
+// CreateEncryptionKeyE is CreateEncryptionKey returning an error instead of exiting.
+func CreateEncryptionKeyE(awsSession *session.Session, k string, v string) (string, error) {
+  return CreateEncryptionKeyWithContext(context.Background(), awsSession, k, v)
+}
+
+// CreateEncryptionKeyWithContext is CreateEncryptionKeyE with a context to allow cancellation.
+func CreateEncryptionKeyWithContext(ctx context.Context, awsSession *session.Session, k string, v string) (string, error) {
+  return New(awsSession).CreateEncryptionKey(ctx, k, v)
+}
+
+// CreateEncryptionKey creates a key tagged k=v and aliased alias/pac/<v> and returns its id.
+func (client *Client) CreateEncryptionKey(ctx context.Context, k string, v string) (string, error) {
+  key, err := client.CreateKey(ctx, KeyOptions{
+    Alias: DefaultAliasPrefix + v,
+    Tags: map[string]string{k: v},
   })
+  return key.Id, err
+}
+
+// CreateKey creates a customer managed key with the given options and returns it, or exits if it cannot be created.
+func CreateKey(options KeyOptions, awsSession *session.Session) Key {
+  key, err := CreateKeyE(options, awsSession)
+  errors.QuitIfError(err)
+  return key
+}
 
+// CreateKeyE is CreateKey returning an error instead of exiting.
+func CreateKeyE(options KeyOptions, awsSession *session.Session) (Key, error) {
+  return CreateKeyWithContext(context.Background(), options, awsSession)
+}
+
+// CreateKeyWithContext is CreateKeyE with a context to allow cancellation.
+func CreateKeyWithContext(ctx context.Context, options KeyOptions, awsSession *session.Session) (Key, error) {
+  return New(awsSession).CreateKey(ctx, options)
+}
+
+// CreateKey creates a symmetric customer managed key with the given options and returns it. If rotation or the alias
+// cannot be set up, the half made key is scheduled for deletion in 7 days and the error is returned.
+func (client *Client) CreateKey(ctx context.Context, options KeyOptions) (Key, error) {
+  input := &kms.CreateKeyInput{}
+  if options.Description != "" {
+    input.Description = aws.String(options.Description)
+  }
+  if options.Policy != "" {
+    input.Policy = aws.String(options.Policy)
+  }
+  tagKeys := make([]string, 0, len(options.Tags))
+  for tagKey := range options.Tags {
+    tagKeys = append(tagKeys, tagKey)
+  }
+  sort.Strings(tagKeys)
+  for _, tagKey := range tagKeys {
+    input.Tags = append(input.Tags, &kms.Tag{
+      TagKey: aws.String(tagKey),
+      TagValue: aws.String(options.Tags[tagKey]),
+    })
+  }
+  result, err := client.KMS.CreateKeyWithContext(ctx, input)
+  if err != nil {
+    return Key{}, errors.New("error creating encryption key: " + err.Error())
+  }
+  key := toKey(result.KeyMetadata)
+  key.Tags = options.Tags
+  if options.Rotation {
+    _, err = client.KMS.EnableKeyRotationWithContext(ctx, &kms.EnableKeyRotationInput{
+      KeyId: aws.String(key.Id),
+    })
+    if err != nil {
+      return Key{}, client.abandonKey(ctx, key.Id, "error enabling encryption key rotation: " + err.Error())
+    }
+    key.Rotation = true
+  }
+  if options.Alias != "" {
+    alias := aliasName(options.Alias)
+    _, err = client.KMS.CreateAliasWithContext(ctx, &kms.CreateAliasInput{
+      AliasName: aws.String(alias),
+      TargetKeyId: aws.String(key.Id),
+    })
+    if err != nil {
+      return Key{}, client.abandonKey(ctx, key.Id, "error creating encryption key alias: " + err.Error())
+    }
+    key.Aliases = []string{alias}
+  }
+  return key, nil
+}
+
+// Decrypt returns the plaintext of data encrypted by Encrypt with the same encryption context, or exits if it cannot be decrypted.
+func Decrypt(ciphertext []byte, encryptionContext map[string]string, awsSession *session.Session) []byte {
+  plaintext, err := DecryptE(ciphertext, encryptionContext, awsSession)
+  errors.QuitIfError(err)
+  return plaintext
+}
+
+// DecryptE is Decrypt returning an error instead of exiting.
+func DecryptE(ciphertext []byte, encryptionContext map[string]string, awsSession *session.Session) ([]byte, error) {
+  return DecryptWithContext(context.Background(), ciphertext, encryptionContext, awsSession)
+}
+
+// DecryptWithContext is DecryptE with a context to allow cancellation.
+func DecryptWithContext(ctx context.Context, ciphertext []byte, encryptionContext map[string]string, awsSession *session.Session) ([]byte, error) {
+  return New(awsSession).Decrypt(ctx, ciphertext, encryptionContext)
+}
+
+// Decrypt returns the plaintext of data encrypted by Encrypt. The encryption context must be the one it was encrypted with.
+func (client *Client) Decrypt(ctx context.Context, ciphertext []byte, encryptionContext map[string]string) ([]byte, error) {
+  result, err := client.KMS.DecryptWithContext(ctx, &kms.DecryptInput{
+    CiphertextBlob: ciphertext,
+    EncryptionContext: optionalStringMap(encryptionContext),
+  })
   if err != nil {
-    fmt.Println("error creating encryption key: ", err)
-    os.Exit(1)
+    return nil, err
   }
+  return result.Plaintext, nil
+}
+
+// DecryptFile replaces a file encrypted by EncryptFile with its plaintext, or exits if it cannot be decrypted.
+func DecryptFile(filePath string, encryptionContext map[string]string, awsSession *session.Session) {
+  errors.QuitIfError(DecryptFileE(filePath, encryptionContext, awsSession))
+}
+
+// DecryptFileE is DecryptFile returning an error instead of exiting.
+func DecryptFileE(filePath string, encryptionContext map[string]string, awsSession *session.Session) error {
+  return DecryptFileWithContext(context.Background(), filePath, encryptionContext, awsSession)
+}
 
-  alias := "alias/pac/" + v
+// DecryptFileWithContext is DecryptFileE with a context to allow cancellation.
+func DecryptFileWithContext(ctx context.Context, filePath string, encryptionContext map[string]string, awsSession *session.Session) error {
+  return New(awsSession).DecryptFile(ctx, filePath, encryptionContext)
+}
 
-  _, err = kmsClient.CreateAlias(&kms.CreateAliasInput{
-    AliasName:   aws.String(alias),
-    TargetKeyId: aws.String(*result.KeyMetadata.KeyId),
+// DecryptFile replaces a file encrypted by EncryptFile with its plaintext. The file is left encrypted if any of it
+// cannot be decrypted or authenticated.
+func (client *Client) DecryptFile(ctx context.Context, filePath string, encryptionContext map[string]string) error {
+  err := files.Rewrite(filePath, func(reader io.Reader, writer io.Writer) error {
+    return client.DecryptStream(ctx, reader, writer, encryptionContext)
   })
+  if err != nil {
+    return errors.New(str.Concat("Could not decrypt ", filePath, ": ", err.Error()))
+  }
+  return nil
+}
+
+// DecryptStream writes the plaintext of a stream encrypted by EncryptStream or EncryptFile, or exits if it cannot be decrypted.
+func DecryptStream(reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) {
+  errors.QuitIfError(DecryptStreamE(reader, writer, encryptionContext, awsSession))
+}
+
+// DecryptStreamE is DecryptStream returning an error instead of exiting.
+func DecryptStreamE(reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) error {
+  return DecryptStreamWithContext(context.Background(), reader, writer, encryptionContext, awsSession)
+}
+
+// DecryptStreamWithContext is DecryptStreamE with a context to allow cancellation.
+func DecryptStreamWithContext(ctx context.Context, reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) error {
+  return New(awsSession).DecryptStream(ctx, reader, writer, encryptionContext)
+}
 
+// DecryptStream writes the plaintext of a stream encrypted by EncryptStream or EncryptFile. The encryption context must be
+// the one it was encrypted with. Chunks are written as they are authenticated, so when an error is returned part of the
+// plaintext may already have been written and must be discarded.
+func (client *Client) DecryptStream(ctx context.Context, reader io.Reader, writer io.Writer, encryptionContext map[string]string) error {
+  bufferedReader := bufio.NewReader(reader)
+  prefix := make([]byte, len(formatHeader) + 2)
+  _, err := io.ReadFull(bufferedReader, prefix)
+  if err != nil || !bytes.HasPrefix(prefix, formatHeader) {
+    return errors.New("The data was not encrypted by this package")
+  }
+  if prefix[len(formatHeader)] != formatVersion {
+    return errors.New(str.Concat("The data was encrypted with the unknown format version ", strconv.Itoa(int(prefix[len(formatHeader)]))))
+  }
+  if prefix[len(formatHeader) + 1] == modeDirect {
+    ciphertext, err := ioutil.ReadAll(bufferedReader)
+    if err != nil {
+      return err
+    }
+    plaintext, err := client.Decrypt(ctx, ciphertext, encryptionContext)
+    if err != nil {
+      return err
+    }
+    _, err = writer.Write(plaintext)
+    return err
+  }
+  if prefix[len(formatHeader) + 1] != modeEnvelope {
+    return errors.New("The data was encrypted in an unknown mode")
+  }
+  var wrappedKeySize uint16
+  err = binary.Read(bufferedReader, binary.BigEndian, &wrappedKeySize)
+  if err != nil {
+    return truncated(err)
+  }
+  wrappedKey := make([]byte, wrappedKeySize)
+  noncePrefix := make([]byte, noncePrefixSize)
+  var chunkSize uint32
+  _, err = io.ReadFull(bufferedReader, wrappedKey)
+  if err == nil {
+    _, err = io.ReadFull(bufferedReader, noncePrefix)
+  }
+  if err == nil {
+    err = binary.Read(bufferedReader, binary.BigEndian, &chunkSize)
+  }
+  if err != nil {
+    return truncated(err)
+  }
+  if chunkSize != envelopeChunkSize {
+    return errors.New("The encrypted data is corrupt")
+  }
+  header := envelopeHeader(wrappedKey, noncePrefix, chunkSize)
+  dataKey, err := client.Decrypt(ctx, wrappedKey, encryptionContext)
   if err != nil {
-    fmt.Println("error creating encryption key alias: ", err)
+    return err
   }
+  aead, err := newAead(dataKey)
+  if err != nil {
+    return err
+  }
+  sealed := make([]byte, int(chunkSize) + aead.Overhead())
+  for counter := uint32(0); ; counter++ {
+    var length uint32
+    err = binary.Read(bufferedReader, binary.BigEndian, &length)
+    if err != nil {
+      return truncated(err)
+    }
+    last := length & lastChunkFlag != 0
+    length &^= lastChunkFlag
+    if int(length) > len(sealed) {
+      return errors.New("The encrypted data is corrupt")
+    }
+    _, err = io.ReadFull(bufferedReader, sealed[:length])
+    if err != nil {
+      return truncated(err)
+    }
+    plaintext, err := aead.Open(nil, chunkNonce(noncePrefix, counter, last), sealed[:length], header)
+    if err != nil {
+      return errors.New("The encrypted data is corrupt or was tampered with")
+    }
+    _, err = writer.Write(plaintext)
+    if err != nil {
+      return err
+    }
+    if last {
+      break
+    }
+  }
+  if _, err := bufferedReader.ReadByte(); err != io.EOF {
+    return errors.New("The encrypted data is followed by unexpected data")
+  }
+  return nil
+}
+
+// Encrypt returns data of up to 4 KB encrypted by the key, or exits if it cannot be encrypted.
+func Encrypt(keyId string, plaintext []byte, encryptionContext map[string]string, awsSession *session.Session) []byte {
+  ciphertext, err := EncryptE(keyId, plaintext, encryptionContext, awsSession)
+  errors.QuitIfError(err)
+  return ciphertext
+}
+
+// EncryptE is Encrypt returning an error instead of exiting.
+func EncryptE(keyId string, plaintext []byte, encryptionContext map[string]string, awsSession *session.Session) ([]byte, error) {
+  return EncryptWithContext(context.Background(), keyId, plaintext, encryptionContext, awsSession)
+}
 
-  return *result.KeyMetadata.KeyId
+// EncryptWithContext is EncryptE with a context to allow cancellation.
+func EncryptWithContext(ctx context.Context, keyId string, plaintext []byte, encryptionContext map[string]string, awsSession *session.Session) ([]byte, error) {
+  return New(awsSession).Encrypt(ctx, keyId, plaintext, encryptionContext)
+}
+
+// Encrypt returns data of up to 4 KB encrypted by the key, given by id, ARN or alias. The encryption context, such as
+// the name of the file or secret, is not secret but must be given again to decrypt. Use EncryptStream for larger data.
+func (client *Client) Encrypt(ctx context.Context, keyId string, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+  if len(plaintext) > maxDirectSize {
+    return nil, errors.New(str.Concat("KMS only encrypts up to 4096 bytes, got ", strconv.Itoa(len(plaintext)), ". Use EncryptStream or EncryptFile"))
+  }
+  result, err := client.KMS.EncryptWithContext(ctx, &kms.EncryptInput{
+    EncryptionContext: optionalStringMap(encryptionContext),
+    KeyId: aws.String(keyId),
+    Plaintext: plaintext,
+  })
+  if err != nil {
+    return nil, err
+  }
+  return result.CiphertextBlob, nil
+}
+
+// EncryptFile replaces a file with its contents encrypted by the key, or exits if it cannot be encrypted.
+func EncryptFile(filePath string, keyId string, encryptionContext map[string]string, awsSession *session.Session) {
+  errors.QuitIfError(EncryptFileE(filePath, keyId, encryptionContext, awsSession))
+}
+
+// EncryptFileE is EncryptFile returning an error instead of exiting.
+func EncryptFileE(filePath string, keyId string, encryptionContext map[string]string, awsSession *session.Session) error {
+  return EncryptFileWithContext(context.Background(), filePath, keyId, encryptionContext, awsSession)
+}
+
+// EncryptFileWithContext is EncryptFileE with a context to allow cancellation.
+func EncryptFileWithContext(ctx context.Context, filePath string, keyId string, encryptionContext map[string]string, awsSession *session.Session) error {
+  return New(awsSession).EncryptFile(ctx, filePath, keyId, encryptionContext)
+}
+
+// EncryptFile replaces a file with its contents encrypted by the key, so that it can be committed and later restored by
+// DecryptFile. Files of up to 4 KB are encrypted by KMS itself and larger ones with a data key as EncryptStream does.
+// Encrypting a file that is already encrypted is an error.
+func (client *Client) EncryptFile(ctx context.Context, filePath string, keyId string, encryptionContext map[string]string) error {
+  info, err := os.Stat(filePath)
+  if err != nil {
+    return err
+  }
+  err = files.Rewrite(filePath, func(reader io.Reader, writer io.Writer) error {
+    bufferedReader := bufio.NewReader(reader)
+    if start, _ := bufferedReader.Peek(len(formatHeader)); bytes.Equal(start, formatHeader) {
+      return errors.New("The file is already encrypted")
+    }
+    if info.Size() > maxDirectSize {
+      return client.EncryptStream(ctx, keyId, bufferedReader, writer, encryptionContext)
+    }
+    plaintext, err := ioutil.ReadAll(bufferedReader)
+    if err != nil {
+      return err
+    }
+    ciphertext, err := client.Encrypt(ctx, keyId, plaintext, encryptionContext)
+    if err != nil {
+      return err
+    }
+    _, err = writer.Write(append(append(append([]byte{}, formatHeader...), formatVersion, modeDirect), ciphertext...))
+    return err
+  })
+  if err != nil {
+    return errors.New(str.Concat("Could not encrypt ", filePath, ": ", err.Error()))
+  }
+  return nil
+}
+
+// EncryptStream writes a stream of any size encrypted by a new data key of the key, or exits if it cannot be encrypted.
+func EncryptStream(keyId string, reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) {
+  errors.QuitIfError(EncryptStreamE(keyId, reader, writer, encryptionContext, awsSession))
+}
+
+// EncryptStreamE is EncryptStream returning an error instead of exiting.
+func EncryptStreamE(keyId string, reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) error {
+  return EncryptStreamWithContext(context.Background(), keyId, reader, writer, encryptionContext, awsSession)
+}
+
+// EncryptStreamWithContext is EncryptStreamE with a context to allow cancellation.
+func EncryptStreamWithContext(ctx context.Context, keyId string, reader io.Reader, writer io.Writer, encryptionContext map[string]string, awsSession *session.Session) error {
+  return New(awsSession).EncryptStream(ctx, keyId, reader, writer, encryptionContext)
+}
+
+// EncryptStream writes a stream of any size encrypted with envelope encryption: KMS generates a data key under the key
+// (given by id, ARN or alias) and the encryption context, the data key wrapped by KMS is written in a header, and the
+// stream follows in 64 KB chunks each sealed with AES-256-GCM. Reordered, dropped or truncated chunks fail DecryptStream.
+func (client *Client) EncryptStream(ctx context.Context, keyId string, reader io.Reader, writer io.Writer, encryptionContext map[string]string) error {
+  dataKey, err := client.KMS.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+    EncryptionContext: optionalStringMap(encryptionContext),
+    KeyId: aws.String(keyId),
+    KeySpec: aws.String(kms.DataKeySpecAes256),
+  })
+  if err != nil {
+    return err
+  }
+  aead, err := newAead(dataKey.Plaintext)
+  if err != nil {
+    return err
+  }
+  noncePrefix := make([]byte, noncePrefixSize)
+  _, err = rand.Read(noncePrefix)
+  if err != nil {
+    return err
+  }
+  header := envelopeHeader(dataKey.CiphertextBlob, noncePrefix, envelopeChunkSize)
+  _, err = writer.Write(header)
+  if err != nil {
+    return err
+  }
+  chunk := make([]byte, envelopeChunkSize)
+  for counter := uint32(0); ; counter++ {
+    size, err := io.ReadFull(reader, chunk)
+    last := err == io.EOF || err == io.ErrUnexpectedEOF
+    if err != nil && !last {
+      return err
+    }
+    sealed := aead.Seal(nil, chunkNonce(noncePrefix, counter, last), chunk[:size], header)
+    length := uint32(len(sealed))
+    if last {
+      length |= lastChunkFlag
+    }
+    err = binary.Write(writer, binary.BigEndian, length)
+    if err == nil {
+      _, err = writer.Write(sealed)
+    }
+    if err != nil || last {
+      return err
+    }
+  }
+}
+
+// FindKeyByAlias returns the key an alias points at and whether there is one, or exits if it cannot be looked up.
+func FindKeyByAlias(alias string, awsSession *session.Session) (Key, bool) {
+  key, found, err := FindKeyByAliasE(alias, awsSession)
+  errors.QuitIfError(err)
+  return key, found
+}
+
+// FindKeyByAliasE is FindKeyByAlias returning an error instead of exiting.
+func FindKeyByAliasE(alias string, awsSession *session.Session) (Key, bool, error) {
+  return FindKeyByAliasWithContext(context.Background(), alias, awsSession)
+}
+
+// FindKeyByAliasWithContext is FindKeyByAliasE with a context to allow cancellation.
+func FindKeyByAliasWithContext(ctx context.Context, alias string, awsSession *session.Session) (Key, bool, error) {
+  return New(awsSession).FindKeyByAlias(ctx, alias)
+}
+
+// FindKeyByAlias returns the key an alias, such as alias/pac/example or pac/example, points at and whether there is one.
+func (client *Client) FindKeyByAlias(ctx context.Context, alias string) (Key, bool, error) {
+  key, err := client.describeKey(ctx, aliasName(alias), nil)
+  if isErrorCode(err, kms.ErrCodeNotFoundException) {
+    return Key{}, false, nil
+  }
+  if err != nil {
+    return Key{}, false, err
+  }
+  return key, true, nil
+}
+
+// FindKeysByTag returns the customer managed keys tagged with the key and value, or exits if they cannot be listed.
+func FindKeysByTag(tagKey string, tagValue string, awsSession *session.Session) []Key {
+  keys, err := FindKeysByTagE(tagKey, tagValue, awsSession)
+  errors.QuitIfError(err)
+  return keys
+}
+
+// FindKeysByTagE is FindKeysByTag returning an error instead of exiting.
+func FindKeysByTagE(tagKey string, tagValue string, awsSession *session.Session) ([]Key, error) {
+  return FindKeysByTagWithContext(context.Background(), tagKey, tagValue, awsSession)
+}
+
+// FindKeysByTagWithContext is FindKeysByTagE with a context to allow cancellation.
+func FindKeysByTagWithContext(ctx context.Context, tagKey string, tagValue string, awsSession *session.Session) ([]Key, error) {
+  return New(awsSession).FindKeysByTag(ctx, tagKey, tagValue)
+}
+
+// FindKeysByTag returns the customer managed keys tagged with the key and value, such as every key of a project, in
+// the order of ListKeys.
+func (client *Client) FindKeysByTag(ctx context.Context, tagKey string, tagValue string) ([]Key, error) {
+  keys, err := client.ListKeys(ctx)
+  if err != nil {
+    return nil, err
+  }
+  var tagged []Key
+  for _, key := range keys {
+    if value, ok := key.Tags[tagKey]; ok && value == tagValue {
+      tagged = append(tagged, key)
+    }
+  }
+  return tagged, nil
+}
+
+// ListKeys returns every key of the account in the region of the session, or exits if they cannot be listed.
+func ListKeys(awsSession *session.Session) []Key {
+  keys, err := ListKeysE(awsSession)
+  errors.QuitIfError(err)
+  return keys
+}
+
+// ListKeysE is ListKeys returning an error instead of exiting.
+func ListKeysE(awsSession *session.Session) ([]Key, error) {
+  return ListKeysWithContext(context.Background(), awsSession)
+}
+
+// ListKeysWithContext is ListKeysE with a context to allow cancellation.
+func ListKeysWithContext(ctx context.Context, awsSession *session.Session) ([]Key, error) {
+  return New(awsSession).ListKeys(ctx)
+}
+
+// ListKeys returns every key of the account, customer and AWS managed, following all pages of results. Each is
+// described with its aliases, and customer managed keys with their tags and rotation.
+func (client *Client) ListKeys(ctx context.Context) ([]Key, error) {
+  aliases, err := client.aliases(ctx, "")
+  if err != nil {
+    return nil, err
+  }
+  var keyIds []string
+  err = client.KMS.ListKeysPagesWithContext(ctx, &kms.ListKeysInput{}, func(page *kms.ListKeysOutput, lastPage bool) bool {
+    for _, entry := range page.Keys {
+      keyIds = append(keyIds, aws.StringValue(entry.KeyId))
+    }
+    return true
+  })
+  if err != nil {
+    return nil, err
+  }
+  keys := make([]Key, 0, len(keyIds))
+  for _, keyId := range keyIds {
+    key, err := client.describeKey(ctx, keyId, aliases)
+    if err != nil {
+      return nil, err
+    }
+    keys = append(keys, key)
+  }
+  return keys, nil
 }
 
 // ScheduleEncryptionKeyDeletion schedules encryption key for deletion in 7 days
 // AWS does not allow for immediate deletion of encryption keys just-in-case encrypted
-// resources are later found and need decrypting.
+// resources are later found and need decrypting. It exits if the deletion cannot be scheduled.
 func ScheduleEncryptionKeyDeletion(key string, awsSession *session.Session) {
-  svc := kms.New(awsSession)
-  input := &kms.ScheduleKeyDeletionInput{
-    KeyId:               aws.String(key),
-    PendingWindowInDays: aws.Int64(7),
-  }
-
-  result, err := svc.ScheduleKeyDeletion(input)
-  if err != nil {
-    if aerr, ok := err.(awserr.Error); ok {
-      switch aerr.Code() {
-      case kms.ErrCodeNotFoundException:
-        fmt.Println(kms.ErrCodeNotFoundException, aerr.Error())
-      case kms.ErrCodeInvalidArnException:
-        fmt.Println(kms.ErrCodeInvalidArnException, aerr.Error())
-      case kms.ErrCodeDependencyTimeoutException:
-        fmt.Println(kms.ErrCodeDependencyTimeoutException, aerr.Error())
-      case kms.ErrCodeInternalException:
-        fmt.Println(kms.ErrCodeInternalException, aerr.Error())
-      case kms.ErrCodeInvalidStateException:
-        fmt.Println(kms.ErrCodeInvalidStateException, aerr.Error())
-      default:
-        fmt.Println(aerr.Error())
+  errors.QuitIfError(ScheduleEncryptionKeyDeletionE(key, awsSession))
+}
+
+// ScheduleEncryptionKeyDeletionE is ScheduleEncryptionKeyDeletion returning an error instead of exiting.
+func ScheduleEncryptionKeyDeletionE(key string, awsSession *session.Session) error {
+  return ScheduleEncryptionKeyDeletionWithContext(context.Background(), key, awsSession)
+}
+
+// ScheduleEncryptionKeyDeletionWithContext is ScheduleEncryptionKeyDeletionE with a context to allow cancellation.
+func ScheduleEncryptionKeyDeletionWithContext(ctx context.Context, key string, awsSession *session.Session) error {
+  return New(awsSession).ScheduleEncryptionKeyDeletion(ctx, key)
+}
+
+// ScheduleEncryptionKeyDeletion schedules the encryption key for deletion in 7 days.
+func (client *Client) ScheduleEncryptionKeyDeletion(ctx context.Context, key string) error {
+  _, err := client.ScheduleKeyDeletion(ctx, key, MinPendingWindowDays)
+  return err
+}
+
+// ScheduleKeyDeletion schedules a key for deletion after a pending window of 7 to 30 days and returns when it will be
+// deleted, or exits if the deletion cannot be scheduled.
+func ScheduleKeyDeletion(keyId string, pendingWindowDays int, awsSession *session.Session) time.Time {
+  deletionDate, err := ScheduleKeyDeletionE(keyId, pendingWindowDays, awsSession)
+  errors.QuitIfError(err)
+  return deletionDate
+}
+
+// ScheduleKeyDeletionE is ScheduleKeyDeletion returning an error instead of exiting.
+func ScheduleKeyDeletionE(keyId string, pendingWindowDays int, awsSession *session.Session) (time.Time, error) {
+  return ScheduleKeyDeletionWithContext(context.Background(), keyId, pendingWindowDays, awsSession)
+}
+
+// ScheduleKeyDeletionWithContext is ScheduleKeyDeletionE with a context to allow cancellation.
+func ScheduleKeyDeletionWithContext(ctx context.Context, keyId string, pendingWindowDays int, awsSession *session.Session) (time.Time, error) {
+  return New(awsSession).ScheduleKeyDeletion(ctx, keyId, pendingWindowDays)
+}
+
+// ScheduleKeyDeletion schedules a key, given by id or ARN, for deletion after a pending window of 7 to 30 days and
+// returns when it will be deleted. Until then the key is unusable but CancelKeyDeletion can bring it back.
+func (client *Client) ScheduleKeyDeletion(ctx context.Context, keyId string, pendingWindowDays int) (time.Time, error) {
+  if pendingWindowDays < MinPendingWindowDays || pendingWindowDays > MaxPendingWindowDays {
+    return time.Time{}, errors.New(str.Concat("The pending window of a key deletion must be 7 to 30 days, got ", strconv.Itoa(pendingWindowDays)))
+  }
+  result, err := client.KMS.ScheduleKeyDeletionWithContext(ctx, &kms.ScheduleKeyDeletionInput{
+    KeyId: aws.String(keyId),
+    PendingWindowInDays: aws.Int64(int64(pendingWindowDays)),
+  })
+  if err != nil {
+    return time.Time{}, err
+  }
+  return aws.TimeValue(result.DeletionDate), nil
+}
+
+// abandonKey schedules the deletion of a key that could not be set up and returns the error that stopped it.
+func (client *Client) abandonKey(ctx context.Context, keyId string, message string) error {
+  _, err := client.ScheduleKeyDeletion(ctx, keyId, MinPendingWindowDays)
+  if err != nil {
+    return errors.New(str.Concat(message, ". The key ", keyId, " could not be scheduled for deletion: ", err.Error()))
+  }
+  return errors.New(str.Concat(message, ". The key ", keyId, " is scheduled for deletion"))
+}
+
+// aliases returns the alias names of a key, or of every key when keyId is empty, by key id.
+func (client *Client) aliases(ctx context.Context, keyId string) (map[string][]string, error) {
+  input := &kms.ListAliasesInput{}
+  if keyId != "" {
+    input.KeyId = aws.String(keyId)
+  }
+  aliases := map[string][]string{}
+  err := client.KMS.ListAliasesPagesWithContext(ctx, input, func(page *kms.ListAliasesOutput, lastPage bool) bool {
+    for _, entry := range page.Aliases {
+      if entry.TargetKeyId != nil {
+        aliases[*entry.TargetKeyId] = append(aliases[*entry.TargetKeyId], aws.StringValue(entry.AliasName))
       }
-    } else {
-      fmt.Println(err.Error())
     }
-    return
+    return true
+  })
+  return aliases, err
+}
+
+// describeKey returns a key with its aliases, looking them up when aliases is nil, and with the tags and rotation of
+// customer managed keys.
+func (client *Client) describeKey(ctx context.Context, keyId string, aliases map[string][]string) (Key, error) {
+  result, err := client.KMS.DescribeKeyWithContext(ctx, &kms.DescribeKeyInput{
+    KeyId: aws.String(keyId),
+  })
+  if err != nil {
+    return Key{}, err
+  }
+  key := toKey(result.KeyMetadata)
+  if aliases == nil {
+    aliases, err = client.aliases(ctx, key.Id)
+    if err != nil {
+      return Key{}, err
+    }
+  }
+  key.Aliases = aliases[key.Id]
+  if key.Manager != kms.KeyManagerTypeCustomer {
+    return key, nil
+  }
+  key.Tags = map[string]string{}
+  err = client.KMS.ListResourceTagsPagesWithContext(ctx, &kms.ListResourceTagsInput{
+    KeyId: aws.String(key.Id),
+  }, func(page *kms.ListResourceTagsOutput, lastPage bool) bool {
+    for _, tag := range page.Tags {
+      key.Tags[aws.StringValue(tag.TagKey)] = aws.StringValue(tag.TagValue)
+    }
+    return true
+  })
+  if err != nil {
+    return Key{}, err
+  }
+  if key.State == kms.KeyStatePendingDeletion {
+    return key, nil
   }
+  rotation, err := client.KMS.GetKeyRotationStatusWithContext(ctx, &kms.GetKeyRotationStatusInput{
+    KeyId: aws.String(key.Id),
+  })
+  if err != nil {
+    return Key{}, err
+  }
+  key.Rotation = aws.BoolValue(rotation.KeyRotationEnabled)
+  return key, nil
+}
 
-  fmt.Println(result)
+func toKey(metadata *kms.KeyMetadata) Key {
+  return Key{
+    Id: aws.StringValue(metadata.KeyId),
+    Arn: aws.StringValue(metadata.Arn),
+    Description: aws.StringValue(metadata.Description),
+    State: aws.StringValue(metadata.KeyState),
+    Manager: aws.StringValue(metadata.KeyManager),
+    CreatedAt: aws.TimeValue(metadata.CreationDate),
+    DeletionDate: aws.TimeValue(metadata.DeletionDate),
+  }
+}
+
+// aliasName adds the alias/ prefix that KMS requires to an alias name missing it.
+func aliasName(alias string) string {
+  if strings.HasPrefix(alias, "alias/") {
+    return alias
+  }
+  return "alias/" + alias
 }
 
-// GetParameter returns the value stored in the systems manager paramter store at the given path
-func GetParameter(awsSession *session.Session, k, v, path string) {
-  //
+func isErrorCode(err error, code string) bool {
+  aerr, ok := err.(awserr.Error)
+  return ok && aerr.Code() == code
+}
+
+// envelopeHeader returns the start of an envelope, which is also authenticated with every chunk.
+func envelopeHeader(wrappedKey []byte, noncePrefix []byte, chunkSize uint32) []byte {
+  var header bytes.Buffer
+  header.Write(formatHeader)
+  header.WriteByte(formatVersion)
+  header.WriteByte(modeEnvelope)
+  binary.Write(&header, binary.BigEndian, uint16(len(wrappedKey)))
+  header.Write(wrappedKey)
+  header.Write(noncePrefix)
+  binary.Write(&header, binary.BigEndian, chunkSize)
+  return header.Bytes()
+}
+
+// chunkNonce returns a nonce unique to each chunk of an envelope, which also marks the last chunk so that truncating
+// the envelope at a chunk boundary is detected.
+func chunkNonce(noncePrefix []byte, counter uint32, last bool) []byte {
+  nonce := make([]byte, noncePrefixSize + 5)
+  copy(nonce, noncePrefix)
+  binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+  if last {
+    nonce[noncePrefixSize + 4] = 1
+  }
+  return nonce
+}
+
+func newAead(dataKey []byte) (cipher.AEAD, error) {
+  block, err := aes.NewCipher(dataKey)
+  if err != nil {
+    return nil, err
+  }
+  return cipher.NewGCM(block)
+}
+
+func truncated(err error) error {
+  if err == io.EOF || err == io.ErrUnexpectedEOF {
+    return errors.New("The encrypted data is truncated")
+  }
+  return err
+}
+
+func optionalStringMap(values map[string]string) map[string]*string {
+  if len(values) == 0 {
+    return nil
+  }
+  return aws.StringMap(values)
 }
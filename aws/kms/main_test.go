@@ -1,10 +1,19 @@
 package kms
 
 import (
+  "bytes"
+  "context"
+  "crypto/rand"
+  "encoding/binary"
   "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
   "testing"
+  "time"
 
   pacaws "github.com/PyramidSystemsInc/go/aws"
+  "github.com/PyramidSystemsInc/go/aws/kms/kmsfake"
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/awserr"
   "github.com/aws/aws-sdk-go/service/kms"
@@ -13,6 +22,7 @@ import (
 // TestCreateEncryptionKey creates an encryption key then tests the successful creation of an encryption key by
 // calling the DescribeKey function using the created keys id. If an error is returned, the key wasn't created.
 func TestCreateEncryptionKey(t *testing.T) {
+  skipWithoutAws(t)
   session := pacaws.CreateAwsSession("us-east-2")
 
   key := CreateEncryptionKey(session, "createdBy", "TestCreateEncryptionKey unit test")
@@ -51,7 +61,404 @@ func TestCreateEncryptionKey(t *testing.T) {
 
 // TestScheduleEncryptionKeyDeletion creates an encryption key and then attempts to schedule it for deletion.
 func TestScheduleEncryptionKeyDeletion(t *testing.T) {
+  skipWithoutAws(t)
   session := pacaws.CreateAwsSession("us-east-2")
   key := CreateEncryptionKey(session, "createdBy", "TestScheduleEncryptionKeyDeletion unit test")
   ScheduleEncryptionKeyDeletion(key, session)
 }
+
+func newFakeClient() (*Client, *kmsfake.KMS) {
+  fake := kmsfake.New()
+  return &Client{KMS: fake}, fake
+}
+
+// TestClientCreateEncryptionKey checks that the created key is tagged and aliased.
+func TestClientCreateEncryptionKey(t *testing.T) {
+  client, fake := newFakeClient()
+
+  key, err := client.CreateEncryptionKey(context.Background(), "pac-project", "test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fake.Aliases["alias/pac/test"] != key {
+    t.Errorf("alias/pac/test does not point at %s", key)
+  }
+  if tags := fake.Tags[key]; len(tags) != 1 || *tags[0].TagKey != "pac-project" || *tags[0].TagValue != "test" {
+    t.Errorf("unexpected tags %v", tags)
+  }
+}
+
+// TestClientCreateEncryptionKeyAliasTaken checks that a key is not created under an alias another key has.
+func TestClientCreateEncryptionKeyAliasTaken(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  _, err := client.CreateEncryptionKey(ctx, "pac-project", "test")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = client.CreateEncryptionKey(ctx, "pac-project", "test")
+  if err == nil {
+    t.Error("expected an error when the alias already exists")
+  }
+}
+
+// TestClientScheduleEncryptionKeyDeletion checks that a key is pending deletion once it is scheduled for deletion.
+func TestClientScheduleEncryptionKeyDeletion(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  key, err := client.CreateEncryptionKey(ctx, "pac-project", "test")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.ScheduleEncryptionKeyDeletion(ctx, key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *fake.Keys[key].KeyState != kms.KeyStatePendingDeletion {
+    t.Errorf("key is %s instead of pending deletion", *fake.Keys[key].KeyState)
+  }
+}
+
+// newFakeKey returns a client of an in-memory fake with a key to encrypt with.
+func newFakeKey(t *testing.T) (*Client, string) {
+  client, _ := newFakeClient()
+  key, err := client.CreateEncryptionKey(context.Background(), "pac-project", "encrypt")
+  if err != nil {
+    t.Fatal(err)
+  }
+  return client, key
+}
+
+var encryptionContext = map[string]string{"file": "secrets.tfvars"}
+
+// TestClientEncrypt encrypts a secret directly, by the alias of the key, and decrypts it.
+func TestClientEncrypt(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeKey(t)
+
+  ciphertext, err := client.Encrypt(ctx, "alias/pac/encrypt", []byte("password"), encryptionContext)
+  if err != nil {
+    t.Fatal(err)
+  }
+  plaintext, err := client.Decrypt(ctx, ciphertext, encryptionContext)
+  if err != nil || string(plaintext) != "password" {
+    t.Errorf("decrypted %q, %v", plaintext, err)
+  }
+}
+
+// TestClientEncryptTooLarge checks that more than KMS encrypts directly is refused.
+func TestClientEncryptTooLarge(t *testing.T) {
+  client, key := newFakeKey(t)
+
+  _, err := client.Encrypt(context.Background(), key, make([]byte, 4097), encryptionContext)
+  if err == nil {
+    t.Error("expected an error encrypting more than 4096 bytes directly")
+  }
+}
+
+// TestClientDecryptContext checks that a secret is not decrypted with another encryption context.
+func TestClientDecryptContext(t *testing.T) {
+  ctx := context.Background()
+  client, key := newFakeKey(t)
+  ciphertext, err := client.Encrypt(ctx, key, []byte("password"), encryptionContext)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = client.Decrypt(ctx, ciphertext, map[string]string{"file": "other.tfvars"})
+  if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != kms.ErrCodeInvalidCiphertextException {
+    t.Errorf("expected an invalid ciphertext error for the wrong context, got %v", err)
+  }
+}
+
+// TestClientDecryptPendingDeletion checks that a secret is not decrypted once its key is pending deletion.
+func TestClientDecryptPendingDeletion(t *testing.T) {
+  ctx := context.Background()
+  client, key := newFakeKey(t)
+  ciphertext, err := client.Encrypt(ctx, key, []byte("password"), encryptionContext)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.ScheduleEncryptionKeyDeletion(ctx, key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.Decrypt(ctx, ciphertext, encryptionContext)
+  if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != kms.ErrCodeInvalidStateException {
+    t.Errorf("expected an invalid state error once the key is pending deletion, got %v", err)
+  }
+}
+
+// encryptStream returns random data of several chunks and the data encrypted with EncryptStream.
+func encryptStream(t *testing.T, client *Client, key string) ([]byte, []byte) {
+  large := make([]byte, 200000)
+  rand.Read(large)
+  var encrypted bytes.Buffer
+  err := client.EncryptStream(context.Background(), key, bytes.NewReader(large), &encrypted, encryptionContext)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return large, encrypted.Bytes()
+}
+
+// TestClientEncryptStream encrypts a stream of several chunks with a data key and decrypts it.
+func TestClientEncryptStream(t *testing.T) {
+  client, key := newFakeKey(t)
+  large, encrypted := encryptStream(t, client, key)
+
+  var decrypted bytes.Buffer
+  err := client.DecryptStream(context.Background(), bytes.NewReader(encrypted), &decrypted, encryptionContext)
+  if err != nil || !bytes.Equal(decrypted.Bytes(), large) {
+    t.Errorf("stream did not round trip: %v", err)
+  }
+}
+
+// TestClientDecryptStreamTampered checks that a stream with a changed byte is not decrypted.
+func TestClientDecryptStreamTampered(t *testing.T) {
+  client, key := newFakeKey(t)
+  _, encrypted := encryptStream(t, client, key)
+
+  encrypted[len(encrypted) - 100] ^= 1
+  if err := client.DecryptStream(context.Background(), bytes.NewReader(encrypted), ioutil.Discard, encryptionContext); err == nil {
+    t.Error("expected an error decrypting a tampered stream")
+  }
+}
+
+// TestClientDecryptStreamTruncated checks that a stream missing its end is not decrypted.
+func TestClientDecryptStreamTruncated(t *testing.T) {
+  client, key := newFakeKey(t)
+  _, encrypted := encryptStream(t, client, key)
+
+  truncated := encrypted[:len(encrypted) - 1000]
+  if err := client.DecryptStream(context.Background(), bytes.NewReader(truncated), ioutil.Discard, encryptionContext); err == nil {
+    t.Error("expected an error decrypting a truncated stream")
+  }
+}
+
+// TestClientDecryptStreamChunkSize checks that a stream whose header asks for chunks of another size is refused
+// before its chunks are read, since the header is not authenticated until then.
+func TestClientDecryptStreamChunkSize(t *testing.T) {
+  client, key := newFakeKey(t)
+  _, encrypted := encryptStream(t, client, key)
+
+  chunkSizeAt := len(formatHeader) + 4 + int(binary.BigEndian.Uint16(encrypted[len(formatHeader) + 2:])) + noncePrefixSize
+  binary.BigEndian.PutUint32(encrypted[chunkSizeAt:], 0xffffffff)
+  err := client.DecryptStream(context.Background(), bytes.NewReader(encrypted), ioutil.Discard, encryptionContext)
+  if err == nil || err.Error() != "The encrypted data is corrupt" {
+    t.Errorf("expected a chunk size of 4GB to be refused, got %v", err)
+  }
+}
+
+// TestClientEncryptFile encrypts a file that KMS could encrypt directly and one that needs a data key in place, and
+// decrypts them back in place.
+func TestClientEncryptFile(t *testing.T) {
+  ctx := context.Background()
+  client, key := newFakeKey(t)
+  directory, err := ioutil.TempDir("", "kms")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  large := make([]byte, 200000)
+  rand.Read(large)
+
+  for _, contents := range [][]byte{[]byte("small"), large} {
+    filePath := filepath.Join(directory, "secrets.tfvars")
+    err = ioutil.WriteFile(filePath, contents, 0600)
+    if err != nil {
+      t.Fatal(err)
+    }
+    err = client.EncryptFile(ctx, filePath, key, encryptionContext)
+    if err != nil {
+      t.Fatal(err)
+    }
+    err = client.DecryptFile(ctx, filePath, encryptionContext)
+    if err != nil {
+      t.Fatal(err)
+    }
+    restored, _ := ioutil.ReadFile(filePath)
+    if !bytes.Equal(restored, contents) {
+      t.Errorf("file of %d bytes did not round trip", len(contents))
+    }
+  }
+}
+
+// TestClientEncryptFileTwice checks that an encrypted file is not encrypted again, and not decrypted without its
+// encryption context.
+func TestClientEncryptFileTwice(t *testing.T) {
+  ctx := context.Background()
+  client, key := newFakeKey(t)
+  directory, err := ioutil.TempDir("", "kms")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(directory)
+  filePath := filepath.Join(directory, "secrets.tfvars")
+  err = ioutil.WriteFile(filePath, []byte("small"), 0600)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.EncryptFile(ctx, filePath, key, encryptionContext)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if err := client.EncryptFile(ctx, filePath, key, encryptionContext); err == nil {
+    t.Error("expected an error encrypting a file twice")
+  }
+  if err := client.DecryptFile(ctx, filePath, nil); err == nil {
+    t.Error("expected an error decrypting a file without its context")
+  }
+}
+
+// stateKeyOptions are the options of a key for Terraform state, made with every option.
+var stateKeyOptions = KeyOptions{
+  Description: "Terraform state",
+  Alias: "myteam/state",
+  Tags: map[string]string{"project": "example", "environment": "dev"},
+  Policy: `{"Version":"2012-10-17","Statement":[]}`,
+  Rotation: true,
+}
+
+// TestClientCreateKey creates a key with every option and finds it by its alias with them.
+func TestClientCreateKey(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+
+  key, err := client.CreateKey(ctx, stateKeyOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fake.Policies[key.Id] == "" || !fake.Rotations[key.Id] {
+    t.Errorf("the key policy or rotation was not set")
+  }
+  found, ok, err := client.FindKeyByAlias(ctx, "alias/myteam/state")
+  if err != nil || !ok {
+    t.Fatalf("key not found by alias: %v", err)
+  }
+  if found.Id != key.Id || found.Description != "Terraform state" || !found.Rotation || found.Tags["environment"] != "dev" || len(found.Aliases) != 1 || found.Aliases[0] != "alias/myteam/state" {
+    t.Errorf("unexpected key %+v", found)
+  }
+}
+
+// TestClientCreateKeyAliasTaken checks that a key is not left behind without its alias when the alias is taken.
+func TestClientCreateKeyAliasTaken(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  _, err := client.CreateKey(ctx, stateKeyOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = client.CreateKey(ctx, KeyOptions{Alias: "alias/myteam/state"})
+  if err == nil {
+    t.Error("expected an error when the alias already exists")
+  }
+  if keys, _ := client.ListKeys(ctx); len(keys) != 2 || keys[1].State != kms.KeyStatePendingDeletion {
+    t.Errorf("expected the key without its alias to be pending deletion, got %+v", keys)
+  }
+}
+
+// TestClientFindKeyByAliasMissing checks that an alias no key has is not an error.
+func TestClientFindKeyByAliasMissing(t *testing.T) {
+  client, _ := newFakeClient()
+
+  _, ok, err := client.FindKeyByAlias(context.Background(), "myteam/missing")
+  if err != nil || ok {
+    t.Errorf("expected a missing alias to be not found, got %v, %v", ok, err)
+  }
+}
+
+// TestClientListKeys lists keys across pages.
+func TestClientListKeys(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  fake.PageSize = 1
+  for i := 0; i < 2; i++ {
+    _, err := client.CreateKey(ctx, KeyOptions{})
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  keys, err := client.ListKeys(ctx)
+  if err != nil || len(keys) != 2 {
+    t.Errorf("listed %d keys: %v", len(keys), err)
+  }
+}
+
+// TestClientFindKeysByTag finds the keys with a tag across pages.
+func TestClientFindKeysByTag(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  fake.PageSize = 1
+  _, err := client.CreateKey(ctx, stateKeyOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  other, err := client.CreateKey(ctx, KeyOptions{Tags: map[string]string{"project": "other"}})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tagged, err := client.FindKeysByTag(ctx, "project", "other")
+  if err != nil || len(tagged) != 1 || tagged[0].Id != other.Id {
+    t.Errorf("unexpected keys %+v by tag: %v", tagged, err)
+  }
+}
+
+// TestClientScheduleKeyDeletion schedules the deletion of a key in 14 days, and checks that a window over 30 days is
+// refused.
+func TestClientScheduleKeyDeletion(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  key, err := client.CreateKey(ctx, KeyOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = client.ScheduleKeyDeletion(ctx, key.Id, 31)
+  if err == nil {
+    t.Error("expected an error for a pending window over 30 days")
+  }
+  deletionDate, err := client.ScheduleKeyDeletion(ctx, key.Id, 14)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if days := time.Until(deletionDate).Hours() / 24; days < 13 || days > 14 {
+    t.Errorf("the key is deleted in %.1f days instead of 14", days)
+  }
+}
+
+// TestClientCancelKeyDeletion cancels the deletion of a key and checks that it is enabled again.
+func TestClientCancelKeyDeletion(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  key, err := client.CreateKey(ctx, stateKeyOptions)
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.ScheduleKeyDeletion(ctx, key.Id, 14)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.CancelKeyDeletion(ctx, key.Id)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if found, _, _ := client.FindKeyByAlias(ctx, "myteam/state"); found.State != kms.KeyStateEnabled || !found.DeletionDate.IsZero() {
+    t.Errorf("expected the key to be enabled again, got %+v", found)
+  }
+}
+
+// skipWithoutAws skips a test that creates real AWS resources unless PAC_AWS_TESTS is set, so that the package is
+// unit tested offline against its fake by default.
+func skipWithoutAws(t *testing.T) {
+  if os.Getenv("PAC_AWS_TESTS") == "" {
+    t.Skip("set PAC_AWS_TESTS to run against AWS")
+  }
+}
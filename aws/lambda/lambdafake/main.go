@@ -0,0 +1,531 @@
+// Package lambdafake is an in-memory stand-in for the parts of the Lambda API used by the
+// github.com/PyramidSystemsInc/go/aws/lambda package, so it can be unit tested offline.
+package lambdafake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+// Lambda keeps function configurations in memory, keyed by function name. Functions are Active and updates
+// Successful as soon as they are made. Calling an operation that is not implemented panics.
+type Lambda struct {
+	lambdaiface.LambdaAPI
+
+	mutex     sync.Mutex
+	counter   int
+	Region    string
+	AccountID string
+	Functions map[string]*lambda.FunctionConfiguration
+	// Code holds the latest code of each function as it was sent.
+	Code map[string]*lambda.FunctionCode
+	// Versions are keyed by function name, then version number.
+	Versions map[string]map[string]*lambda.FunctionConfiguration
+	// Aliases are keyed by function name, then alias name.
+	Aliases map[string]map[string]*lambda.AliasConfiguration
+	// Handlers run the invocations of a function, keyed by function name. Returning an error makes the
+	// invocation fail with an Unhandled function error. Functions without a handler echo their payload.
+	Handlers map[string]func(payload []byte) ([]byte, error)
+	// Invocations records the payloads each function was invoked with, including asynchronously.
+	Invocations map[string][][]byte
+	// EventSourceMappings are keyed by UUID and Enabled as soon as they are created.
+	EventSourceMappings map[string]*lambda.EventSourceMappingConfiguration
+	// Permissions holds the statements of the resource-based policies, keyed by function name, then statement ID.
+	Permissions map[string]map[string]*lambda.AddPermissionInput
+	// UpdatesInProgress is how many of the next AddPermission calls fail with a conflict, as while a function is
+	// being updated.
+	UpdatesInProgress int
+}
+
+// New returns a fake without functions in us-east-1 for account 123456789012.
+func New() *Lambda {
+	return &Lambda{
+		Region:              "us-east-1",
+		AccountID:           "123456789012",
+		Functions:           map[string]*lambda.FunctionConfiguration{},
+		Code:                map[string]*lambda.FunctionCode{},
+		Versions:            map[string]map[string]*lambda.FunctionConfiguration{},
+		Aliases:             map[string]map[string]*lambda.AliasConfiguration{},
+		Handlers:            map[string]func(payload []byte) ([]byte, error){},
+		Invocations:         map[string][][]byte{},
+		EventSourceMappings: map[string]*lambda.EventSourceMappingConfiguration{},
+		Permissions:         map[string]map[string]*lambda.AddPermissionInput{},
+	}
+}
+
+// CreateFunctionWithContext creates an Active function.
+func (fake *Lambda) CreateFunctionWithContext(ctx aws.Context, input *lambda.CreateFunctionInput, opts ...request.Option) (*lambda.FunctionConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.FunctionName)
+	if _, ok := fake.Functions[name]; ok {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "Function already exist: "+name, nil)
+	}
+	function := &lambda.FunctionConfiguration{
+		Description:      input.Description,
+		FunctionArn:      aws.String(fake.arn(name)),
+		FunctionName:     aws.String(name),
+		Handler:          input.Handler,
+		LastUpdateStatus: aws.String(lambda.LastUpdateStatusSuccessful),
+		MemorySize:       aws.Int64(128),
+		Role:             input.Role,
+		Runtime:          input.Runtime,
+		State:            aws.String(lambda.StateActive),
+		Timeout:          aws.Int64(3),
+		Version:          aws.String("$LATEST"),
+	}
+	if input.MemorySize != nil {
+		function.MemorySize = input.MemorySize
+	}
+	if input.Timeout != nil {
+		function.Timeout = input.Timeout
+	}
+	if input.Environment != nil {
+		function.Environment = &lambda.EnvironmentResponse{
+			Variables: input.Environment.Variables,
+		}
+	}
+	fake.Functions[name] = function
+	fake.Code[name] = input.Code
+	return function, nil
+}
+
+// UpdateFunctionCodeWithContext replaces the code of a function.
+func (fake *Lambda) UpdateFunctionCodeWithContext(ctx aws.Context, input *lambda.UpdateFunctionCodeInput, opts ...request.Option) (*lambda.FunctionConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	fake.Code[aws.StringValue(function.FunctionName)] = &lambda.FunctionCode{
+		S3Bucket:        input.S3Bucket,
+		S3Key:           input.S3Key,
+		S3ObjectVersion: input.S3ObjectVersion,
+		ZipFile:         input.ZipFile,
+	}
+	return function, nil
+}
+
+// UpdateFunctionConfigurationWithContext changes the settings given in the input.
+func (fake *Lambda) UpdateFunctionConfigurationWithContext(ctx aws.Context, input *lambda.UpdateFunctionConfigurationInput, opts ...request.Option) (*lambda.FunctionConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	if input.Description != nil {
+		function.Description = input.Description
+	}
+	if input.Environment != nil {
+		function.Environment = &lambda.EnvironmentResponse{
+			Variables: input.Environment.Variables,
+		}
+	}
+	if input.Handler != nil {
+		function.Handler = input.Handler
+	}
+	if input.MemorySize != nil {
+		function.MemorySize = input.MemorySize
+	}
+	if input.Role != nil {
+		function.Role = input.Role
+	}
+	if input.Runtime != nil {
+		function.Runtime = input.Runtime
+	}
+	if input.Timeout != nil {
+		function.Timeout = input.Timeout
+	}
+	return function, nil
+}
+
+// GetFunctionConfigurationWithContext returns a function, or a version of it when qualified.
+func (fake *Lambda) GetFunctionConfigurationWithContext(ctx aws.Context, input *lambda.GetFunctionConfigurationInput, opts ...request.Option) (*lambda.FunctionConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	qualifier := aws.StringValue(input.Qualifier)
+	if qualifier == "" {
+		qualifier = qualifierOf(input.FunctionName)
+	}
+	if qualifier == "" || qualifier == "$LATEST" {
+		return function, nil
+	}
+	version, ok := fake.Versions[aws.StringValue(function.FunctionName)][qualifier]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Function not found: "+aws.StringValue(input.FunctionName), nil)
+	}
+	return version, nil
+}
+
+// PublishVersionWithContext snapshots the configuration of a function as the next version number.
+func (fake *Lambda) PublishVersionWithContext(ctx aws.Context, input *lambda.PublishVersionInput, opts ...request.Option) (*lambda.FunctionConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(function.FunctionName)
+	if fake.Versions[name] == nil {
+		fake.Versions[name] = map[string]*lambda.FunctionConfiguration{}
+	}
+	number := strconv.Itoa(len(fake.Versions[name]) + 1)
+	version := *function
+	version.FunctionArn = aws.String(fake.arn(name + ":" + number))
+	version.Version = aws.String(number)
+	if input.Description != nil {
+		version.Description = input.Description
+	}
+	fake.Versions[name][number] = &version
+	return &version, nil
+}
+
+// CreateAliasWithContext points a new alias at a published version.
+func (fake *Lambda) CreateAliasWithContext(ctx aws.Context, input *lambda.CreateAliasInput, opts ...request.Option) (*lambda.AliasConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(function.FunctionName)
+	aliasName := aws.StringValue(input.Name)
+	if _, ok := fake.Aliases[name][aliasName]; ok {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "Alias already exists: "+aliasName, nil)
+	}
+	err = fake.checkVersions(name, input.FunctionVersion, input.RoutingConfig)
+	if err != nil {
+		return nil, err
+	}
+	if fake.Aliases[name] == nil {
+		fake.Aliases[name] = map[string]*lambda.AliasConfiguration{}
+	}
+	alias := &lambda.AliasConfiguration{
+		AliasArn:        aws.String(fake.arn(name + ":" + aliasName)),
+		Description:     input.Description,
+		FunctionVersion: input.FunctionVersion,
+		Name:            aws.String(aliasName),
+		RoutingConfig:   input.RoutingConfig,
+	}
+	fake.Aliases[name][aliasName] = alias
+	return alias, nil
+}
+
+// GetAliasWithContext returns an alias of a function.
+func (fake *Lambda) GetAliasWithContext(ctx aws.Context, input *lambda.GetAliasInput, opts ...request.Option) (*lambda.AliasConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.alias(input.FunctionName, input.Name)
+}
+
+// UpdateAliasWithContext changes the version and/or the routing configuration of an alias.
+func (fake *Lambda) UpdateAliasWithContext(ctx aws.Context, input *lambda.UpdateAliasInput, opts ...request.Option) (*lambda.AliasConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	alias, err := fake.alias(input.FunctionName, input.Name)
+	if err != nil {
+		return nil, err
+	}
+	functionVersion := alias.FunctionVersion
+	if input.FunctionVersion != nil {
+		functionVersion = input.FunctionVersion
+	}
+	err = fake.checkVersions(functionName(input.FunctionName), functionVersion, input.RoutingConfig)
+	if err != nil {
+		return nil, err
+	}
+	alias.FunctionVersion = functionVersion
+	if input.Description != nil {
+		alias.Description = input.Description
+	}
+	if input.RoutingConfig != nil {
+		alias.RoutingConfig = input.RoutingConfig
+	}
+	return alias, nil
+}
+
+// DeleteAliasWithContext deletes an alias of a function.
+func (fake *Lambda) DeleteAliasWithContext(ctx aws.Context, input *lambda.DeleteAliasInput, opts ...request.Option) (*lambda.DeleteAliasOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if _, err := fake.alias(input.FunctionName, input.Name); err != nil {
+		return nil, err
+	}
+	delete(fake.Aliases[functionName(input.FunctionName)], aws.StringValue(input.Name))
+	return &lambda.DeleteAliasOutput{}, nil
+}
+
+// DeleteFunctionWithContext deletes a function by name or ARN.
+func (fake *Lambda) DeleteFunctionWithContext(ctx aws.Context, input *lambda.DeleteFunctionInput, opts ...request.Option) (*lambda.DeleteFunctionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := functionName(input.FunctionName)
+	if _, ok := fake.Functions[name]; !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Function not found: "+aws.StringValue(input.FunctionName), nil)
+	}
+	delete(fake.Functions, name)
+	return &lambda.DeleteFunctionOutput{}, nil
+}
+
+// InvokeWithContext runs the handler of a function, returning its tail log when requested.
+func (fake *Lambda) InvokeWithContext(ctx aws.Context, input *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	fake.mutex.Lock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		fake.mutex.Unlock()
+		return nil, err
+	}
+	name := aws.StringValue(function.FunctionName)
+	fake.Invocations[name] = append(fake.Invocations[name], input.Payload)
+	handler := fake.Handlers[name]
+	fake.mutex.Unlock()
+	if aws.StringValue(input.InvocationType) == lambda.InvocationTypeEvent {
+		return &lambda.InvokeOutput{
+			StatusCode: aws.Int64(202),
+		}, nil
+	}
+	output := &lambda.InvokeOutput{
+		ExecutedVersion: aws.String("$LATEST"),
+		Payload:         input.Payload,
+		StatusCode:      aws.Int64(200),
+	}
+	logs := "START RequestId: fake Version: $LATEST\n"
+	if handler != nil {
+		payload, err := handler(input.Payload)
+		if err != nil {
+			output.FunctionError = aws.String("Unhandled")
+			payload, _ = json.Marshal(map[string]string{
+				"errorMessage": err.Error(),
+				"errorType":    "Error",
+			})
+			logs += "ERROR " + err.Error() + "\n"
+		}
+		output.Payload = payload
+	}
+	logs += "END RequestId: fake\n"
+	if aws.StringValue(input.LogType) == lambda.LogTypeTail {
+		output.LogResult = aws.String(base64.StdEncoding.EncodeToString([]byte(logs)))
+	}
+	return output, nil
+}
+
+// CreateEventSourceMappingWithContext maps an event source to a function, Enabled straight away.
+func (fake *Lambda) CreateEventSourceMappingWithContext(ctx aws.Context, input *lambda.CreateEventSourceMappingInput, opts ...request.Option) (*lambda.EventSourceMappingConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	for _, mapping := range fake.EventSourceMappings {
+		if aws.StringValue(mapping.EventSourceArn) == aws.StringValue(input.EventSourceArn) && aws.StringValue(mapping.FunctionArn) == aws.StringValue(function.FunctionArn) {
+			return nil, awserr.New(lambda.ErrCodeResourceConflictException, "The event source arn and function provided mapping already exists.", nil)
+		}
+	}
+	fake.counter++
+	mapping := &lambda.EventSourceMappingConfiguration{
+		BatchSize:        input.BatchSize,
+		EventSourceArn:   input.EventSourceArn,
+		FunctionArn:      function.FunctionArn,
+		StartingPosition: input.StartingPosition,
+		State:            aws.String("Enabled"),
+		UUID:             aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", fake.counter)),
+	}
+	fake.EventSourceMappings[aws.StringValue(mapping.UUID)] = mapping
+	return mapping, nil
+}
+
+// GetEventSourceMappingWithContext returns a mapping by UUID.
+func (fake *Lambda) GetEventSourceMappingWithContext(ctx aws.Context, input *lambda.GetEventSourceMappingInput, opts ...request.Option) (*lambda.EventSourceMappingConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	mapping, ok := fake.EventSourceMappings[aws.StringValue(input.UUID)]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "The resource you requested does not exist.", nil)
+	}
+	return mapping, nil
+}
+
+// DeleteEventSourceMappingWithContext deletes a mapping by UUID straight away.
+func (fake *Lambda) DeleteEventSourceMappingWithContext(ctx aws.Context, input *lambda.DeleteEventSourceMappingInput, opts ...request.Option) (*lambda.EventSourceMappingConfiguration, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	mapping, ok := fake.EventSourceMappings[aws.StringValue(input.UUID)]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "The resource you requested does not exist.", nil)
+	}
+	delete(fake.EventSourceMappings, aws.StringValue(input.UUID))
+	mapping.State = aws.String("Deleting")
+	return mapping, nil
+}
+
+// AddPermissionWithContext adds a statement to the policy of a function, failing if the statement ID is taken.
+func (fake *Lambda) AddPermissionWithContext(ctx aws.Context, input *lambda.AddPermissionInput, opts ...request.Option) (*lambda.AddPermissionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	if fake.UpdatesInProgress > 0 {
+		fake.UpdatesInProgress--
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "The operation cannot be performed at this time. An update is in progress for resource: "+aws.StringValue(function.FunctionArn), nil)
+	}
+	name := aws.StringValue(function.FunctionName)
+	statementId := aws.StringValue(input.StatementId)
+	if _, ok := fake.Permissions[name][statementId]; ok {
+		return nil, awserr.New(lambda.ErrCodeResourceConflictException, "The statement id ("+statementId+") provided already exists.", nil)
+	}
+	if fake.Permissions[name] == nil {
+		fake.Permissions[name] = map[string]*lambda.AddPermissionInput{}
+	}
+	fake.Permissions[name][statementId] = input
+	return &lambda.AddPermissionOutput{}, nil
+}
+
+// GetPolicyWithContext returns the policy of a function as the JSON Lambda writes for the statements added to it.
+func (fake *Lambda) GetPolicyWithContext(ctx aws.Context, input *lambda.GetPolicyInput, opts ...request.Option) (*lambda.GetPolicyOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	function, err := fake.function(input.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(function.FunctionName)
+	if len(fake.Permissions[name]) == 0 {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "The resource you requested does not exist.", nil)
+	}
+	statements := []map[string]interface{}{}
+	for statementId, permission := range fake.Permissions[name] {
+		principalType := "Service"
+		if !strings.HasSuffix(aws.StringValue(permission.Principal), ".amazonaws.com") {
+			principalType = "AWS"
+		}
+		statement := map[string]interface{}{
+			"Sid":       statementId,
+			"Effect":    "Allow",
+			"Principal": map[string]string{principalType: aws.StringValue(permission.Principal)},
+			"Action":    aws.StringValue(permission.Action),
+			"Resource":  aws.StringValue(function.FunctionArn),
+		}
+		condition := map[string]map[string]string{}
+		if permission.SourceAccount != nil {
+			condition["StringEquals"] = map[string]string{"AWS:SourceAccount": aws.StringValue(permission.SourceAccount)}
+		}
+		if permission.SourceArn != nil {
+			condition["ArnLike"] = map[string]string{"AWS:SourceArn": aws.StringValue(permission.SourceArn)}
+		}
+		if len(condition) > 0 {
+			statement["Condition"] = condition
+		}
+		statements = append(statements, statement)
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Id":        "default",
+		"Statement": statements,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lambda.GetPolicyOutput{
+		Policy: aws.String(string(policy)),
+	}, nil
+}
+
+// RemovePermissionWithContext removes a statement from the policy of a function.
+func (fake *Lambda) RemovePermissionWithContext(ctx aws.Context, input *lambda.RemovePermissionInput, opts ...request.Option) (*lambda.RemovePermissionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := functionName(input.FunctionName)
+	statementId := aws.StringValue(input.StatementId)
+	if _, ok := fake.Permissions[name][statementId]; !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Statement "+statementId+" is not found in resource policy.", nil)
+	}
+	delete(fake.Permissions[name], statementId)
+	return &lambda.RemovePermissionOutput{}, nil
+}
+
+func (fake *Lambda) arn(qualifiedName string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fake.Region, fake.AccountID, qualifiedName)
+}
+
+func (fake *Lambda) function(nameOrArn *string) (*lambda.FunctionConfiguration, error) {
+	function, ok := fake.Functions[functionName(nameOrArn)]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Function not found: "+aws.StringValue(nameOrArn), nil)
+	}
+	return function, nil
+}
+
+func (fake *Lambda) alias(functionNameOrArn *string, aliasName *string) (*lambda.AliasConfiguration, error) {
+	if _, err := fake.function(functionNameOrArn); err != nil {
+		return nil, err
+	}
+	alias, ok := fake.Aliases[functionName(functionNameOrArn)][aws.StringValue(aliasName)]
+	if !ok {
+		return nil, awserr.New(lambda.ErrCodeResourceNotFoundException, "Alias not found: "+aws.StringValue(aliasName), nil)
+	}
+	return alias, nil
+}
+
+// checkVersions fails like Lambda when an alias would point at a version that is not published, or shift traffic
+// to more than one other version.
+func (fake *Lambda) checkVersions(name string, version *string, routing *lambda.AliasRoutingConfiguration) error {
+	versions := []string{aws.StringValue(version)}
+	if routing != nil {
+		if len(routing.AdditionalVersionWeights) > 1 {
+			return awserr.New(lambda.ErrCodeInvalidParameterValueException, "Only one additional version can be routed to", nil)
+		}
+		for additional := range routing.AdditionalVersionWeights {
+			versions = append(versions, additional)
+		}
+	}
+	for _, number := range versions {
+		if _, ok := fake.Versions[name][number]; !ok && number != "$LATEST" {
+			return awserr.New(lambda.ErrCodeResourceNotFoundException, "Function not found: "+name+":"+number, nil)
+		}
+	}
+	return nil
+}
+
+// qualifierOf returns the version or alias at the end of a qualified name or ARN, if any.
+func qualifierOf(nameOrArn *string) string {
+	parts := nameParts(nameOrArn)
+	if len(parts) > 1 {
+		return parts[1]
+	}
+	return ""
+}
+
+// functionName returns the bare name of a function given its name, partial ARN or ARN.
+func functionName(nameOrArn *string) string {
+	return nameParts(nameOrArn)[0]
+}
+
+// nameParts splits a name, partial ARN or ARN into the function name and its qualifier, if any.
+func nameParts(nameOrArn *string) []string {
+	parts := strings.Split(aws.StringValue(nameOrArn), ":")
+	for i, part := range parts {
+		if part == "function" && i+1 < len(parts) {
+			return parts[i+1:]
+		}
+	}
+	return parts
+}
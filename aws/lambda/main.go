@@ -1,16 +1,935 @@
 package lambda
 
 import (
+  "context"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "encoding/json"
+  "strings"
+  "time"
   "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/lambda"
+  "github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+  "github.com/PyramidSystemsInc/go/aws/cloudwatchlogs"
+  "github.com/PyramidSystemsInc/go/aws/iam"
+  "github.com/PyramidSystemsInc/go/aws/s3"
   "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/files"
+  "github.com/PyramidSystemsInc/go/logger"
+  "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Deploys, invokes and wires up Lambda functions. Large code is staged through S3 and logs are read through Logs
+type Client struct {
+  Lambda lambdaiface.LambdaAPI
+  Logs *cloudwatchlogs.Client
+  S3 *s3.Client
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    Lambda: lambda.New(awsSession),
+    Logs: cloudwatchlogs.New(awsSession),
+    S3: s3.New(awsSession),
+  }
+}
+
+// Code - Where the deployment package of a function comes from
+type Code struct {
+  // SourceDir - Directory zipped into the deployment package, with its contents at the root of the zip
+  SourceDir      string
+  // StagingBucket - S3 bucket the zip is uploaded to and deployed from. Required for zips over 50MB
+  StagingBucket  string
+}
+
+// FunctionConfig - Settings of a function. UpdateConfiguration leaves empty fields unchanged
+type FunctionConfig struct {
+  Runtime      string
+  Handler      string
+  RoleArn      string
+  Description  string
+  // MemorySize - In MB. Defaults to 128 on creation
+  MemorySize   int64
+  // Timeout - Defaults to 3 seconds on creation
+  Timeout      time.Duration
+  Environment  map[string]string
+}
+
+// InvokeResult - What a synchronous invocation returned
+type InvokeResult struct {
+  StatusCode       int64
+  Payload          []byte
+  // FunctionError - Handled or Unhandled when the function threw, in which case Payload describes the error
+  FunctionError    string
+  // Logs - The last 4KB of the log of the invocation, decoded
+  Logs             string
+  ExecutedVersion  string
+}
+
+// EventSourceOptions - Settings for CreateEventSourceMapping
+type EventSourceOptions struct {
+  // BatchSize - Most records passed to one invocation. Defaults to 10 for SQS and 100 for streams
+  BatchSize         int64
+  // StartingPosition - Where to start reading a DynamoDB stream, LATEST or TRIM_HORIZON. Defaults to LATEST
+  StartingPosition  string
+}
+
+// maxDirectUploadSize - Largest zip Lambda accepts in the request itself rather than from S3
+const maxDirectUploadSize = 50 * 1024 * 1024
+
+func AllowApiGatewayInvoke(functionName string, executeApiArn string, awsSession *session.Session) string {
+  statementId, err := AllowApiGatewayInvokeE(functionName, executeApiArn, awsSession)
+  errors.QuitIfError(err)
+  return statementId
+}
+
+// AllowApiGatewayInvokeE - Lets API Gateway invoke a function for the methods matching an execute-api ARN (arn:aws:execute-api:<region>:<account>:<api id>/<stage>/<method>/<path>)
+// and returns the ID of the policy statement, or an error
+func AllowApiGatewayInvokeE(functionName string, executeApiArn string, awsSession *session.Session) (string, error) {
+  return AllowApiGatewayInvokeWithContext(context.Background(), functionName, executeApiArn, awsSession)
+}
+
+// AllowApiGatewayInvokeWithContext - AllowApiGatewayInvokeE with a context to allow cancellation
+func AllowApiGatewayInvokeWithContext(ctx context.Context, functionName string, executeApiArn string, awsSession *session.Session) (string, error) {
+  return New(awsSession).AllowApiGatewayInvoke(ctx, functionName, executeApiArn)
+}
+
+// AllowApiGatewayInvoke - Lets API Gateway invoke a function for the methods matching an execute-api ARN and returns the ID of the policy statement, or an error.
+// Allowing the same ARN twice is not an error
+func (client *Client) AllowApiGatewayInvoke(ctx context.Context, functionName string, executeApiArn string) (string, error) {
+  checksum := sha256.Sum256([]byte(executeApiArn))
+  statementId := str.Concat("apigateway-", hex.EncodeToString(checksum[:8]))
+  return statementId, client.addPermission(ctx, &lambda.AddPermissionInput{
+    Action: aws.String("lambda:InvokeFunction"),
+    FunctionName: aws.String(functionName),
+    Principal: aws.String("apigateway.amazonaws.com"),
+    SourceArn: aws.String(executeApiArn),
+    StatementId: aws.String(statementId),
+  })
+}
+
+func AllowS3Invoke(functionName string, bucketName string, accountId string, awsSession *session.Session) string {
+  statementId, err := AllowS3InvokeE(functionName, bucketName, accountId, awsSession)
+  errors.QuitIfError(err)
+  return statementId
+}
+
+// AllowS3InvokeE - Lets the notifications of a bucket owned by the account invoke a function and returns the ID of the policy statement, or an error
+func AllowS3InvokeE(functionName string, bucketName string, accountId string, awsSession *session.Session) (string, error) {
+  return AllowS3InvokeWithContext(context.Background(), functionName, bucketName, accountId, awsSession)
+}
+
+// AllowS3InvokeWithContext - AllowS3InvokeE with a context to allow cancellation
+func AllowS3InvokeWithContext(ctx context.Context, functionName string, bucketName string, accountId string, awsSession *session.Session) (string, error) {
+  return New(awsSession).AllowS3Invoke(ctx, functionName, bucketName, accountId)
+}
+
+// AllowS3Invoke - Lets the notifications of a bucket owned by the account invoke a function and returns the ID of the policy statement, or an error.
+// The account stops another account that later takes the bucket name from invoking the function. Allowing the same bucket twice is not an error, for another account it is
+func (client *Client) AllowS3Invoke(ctx context.Context, functionName string, bucketName string, accountId string) (string, error) {
+  partition, err := client.partition(ctx, functionName)
+  if err != nil {
+    return "", err
+  }
+  checksum := sha256.Sum256([]byte(bucketName))
+  statementId := str.Concat("s3-", hex.EncodeToString(checksum[:8]))
+  return statementId, client.addPermission(ctx, &lambda.AddPermissionInput{
+    Action: aws.String("lambda:InvokeFunction"),
+    FunctionName: aws.String(functionName),
+    Principal: aws.String("s3.amazonaws.com"),
+    SourceAccount: optionalString(accountId),
+    SourceArn: aws.String(str.Concat("arn:", partition, ":s3:::", bucketName)),
+    StatementId: aws.String(statementId),
+  })
+}
+
+func Create(functionName string, code Code, config FunctionConfig, awsSession *session.Session) string {
+  functionArn, err := CreateE(functionName, code, config, awsSession)
+  errors.QuitIfError(err)
+  return functionArn
+}
+
+// CreateE - Zips a directory into a new Lambda function, waits until it is Active and returns its ARN or an error
+func CreateE(functionName string, code Code, config FunctionConfig, awsSession *session.Session) (string, error) {
+  return CreateWithContext(context.Background(), functionName, code, config, awsSession)
+}
+
+// CreateWithContext - CreateE where the context can cancel the wait or give it another deadline
+func CreateWithContext(ctx context.Context, functionName string, code Code, config FunctionConfig, awsSession *session.Session) (string, error) {
+  return New(awsSession).Create(ctx, functionName, code, config)
+}
+
+// Create - Zips a directory into a new Lambda function, waits until it is Active and returns its ARN or an error.
+// Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) Create(ctx context.Context, functionName string, code Code, config FunctionConfig) (string, error) {
+  if config.Runtime == "" || config.Handler == "" || config.RoleArn == "" {
+    return "", errors.New(str.Concat("The Lambda function ", functionName, " needs a runtime, a handler and a role"))
+  }
+  functionCode, err := client.uploadCode(ctx, functionName, code)
+  if err != nil {
+    return "", err
+  }
+  input := &lambda.CreateFunctionInput{
+    Code: &lambda.FunctionCode{
+      S3Bucket: functionCode.S3Bucket,
+      S3Key: functionCode.S3Key,
+      S3ObjectVersion: functionCode.S3ObjectVersion,
+      ZipFile: functionCode.ZipFile,
+    },
+    Description: optionalString(config.Description),
+    Environment: environment(config.Environment),
+    FunctionName: aws.String(functionName),
+    Handler: aws.String(config.Handler),
+    MemorySize: optionalInt64(config.MemorySize),
+    Role: aws.String(config.RoleArn),
+    Runtime: aws.String(config.Runtime),
+    Timeout: optionalInt64(int64(config.Timeout / time.Second)),
+  }
+  result, err := client.Lambda.CreateFunctionWithContext(ctx, input)
+  if err != nil {
+    return "", err
+  }
+  err = client.WaitForFunction(ctx, functionName)
+  if err != nil {
+    return "", err
+  }
+  return aws.StringValue(result.FunctionArn), nil
+}
+
+func CreateAlias(functionName string, aliasName string, version string, awsSession *session.Session) {
+  errors.QuitIfError(CreateAliasE(functionName, aliasName, version, awsSession))
+}
+
+// CreateAliasE - Points an alias at a version of a function, creating the alias if needed and removing any traffic shifting, returning any error
+func CreateAliasE(functionName string, aliasName string, version string, awsSession *session.Session) error {
+  return CreateAliasWithContext(context.Background(), functionName, aliasName, version, awsSession)
+}
+
+// CreateAliasWithContext - CreateAliasE with a context to allow cancellation
+func CreateAliasWithContext(ctx context.Context, functionName string, aliasName string, version string, awsSession *session.Session) error {
+  return New(awsSession).CreateAlias(ctx, functionName, aliasName, version)
+}
+
+// CreateAlias - Points an alias at a version of a function, creating the alias if needed and removing any traffic shifting, returning any error
+func (client *Client) CreateAlias(ctx context.Context, functionName string, aliasName string, version string) error {
+  _, err := client.Lambda.UpdateAliasWithContext(ctx, &lambda.UpdateAliasInput{
+    FunctionName: aws.String(functionName),
+    FunctionVersion: aws.String(version),
+    Name: aws.String(aliasName),
+    RoutingConfig: &lambda.AliasRoutingConfiguration{},
+  })
+  if !isNotFound(err) {
+    return err
+  }
+  _, err = client.Lambda.CreateAliasWithContext(ctx, &lambda.CreateAliasInput{
+    FunctionName: aws.String(functionName),
+    FunctionVersion: aws.String(version),
+    Name: aws.String(aliasName),
+  })
+  return err
+}
+
+func CreateEventSourceMapping(functionName string, eventSourceArn string, options EventSourceOptions, awsSession *session.Session) string {
+  uuid, err := CreateEventSourceMappingE(functionName, eventSourceArn, options, awsSession)
+  errors.QuitIfError(err)
+  return uuid
+}
+
+// CreateEventSourceMappingE - Invokes a function with the messages of an SQS queue or the records of a DynamoDB stream, waits until the mapping is Enabled
+// and returns its UUID or an error
+func CreateEventSourceMappingE(functionName string, eventSourceArn string, options EventSourceOptions, awsSession *session.Session) (string, error) {
+  return CreateEventSourceMappingWithContext(context.Background(), functionName, eventSourceArn, options, awsSession)
+}
+
+// CreateEventSourceMappingWithContext - CreateEventSourceMappingE where the context can cancel the wait or give it another deadline
+func CreateEventSourceMappingWithContext(ctx context.Context, functionName string, eventSourceArn string, options EventSourceOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateEventSourceMapping(ctx, functionName, eventSourceArn, options)
+}
+
+// CreateEventSourceMapping - Invokes a function with the messages of an SQS queue or the records of a DynamoDB stream, waits until the mapping is Enabled
+// and returns its UUID or an error. Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) CreateEventSourceMapping(ctx context.Context, functionName string, eventSourceArn string, options EventSourceOptions) (string, error) {
+  input := &lambda.CreateEventSourceMappingInput{
+    BatchSize: optionalInt64(options.BatchSize),
+    EventSourceArn: aws.String(eventSourceArn),
+    FunctionName: aws.String(functionName),
+  }
+  service := arnService(eventSourceArn)
+  if service == "dynamodb" {
+    input.StartingPosition = aws.String(lambda.EventSourcePositionLatest)
+    if options.StartingPosition != "" {
+      input.StartingPosition = aws.String(options.StartingPosition)
+    }
+  } else if service != "sqs" {
+    return "", errors.New(str.Concat("The event source ", eventSourceArn, " is not an SQS queue or a DynamoDB stream"))
+  }
+  result, err := client.Lambda.CreateEventSourceMappingWithContext(ctx, input)
+  if err != nil {
+    return "", err
+  }
+  uuid := aws.StringValue(result.UUID)
+  return uuid, client.waitForEventSourceMapping(ctx, uuid, "Enabled")
+}
+
 func Delete(functionArnOrName string, awsSession *session.Session) {
-  lambdaClient := lambda.New(awsSession)
-  _, err := lambdaClient.DeleteFunction(&lambda.DeleteFunctionInput{
+  errors.QuitIfError(DeleteE(functionArnOrName, awsSession))
+}
+
+// DeleteE - Deletes a Lambda function, returning any error
+func DeleteE(functionArnOrName string, awsSession *session.Session) error {
+  return DeleteWithContext(context.Background(), functionArnOrName, awsSession)
+}
+
+// DeleteWithContext - DeleteE with a context to allow cancellation
+func DeleteWithContext(ctx context.Context, functionArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).Delete(ctx, functionArnOrName)
+}
+
+// Delete - Deletes a Lambda function, returning any error
+func (client *Client) Delete(ctx context.Context, functionArnOrName string) error {
+  _, err := client.Lambda.DeleteFunctionWithContext(ctx, &lambda.DeleteFunctionInput{
     FunctionName: aws.String(functionArnOrName),
   })
+  return err
+}
+
+func DeleteAlias(functionName string, aliasName string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteAliasE(functionName, aliasName, awsSession))
+}
+
+// DeleteAliasE - Deletes an alias of a function, returning any error
+func DeleteAliasE(functionName string, aliasName string, awsSession *session.Session) error {
+  return DeleteAliasWithContext(context.Background(), functionName, aliasName, awsSession)
+}
+
+// DeleteAliasWithContext - DeleteAliasE with a context to allow cancellation
+func DeleteAliasWithContext(ctx context.Context, functionName string, aliasName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteAlias(ctx, functionName, aliasName)
+}
+
+// DeleteAlias - Deletes an alias of a function, returning any error
+func (client *Client) DeleteAlias(ctx context.Context, functionName string, aliasName string) error {
+  _, err := client.Lambda.DeleteAliasWithContext(ctx, &lambda.DeleteAliasInput{
+    FunctionName: aws.String(functionName),
+    Name: aws.String(aliasName),
+  })
+  return err
+}
+
+func DeleteEventSourceMapping(uuid string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteEventSourceMappingE(uuid, awsSession))
+}
+
+// DeleteEventSourceMappingE - Stops invoking a function from an event source and waits until the mapping is gone, returning any error
+func DeleteEventSourceMappingE(uuid string, awsSession *session.Session) error {
+  return DeleteEventSourceMappingWithContext(context.Background(), uuid, awsSession)
+}
+
+// DeleteEventSourceMappingWithContext - DeleteEventSourceMappingE where the context can cancel the wait or give it another deadline
+func DeleteEventSourceMappingWithContext(ctx context.Context, uuid string, awsSession *session.Session) error {
+  return New(awsSession).DeleteEventSourceMapping(ctx, uuid)
+}
+
+// DeleteEventSourceMapping - Stops invoking a function from an event source and waits until the mapping is gone, returning any error.
+// Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) DeleteEventSourceMapping(ctx context.Context, uuid string) error {
+  _, err := client.Lambda.DeleteEventSourceMappingWithContext(ctx, &lambda.DeleteEventSourceMappingInput{
+    UUID: aws.String(uuid),
+  })
+  if err != nil {
+    return err
+  }
+  return client.waitForEventSourceMapping(ctx, uuid, "")
+}
+
+func FetchLogs(functionArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) []cloudwatchlogs.LogEvent {
+  events, err := FetchLogsE(functionArnOrName, options, awsSession)
+  errors.QuitIfError(err)
+  return events
+}
+
+// FetchLogsE - Returns the events a Lambda function logged within the time range of the options, oldest first, or an error
+func FetchLogsE(functionArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) ([]cloudwatchlogs.LogEvent, error) {
+  return FetchLogsWithContext(context.Background(), functionArnOrName, options, awsSession)
+}
+
+// FetchLogsWithContext - FetchLogsE with a context to allow cancellation
+func FetchLogsWithContext(ctx context.Context, functionArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) ([]cloudwatchlogs.LogEvent, error) {
+  return New(awsSession).FetchLogs(ctx, functionArnOrName, options)
+}
+
+// FetchLogs - Returns the events a Lambda function logged to /aws/lambda/<name> within the time range of the options, oldest first, or an error
+func (client *Client) FetchLogs(ctx context.Context, functionArnOrName string, options cloudwatchlogs.LogOptions) ([]cloudwatchlogs.LogEvent, error) {
+  return client.Logs.FetchLogs(ctx, logGroup(functionArnOrName), options)
+}
+
+func Invoke(functionArnOrName string, payload interface{}, response interface{}, awsSession *session.Session) InvokeResult {
+  result, err := InvokeE(functionArnOrName, payload, response, awsSession)
   errors.QuitIfError(err)
+  return result
+}
+
+// InvokeE - Invokes a function and waits for it to return, decoding its JSON response into response (when not nil).
+// Returns an error holding the error message and logs if the function threw
+func InvokeE(functionArnOrName string, payload interface{}, response interface{}, awsSession *session.Session) (InvokeResult, error) {
+  return InvokeWithContext(context.Background(), functionArnOrName, payload, response, awsSession)
+}
+
+// InvokeWithContext - InvokeE with a context to allow cancellation
+func InvokeWithContext(ctx context.Context, functionArnOrName string, payload interface{}, response interface{}, awsSession *session.Session) (InvokeResult, error) {
+  return New(awsSession).Invoke(ctx, functionArnOrName, payload, response)
+}
+
+// Invoke - Invokes a function (or <name>:<version or alias>) and waits for it to return, decoding its JSON response into response (when not nil).
+// The payload is sent as is when it is a []byte and as JSON otherwise. Returns an error holding the error message and logs if the function threw
+func (client *Client) Invoke(ctx context.Context, functionArnOrName string, payload interface{}, response interface{}) (InvokeResult, error) {
+  body, err := encodePayload(payload)
+  if err != nil {
+    return InvokeResult{}, err
+  }
+  output, err := client.Lambda.InvokeWithContext(ctx, &lambda.InvokeInput{
+    FunctionName: aws.String(functionArnOrName),
+    InvocationType: aws.String(lambda.InvocationTypeRequestResponse),
+    LogType: aws.String(lambda.LogTypeTail),
+    Payload: body,
+  })
+  if err != nil {
+    return InvokeResult{}, err
+  }
+  result := InvokeResult{
+    ExecutedVersion: aws.StringValue(output.ExecutedVersion),
+    FunctionError: aws.StringValue(output.FunctionError),
+    Payload: output.Payload,
+    StatusCode: aws.Int64Value(output.StatusCode),
+  }
+  if output.LogResult != nil {
+    logs, err := base64.StdEncoding.DecodeString(*output.LogResult)
+    if err != nil {
+      return result, err
+    }
+    result.Logs = string(logs)
+  }
+  if result.FunctionError != "" {
+    var functionError struct {
+      ErrorMessage string `json:"errorMessage"`
+      ErrorType string `json:"errorType"`
+    }
+    message := string(result.Payload)
+    if json.Unmarshal(result.Payload, &functionError) == nil && functionError.ErrorMessage != "" {
+      message = str.Concat(functionError.ErrorType, ": ", functionError.ErrorMessage)
+    }
+    return result, errors.New(str.Concat("The Lambda function ", functionArnOrName, " returned an error (", result.FunctionError, ") ", message, "\n", result.Logs))
+  }
+  if response != nil && len(result.Payload) > 0 {
+    err = json.Unmarshal(result.Payload, response)
+  }
+  return result, err
+}
+
+func InvokeAsync(functionArnOrName string, payload interface{}, awsSession *session.Session) {
+  errors.QuitIfError(InvokeAsyncE(functionArnOrName, payload, awsSession))
+}
+
+// InvokeAsyncE - Queues an invocation of a function without waiting for it to run, returning any error
+func InvokeAsyncE(functionArnOrName string, payload interface{}, awsSession *session.Session) error {
+  return InvokeAsyncWithContext(context.Background(), functionArnOrName, payload, awsSession)
+}
+
+// InvokeAsyncWithContext - InvokeAsyncE with a context to allow cancellation
+func InvokeAsyncWithContext(ctx context.Context, functionArnOrName string, payload interface{}, awsSession *session.Session) error {
+  return New(awsSession).InvokeAsync(ctx, functionArnOrName, payload)
+}
+
+// InvokeAsync - Queues an invocation of a function without waiting for it to run, returning any error.
+// The payload is sent as is when it is a []byte and as JSON otherwise
+func (client *Client) InvokeAsync(ctx context.Context, functionArnOrName string, payload interface{}) error {
+  body, err := encodePayload(payload)
+  if err != nil {
+    return err
+  }
+  _, err = client.Lambda.InvokeWithContext(ctx, &lambda.InvokeInput{
+    FunctionName: aws.String(functionArnOrName),
+    InvocationType: aws.String(lambda.InvocationTypeEvent),
+    Payload: body,
+  })
+  return err
+}
+
+func PublishVersion(functionName string, description string, awsSession *session.Session) string {
+  version, err := PublishVersionE(functionName, description, awsSession)
+  errors.QuitIfError(err)
+  return version
+}
+
+// PublishVersionE - Publishes the current code and configuration of a function as a new version, waits until it is Active and returns its number or an error
+func PublishVersionE(functionName string, description string, awsSession *session.Session) (string, error) {
+  return PublishVersionWithContext(context.Background(), functionName, description, awsSession)
+}
+
+// PublishVersionWithContext - PublishVersionE where the context can cancel the wait or give it another deadline
+func PublishVersionWithContext(ctx context.Context, functionName string, description string, awsSession *session.Session) (string, error) {
+  return New(awsSession).PublishVersion(ctx, functionName, description)
+}
+
+// PublishVersion - Publishes the current code and configuration of a function as a new version, waits until it is Active and returns its number or an error.
+// Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) PublishVersion(ctx context.Context, functionName string, description string) (string, error) {
+  result, err := client.Lambda.PublishVersionWithContext(ctx, &lambda.PublishVersionInput{
+    Description: optionalString(description),
+    FunctionName: aws.String(functionName),
+  })
+  if err != nil {
+    return "", err
+  }
+  version := aws.StringValue(result.Version)
+  err = client.WaitForFunction(ctx, str.Concat(functionName, ":", version))
+  if err != nil {
+    return "", err
+  }
+  return version, nil
+}
+
+func RemovePermission(functionName string, statementId string, awsSession *session.Session) {
+  errors.QuitIfError(RemovePermissionE(functionName, statementId, awsSession))
+}
+
+// RemovePermissionE - Removes a statement, such as one added by AllowS3Invoke, from the resource-based policy of a function, returning any error
+func RemovePermissionE(functionName string, statementId string, awsSession *session.Session) error {
+  return RemovePermissionWithContext(context.Background(), functionName, statementId, awsSession)
+}
+
+// RemovePermissionWithContext - RemovePermissionE with a context to allow cancellation
+func RemovePermissionWithContext(ctx context.Context, functionName string, statementId string, awsSession *session.Session) error {
+  return New(awsSession).RemovePermission(ctx, functionName, statementId)
+}
+
+// RemovePermission - Removes a statement, such as one added by AllowS3Invoke, from the resource-based policy of a function, returning any error
+func (client *Client) RemovePermission(ctx context.Context, functionName string, statementId string) error {
+  _, err := client.Lambda.RemovePermissionWithContext(ctx, &lambda.RemovePermissionInput{
+    FunctionName: aws.String(functionName),
+    StatementId: aws.String(statementId),
+  })
+  return err
+}
+
+func ShiftAliasTraffic(functionName string, aliasName string, version string, weight float64, awsSession *session.Session) {
+  errors.QuitIfError(ShiftAliasTrafficE(functionName, aliasName, version, weight, awsSession))
+}
+
+// ShiftAliasTrafficE - Sends a share (from 0 to 1) of the invocations of an alias to another version, returning any error.
+// A weight of 1 points the alias at the version
+func ShiftAliasTrafficE(functionName string, aliasName string, version string, weight float64, awsSession *session.Session) error {
+  return ShiftAliasTrafficWithContext(context.Background(), functionName, aliasName, version, weight, awsSession)
+}
+
+// ShiftAliasTrafficWithContext - ShiftAliasTrafficE with a context to allow cancellation
+func ShiftAliasTrafficWithContext(ctx context.Context, functionName string, aliasName string, version string, weight float64, awsSession *session.Session) error {
+  return New(awsSession).ShiftAliasTraffic(ctx, functionName, aliasName, version, weight)
+}
+
+// ShiftAliasTraffic - Sends a share (from 0 to 1) of the invocations of an alias to another version, returning any error.
+// The rest keeps going to the version the alias points at. A weight of 1 points the alias at the version and a weight of 0 stops shifting
+func (client *Client) ShiftAliasTraffic(ctx context.Context, functionName string, aliasName string, version string, weight float64) error {
+  if weight < 0 || weight > 1 {
+    return errors.New("The weight of the traffic shifted to a version must be between 0 and 1")
+  }
+  if weight == 1 {
+    return client.CreateAlias(ctx, functionName, aliasName, version)
+  }
+  alias, err := client.Lambda.GetAliasWithContext(ctx, &lambda.GetAliasInput{
+    FunctionName: aws.String(functionName),
+    Name: aws.String(aliasName),
+  })
+  if err != nil {
+    return err
+  }
+  weights := map[string]*float64{}
+  if weight > 0 && version != aws.StringValue(alias.FunctionVersion) {
+    weights[version] = aws.Float64(weight)
+  }
+  _, err = client.Lambda.UpdateAliasWithContext(ctx, &lambda.UpdateAliasInput{
+    FunctionName: aws.String(functionName),
+    Name: aws.String(aliasName),
+    RoutingConfig: &lambda.AliasRoutingConfiguration{
+      AdditionalVersionWeights: weights,
+    },
+  })
+  return err
+}
+
+func TailLogs(functionArnOrName string, options cloudwatchlogs.LogOptions, awsSession *session.Session) {
+  errors.QuitIfError(TailLogsE(functionArnOrName, options, func(event cloudwatchlogs.LogEvent) {
+    logger.Info(event.Message)
+  }, awsSession))
+}
+
+// TailLogsE - Passes the events a Lambda function logged to handle as they are read, oldest first, returning any error.
+// When following, it keeps polling for new events until the context is cancelled or the end of the time range is reached
+func TailLogsE(functionArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent), awsSession *session.Session) error {
+  return TailLogsWithContext(context.Background(), functionArnOrName, options, handle, awsSession)
+}
+
+// TailLogsWithContext - TailLogsE where cancelling the context stops following without an error
+func TailLogsWithContext(ctx context.Context, functionArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent), awsSession *session.Session) error {
+  return New(awsSession).TailLogs(ctx, functionArnOrName, options, handle)
+}
+
+// TailLogs - Passes the events a Lambda function logged to /aws/lambda/<name> to handle as they are read, oldest first, returning any error
+func (client *Client) TailLogs(ctx context.Context, functionArnOrName string, options cloudwatchlogs.LogOptions, handle func(cloudwatchlogs.LogEvent)) error {
+  return client.Logs.TailLogs(ctx, logGroup(functionArnOrName), options, handle)
+}
+
+func UpdateCode(functionName string, code Code, awsSession *session.Session) {
+  errors.QuitIfError(UpdateCodeE(functionName, code, awsSession))
+}
+
+// UpdateCodeE - Zips a directory into the code of an existing function and waits until the update is Successful, returning any error
+func UpdateCodeE(functionName string, code Code, awsSession *session.Session) error {
+  return UpdateCodeWithContext(context.Background(), functionName, code, awsSession)
+}
+
+// UpdateCodeWithContext - UpdateCodeE where the context can cancel the wait or give it another deadline
+func UpdateCodeWithContext(ctx context.Context, functionName string, code Code, awsSession *session.Session) error {
+  return New(awsSession).UpdateCode(ctx, functionName, code)
+}
+
+// UpdateCode - Zips a directory into the code of an existing function and waits until the update is Successful, returning any error.
+// Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) UpdateCode(ctx context.Context, functionName string, code Code) error {
+  functionCode, err := client.uploadCode(ctx, functionName, code)
+  if err != nil {
+    return err
+  }
+  functionCode.FunctionName = aws.String(functionName)
+  _, err = client.Lambda.UpdateFunctionCodeWithContext(ctx, functionCode)
+  if err != nil {
+    return err
+  }
+  return client.WaitForFunction(ctx, functionName)
+}
+
+func UpdateConfiguration(functionName string, config FunctionConfig, awsSession *session.Session) {
+  errors.QuitIfError(UpdateConfigurationE(functionName, config, awsSession))
+}
+
+// UpdateConfigurationE - Changes the non-empty settings of an existing function and waits until the update is Successful, returning any error
+func UpdateConfigurationE(functionName string, config FunctionConfig, awsSession *session.Session) error {
+  return UpdateConfigurationWithContext(context.Background(), functionName, config, awsSession)
+}
+
+// UpdateConfigurationWithContext - UpdateConfigurationE where the context can cancel the wait or give it another deadline
+func UpdateConfigurationWithContext(ctx context.Context, functionName string, config FunctionConfig, awsSession *session.Session) error {
+  return New(awsSession).UpdateConfiguration(ctx, functionName, config)
+}
+
+// UpdateConfiguration - Changes the non-empty settings of an existing function and waits until the update is Successful, returning any error.
+// Without a deadline on the context, it waits up to 5 minutes
+func (client *Client) UpdateConfiguration(ctx context.Context, functionName string, config FunctionConfig) error {
+  _, err := client.Lambda.UpdateFunctionConfigurationWithContext(ctx, &lambda.UpdateFunctionConfigurationInput{
+    Description: optionalString(config.Description),
+    Environment: environment(config.Environment),
+    FunctionName: aws.String(functionName),
+    Handler: optionalString(config.Handler),
+    MemorySize: optionalInt64(config.MemorySize),
+    Role: optionalString(config.RoleArn),
+    Runtime: optionalString(config.Runtime),
+    Timeout: optionalInt64(int64(config.Timeout / time.Second)),
+  })
+  if err != nil {
+    return err
+  }
+  return client.WaitForFunction(ctx, functionName)
+}
+
+func WaitForFunction(functionArnOrName string, awsSession *session.Session) {
+  errors.QuitIfError(WaitForFunctionE(functionArnOrName, awsSession))
+}
+
+// WaitForFunctionE - Waits up to 5 minutes until a function (or version, as <name>:<version>) is Active and its last update Successful, returning any error
+func WaitForFunctionE(functionArnOrName string, awsSession *session.Session) error {
+  return WaitForFunctionWithContext(context.Background(), functionArnOrName, awsSession)
+}
+
+// WaitForFunctionWithContext - WaitForFunctionE where the context can cancel the wait or give it another deadline
+func WaitForFunctionWithContext(ctx context.Context, functionArnOrName string, awsSession *session.Session) error {
+  return New(awsSession).WaitForFunction(ctx, functionArnOrName)
+}
+
+// WaitForFunction - Polls a function (or version, as <name>:<version>) with backoff until it is Active and its last update Successful.
+// Returns the reason as an error if it Failed. Without a deadline on the context, it gives up after 5 minutes
+func (client *Client) WaitForFunction(ctx context.Context, functionArnOrName string) error {
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 5 * time.Minute)
+    defer cancel()
+  }
+  delay := time.Second
+  for {
+    result, err := client.Lambda.GetFunctionConfigurationWithContext(ctx, &lambda.GetFunctionConfigurationInput{
+      FunctionName: aws.String(functionArnOrName),
+    })
+    if err != nil {
+      return err
+    }
+    state := aws.StringValue(result.State)
+    updateStatus := aws.StringValue(result.LastUpdateStatus)
+    if state == lambda.StateFailed {
+      return errors.New(str.Concat("The Lambda function ", functionArnOrName, " failed: ", aws.StringValue(result.StateReason)))
+    }
+    if updateStatus == lambda.LastUpdateStatusFailed {
+      return errors.New(str.Concat("The update of the Lambda function ", functionArnOrName, " failed: ", aws.StringValue(result.LastUpdateStatusReason)))
+    }
+    if (state == "" || state == lambda.StateActive) && (updateStatus == "" || updateStatus == lambda.LastUpdateStatusSuccessful) {
+      return nil
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      return errors.New(str.Concat("The Lambda function ", functionArnOrName, " is still ", state, "/", updateStatus, ": ", err.Error()))
+    }
+    delay *= 2
+    if delay > 10 * time.Second {
+      delay = 10 * time.Second
+    }
+  }
+}
+
+// uploadCode - Zips the source directory and returns it as the code of an update, staged in S3 when a bucket is given
+func (client *Client) uploadCode(ctx context.Context, functionName string, code Code) (*lambda.UpdateFunctionCodeInput, error) {
+  zipFile, err := files.ZipDirectory(code.SourceDir)
+  if err != nil {
+    return nil, err
+  }
+  if code.StagingBucket == "" {
+    if len(zipFile) > maxDirectUploadSize {
+      return nil, errors.New(str.Concat("The code of the Lambda function ", functionName, " is over 50MB zipped and needs a staging bucket"))
+    }
+    return &lambda.UpdateFunctionCodeInput{
+      ZipFile: zipFile,
+    }, nil
+  }
+  checksum := sha256.Sum256(zipFile)
+  key := str.Concat(functionName, "/", hex.EncodeToString(checksum[:]), ".zip")
+  versionId, err := client.S3.Upload(ctx, code.StagingBucket, key, zipFile)
+  if err != nil {
+    return nil, err
+  }
+  return &lambda.UpdateFunctionCodeInput{
+    S3Bucket: aws.String(code.StagingBucket),
+    S3Key: aws.String(key),
+    S3ObjectVersion: optionalString(versionId),
+  }, nil
+}
+
+// addPermission - Adds a statement to the policy of a function. A statement ID already taken by the same permission is not an error
+// and one taken by another permission is. Other conflicts, as while the function is being updated, are retried with backoff, for up
+// to 5 minutes without a deadline on the context
+func (client *Client) addPermission(ctx context.Context, input *lambda.AddPermissionInput) error {
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 5 * time.Minute)
+    defer cancel()
+  }
+  delay := time.Second
+  for {
+    _, err := client.Lambda.AddPermissionWithContext(ctx, input)
+    if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != lambda.ErrCodeResourceConflictException {
+      return err
+    }
+    statement, found, policyErr := client.policyStatement(ctx, input)
+    if policyErr != nil {
+      return policyErr
+    }
+    if found {
+      if !samePermission(statement, input) {
+        return errors.New(str.Concat("The statement ", aws.StringValue(input.StatementId), " of the Lambda function ", aws.StringValue(input.FunctionName), " already grants another permission"))
+      }
+      return nil
+    }
+    if aws.SleepWithContext(ctx, delay) != nil {
+      return err
+    }
+    delay *= 2
+    if delay > 10 * time.Second {
+      delay = 10 * time.Second
+    }
+  }
+}
+
+// policyStatement - Returns the statement of the function's policy with the ID of the permission, if there is one
+func (client *Client) policyStatement(ctx context.Context, input *lambda.AddPermissionInput) (iam.Statement, bool, error) {
+  result, err := client.Lambda.GetPolicyWithContext(ctx, &lambda.GetPolicyInput{
+    FunctionName: input.FunctionName,
+    Qualifier: input.Qualifier,
+  })
+  if isNotFound(err) {
+    return iam.Statement{}, false, nil
+  }
+  if err != nil {
+    return iam.Statement{}, false, err
+  }
+  policy, err := iam.ParsePolicy(aws.StringValue(result.Policy))
+  if err != nil {
+    return iam.Statement{}, false, err
+  }
+  for _, statement := range policy.Statement {
+    if statement.Sid == aws.StringValue(input.StatementId) {
+      return statement, true, nil
+    }
+  }
+  return iam.Statement{}, false, nil
+}
+
+// samePermission - Checks whether a statement of a function's policy grants what the permission would: the action, to the principal,
+// for the same source ARN and account
+func samePermission(statement iam.Statement, input *lambda.AddPermissionInput) bool {
+  principal := false
+  for _, values := range statement.Principal {
+    principal = principal || contains(values, aws.StringValue(input.Principal))
+  }
+  return statement.Effect == "Allow" && principal && contains(statement.Action, aws.StringValue(input.Action)) &&
+    conditionValue(statement, "AWS:SourceArn") == aws.StringValue(input.SourceArn) &&
+    conditionValue(statement, "AWS:SourceAccount") == aws.StringValue(input.SourceAccount)
+}
+
+// conditionValue - Returns the value a statement's conditions give a key, under any operator, or "" if they do not
+func conditionValue(statement iam.Statement, key string) string {
+  for _, keys := range statement.Condition {
+    for conditionKey, values := range keys {
+      if strings.EqualFold(conditionKey, key) && len(values) > 0 {
+        return values[0]
+      }
+    }
+  }
+  return ""
+}
+
+func contains(values []string, value string) bool {
+  for _, each := range values {
+    if each == value {
+      return true
+    }
+  }
+  return false
+}
+
+// waitForEventSourceMapping - Polls a mapping with backoff until it reaches the state, or is gone when the state is empty.
+// Without a deadline on the context, it gives up after 5 minutes
+func (client *Client) waitForEventSourceMapping(ctx context.Context, uuid string, state string) error {
+  if _, ok := ctx.Deadline(); !ok {
+    var cancel context.CancelFunc
+    ctx, cancel = context.WithTimeout(ctx, 5 * time.Minute)
+    defer cancel()
+  }
+  delay := time.Second
+  for {
+    result, err := client.Lambda.GetEventSourceMappingWithContext(ctx, &lambda.GetEventSourceMappingInput{
+      UUID: aws.String(uuid),
+    })
+    if isNotFound(err) && state == "" {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    if aws.StringValue(result.State) == state {
+      return nil
+    }
+    err = aws.SleepWithContext(ctx, delay)
+    if err != nil {
+      return errors.New(str.Concat("The event source mapping ", uuid, " is still ", aws.StringValue(result.State), ": ", aws.StringValue(result.StateTransitionReason)))
+    }
+    delay *= 2
+    if delay > 10 * time.Second {
+      delay = 10 * time.Second
+    }
+  }
+}
+
+func encodePayload(payload interface{}) ([]byte, error) {
+  if payload == nil {
+    return nil, nil
+  }
+  if body, ok := payload.([]byte); ok {
+    return body, nil
+  }
+  return json.Marshal(payload)
+}
+
+func environment(variables map[string]string) *lambda.Environment {
+  if len(variables) == 0 {
+    return nil
+  }
+  return &lambda.Environment{
+    Variables: aws.StringMap(variables),
+  }
+}
+
+// arnService - Returns the service of an ARN (arn:<partition>:<service>:...), whatever its partition, or "" if it is not an ARN
+func arnService(arn string) string {
+  fields := strings.SplitN(arn, ":", 4)
+  if len(fields) < 4 || fields[0] != "arn" {
+    return ""
+  }
+  return fields[2]
+}
+
+// arnPartition - Returns the partition of an ARN (arn:<partition>:...), such as aws or aws-us-gov, or "" if it is not an ARN
+func arnPartition(arn string) string {
+  fields := strings.SplitN(arn, ":", 3)
+  if len(fields) < 3 || fields[0] != "arn" {
+    return ""
+  }
+  return fields[1]
+}
+
+// partition - Returns the partition of a function given by name or ARN, looking up the ARN of a name
+func (client *Client) partition(ctx context.Context, functionArnOrName string) (string, error) {
+  if partition := arnPartition(functionArnOrName); partition != "" {
+    return partition, nil
+  }
+  result, err := client.Lambda.GetFunctionConfigurationWithContext(ctx, &lambda.GetFunctionConfigurationInput{
+    FunctionName: aws.String(functionArnOrName),
+  })
+  if err != nil {
+    return "", err
+  }
+  return arnPartition(aws.StringValue(result.FunctionArn)), nil
+}
+
+func isNotFound(err error) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == lambda.ErrCodeResourceNotFoundException
+}
+
+func optionalInt64(value int64) *int64 {
+  if value == 0 {
+    return nil
+  }
+  return aws.Int64(value)
+}
+
+func optionalString(value string) *string {
+  if value == "" {
+    return nil
+  }
+  return aws.String(value)
+}
+
+// logGroup - Returns the log group Lambda writes to for a function name or ARN (arn:aws:lambda:<region>:<account>:function:<name>[:<qualifier>]).
+// Every version and alias of a function shares its log group, so a qualifier after the name is dropped
+func logGroup(functionArnOrName string) string {
+  name := functionArnOrName
+  if strings.HasPrefix(name, "arn:") {
+    parts := strings.Split(name, ":")
+    if len(parts) >= 7 {
+      name = parts[6]
+    }
+  } else if index := strings.Index(name, ":"); index >= 0 {
+    name = name[:index]
+  }
+  return "/aws/lambda/" + name
 }
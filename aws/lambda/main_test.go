@@ -0,0 +1,246 @@
+package lambda
+
+import (
+  "context"
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/lambda/lambdafake"
+  "github.com/PyramidSystemsInc/go/aws/s3"
+  "github.com/PyramidSystemsInc/go/aws/s3/s3fake"
+  "github.com/aws/aws-sdk-go/aws"
+  awslambda "github.com/aws/aws-sdk-go/service/lambda"
+  awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+// TestDeploy creates a function, publishes two versions and shifts an alias from the first to the second
+// against the in-memory fakes.
+func TestDeploy(t *testing.T) {
+  ctx := context.Background()
+  fake := lambdafake.New()
+  s3Fake := s3fake.New()
+  client := &Client{
+    Lambda: fake,
+    S3: &s3.Client{S3: s3Fake},
+  }
+  _, err := s3Fake.CreateBucketWithContext(ctx, &awss3.CreateBucketInput{
+    Bucket: aws.String("test-staging"),
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  sourceDir, err := ioutil.TempDir("", "lambda")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(sourceDir)
+  err = ioutil.WriteFile(filepath.Join(sourceDir, "index.js"), []byte("exports.handler = async () => 'v1'"), 0644)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  functionArn, err := client.Create(ctx, "test-function", Code{
+    SourceDir: sourceDir,
+  }, FunctionConfig{
+    Environment: map[string]string{
+      "STAGE": "test",
+    },
+    Handler: "index.handler",
+    RoleArn: "arn:aws:iam::123456789012:role/test-lambda",
+    Runtime: "nodejs12.x",
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if functionArn != "arn:aws:lambda:us-east-1:123456789012:function:test-function" || len(fake.Code["test-function"].ZipFile) == 0 {
+    t.Errorf("expected the function to be created from a zip, got %s", functionArn)
+  }
+  firstVersion, err := client.PublishVersion(ctx, "test-function", "first")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.CreateAlias(ctx, "test-function", "live", firstVersion)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.UpdateCode(ctx, "test-function", Code{
+    SourceDir: sourceDir,
+    StagingBucket: "test-staging",
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if code := fake.Code["test-function"]; code.ZipFile != nil || aws.StringValue(code.S3Bucket) != "test-staging" || code.S3ObjectVersion != nil {
+    t.Errorf("expected the code to be deployed from the staging bucket, got %+v", code)
+  }
+  err = client.UpdateConfiguration(ctx, "test-function", FunctionConfig{
+    MemorySize: 512,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if function := fake.Functions["test-function"]; *function.MemorySize != 512 || *function.Handler != "index.handler" {
+    t.Errorf("expected only the memory size to change, got %d and %s", *function.MemorySize, *function.Handler)
+  }
+  secondVersion, err := client.PublishVersion(ctx, "test-function", "second")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.ShiftAliasTraffic(ctx, "test-function", "live", secondVersion, 0.1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  alias := fake.Aliases["test-function"]["live"]
+  if *alias.FunctionVersion != firstVersion || aws.Float64Value(alias.RoutingConfig.AdditionalVersionWeights[secondVersion]) != 0.1 {
+    t.Errorf("expected 10%% of live shifted to version %s, got %+v", secondVersion, alias)
+  }
+  err = client.ShiftAliasTraffic(ctx, "test-function", "live", secondVersion, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if *alias.FunctionVersion != secondVersion || len(alias.RoutingConfig.AdditionalVersionWeights) != 0 {
+    t.Errorf("expected live to point at version %s only, got %+v", secondVersion, alias)
+  }
+}
+
+// TestInvokeAndTriggers invokes a function that succeeds and one that throws, then wires and unwires an SQS
+// trigger and an S3 permission against the in-memory fake.
+func TestInvokeAndTriggers(t *testing.T) {
+  ctx := context.Background()
+  fake := lambdafake.New()
+  client := &Client{Lambda: fake}
+  for _, name := range []string{"test-greeter", "test-failing"} {
+    fake.Functions[name] = &awslambda.FunctionConfiguration{
+      FunctionArn: aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + name),
+      FunctionName: aws.String(name),
+    }
+  }
+  fake.Handlers["test-greeter"] = func(payload []byte) ([]byte, error) {
+    return []byte(`{"greeting":"hello"}`), nil
+  }
+  fake.Handlers["test-failing"] = func(payload []byte) ([]byte, error) {
+    return nil, errors.New("table not found")
+  }
+
+  var response struct {
+    Greeting string `json:"greeting"`
+  }
+  result, err := client.Invoke(ctx, "test-greeter", map[string]string{"name": "pac"}, &response)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if response.Greeting != "hello" || !strings.Contains(result.Logs, "START RequestId") {
+    t.Errorf("expected a decoded response and logs, got %+v", result)
+  }
+  if string(fake.Invocations["test-greeter"][0]) != `{"name":"pac"}` {
+    t.Errorf("expected the payload as JSON, got %s", fake.Invocations["test-greeter"][0])
+  }
+  result, err = client.Invoke(ctx, "test-failing", nil, nil)
+  if err == nil || result.FunctionError != "Unhandled" || !strings.Contains(err.Error(), "Error: table not found") || !strings.Contains(err.Error(), "ERROR table not found") {
+    t.Errorf("expected the function error with its message and logs, got %v", err)
+  }
+  err = client.InvokeAsync(ctx, "test-failing", []byte(`{"raw":true}`))
+  if err != nil || string(fake.Invocations["test-failing"][1]) != `{"raw":true}` {
+    t.Errorf("expected the raw payload to be queued, got %v", err)
+  }
+
+  uuid, err := client.CreateEventSourceMapping(ctx, "test-greeter", "arn:aws:sqs:us-east-1:123456789012:test-queue", EventSourceOptions{
+    BatchSize: 5,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if mapping := fake.EventSourceMappings[uuid]; *mapping.BatchSize != 5 || mapping.StartingPosition != nil {
+    t.Errorf("expected a batch size of 5 without a starting position, got %+v", mapping)
+  }
+  govUuid, err := client.CreateEventSourceMapping(ctx, "test-greeter", "arn:aws-us-gov:dynamodb:us-gov-west-1:123456789012:table/test/stream/2024", EventSourceOptions{})
+  if err != nil || *fake.EventSourceMappings[govUuid].StartingPosition != awslambda.EventSourcePositionLatest {
+    t.Errorf("expected a stream of another partition to start at the latest record, got %v", err)
+  }
+  delete(fake.EventSourceMappings, govUuid)
+  _, err = client.CreateEventSourceMapping(ctx, "test-greeter", "arn:aws:sns:us-east-1:123456789012:test-topic", EventSourceOptions{})
+  if err == nil {
+    t.Error("expected SNS topics to be refused")
+  }
+  err = client.DeleteEventSourceMapping(ctx, uuid)
+  if err != nil || len(fake.EventSourceMappings) != 0 {
+    t.Errorf("expected the mapping to be deleted, got %v", err)
+  }
+
+  statementId, err := client.AllowS3Invoke(ctx, "test-greeter", "test.uploads", "123456789012")
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.AllowS3Invoke(ctx, "test-greeter", "test.uploads", "123456789012")
+  if err != nil {
+    t.Errorf("expected allowing the bucket twice to succeed, got %v", err)
+  }
+  _, err = client.AllowS3Invoke(ctx, "test-greeter", "test.uploads", "210987654321")
+  if err == nil {
+    t.Error("expected allowing the bucket for another account under the same statement to fail")
+  }
+  fake.UpdatesInProgress = 1
+  _, err = client.AllowApiGatewayInvoke(ctx, "test-greeter", "arn:aws:execute-api:us-east-1:123456789012:abc123/*/GET/hello")
+  if err != nil || len(fake.Permissions["test-greeter"]) != 2 {
+    t.Errorf("expected the permission to be added once the update is over, got %v", err)
+  }
+  permission := fake.Permissions["test-greeter"][statementId]
+  if !strings.HasPrefix(statementId, "s3-") || *permission.SourceArn != "arn:aws:s3:::test.uploads" || *permission.Principal != "s3.amazonaws.com" {
+    t.Errorf("expected the bucket to be allowed, got %s %+v", statementId, permission)
+  }
+  dashedStatementId, err := client.AllowS3Invoke(ctx, "test-greeter", "test-uploads", "123456789012")
+  if err != nil || dashedStatementId == statementId {
+    t.Errorf("expected a bucket differing only in dots and dashes to get its own statement, got %s, %v", dashedStatementId, err)
+  }
+  err = client.RemovePermission(ctx, "test-greeter", dashedStatementId)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.RemovePermission(ctx, "test-greeter", statementId)
+  if err != nil || len(fake.Permissions["test-greeter"]) != 1 {
+    t.Errorf("expected the statement to be removed, got %v", err)
+  }
+}
+
+// TestLogGroup checks that names and ARNs, with or without a qualifier, map to the log group of the function.
+func TestLogGroup(t *testing.T) {
+  for _, functionArnOrName := range []string{
+    "test-greeter",
+    "test-greeter:live",
+    "arn:aws:lambda:us-east-1:123456789012:function:test-greeter",
+    "arn:aws:lambda:us-east-1:123456789012:function:test-greeter:2",
+  } {
+    if group := logGroup(functionArnOrName); group != "/aws/lambda/test-greeter" {
+      t.Errorf("expected the log group of %s to be /aws/lambda/test-greeter, got %s", functionArnOrName, group)
+    }
+  }
+}
+
+// TestAllowS3InvokePartition checks that the bucket ARN allowed to invoke a function is in the partition of the function.
+func TestAllowS3InvokePartition(t *testing.T) {
+  ctx := context.Background()
+  fake := lambdafake.New()
+  client := &Client{Lambda: fake}
+  fake.Functions["test-greeter"] = &awslambda.FunctionConfiguration{
+    FunctionArn: aws.String("arn:aws-us-gov:lambda:us-gov-west-1:123456789012:function:test-greeter"),
+    FunctionName: aws.String("test-greeter"),
+  }
+
+  statementId, err := client.AllowS3Invoke(ctx, "test-greeter", "test.uploads", "123456789012")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if sourceArn := *fake.Permissions["test-greeter"][statementId].SourceArn; sourceArn != "arn:aws-us-gov:s3:::test.uploads" {
+    t.Errorf("expected a bucket ARN in the aws-us-gov partition, got %s", sourceArn)
+  }
+  _, err = client.AllowS3Invoke(ctx, "test-missing", "test.uploads", "123456789012")
+  if err == nil {
+    t.Error("expected an error for a missing function")
+  }
+}
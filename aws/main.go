@@ -1,32 +1,189 @@
+// Package aws builds AWS sessions. Each service package below it wraps the SDK in a Client holding the SDK interface
+// of the service, with package functions that build one from a session. Tests give the Client the in-memory fake of
+// the service's fake package, such as s3fake, instead.
 package aws
 
 import (
+	"context"
+	"time"
+
 	"github.com/PyramidSystemsInc/go/errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
+// SessionOptions - Settings for CreateCustomAwsSession. Empty fields fall back to the environment and shared config
+type SessionOptions struct {
+  Region      string
+  // Profile - Named profile of the shared config and credentials files
+  Profile     string
+  // Endpoint - URL every service is called at, such as http://localhost:4566 for a local emulator
+  Endpoint    string
+  // MaxRetries - Number of times a throttled or failed request is retried. Zero keeps the SDK default
+  MaxRetries  int
+  AssumeRole  *AssumeRoleOptions
+}
+
+// AssumeRoleOptions - Role the session assumes on top of the credentials found for the profile
+type AssumeRoleOptions struct {
+  RoleArn       string
+  ExternalID    string
+  // SessionName - Defaults to a name generated by the SDK
+  SessionName   string
+  // Duration - Defaults to 15 minutes
+  Duration      time.Duration
+  // MFASerial - Serial number or ARN of the MFA device required by the role's trust policy
+  MFASerial     string
+  // TokenProvider - Returns the current MFA code. Defaults to prompting on stdin when MFASerial is set
+  TokenProvider func() (string, error)
+}
+
 func CreateAwsSession(region string) *session.Session {
-  awsSession, err := session.NewSession(&aws.Config{
-    Region: aws.String(region),
-  })
+  awsSession, err := CreateAwsSessionE(region)
   errors.QuitIfError(err)
-  _, err = awsSession.Config.Credentials.Get()
+  return awsSession
+}
+
+// CreateAwsSessionE - Creates a session for the region and verifies credentials can be found, returning any error
+func CreateAwsSessionE(region string) (*session.Session, error) {
+  return CreateAwsSessionWithContext(context.Background(), region)
+}
+
+// CreateAwsSessionWithContext - CreateAwsSessionE where retrieving the credentials can be cancelled using the context
+func CreateAwsSessionWithContext(ctx context.Context, region string) (*session.Session, error) {
+  return CreateCustomAwsSessionWithContext(ctx, SessionOptions{
+    Region: region,
+  })
+}
+
+func CreateCustomAwsSession(options SessionOptions) *session.Session {
+  awsSession, err := CreateCustomAwsSessionE(options)
   errors.QuitIfError(err)
   return awsSession
 }
 
+// CreateCustomAwsSessionE - Creates a session using a profile, endpoint, retry limit and/or assumed role and verifies credentials can be found, returning any error
+func CreateCustomAwsSessionE(options SessionOptions) (*session.Session, error) {
+  return CreateCustomAwsSessionWithContext(context.Background(), options)
+}
+
+// CreateCustomAwsSessionWithContext - CreateCustomAwsSessionE where retrieving the credentials (and assuming the role) can be cancelled using the context
+func CreateCustomAwsSessionWithContext(ctx context.Context, options SessionOptions) (*session.Session, error) {
+  config := aws.Config{}
+  if options.Region != "" {
+    config.Region = aws.String(options.Region)
+  }
+  if options.Endpoint != "" {
+    config.Endpoint = aws.String(options.Endpoint)
+    config.S3ForcePathStyle = aws.Bool(true)
+  }
+  if options.MaxRetries != 0 {
+    config.MaxRetries = aws.Int(options.MaxRetries)
+  }
+  sessionOptions := session.Options{
+    AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+    Config: config,
+    Profile: options.Profile,
+  }
+  if options.Profile != "" {
+    sessionOptions.SharedConfigState = session.SharedConfigEnable
+  }
+  awsSession, err := session.NewSessionWithOptions(sessionOptions)
+  if err != nil {
+    return nil, err
+  }
+  if options.AssumeRole != nil {
+    awsSession.Config.Credentials = assumeRoleCredentials(awsSession, options.AssumeRole)
+  }
+  _, err = awsSession.Config.Credentials.GetWithContext(ctx)
+  if err != nil {
+    return nil, err
+  }
+  return awsSession, nil
+}
+
+func assumeRoleCredentials(awsSession *session.Session, role *AssumeRoleOptions) *credentials.Credentials {
+  return stscreds.NewCredentials(awsSession, role.RoleArn, func(provider *stscreds.AssumeRoleProvider) {
+    if role.ExternalID != "" {
+      provider.ExternalID = aws.String(role.ExternalID)
+    }
+    if role.SessionName != "" {
+      provider.RoleSessionName = role.SessionName
+    }
+    if role.Duration != 0 {
+      provider.Duration = role.Duration
+    }
+    if role.MFASerial != "" {
+      provider.SerialNumber = aws.String(role.MFASerial)
+      provider.TokenProvider = role.TokenProvider
+      if provider.TokenProvider == nil {
+        provider.TokenProvider = stscreds.StdinTokenProvider
+      }
+    }
+  })
+}
+
 func GetAccessKey() (string) {
 	return getSharedCredentials().AccessKeyID
 }
 
+// GetAccessKeyE - Returns the access key of the default shared profile, or an error if it cannot be read
+func GetAccessKeyE() (string, error) {
+	sharedCreds, err := getSharedCredentialsE()
+	return sharedCreds.AccessKeyID, err
+}
+
 func GetSecretKey() (string) {
 	return getSharedCredentials().SecretAccessKey
 }
 
+// GetSecretKeyE - Returns the secret key of the default shared profile, or an error if it cannot be read
+func GetSecretKeyE() (string, error) {
+	sharedCreds, err := getSharedCredentialsE()
+	return sharedCreds.SecretAccessKey, err
+}
+
+func GetProfileAccessKey(profile string) (string) {
+	return getProfileCredentials(profile).AccessKeyID
+}
+
+// GetProfileAccessKeyE - Returns the access key of a named shared profile, or an error if it cannot be read
+func GetProfileAccessKeyE(profile string) (string, error) {
+	sharedCreds, err := getProfileCredentialsE(profile)
+	return sharedCreds.AccessKeyID, err
+}
+
+func GetProfileSecretKey(profile string) (string) {
+	return getProfileCredentials(profile).SecretAccessKey
+}
+
+// GetProfileSecretKeyE - Returns the secret key of a named shared profile, or an error if it cannot be read
+func GetProfileSecretKeyE(profile string) (string, error) {
+	sharedCreds, err := getProfileCredentialsE(profile)
+	return sharedCreds.SecretAccessKey, err
+}
+
+// GetSessionCredentialsE - Returns the credentials a session signs its requests with, such as those of an assumed role
+func GetSessionCredentialsE(awsSession *session.Session) (credentials.Value, error) {
+	return awsSession.Config.Credentials.Get()
+}
+
 func getSharedCredentials() credentials.Value {
-	sharedCreds, err := credentials.NewSharedCredentials("", "").Get()
+	return getProfileCredentials("")
+}
+
+func getProfileCredentials(profile string) credentials.Value {
+	sharedCreds, err := getProfileCredentialsE(profile)
 	errors.QuitIfError(err)
 	return sharedCreds
 }
+
+func getSharedCredentialsE() (credentials.Value, error) {
+	return getProfileCredentialsE("")
+}
+
+func getProfileCredentialsE(profile string) (credentials.Value, error) {
+	return credentials.NewSharedCredentials("", profile).Get()
+}
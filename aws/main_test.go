@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"os"
+	"testing"
+)
+
+// TestCreateCustomAwsSession checks that the endpoint and retry settings end up in the session config
+// without calling AWS, using static credentials from the environment.
+func TestCreateCustomAwsSession(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	awsSession, err := CreateCustomAwsSessionE(SessionOptions{
+		Region:     "us-east-2",
+		Endpoint:   "http://localhost:4566",
+		MaxRetries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *awsSession.Config.Region != "us-east-2" {
+		t.Errorf("expected region us-east-2, got %s", *awsSession.Config.Region)
+	}
+	if *awsSession.Config.Endpoint != "http://localhost:4566" {
+		t.Errorf("expected endpoint http://localhost:4566, got %s", *awsSession.Config.Endpoint)
+	}
+	if !*awsSession.Config.S3ForcePathStyle {
+		t.Error("expected path style S3 addressing with a custom endpoint")
+	}
+	if *awsSession.Config.MaxRetries != 2 {
+		t.Errorf("expected 2 retries, got %d", *awsSession.Config.MaxRetries)
+	}
+
+	creds, err := GetSessionCredentialsE(awsSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "test" {
+		t.Errorf("expected the access key from the environment, got %s", creds.AccessKeyID)
+	}
+}
@@ -1,9 +1,13 @@
 package resourcegroups
 
 import (
+	"context"
+
 	"github.com/PyramidSystemsInc/go/aws/dynamodb"
+	"github.com/PyramidSystemsInc/go/aws/ecr"
 	"github.com/PyramidSystemsInc/go/aws/ecs"
 	"github.com/PyramidSystemsInc/go/aws/elbv2"
+	"github.com/PyramidSystemsInc/go/aws/iam"
 	"github.com/PyramidSystemsInc/go/aws/lambda"
 	"github.com/PyramidSystemsInc/go/errors"
 	"github.com/PyramidSystemsInc/go/logger"
@@ -11,59 +15,158 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/resourcegroups"
+	"github.com/aws/aws-sdk-go/service/resourcegroups/resourcegroupsiface"
 )
 
+// Client creates resource groups by tag and deletes the resources in them, each through the client of its own package.
+type Client struct {
+	ResourceGroups resourcegroupsiface.ResourceGroupsAPI
+	DynamoDB       *dynamodb.Client
+	ECR            *ecr.Client
+	ECS            *ecs.Client
+	ELBV2          *elbv2.Client
+	IAM            *iam.Client
+	Lambda         *lambda.Client
+}
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+	return &Client{
+		ResourceGroups: resourcegroups.New(awsSession),
+		DynamoDB:       dynamodb.New(awsSession),
+		ECR:            ecr.New(awsSession),
+		ECS:            ecs.New(awsSession),
+		ELBV2:          elbv2.New(awsSession),
+		IAM:            iam.New(awsSession),
+		Lambda:         lambda.New(awsSession),
+	}
+}
+
 func Create(groupName string, tagKey string, tagValue string, awsSession *session.Session) {
-	resourceGroupsClient := resourcegroups.New(awsSession)
-	_, err := resourceGroupsClient.CreateGroup(&resourcegroups.CreateGroupInput{
+	errors.QuitIfError(CreateE(groupName, tagKey, tagValue, awsSession))
+}
+
+// CreateE creates a resource group of every resource tagged with tagKey=tagValue, returning any error.
+func CreateE(groupName string, tagKey string, tagValue string, awsSession *session.Session) error {
+	return CreateWithContext(context.Background(), groupName, tagKey, tagValue, awsSession)
+}
+
+// CreateWithContext is CreateE with a context to allow cancellation.
+func CreateWithContext(ctx context.Context, groupName string, tagKey string, tagValue string, awsSession *session.Session) error {
+	return New(awsSession).Create(ctx, groupName, tagKey, tagValue)
+}
+
+// Create creates a resource group of every resource tagged with tagKey=tagValue, returning any error.
+func (client *Client) Create(ctx context.Context, groupName string, tagKey string, tagValue string) error {
+	_, err := client.ResourceGroups.CreateGroupWithContext(ctx, &resourcegroups.CreateGroupInput{
 		Name: aws.String(groupName),
 		ResourceQuery: &resourcegroups.ResourceQuery{
 			Query: aws.String(str.Concat("{\"ResourceTypeFilters\":[\"AWS::AllSupported\"],\"TagFilters\":[{\"Key\":\"", tagKey, "\", \"Values\":[\"", tagValue, "\"]}]}")),
 			Type:  aws.String("TAG_FILTERS_1_0"),
 		},
 	})
-	errors.QuitIfError(err)
+	return err
 }
 
 func DeleteAllResources(groupName string, awsSession *session.Session) {
-	resourceGroupsClient := resourcegroups.New(awsSession)
-	resourcesReport, err := resourceGroupsClient.ListGroupResources(&resourcegroups.ListGroupResourcesInput{
+	errors.QuitIfError(DeleteAllResourcesE(groupName, awsSession))
+}
+
+// DeleteAllResourcesE deletes every resource in the group and then the group itself. It stops at the
+// first resource that fails to delete and returns that error.
+func DeleteAllResourcesE(groupName string, awsSession *session.Session) error {
+	return DeleteAllResourcesWithContext(context.Background(), groupName, awsSession)
+}
+
+// DeleteAllResourcesWithContext is DeleteAllResourcesE with a context to allow cancellation.
+func DeleteAllResourcesWithContext(ctx context.Context, groupName string, awsSession *session.Session) error {
+	return New(awsSession).DeleteAllResources(ctx, groupName)
+}
+
+// DeleteAllResources deletes every resource in the group and then the group itself. It stops at the
+// first resource that fails to delete, or when the context is done, and returns that error.
+func (client *Client) DeleteAllResources(ctx context.Context, groupName string) error {
+	resourcesReport, err := client.ResourceGroups.ListGroupResourcesWithContext(ctx, &resourcegroups.ListGroupResourcesInput{
 		GroupName: aws.String(groupName),
 	})
-	errors.QuitIfError(err)
+	if err != nil {
+		return err
+	}
 	groupResources := resourcesReport.ResourceIdentifiers
 	for _, resource := range groupResources {
-		deleteResource(resource, awsSession)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = client.deleteResource(ctx, resource)
+		if err != nil {
+			return err
+		}
 	}
-	DeleteGroup(groupName, awsSession)
+	return client.DeleteGroup(ctx, groupName)
 }
 
 func DeleteGroup(groupName string, awsSession *session.Session) {
-	resourceGroupsClient := resourcegroups.New(awsSession)
-	_, err := resourceGroupsClient.DeleteGroup(&resourcegroups.DeleteGroupInput{
+	errors.QuitIfError(DeleteGroupE(groupName, awsSession))
+}
+
+// DeleteGroupE deletes the resource group (but not its resources), returning any error.
+func DeleteGroupE(groupName string, awsSession *session.Session) error {
+	return DeleteGroupWithContext(context.Background(), groupName, awsSession)
+}
+
+// DeleteGroupWithContext is DeleteGroupE with a context to allow cancellation.
+func DeleteGroupWithContext(ctx context.Context, groupName string, awsSession *session.Session) error {
+	return New(awsSession).DeleteGroup(ctx, groupName)
+}
+
+// DeleteGroup deletes the resource group (but not its resources), returning any error.
+func (client *Client) DeleteGroup(ctx context.Context, groupName string) error {
+	_, err := client.ResourceGroups.DeleteGroupWithContext(ctx, &resourcegroups.DeleteGroupInput{
 		GroupName: aws.String(groupName),
 	})
-	errors.QuitIfError(err)
+	return err
 }
 
-func deleteResource(resource *resourcegroups.ResourceIdentifier, awsSession *session.Session) {
+func (client *Client) deleteResource(ctx context.Context, resource *resourcegroups.ResourceIdentifier) error {
 	arn := *resource.ResourceArn
 	switch *resource.ResourceType {
 	case "AWS::DynamoDB::Table":
-		dynamodb.DeleteTable(arn, awsSession)
+		if err := client.DynamoDB.DeleteTable(ctx, arn); err != nil {
+			return err
+		}
 		logger.Info("Deleted a DynamoDB table")
+	case "AWS::ECR::Repository":
+		if err := client.ECR.DeleteRepository(ctx, arn, true); err != nil {
+			return err
+		}
+		logger.Info("Deleted an ECR repository and its images")
 	case "AWS::ECS::Cluster":
-		ecs.StopAllTasksInCluster(arn, awsSession)
-		ecs.DeleteCluster(arn, awsSession)
+		if err := client.ECS.StopAllTasksInCluster(ctx, arn); err != nil {
+			return err
+		}
+		if err := client.ECS.DeleteCluster(ctx, arn); err != nil {
+			return err
+		}
 		logger.Info("Stopped all tasks and deleted an ECS cluster")
 	case "AWS::ECS::TaskDefinition":
-		ecs.DeregisterTaskDefinition(arn, awsSession)
+		if err := client.ECS.DeregisterTaskDefinition(ctx, arn); err != nil {
+			return err
+		}
 		logger.Info("Deregistered an ECS task definition")
 	case "AWS::ElasticLoadBalancingV2::LoadBalancer":
-		elbv2.Delete(arn, awsSession)
+		if err := client.ELBV2.Delete(ctx, arn); err != nil {
+			return err
+		}
 		logger.Info("Deleted an ELBV2 load balancer")
+	case "AWS::IAM::Role":
+		if err := client.IAM.DeleteRole(ctx, arn); err != nil {
+			return err
+		}
+		logger.Info("Detached the policies of and deleted an IAM role")
 	case "AWS::Lambda::Function":
-		lambda.Delete(arn, awsSession)
+		if err := client.Lambda.Delete(ctx, arn); err != nil {
+			return err
+		}
 		logger.Info("Deleted a Lambda function")
 	// case "AWS::S3::Bucket":
 	// 	s3.EmptyBucket(arn, awsSession)
@@ -72,4 +175,5 @@ func deleteResource(resource *resourcegroups.ResourceIdentifier, awsSession *ses
 	default:
 		logger.Err(str.Concat("There is a resource of type ", *resource.ResourceType, " which the github.com/PyramidSystemsInc/go/aws/resourcegroups package does not know how to handle"))
 	}
+	return nil
 }
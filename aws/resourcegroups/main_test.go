@@ -0,0 +1,167 @@
+package resourcegroups
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PyramidSystemsInc/go/aws/dynamodb"
+	"github.com/PyramidSystemsInc/go/aws/dynamodb/dynamodbfake"
+	"github.com/PyramidSystemsInc/go/aws/ecr"
+	"github.com/PyramidSystemsInc/go/aws/ecr/ecrfake"
+	"github.com/PyramidSystemsInc/go/aws/elbv2"
+	"github.com/PyramidSystemsInc/go/aws/elbv2/elbv2fake"
+	"github.com/PyramidSystemsInc/go/aws/iam"
+	"github.com/PyramidSystemsInc/go/aws/iam/iamfake"
+	"github.com/PyramidSystemsInc/go/aws/resourcegroups/resourcegroupsfake"
+	"github.com/aws/aws-sdk-go/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	awselbv2 "github.com/aws/aws-sdk-go/service/elbv2"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/resourcegroups"
+)
+
+// fakes are the fakes behind a Client made by newFakeClient.
+type fakes struct {
+	ResourceGroups *resourcegroupsfake.ResourceGroups
+	DynamoDB       *dynamodbfake.DynamoDB
+	ECR            *ecrfake.ECR
+	ELBV2          *elbv2fake.ELBV2
+	IAM            *iamfake.IAM
+}
+
+func newFakeClient() (*Client, *fakes) {
+	fake := &fakes{
+		ResourceGroups: resourcegroupsfake.New(),
+		DynamoDB:       dynamodbfake.New(),
+		ECR:            ecrfake.New(),
+		ELBV2:          elbv2fake.New(),
+		IAM:            iamfake.New(),
+	}
+	return &Client{
+		ResourceGroups: fake.ResourceGroups,
+		DynamoDB:       &dynamodb.Client{DynamoDB: fake.DynamoDB},
+		ECR:            &ecr.Client{ECR: fake.ECR},
+		ELBV2:          &elbv2.Client{ELBV2: fake.ELBV2},
+		IAM:            &iam.Client{IAM: fake.IAM},
+	}, fake
+}
+
+// newGroup creates a group for the project tag and seeds the fake with the resources it lists.
+func newGroup(t *testing.T, client *Client, fake *fakes, groupName string, resources ...*resourcegroups.ResourceIdentifier) {
+	err := client.Create(context.Background(), groupName, "pac-project", "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.ResourceGroups.Groups[groupName].Resources = resources
+}
+
+func resource(resourceType string, arn string) *resourcegroups.ResourceIdentifier {
+	return &resourcegroups.ResourceIdentifier{
+		ResourceArn:  aws.String(arn),
+		ResourceType: aws.String(resourceType),
+	}
+}
+
+func createTable(t *testing.T, client *Client, name string) string {
+	ctx := context.Background()
+	err := client.DynamoDB.CreateTable(ctx, &awsdynamodb.CreateTableInput{
+		AttributeDefinitions: []*awsdynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*awsdynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := client.DynamoDB.DynamoDB.DescribeTableWithContext(ctx, &awsdynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aws.StringValue(table.Table.TableArn)
+}
+
+// TestCreate creates a group that queries resources by tag.
+func TestCreate(t *testing.T) {
+	client, fake := newFakeClient()
+
+	newGroup(t, client, fake, "example")
+	group := fake.ResourceGroups.Groups["example"]
+	if group == nil || aws.StringValue(group.Query.Type) != resourcegroups.QueryTypeTagFilters10 {
+		t.Errorf("expected a group querying by tag, got %v", group)
+	}
+}
+
+// TestDeleteAllResources deletes each kind of resource in a group through its own client, skips a kind it does not
+// know, and then deletes the group.
+func TestDeleteAllResources(t *testing.T) {
+	ctx := context.Background()
+	client, fake := newFakeClient()
+	tableArn := createTable(t, client, "example")
+	_, err := client.ECR.CreateRepository(ctx, "example", ecr.RepositoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repositoryArn := aws.StringValue(fake.ECR.Repositories["example"].RepositoryArn)
+	fake.ECR.PushImage("example", "sha256:1", time.Now(), "latest")
+	fake.IAM.Roles["example"] = &awsiam.Role{
+		Arn:      aws.String("arn:aws:iam::123456789012:role/example"),
+		RoleName: aws.String("example"),
+	}
+	fake.IAM.AttachedPolicies["example"] = []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"}
+	fake.IAM.InlinePolicies["example"] = map[string]string{"logs": "{}"}
+	loadBalancer, err := fake.ELBV2.CreateLoadBalancerWithContext(ctx, &awselbv2.CreateLoadBalancerInput{
+		Name: aws.String("example"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newGroup(t, client, fake, "example",
+		resource("AWS::DynamoDB::Table", tableArn),
+		resource("AWS::ECR::Repository", repositoryArn),
+		resource("AWS::IAM::Role", "arn:aws:iam::123456789012:role/example"),
+		resource("AWS::ElasticLoadBalancingV2::LoadBalancer", aws.StringValue(loadBalancer.LoadBalancers[0].LoadBalancerArn)),
+		resource("AWS::S3::Bucket", "arn:aws:s3:::example"),
+	)
+
+	err = client.DeleteAllResources(ctx, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.DynamoDB.Tables) != 0 || len(fake.ECR.Repositories) != 0 || len(fake.IAM.Roles) != 0 || len(fake.ELBV2.LoadBalancers) != 0 {
+		t.Error("expected every resource to be deleted")
+	}
+	if len(fake.ResourceGroups.Groups) != 0 {
+		t.Error("the group was not deleted")
+	}
+}
+
+// TestDeleteAllResourcesStopsAtError checks that the first resource that cannot be deleted stops the deletion, leaving
+// the resources after it and the group in place.
+func TestDeleteAllResourcesStopsAtError(t *testing.T) {
+	client, fake := newFakeClient()
+	tableArn := createTable(t, client, "example")
+	newGroup(t, client, fake, "example",
+		resource("AWS::ECR::Repository", "arn:aws:ecr:us-east-1:123456789012:repository/missing"),
+		resource("AWS::DynamoDB::Table", tableArn),
+	)
+
+	err := client.DeleteAllResources(context.Background(), "example")
+	if err == nil {
+		t.Fatal("expected an error deleting a missing repository")
+	}
+	if len(fake.DynamoDB.Tables) != 1 || len(fake.ResourceGroups.Groups) != 1 {
+		t.Error("expected the table and the group to be left after the error")
+	}
+}
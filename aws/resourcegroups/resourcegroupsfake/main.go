@@ -0,0 +1,106 @@
+// Package resourcegroupsfake is an in-memory stand-in for the parts of the Resource Groups API used by the
+// github.com/PyramidSystemsInc/go/aws/resourcegroups package, so it can be unit tested offline.
+package resourcegroupsfake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/resourcegroups"
+	"github.com/aws/aws-sdk-go/service/resourcegroups/resourcegroupsiface"
+)
+
+// ResourceGroups keeps groups in memory, keyed by name. The fake does not evaluate resource queries,
+// so seed Group.Resources with the resources a group should list. Calling an operation that is not
+// implemented panics.
+type ResourceGroups struct {
+	resourcegroupsiface.ResourceGroupsAPI
+
+	mutex     sync.Mutex
+	Region    string
+	AccountID string
+	Groups    map[string]*Group
+}
+
+// Group is the state of one fake resource group.
+type Group struct {
+	Group     *resourcegroups.Group
+	Query     *resourcegroups.ResourceQuery
+	Resources []*resourcegroups.ResourceIdentifier
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *ResourceGroups {
+	return &ResourceGroups{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		Groups:    map[string]*Group{},
+	}
+}
+
+// CreateGroupWithContext creates an empty group.
+func (fake *ResourceGroups) CreateGroupWithContext(ctx aws.Context, input *resourcegroups.CreateGroupInput, opts ...request.Option) (*resourcegroups.CreateGroupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	if _, ok := fake.Groups[name]; ok {
+		return nil, awserr.New(resourcegroups.ErrCodeBadRequestException, "Cannot create group: group already exists", nil)
+	}
+	group := &Group{
+		Group: &resourcegroups.Group{
+			Description: input.Description,
+			GroupArn:    aws.String(fmt.Sprintf("arn:aws:resource-groups:%s:%s:group/%s", fake.Region, fake.AccountID, name)),
+			Name:        aws.String(name),
+		},
+		Query: input.ResourceQuery,
+	}
+	fake.Groups[name] = group
+	return &resourcegroups.CreateGroupOutput{
+		Group:         group.Group,
+		ResourceQuery: group.Query,
+	}, nil
+}
+
+// DeleteGroupWithContext deletes a group, leaving its resources alone.
+func (fake *ResourceGroups) DeleteGroupWithContext(ctx aws.Context, input *resourcegroups.DeleteGroupInput, opts ...request.Option) (*resourcegroups.DeleteGroupOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	group, err := fake.group(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	delete(fake.Groups, aws.StringValue(group.Group.Name))
+	return &resourcegroups.DeleteGroupOutput{
+		Group: group.Group,
+	}, nil
+}
+
+// ListGroupResourcesWithContext lists the seeded resources of a group.
+func (fake *ResourceGroups) ListGroupResourcesWithContext(ctx aws.Context, input *resourcegroups.ListGroupResourcesInput, opts ...request.Option) (*resourcegroups.ListGroupResourcesOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	group, err := fake.group(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	output := &resourcegroups.ListGroupResourcesOutput{
+		ResourceIdentifiers: group.Resources,
+	}
+	for _, resource := range group.Resources {
+		output.Resources = append(output.Resources, &resourcegroups.ListGroupResourcesItem{
+			Identifier: resource,
+		})
+	}
+	return output, nil
+}
+
+func (fake *ResourceGroups) group(name *string) (*Group, error) {
+	group, ok := fake.Groups[aws.StringValue(name)]
+	if !ok {
+		return nil, awserr.New(resourcegroups.ErrCodeNotFoundException, "Cannot find group "+aws.StringValue(name)+".", nil)
+	}
+	return group, nil
+}
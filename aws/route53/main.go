@@ -1,39 +1,87 @@
 package route53
 
 import (
+  "context"
   "time"
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/route53"
+  "github.com/aws/aws-sdk-go/service/route53/route53iface"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/str"
 )
 
+// Client - Manages hosted zones and their records through Route 53
+type Client struct {
+  Route53 route53iface.Route53API
+}
+
+// New - Returns a Client that talks to AWS using the given session
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    Route53: route53.New(awsSession),
+  }
+}
+
 func CreateHostedZone(domainName string, awsSession *session.Session) []string {
-  route53Client := route53.New(awsSession)
-  result, err := route53Client.CreateHostedZone(&route53.CreateHostedZoneInput{
+  nameServers, err := CreateHostedZoneE(domainName, awsSession)
+  errors.QuitIfError(err)
+  return nameServers
+}
+
+// CreateHostedZoneE - Creates a hosted zone and returns its name servers, or an error
+func CreateHostedZoneE(domainName string, awsSession *session.Session) ([]string, error) {
+  return CreateHostedZoneWithContext(context.Background(), domainName, awsSession)
+}
+
+// CreateHostedZoneWithContext - CreateHostedZoneE with a context to allow cancellation
+func CreateHostedZoneWithContext(ctx context.Context, domainName string, awsSession *session.Session) ([]string, error) {
+  return New(awsSession).CreateHostedZone(ctx, domainName)
+}
+
+// CreateHostedZone - Creates a hosted zone and returns its name servers, or an error
+func (client *Client) CreateHostedZone(ctx context.Context, domainName string) ([]string, error) {
+  result, err := client.Route53.CreateHostedZoneWithContext(ctx, &route53.CreateHostedZoneInput{
     CallerReference: aws.String(time.Now().String()),
     Name: aws.String(domainName),
   })
-  errors.LogIfError(err)
+  if err != nil {
+    return nil, err
+  }
   nameServers := make([]string, 0)
   for _, nameServer := range result.DelegationSet.NameServers {
     nameServers = append(nameServers, *nameServer)
   }
-  return nameServers
+  return nameServers, nil
 }
 
 func ChangeRecord(domainName string, recordType string, recordName string, records []string, ttl int64, awsSession *session.Session) {
-  route53Client := route53.New(awsSession)
-  hostedZoneId, err := findDomainNameId(domainName, route53Client)
-  errors.LogIfError(err)
+  errors.QuitIfError(ChangeRecordE(domainName, recordType, recordName, records, ttl, awsSession))
+}
+
+// ChangeRecordE - Creates or updates a record in the hosted zone of `domainName`, returning any error
+func ChangeRecordE(domainName string, recordType string, recordName string, records []string, ttl int64, awsSession *session.Session) error {
+  return ChangeRecordWithContext(context.Background(), domainName, recordType, recordName, records, ttl, awsSession)
+}
+
+// ChangeRecordWithContext - ChangeRecordE with a context to allow cancellation
+func ChangeRecordWithContext(ctx context.Context, domainName string, recordType string, recordName string, records []string, ttl int64, awsSession *session.Session) error {
+  return New(awsSession).ChangeRecord(ctx, domainName, recordType, recordName, records, ttl)
+}
+
+// ChangeRecord - Creates or updates a record in the hosted zone of `domainName`, returning any error
+func (client *Client) ChangeRecord(ctx context.Context, domainName string, recordType string, recordName string, records []string, ttl int64) error {
+  hostedZoneId, err := client.findDomainNameId(ctx, domainName)
+  if err != nil {
+    return err
+  }
   resourceRecords := make([]*route53.ResourceRecord, 0)
   for _, record := range records {
     resourceRecords = append(resourceRecords, &route53.ResourceRecord{
       Value: aws.String(record),
     })
   }
-  _, err = route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+  _, err = client.Route53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
     ChangeBatch: &route53.ChangeBatch{
       Changes: []*route53.Change{
         {
@@ -49,80 +97,132 @@ func ChangeRecord(domainName string, recordType string, recordName string, recor
     },
     HostedZoneId: aws.String(hostedZoneId),
   })
-  errors.QuitIfError(err)
+  return err
 }
 
 func DeleteHostedZone(domainName string, awsSession *session.Session) {
-  route53Client := route53.New(awsSession)
-  hostedZoneId, _ := findDomainNameId(domainName, route53Client)
-  if hostedZoneId != "" {
-    listResult, err := route53Client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
-      HostedZoneId: aws.String(hostedZoneId),
-    })
-    errors.LogIfError(err)
-    records := listResult.ResourceRecordSets
-    var batchChanges []*route53.Change
-    for _, record := range records {
-      if *record.Type != "SOA" && *record.Type != "NS" {
-        batchChanges = append(batchChanges, &route53.Change{
-          Action: aws.String("DELETE"),
-          ResourceRecordSet: record,
-        })
-      }
-    }
-    if len(batchChanges) > 0 {
-      _, err = route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
-        ChangeBatch: &route53.ChangeBatch{
-          Changes: batchChanges,
-          Comment: aws.String("Deleted record(s) as part of call to PyramidSystemsInc/go/aws/route53/DeleteHostedZone"),
-        },
-        HostedZoneId: aws.String(hostedZoneId),
+  errors.LogIfError(DeleteHostedZoneE(domainName, awsSession))
+}
+
+// DeleteHostedZoneE - Deletes every record of a hosted zone and then the zone itself, returning any error. A zone that cannot be found is ignored
+func DeleteHostedZoneE(domainName string, awsSession *session.Session) error {
+  return DeleteHostedZoneWithContext(context.Background(), domainName, awsSession)
+}
+
+// DeleteHostedZoneWithContext - DeleteHostedZoneE with a context to allow cancellation
+func DeleteHostedZoneWithContext(ctx context.Context, domainName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteHostedZone(ctx, domainName)
+}
+
+// DeleteHostedZone - Deletes every record of a hosted zone and then the zone itself, returning any error. A zone that cannot be found is ignored
+func (client *Client) DeleteHostedZone(ctx context.Context, domainName string) error {
+  hostedZoneId, _ := client.findDomainNameId(ctx, domainName)
+  if hostedZoneId == "" {
+    return nil
+  }
+  listResult, err := client.Route53.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+    HostedZoneId: aws.String(hostedZoneId),
+  })
+  if err != nil {
+    return err
+  }
+  records := listResult.ResourceRecordSets
+  var batchChanges []*route53.Change
+  for _, record := range records {
+    if *record.Type != "SOA" && *record.Type != "NS" {
+      batchChanges = append(batchChanges, &route53.Change{
+        Action: aws.String("DELETE"),
+        ResourceRecordSet: record,
       })
-      errors.LogIfError(err)
     }
-    _, err = route53Client.DeleteHostedZone(&route53.DeleteHostedZoneInput{
-      Id: aws.String(hostedZoneId),
+  }
+  if len(batchChanges) > 0 {
+    _, err = client.Route53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+      ChangeBatch: &route53.ChangeBatch{
+        Changes: batchChanges,
+        Comment: aws.String("Deleted record(s) as part of call to PyramidSystemsInc/go/aws/route53/DeleteHostedZone"),
+      },
+      HostedZoneId: aws.String(hostedZoneId),
     })
-    errors.LogIfError(err)
+    if err != nil {
+      return err
+    }
   }
+  _, err = client.Route53.DeleteHostedZoneWithContext(ctx, &route53.DeleteHostedZoneInput{
+    Id: aws.String(hostedZoneId),
+  })
+  return err
 }
 
 func DeleteRecord(domainName string, recordName string, awsSession *session.Session) {
-  route53Client := route53.New(awsSession)
-  hostedZoneId, _ := findDomainNameId(domainName, route53Client)
-  if hostedZoneId != "" {
-    listResult, err := route53Client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
-      HostedZoneId: aws.String(hostedZoneId),
-    })
-    errors.LogIfError(err)
-    records := listResult.ResourceRecordSets
-    var batchChanges []*route53.Change
-    for _, record := range records {
-      if *record.Name == recordName {
-        batchChanges = append(batchChanges, &route53.Change{
-          Action: aws.String("DELETE"),
-          ResourceRecordSet: record,
-        })
-      }
-    }
-    if len(batchChanges) > 0 {
-      _, err = route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
-        ChangeBatch: &route53.ChangeBatch{
-          Changes: batchChanges,
-          Comment: aws.String("Deleted record(s) as part of call to PyramidSystemsInc/go/aws/route53/DeleteRecord"),
-        },
-        HostedZoneId: aws.String(hostedZoneId),
+  errors.LogIfError(DeleteRecordE(domainName, recordName, awsSession))
+}
+
+// DeleteRecordE - Deletes all records named `recordName` in the hosted zone of `domainName`, returning any error
+func DeleteRecordE(domainName string, recordName string, awsSession *session.Session) error {
+  return DeleteRecordWithContext(context.Background(), domainName, recordName, awsSession)
+}
+
+// DeleteRecordWithContext - DeleteRecordE with a context to allow cancellation
+func DeleteRecordWithContext(ctx context.Context, domainName string, recordName string, awsSession *session.Session) error {
+  return New(awsSession).DeleteRecord(ctx, domainName, recordName)
+}
+
+// DeleteRecord - Deletes all records named `recordName` in the hosted zone of `domainName`, returning any error
+func (client *Client) DeleteRecord(ctx context.Context, domainName string, recordName string) error {
+  hostedZoneId, _ := client.findDomainNameId(ctx, domainName)
+  if hostedZoneId == "" {
+    return nil
+  }
+  listResult, err := client.Route53.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+    HostedZoneId: aws.String(hostedZoneId),
+  })
+  if err != nil {
+    return err
+  }
+  records := listResult.ResourceRecordSets
+  var batchChanges []*route53.Change
+  for _, record := range records {
+    if *record.Name == recordName {
+      batchChanges = append(batchChanges, &route53.Change{
+        Action: aws.String("DELETE"),
+        ResourceRecordSet: record,
       })
-      errors.LogIfError(err)
     }
   }
+  if len(batchChanges) > 0 {
+    _, err = client.Route53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+      ChangeBatch: &route53.ChangeBatch{
+        Changes: batchChanges,
+        Comment: aws.String("Deleted record(s) as part of call to PyramidSystemsInc/go/aws/route53/DeleteRecord"),
+      },
+      HostedZoneId: aws.String(hostedZoneId),
+    })
+  }
+  return err
 }
 
 func TagHostedZone(domainName string, key string, value string, awsSession *session.Session) {
-  route53Client := route53.New(awsSession)
-  id, err := findDomainNameId(domainName, route53Client)
-  errors.QuitIfError(err)
-  _, err = route53Client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+  errors.QuitIfError(TagHostedZoneE(domainName, key, value, awsSession))
+}
+
+// TagHostedZoneE - Adds a tag to the hosted zone of `domainName`, returning any error
+func TagHostedZoneE(domainName string, key string, value string, awsSession *session.Session) error {
+  return TagHostedZoneWithContext(context.Background(), domainName, key, value, awsSession)
+}
+
+// TagHostedZoneWithContext - TagHostedZoneE with a context to allow cancellation
+func TagHostedZoneWithContext(ctx context.Context, domainName string, key string, value string, awsSession *session.Session) error {
+  return New(awsSession).TagHostedZone(ctx, domainName, key, value)
+}
+
+// TagHostedZone - Adds a tag to the hosted zone of `domainName`, returning any error
+func (client *Client) TagHostedZone(ctx context.Context, domainName string, key string, value string) error {
+  id, err := client.findDomainNameId(ctx, domainName)
+  if err != nil {
+    return err
+  }
+  _, err = client.Route53.ChangeTagsForResourceWithContext(ctx, &route53.ChangeTagsForResourceInput{
     AddTags: []*route53.Tag{
       &route53.Tag{
         Key: aws.String(key),
@@ -132,20 +232,22 @@ func TagHostedZone(domainName string, key string, value string, awsSession *sess
     ResourceId: aws.String(id),
     ResourceType: aws.String("hostedzone"),
   })
-  errors.LogIfError(err)
+  return err
 }
 
 func domainNamesMatch(domainNameA string, domainNameB string) bool {
   return domainNameA == domainNameB || domainNameA == str.Concat(domainNameB, ".") || str.Concat(domainNameA, ".") == domainNameB
 }
 
-func findDomainNameId(domainName string, route53Client *route53.Route53) (string, error) {
-  result, err := route53Client.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+func (client *Client) findDomainNameId(ctx context.Context, domainName string) (string, error) {
+  result, err := client.Route53.ListHostedZonesByNameWithContext(ctx, &route53.ListHostedZonesByNameInput{
     DNSName: aws.String(domainName),
     MaxItems: aws.String("1"),
   })
-  errors.QuitIfError(err)
-  if domainNamesMatch(*result.HostedZones[0].Name, domainName) {
+  if err != nil {
+    return "", err
+  }
+  if len(result.HostedZones) > 0 && domainNamesMatch(*result.HostedZones[0].Name, domainName) {
     return *result.HostedZones[0].Id, nil
   } else {
     return "", errors.New("Domain name provided could not be found")
@@ -0,0 +1,124 @@
+package route53
+
+import (
+  "context"
+  "testing"
+
+  "github.com/PyramidSystemsInc/go/aws/route53/route53fake"
+  "github.com/aws/aws-sdk-go/aws"
+)
+
+func newFakeClient(t *testing.T, domainName string) (*Client, *route53fake.Route53) {
+  fake := route53fake.New()
+  client := &Client{Route53: fake}
+  _, err := client.CreateHostedZone(context.Background(), domainName)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return client, fake
+}
+
+// TestCreateHostedZone creates a hosted zone and checks that its name servers are returned.
+func TestCreateHostedZone(t *testing.T) {
+  fake := route53fake.New()
+  client := &Client{Route53: fake}
+
+  nameServers, err := client.CreateHostedZone(context.Background(), "example.com")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(fake.HostedZones) != 1 || len(nameServers) != 4 {
+    t.Errorf("expected one hosted zone with 4 name servers, got %d zones and %v", len(fake.HostedZones), nameServers)
+  }
+}
+
+// TestChangeRecord creates a record and then changes its value in place.
+func TestChangeRecord(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient(t, "example.com")
+
+  err := client.ChangeRecord(ctx, "example.com", "A", "www.example.com.", []string{"10.0.0.1"}, 300)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.ChangeRecord(ctx, "example.com.", "A", "www.example.com.", []string{"10.0.0.2"}, 60)
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, zone := range fake.HostedZones {
+    if len(zone.Records) != 3 || aws.StringValue(zone.Records[2].ResourceRecords[0].Value) != "10.0.0.2" {
+      t.Errorf("expected the record to be changed in place, got %v", zone.Records)
+    }
+  }
+}
+
+// TestChangeRecordMissingZone checks that a record is not changed in a domain without a hosted zone.
+func TestChangeRecordMissingZone(t *testing.T) {
+  client, _ := newFakeClient(t, "example.com")
+
+  err := client.ChangeRecord(context.Background(), "example.org", "A", "www.example.org.", []string{"10.0.0.1"}, 300)
+  if err == nil {
+    t.Error("expected an error for a domain without a hosted zone")
+  }
+}
+
+// TestDeleteRecord deletes the records of a name and leaves the others.
+func TestDeleteRecord(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient(t, "example.com")
+  for _, recordType := range []string{"A", "AAAA"} {
+    err := client.ChangeRecord(ctx, "example.com", recordType, "www.example.com.", []string{"10.0.0.1"}, 300)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  err := client.ChangeRecord(ctx, "example.com", "A", "api.example.com.", []string{"10.0.0.3"}, 300)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  err = client.DeleteRecord(ctx, "example.com", "www.example.com.")
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, zone := range fake.HostedZones {
+    if len(zone.Records) != 3 || aws.StringValue(zone.Records[2].Name) != "api.example.com." {
+      t.Errorf("expected the api record alone to be left, got %v", zone.Records)
+    }
+  }
+}
+
+// TestDeleteHostedZone deletes a hosted zone holding records, and then ignores the zone that is gone.
+func TestDeleteHostedZone(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient(t, "example.com")
+  err := client.ChangeRecord(ctx, "example.com", "A", "www.example.com.", []string{"10.0.0.1"}, 300)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for i := 0; i < 2; i++ {
+    err = client.DeleteHostedZone(ctx, "example.com")
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if len(fake.HostedZones) != 0 {
+    t.Error("the hosted zone was not deleted")
+  }
+}
+
+// TestTagHostedZone tags the hosted zone of a domain.
+func TestTagHostedZone(t *testing.T) {
+  client, fake := newFakeClient(t, "example.com")
+
+  err := client.TagHostedZone(context.Background(), "example.com", "pac-project", "example")
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, zone := range fake.HostedZones {
+    if len(zone.Tags) != 1 || aws.StringValue(zone.Tags[0].Value) != "example" {
+      t.Errorf("unexpected tags %v", zone.Tags)
+    }
+  }
+}
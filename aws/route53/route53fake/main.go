@@ -0,0 +1,251 @@
+// Package route53fake is an in-memory stand-in for the parts of the Route 53 API used by the
+// github.com/PyramidSystemsInc/go/aws/route53 package, so it can be unit tested offline.
+package route53fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+)
+
+// Route53 keeps hosted zones and their records in memory. New zones get an SOA and an NS record,
+// like real ones. Calling an operation that is not implemented panics.
+type Route53 struct {
+	route53iface.Route53API
+
+	mutex       sync.Mutex
+	counter     int
+	HostedZones map[string]*HostedZone
+}
+
+// HostedZone is the state of one fake hosted zone, keyed by its id in Route53.HostedZones.
+type HostedZone struct {
+	Zone        *route53.HostedZone
+	NameServers []string
+	Records     []*route53.ResourceRecordSet
+	Tags        []*route53.Tag
+}
+
+// New returns a fake without hosted zones.
+func New() *Route53 {
+	return &Route53{
+		HostedZones: map[string]*HostedZone{},
+	}
+}
+
+// CreateHostedZoneWithContext creates a hosted zone with four name servers.
+func (fake *Route53) CreateHostedZoneWithContext(ctx aws.Context, input *route53.CreateHostedZoneInput, opts ...request.Option) (*route53.CreateHostedZoneOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := fqdn(aws.StringValue(input.Name))
+	fake.counter++
+	id := fmt.Sprintf("/hostedzone/Z%013d", fake.counter)
+	var nameServers []string
+	var nameServerRecords []*route53.ResourceRecord
+	for i := 1; i <= 4; i++ {
+		nameServer := fmt.Sprintf("ns-%d.awsdns-%02d.example.", fake.counter*4+i, i)
+		nameServers = append(nameServers, nameServer)
+		nameServerRecords = append(nameServerRecords, &route53.ResourceRecord{
+			Value: aws.String(nameServer),
+		})
+	}
+	zone := &HostedZone{
+		Zone: &route53.HostedZone{
+			CallerReference:        input.CallerReference,
+			Id:                     aws.String(id),
+			Name:                   aws.String(name),
+			ResourceRecordSetCount: aws.Int64(2),
+		},
+		NameServers: nameServers,
+		Records: []*route53.ResourceRecordSet{
+			{
+				Name:            aws.String(name),
+				ResourceRecords: nameServerRecords,
+				TTL:             aws.Int64(172800),
+				Type:            aws.String(route53.RRTypeNs),
+			},
+			{
+				Name: aws.String(name),
+				ResourceRecords: []*route53.ResourceRecord{
+					{
+						Value: aws.String(nameServers[0] + " awsdns-hostmaster.amazon.com. 1 7200 900 1209600 86400"),
+					},
+				},
+				TTL:  aws.Int64(900),
+				Type: aws.String(route53.RRTypeSoa),
+			},
+		},
+	}
+	fake.HostedZones[id] = zone
+	return &route53.CreateHostedZoneOutput{
+		DelegationSet: &route53.DelegationSet{
+			NameServers: aws.StringSlice(nameServers),
+		},
+		HostedZone: zone.Zone,
+	}, nil
+}
+
+// DeleteHostedZoneWithContext deletes a hosted zone that only holds its SOA and NS records.
+func (fake *Route53) DeleteHostedZoneWithContext(ctx aws.Context, input *route53.DeleteHostedZoneInput, opts ...request.Option) (*route53.DeleteHostedZoneOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	zone, err := fake.hostedZone(input.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range zone.Records {
+		recordType := aws.StringValue(record.Type)
+		if recordType != route53.RRTypeSoa && recordType != route53.RRTypeNs {
+			return nil, awserr.New(route53.ErrCodeHostedZoneNotEmpty, "The specified hosted zone contains non-required resource record sets and so cannot be deleted.", nil)
+		}
+	}
+	delete(fake.HostedZones, aws.StringValue(zone.Zone.Id))
+	return &route53.DeleteHostedZoneOutput{}, nil
+}
+
+// ListHostedZonesByNameWithContext lists hosted zones ordered by name, starting at input.DNSName.
+func (fake *Route53) ListHostedZonesByNameWithContext(ctx aws.Context, input *route53.ListHostedZonesByNameInput, opts ...request.Option) (*route53.ListHostedZonesByNameOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var zones []*route53.HostedZone
+	for _, zone := range fake.HostedZones {
+		zones = append(zones, zone.Zone)
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		return aws.StringValue(zones[i].Name) < aws.StringValue(zones[j].Name)
+	})
+	if input.DNSName != nil {
+		start := fqdn(aws.StringValue(input.DNSName))
+		for len(zones) > 0 && aws.StringValue(zones[0].Name) < start {
+			zones = zones[1:]
+		}
+	}
+	maxItems := 100
+	if input.MaxItems != nil {
+		fmt.Sscan(aws.StringValue(input.MaxItems), &maxItems)
+	}
+	truncated := len(zones) > maxItems
+	if truncated {
+		zones = zones[:maxItems]
+	}
+	return &route53.ListHostedZonesByNameOutput{
+		DNSName:     input.DNSName,
+		HostedZones: zones,
+		IsTruncated: aws.Bool(truncated),
+		MaxItems:    input.MaxItems,
+	}, nil
+}
+
+// ListResourceRecordSetsWithContext returns every record in the hosted zone.
+func (fake *Route53) ListResourceRecordSetsWithContext(ctx aws.Context, input *route53.ListResourceRecordSetsInput, opts ...request.Option) (*route53.ListResourceRecordSetsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	zone, err := fake.hostedZone(input.HostedZoneId)
+	if err != nil {
+		return nil, err
+	}
+	return &route53.ListResourceRecordSetsOutput{
+		IsTruncated:        aws.Bool(false),
+		ResourceRecordSets: zone.Records,
+	}, nil
+}
+
+// ChangeResourceRecordSetsWithContext applies CREATE, UPSERT and DELETE changes. The batch is
+// validated before anything is changed, so it either applies completely or not at all.
+func (fake *Route53) ChangeResourceRecordSetsWithContext(ctx aws.Context, input *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	zone, err := fake.hostedZone(input.HostedZoneId)
+	if err != nil {
+		return nil, err
+	}
+	records := append([]*route53.ResourceRecordSet{}, zone.Records...)
+	for _, change := range input.ChangeBatch.Changes {
+		record := change.ResourceRecordSet
+		index := -1
+		for i, existing := range records {
+			if fqdn(aws.StringValue(existing.Name)) == fqdn(aws.StringValue(record.Name)) && aws.StringValue(existing.Type) == aws.StringValue(record.Type) {
+				index = i
+			}
+		}
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if index >= 0 {
+				return nil, awserr.New(route53.ErrCodeInvalidChangeBatch, "Tried to create resource record set but it already exists", nil)
+			}
+			records = append(records, record)
+		case route53.ChangeActionUpsert:
+			if index >= 0 {
+				records[index] = record
+			} else {
+				records = append(records, record)
+			}
+		case route53.ChangeActionDelete:
+			if index < 0 {
+				return nil, awserr.New(route53.ErrCodeInvalidChangeBatch, "Tried to delete resource record set but it was not found", nil)
+			}
+			records = append(records[:index], records[index+1:]...)
+		}
+	}
+	zone.Records = records
+	zone.Zone.ResourceRecordSetCount = aws.Int64(int64(len(records)))
+	fake.counter++
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Comment: input.ChangeBatch.Comment,
+			Id:      aws.String(fmt.Sprintf("/change/C%013d", fake.counter)),
+			Status:  aws.String(route53.ChangeStatusInsync),
+		},
+	}, nil
+}
+
+// ChangeTagsForResourceWithContext adds and removes tags of a hosted zone.
+func (fake *Route53) ChangeTagsForResourceWithContext(ctx aws.Context, input *route53.ChangeTagsForResourceInput, opts ...request.Option) (*route53.ChangeTagsForResourceOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	zone, err := fake.hostedZone(input.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	var tags []*route53.Tag
+	for _, tag := range zone.Tags {
+		removed := false
+		for _, key := range input.RemoveTagKeys {
+			removed = removed || aws.StringValue(key) == aws.StringValue(tag.Key)
+		}
+		for _, added := range input.AddTags {
+			removed = removed || aws.StringValue(added.Key) == aws.StringValue(tag.Key)
+		}
+		if !removed {
+			tags = append(tags, tag)
+		}
+	}
+	zone.Tags = append(tags, input.AddTags...)
+	return &route53.ChangeTagsForResourceOutput{}, nil
+}
+
+func (fake *Route53) hostedZone(id *string) (*HostedZone, error) {
+	zoneId := aws.StringValue(id)
+	if !strings.HasPrefix(zoneId, "/hostedzone/") {
+		zoneId = "/hostedzone/" + zoneId
+	}
+	zone, ok := fake.HostedZones[zoneId]
+	if !ok {
+		return nil, awserr.New(route53.ErrCodeNoSuchHostedZone, "No hosted zone found with ID: "+aws.StringValue(id), nil)
+	}
+	return zone, nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
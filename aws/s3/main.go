@@ -1,6 +1,8 @@
 package s3
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -9,15 +11,35 @@ import (
 	"github.com/PyramidSystemsInc/go/errors"
 	"github.com/PyramidSystemsInc/go/logger"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 )
 
+// Client creates, empties and deletes buckets and sets up their website hosting, versioning and encryption.
+type Client struct {
+	S3 s3iface.S3API
+}
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+	return &Client{
+		S3: s3.New(awsSession),
+	}
+}
+
 // MakeBucket The allowed values for the `access` parameter can be found here: https://docs.aws.amazon.com/AmazonS3/latest/dev/acl-overview.html#canned-acl
 func MakeBucket(bucketName string, access string, region string, awsSession *session.Session) error {
-	s3Client := s3.New(awsSession)
+	return MakeBucketWithContext(context.Background(), bucketName, access, region, awsSession)
+}
+
+// MakeBucketWithContext is MakeBucket with a context to allow cancellation.
+func MakeBucketWithContext(ctx context.Context, bucketName string, access string, region string, awsSession *session.Session) error {
+	return New(awsSession).MakeBucket(ctx, bucketName, access, region)
+}
 
+// MakeBucket creates a bucket with the canned ACL `access` in the region.
+func (client *Client) MakeBucket(ctx context.Context, bucketName string, access string, region string) error {
 	// AWS S3 SDK doesn't accept us-east-1 as region, if the LocationConstraint is set to an empty string or in this case
 	// the CreateBucketConfiguration is left out altogether because it had no other values it will then create the bucket
 	// in the us-east-1 region by default.
@@ -25,7 +47,7 @@ func MakeBucket(bucketName string, access string, region string, awsSession *ses
 	// https://docs.aws.amazon.com/sdk-for-go/api/service/s3/#CreateBucketConfiguration
 
 	if region == "us-east-1" {
-		_, err := s3Client.CreateBucket(&s3.CreateBucketInput{
+		_, err := client.S3.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
 			ACL:                        aws.String(access),
 			Bucket:                     aws.String(bucketName),
 			ObjectLockEnabledForBucket: aws.Bool(false),
@@ -34,7 +56,7 @@ func MakeBucket(bucketName string, access string, region string, awsSession *ses
 		return err
 	}
 
-	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{
+	_, err := client.S3.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
 		ACL:    aws.String(access),
 		Bucket: aws.String(bucketName),
 		CreateBucketConfiguration: &s3.CreateBucketConfiguration{
@@ -47,22 +69,60 @@ func MakeBucket(bucketName string, access string, region string, awsSession *ses
 }
 
 func DeleteBucket(bucketNameOrArn string, awsSession *session.Session) {
+	errors.QuitIfError(DeleteBucketE(bucketNameOrArn, awsSession))
+}
+
+// DeleteBucketE deletes every object version and delete marker in the bucket and then the bucket itself, returning any error.
+func DeleteBucketE(bucketNameOrArn string, awsSession *session.Session) error {
+	return DeleteBucketWithContext(context.Background(), bucketNameOrArn, awsSession)
+}
+
+// DeleteBucketWithContext is DeleteBucketE with a context to allow cancellation.
+func DeleteBucketWithContext(ctx context.Context, bucketNameOrArn string, awsSession *session.Session) error {
+	return New(awsSession).DeleteBucket(ctx, bucketNameOrArn)
+}
+
+// DeleteBucket deletes every object version in the bucket, then the delete markers left behind, which S3 will not delete
+// a bucket with, and then the bucket itself, returning any error.
+func (client *Client) DeleteBucket(ctx context.Context, bucketNameOrArn string) error {
 	bucketName := getBucketName(bucketNameOrArn)
-	DeleteAllObjectVersions(bucketName, awsSession)
-	s3Client := s3.New(awsSession)
-	_, err := s3Client.DeleteBucket(&s3.DeleteBucketInput{
+	err := client.DeleteAllObjectVersions(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	err = client.DeleteAllDeleteMarkers(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	_, err = client.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
 		Bucket: aws.String(bucketName),
 	})
-	errors.QuitIfError(err)
+	return err
 }
 
 func EmptyBucket(bucketNameOrArn string, awsSession *session.Session) {
+	errors.QuitIfError(EmptyBucketE(bucketNameOrArn, awsSession))
+}
+
+// EmptyBucketE deletes the current objects in the bucket, returning any error.
+func EmptyBucketE(bucketNameOrArn string, awsSession *session.Session) error {
+	return EmptyBucketWithContext(context.Background(), bucketNameOrArn, awsSession)
+}
+
+// EmptyBucketWithContext is EmptyBucketE with a context to allow cancellation.
+func EmptyBucketWithContext(ctx context.Context, bucketNameOrArn string, awsSession *session.Session) error {
+	return New(awsSession).EmptyBucket(ctx, bucketNameOrArn)
+}
+
+// EmptyBucket deletes the current objects in the bucket, returning any error.
+func (client *Client) EmptyBucket(ctx context.Context, bucketNameOrArn string) error {
 	bucketName := getBucketName(bucketNameOrArn)
-	s3Client := s3.New(awsSession)
-	bucketObjects, err := s3Client.ListObjects(&s3.ListObjectsInput{
+	bucketObjects, err := client.S3.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
 		Bucket: aws.String(bucketName),
 	})
-	errors.QuitIfError(err)
+	if err != nil {
+		return err
+	}
 	bucketContents := bucketObjects.Contents
 	objectIdentifiers := make([]*s3.ObjectIdentifier, 0)
 	for _, file := range bucketContents {
@@ -70,19 +130,37 @@ func EmptyBucket(bucketNameOrArn string, awsSession *session.Session) {
 			Key: file.Key,
 		})
 	}
-	_, err = s3Client.DeleteObjects(&s3.DeleteObjectsInput{
+	if len(objectIdentifiers) == 0 {
+		return nil
+	}
+	_, err = client.S3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
 		Bucket: aws.String(bucketName),
 		Delete: &s3.Delete{
 			Objects: objectIdentifiers,
 			Quiet:   aws.Bool(true),
 		},
 	})
+	return err
 }
 
 func EnableWebsiteHosting(bucketName string, awsSession *session.Session) {
-	s3Client := s3.New(awsSession)
+	errors.QuitIfError(EnableWebsiteHostingE(bucketName, awsSession))
+}
+
+// EnableWebsiteHostingE serves the bucket as a website with index.html as the index and error document, returning any error.
+func EnableWebsiteHostingE(bucketName string, awsSession *session.Session) error {
+	return EnableWebsiteHostingWithContext(context.Background(), bucketName, awsSession)
+}
+
+// EnableWebsiteHostingWithContext is EnableWebsiteHostingE with a context to allow cancellation.
+func EnableWebsiteHostingWithContext(ctx context.Context, bucketName string, awsSession *session.Session) error {
+	return New(awsSession).EnableWebsiteHosting(ctx, bucketName)
+}
+
+// EnableWebsiteHosting serves the bucket as a website with index.html as the index and error document, returning any error.
+func (client *Client) EnableWebsiteHosting(ctx context.Context, bucketName string) error {
 	documentName := "index.html"
-	_, err := s3Client.PutBucketWebsite(&s3.PutBucketWebsiteInput{
+	_, err := client.S3.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
 		Bucket: aws.String(bucketName),
 		WebsiteConfiguration: &s3.WebsiteConfiguration{
 			ErrorDocument: &s3.ErrorDocument{
@@ -93,12 +171,26 @@ func EnableWebsiteHosting(bucketName string, awsSession *session.Session) {
 			},
 		},
 	})
-	errors.QuitIfError(err)
+	return err
 }
 
 func TagBucket(bucketName string, key string, value string, awsSession *session.Session) {
-	s3Client := s3.New(awsSession)
-	_, err := s3Client.PutBucketTagging(&s3.PutBucketTaggingInput{
+	errors.QuitIfError(TagBucketE(bucketName, key, value, awsSession))
+}
+
+// TagBucketE replaces the tags of the bucket with the single key/value pair, returning any error.
+func TagBucketE(bucketName string, key string, value string, awsSession *session.Session) error {
+	return TagBucketWithContext(context.Background(), bucketName, key, value, awsSession)
+}
+
+// TagBucketWithContext is TagBucketE with a context to allow cancellation.
+func TagBucketWithContext(ctx context.Context, bucketName string, key string, value string, awsSession *session.Session) error {
+	return New(awsSession).TagBucket(ctx, bucketName, key, value)
+}
+
+// TagBucket replaces the tags of the bucket with the single key/value pair, returning any error.
+func (client *Client) TagBucket(ctx context.Context, bucketName string, key string, value string) error {
+	_, err := client.S3.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
 		Bucket: aws.String(bucketName),
 		Tagging: &s3.Tagging{
 			TagSet: []*s3.Tag{
@@ -109,7 +201,36 @@ func TagBucket(bucketName string, key string, value string, awsSession *session.
 			},
 		},
 	})
+	return err
+}
+
+func Upload(bucketName string, key string, data []byte, awsSession *session.Session) string {
+	versionId, err := UploadE(bucketName, key, data, awsSession)
 	errors.QuitIfError(err)
+	return versionId
+}
+
+// UploadE stores data as an object of the bucket and returns its version ID (empty when versioning is off), or an error.
+func UploadE(bucketName string, key string, data []byte, awsSession *session.Session) (string, error) {
+	return UploadWithContext(context.Background(), bucketName, key, data, awsSession)
+}
+
+// UploadWithContext is UploadE with a context to allow cancellation.
+func UploadWithContext(ctx context.Context, bucketName string, key string, data []byte, awsSession *session.Session) (string, error) {
+	return New(awsSession).Upload(ctx, bucketName, key, data)
+}
+
+// Upload stores data as an object of the bucket and returns its version ID (empty when versioning is off), or an error.
+func (client *Client) Upload(ctx context.Context, bucketName string, key string, data []byte) (string, error) {
+	result, err := client.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:   bytes.NewReader(data),
+		Bucket: aws.String(getBucketName(bucketName)),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(result.VersionId), nil
 }
 
 func getBucketName(arnOrName string) string {
@@ -122,18 +243,7 @@ func getBucketName(arnOrName string) string {
 
 // EncryptBucket turns on encryption on the S3 bucket
 func EncryptBucket(bucket, key string) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	svc := s3.New(sess)
-
-	defEnc := &s3.ServerSideEncryptionByDefault{KMSMasterKeyID: aws.String(key), SSEAlgorithm: aws.String(s3.ServerSideEncryptionAwsKms)}
-	rule := &s3.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: defEnc}
-	rules := []*s3.ServerSideEncryptionRule{rule}
-	serverConfig := &s3.ServerSideEncryptionConfiguration{Rules: rules}
-	input := &s3.PutBucketEncryptionInput{Bucket: aws.String(bucket), ServerSideEncryptionConfiguration: serverConfig}
-	_, err := svc.PutBucketEncryption(input)
+	err := EncryptBucketE(bucket, key)
 	if err != nil {
 		fmt.Println("Got an error adding default KMS encryption to bucket", bucket)
 		fmt.Println(err.Error())
@@ -143,132 +253,207 @@ func EncryptBucket(bucket, key string) {
 	logger.Info("Bucket " + bucket + " now has KMS encryption by default")
 }
 
+// EncryptBucketE turns on KMS encryption by default on the S3 bucket, returning any error.
+func EncryptBucketE(bucket, key string) error {
+	return EncryptBucketWithContext(context.Background(), bucket, key)
+}
+
+// EncryptBucketWithContext is EncryptBucketE with a context to allow cancellation.
+func EncryptBucketWithContext(ctx context.Context, bucket, key string) error {
+	return New(sharedConfigSession()).EncryptBucket(ctx, bucket, key)
+}
+
+// EncryptBucket turns on KMS encryption by default on the S3 bucket, returning any error.
+func (client *Client) EncryptBucket(ctx context.Context, bucket, key string) error {
+	defEnc := &s3.ServerSideEncryptionByDefault{KMSMasterKeyID: aws.String(key), SSEAlgorithm: aws.String(s3.ServerSideEncryptionAwsKms)}
+	rule := &s3.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: defEnc}
+	rules := []*s3.ServerSideEncryptionRule{rule}
+	serverConfig := &s3.ServerSideEncryptionConfiguration{Rules: rules}
+	input := &s3.PutBucketEncryptionInput{Bucket: aws.String(bucket), ServerSideEncryptionConfiguration: serverConfig}
+	_, err := client.S3.PutBucketEncryptionWithContext(ctx, input)
+	return err
+}
+
 // EnableVersioning turns on version on the S3 bucket
 func EnableVersioning(bucket string) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	printError(EnableVersioningE(bucket))
+}
 
-	svc := s3.New(sess)
-	input := &s3.PutBucketVersioningInput{
-		Bucket: aws.String(bucket),
-		VersioningConfiguration: &s3.VersioningConfiguration{
-			MFADelete: aws.String("Disabled"),
-			Status:    aws.String("Enabled"),
-		},
-	}
+// EnableVersioningE turns on versioning on the S3 bucket, returning any error.
+func EnableVersioningE(bucket string) error {
+	return EnableVersioningWithContext(context.Background(), bucket)
+}
 
-	_, err := svc.PutBucketVersioning(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
-		}
-		return
-	}
+// EnableVersioningWithContext is EnableVersioningE with a context to allow cancellation.
+func EnableVersioningWithContext(ctx context.Context, bucket string) error {
+	return New(sharedConfigSession()).EnableVersioning(ctx, bucket)
+}
+
+// EnableVersioning turns on versioning on the S3 bucket, returning any error.
+func (client *Client) EnableVersioning(ctx context.Context, bucket string) error {
+	return client.putBucketVersioning(ctx, bucket, "Enabled")
 }
 
 // DisableVersioning turns on versioning on the S3 bucket
 // In the AWS console the bucket will be mark as 'disabled',
 // in the AWS documentation the status is referred to as 'suspended'
 func DisableVersioning(bucket string) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	printError(DisableVersioningE(bucket))
+}
 
-	svc := s3.New(sess)
+// DisableVersioningE suspends versioning on the S3 bucket, returning any error.
+func DisableVersioningE(bucket string) error {
+	return DisableVersioningWithContext(context.Background(), bucket)
+}
+
+// DisableVersioningWithContext is DisableVersioningE with a context to allow cancellation.
+func DisableVersioningWithContext(ctx context.Context, bucket string) error {
+	return New(sharedConfigSession()).DisableVersioning(ctx, bucket)
+}
+
+// DisableVersioning suspends versioning on the S3 bucket, returning any error.
+func (client *Client) DisableVersioning(ctx context.Context, bucket string) error {
+	return client.putBucketVersioning(ctx, bucket, "Suspended")
+}
+
+func (client *Client) putBucketVersioning(ctx context.Context, bucket string, status string) error {
 	input := &s3.PutBucketVersioningInput{
 		Bucket: aws.String(bucket),
 		VersioningConfiguration: &s3.VersioningConfiguration{
 			MFADelete: aws.String("Disabled"),
-			Status:    aws.String("Suspended"),
+			Status:    aws.String(status),
 		},
 	}
 
-	_, err := svc.PutBucketVersioning(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
-		}
-		return
-	}
+	_, err := client.S3.PutBucketVersioningWithContext(ctx, input)
+	return err
 }
 
 // DeleteAllObjectVersions gets an array of all the bucket object versions, iterates over them, and deletes them.
 func DeleteAllObjectVersions(bucket string, awsSession *session.Session) {
-	objectVersions := GetObjectVersions(bucket, awsSession)
-	length := len(objectVersions.Versions)
+	printError(DeleteAllObjectVersionsE(bucket, awsSession))
+}
+
+// DeleteAllObjectVersionsE deletes every object version in the bucket, stopping at the first error.
+func DeleteAllObjectVersionsE(bucket string, awsSession *session.Session) error {
+	return DeleteAllObjectVersionsWithContext(context.Background(), bucket, awsSession)
+}
+
+// DeleteAllObjectVersionsWithContext is DeleteAllObjectVersionsE with a context to allow cancellation.
+func DeleteAllObjectVersionsWithContext(ctx context.Context, bucket string, awsSession *session.Session) error {
+	return New(awsSession).DeleteAllObjectVersions(ctx, bucket)
+}
 
-	for i := 0; i < length; i++ {
-		id := *objectVersions.Versions[i].VersionId
-		key := *objectVersions.Versions[i].Key
-		DeleteObjectVersion(id, bucket, key, awsSession)
+// DeleteAllObjectVersions deletes every object version in the bucket, stopping at the first error.
+func (client *Client) DeleteAllObjectVersions(ctx context.Context, bucket string) error {
+	objectVersions, err := client.GetObjectVersions(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range objectVersions.Versions {
+		err = client.DeleteObjectVersion(ctx, *version.VersionId, bucket, *version.Key)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // DeleteObjectVersion deletes the specific version of an S3 bucket object.
 func DeleteObjectVersion(id, bucket, key string, awsSession *session.Session) {
-	svc := s3.New(awsSession)
+	printError(DeleteObjectVersionE(id, bucket, key, awsSession))
+}
+
+// DeleteObjectVersionE deletes the specific version of an S3 bucket object, returning any error.
+func DeleteObjectVersionE(id, bucket, key string, awsSession *session.Session) error {
+	return DeleteObjectVersionWithContext(context.Background(), id, bucket, key, awsSession)
+}
+
+// DeleteObjectVersionWithContext is DeleteObjectVersionE with a context to allow cancellation.
+func DeleteObjectVersionWithContext(ctx context.Context, id, bucket, key string, awsSession *session.Session) error {
+	return New(awsSession).DeleteObjectVersion(ctx, id, bucket, key)
+}
 
+// DeleteObjectVersion deletes the specific version of an S3 bucket object, returning any error.
+func (client *Client) DeleteObjectVersion(ctx context.Context, id, bucket, key string) error {
 	input := &s3.DeleteObjectInput{
 		Bucket:    aws.String(bucket),
 		Key:       aws.String(key), // S3 key (not encryption key)
 		VersionId: aws.String(id),
 	}
 
-	_, err := svc.DeleteObject(input)
-
-	if err != nil {
-		fmt.Println(err.Error())
-	}
+	_, err := client.S3.DeleteObjectWithContext(ctx, input)
+	return err
 }
 
 // GetObjectVersions retuns the list of version for an S3 bucket.
 func GetObjectVersions(bucket string, awsSession *session.Session) (result *s3.ListObjectVersionsOutput) {
-	svc := s3.New(awsSession)
+	result, err := GetObjectVersionsE(bucket, awsSession)
+	printError(err)
+	return result
+}
+
+// GetObjectVersionsE returns the list of versions for an S3 bucket, or an error.
+func GetObjectVersionsE(bucket string, awsSession *session.Session) (*s3.ListObjectVersionsOutput, error) {
+	return GetObjectVersionsWithContext(context.Background(), bucket, awsSession)
+}
+
+// GetObjectVersionsWithContext is GetObjectVersionsE with a context to allow cancellation.
+func GetObjectVersionsWithContext(ctx context.Context, bucket string, awsSession *session.Session) (*s3.ListObjectVersionsOutput, error) {
+	return New(awsSession).GetObjectVersions(ctx, bucket)
+}
+
+// GetObjectVersions returns the list of versions for an S3 bucket, or an error.
+func (client *Client) GetObjectVersions(ctx context.Context, bucket string) (*s3.ListObjectVersionsOutput, error) {
 	input := &s3.ListObjectVersionsInput{
 		Bucket: aws.String(bucket),
 	}
 
-	result, err := svc.ListObjectVersions(input)
+	return client.S3.ListObjectVersionsWithContext(ctx, input)
+}
+
+// DeleteAllDeleteMarkers retrives the delete markers and deletes them.
+func DeleteAllDeleteMarkers(bucket string, awsSession *session.Session) {
+	printError(DeleteAllDeleteMarkersE(bucket, awsSession))
+}
+
+// DeleteAllDeleteMarkersE retrieves the delete markers and deletes them, stopping at the first error.
+func DeleteAllDeleteMarkersE(bucket string, awsSession *session.Session) error {
+	return DeleteAllDeleteMarkersWithContext(context.Background(), bucket, awsSession)
+}
+
+// DeleteAllDeleteMarkersWithContext is DeleteAllDeleteMarkersE with a context to allow cancellation.
+func DeleteAllDeleteMarkersWithContext(ctx context.Context, bucket string, awsSession *session.Session) error {
+	return New(awsSession).DeleteAllDeleteMarkers(ctx, bucket)
+}
+
+// DeleteAllDeleteMarkers retrieves the delete markers and deletes them, stopping at the first error.
+func (client *Client) DeleteAllDeleteMarkers(ctx context.Context, bucket string) error {
+	deleteMarkers, err := client.GetObjectVersions(ctx, bucket)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
-		}
-		return
+		return err
 	}
 
-	return result
+	for _, marker := range deleteMarkers.DeleteMarkers {
+		err = client.DeleteObjectVersion(ctx, *marker.VersionId, bucket, *marker.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// DeleteAllDeleteMarkers retrives the delete markers and deletes them.
-func DeleteAllDeleteMarkers(bucket string, awsSession *session.Session) {
-	deleteMarkers := GetObjectVersions(bucket, awsSession)
-	length := len(deleteMarkers.DeleteMarkers)
+// sharedConfigSession creates the session used by the helpers that are not given one.
+func sharedConfigSession() *session.Session {
+	return session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+}
 
-	for i := 0; i < length; i++ {
-		id := *deleteMarkers.DeleteMarkers[i].VersionId
-		key := *deleteMarkers.DeleteMarkers[i].Key
-		DeleteObjectVersion(id, bucket, key, awsSession)
+// printError prints the error to stdout the way the process-exiting helpers always have.
+func printError(err error) {
+	if err != nil {
+		fmt.Println(err.Error())
 	}
 }
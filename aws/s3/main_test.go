@@ -1,14 +1,18 @@
 package s3
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"testing"
 	"time"
 
 	pacaws "github.com/PyramidSystemsInc/go/aws"
 	packms "github.com/PyramidSystemsInc/go/aws/kms"
+	"github.com/PyramidSystemsInc/go/aws/s3/s3fake"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -17,6 +21,7 @@ import (
 // TestEncryptBucket creates and s3 bucket, encrypts, and then tests the successful enabling
 // of an S3 bucket by calling GetBucketEncryption. If an error is returned the bucket is not encrypted.
 func TestEncryptBucket(t *testing.T) {
+	skipWithoutAws(t)
 	//create bucket
 	session := pacaws.CreateAwsSession("us-east-2")
 
@@ -59,6 +64,7 @@ func TestEncryptBucket(t *testing.T) {
 
 // TestEnableVersioning tests when turning on versinong on an S3 bucket is successful.
 func TestEnableVersioning(t *testing.T) {
+	skipWithoutAws(t)
 	//create bucket
 	session := pacaws.CreateAwsSession("us-east-2")
 
@@ -112,6 +118,7 @@ func TestEnableVersioning(t *testing.T) {
 
 // TestEnableVersioning tests when turning on versinong on an S3 bucket is successful.
 func TestDisableVersioning(t *testing.T) {
+	skipWithoutAws(t)
 	//create bucket
 	session := pacaws.CreateAwsSession("us-east-2")
 
@@ -163,3 +170,97 @@ func TestDisableVersioning(t *testing.T) {
 	dinput := &s3.DeleteBucketInput{Bucket: aws.String(name)}
 	svc.DeleteBucket(dinput)
 }
+
+// newVersionedBucket makes a versioned bucket in an in-memory fake holding each of the keys as an object version.
+func newVersionedBucket(t *testing.T, name string, keys ...string) (*Client, *s3fake.S3) {
+	ctx := context.Background()
+	fake := s3fake.New()
+	client := &Client{S3: fake}
+	if err := client.MakeBucket(ctx, name, "private", "us-east-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.EnableVersioning(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		_, err := fake.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Body:   bytes.NewReader([]byte(key)),
+			Bucket: aws.String(name),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client, fake
+}
+
+// TestEmptyVersionedBucket checks that emptying a versioned bucket keeps the old versions behind a delete marker for
+// each object.
+func TestEmptyVersionedBucket(t *testing.T) {
+	ctx := context.Background()
+	name := "testbucketemptyversioned"
+	client, _ := newVersionedBucket(t, name, "index.html", "index.html", "app.js")
+
+	if err := client.EmptyBucket(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := client.GetObjectVersions(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions.Versions) != 3 || len(versions.DeleteMarkers) != 2 {
+		t.Errorf("expected 3 versions and 2 delete markers, got %d and %d", len(versions.Versions), len(versions.DeleteMarkers))
+	}
+}
+
+// TestDeleteVersionedBucket checks that a versioned bucket holding objects, old versions and delete markers can be
+// deleted.
+func TestDeleteVersionedBucket(t *testing.T) {
+	ctx := context.Background()
+	name := "testbucketdeleteversioned"
+	client, fake := newVersionedBucket(t, name, "index.html", "index.html", "app.js")
+	if err := client.EmptyBucket(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteBucket(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Buckets[name]; ok {
+		t.Error("bucket was not deleted")
+	}
+}
+
+// TestDeleteBucketDeleteMarkers checks that the delete markers left once every object version is gone are deleted
+// before the bucket, since S3 does not delete a bucket that still holds them.
+func TestDeleteBucketDeleteMarkers(t *testing.T) {
+	ctx := context.Background()
+	name := "testbucketdeletemarkers"
+	client, fake := newVersionedBucket(t, name, "index.html")
+	if err := client.EmptyBucket(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteAllObjectVersions(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	_, err := fake.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "BucketNotEmpty" {
+		t.Fatalf("expected the delete marker to keep the bucket from being deleted, got %v", err)
+	}
+
+	if err := client.DeleteBucket(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Buckets[name]; ok {
+		t.Error("bucket was not deleted")
+	}
+}
+
+// skipWithoutAws skips a test that creates real AWS resources unless PAC_AWS_TESTS is set, so that the package is
+// unit tested offline against its fake by default.
+func skipWithoutAws(t *testing.T) {
+	if os.Getenv("PAC_AWS_TESTS") == "" {
+		t.Skip("set PAC_AWS_TESTS to run against AWS")
+	}
+}
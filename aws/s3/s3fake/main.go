@@ -0,0 +1,342 @@
+// Package s3fake is an in-memory stand-in for the parts of the S3 API used by the
+// github.com/PyramidSystemsInc/go/aws packages, so they can be unit tested offline.
+package s3fake
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3 keeps buckets and object versions in memory. Calling an operation that is not implemented panics.
+type S3 struct {
+	s3iface.S3API
+
+	mutex   sync.Mutex
+	counter int
+	Buckets map[string]*Bucket
+}
+
+// Bucket is the state of one fake bucket.
+type Bucket struct {
+	ACL        string
+	Region     string
+	Encryption *s3.ServerSideEncryptionConfiguration
+	Tags       []*s3.Tag
+	Versioning string
+	Website    *s3.WebsiteConfiguration
+	// Objects holds every version of every key, oldest first.
+	Objects map[string][]*Object
+}
+
+// Object is one version of an object, or a delete marker.
+type Object struct {
+	Body         []byte
+	DeleteMarker bool
+	LastModified time.Time
+	VersionId    string
+}
+
+// New returns a fake without buckets.
+func New() *S3 {
+	return &S3{
+		Buckets: map[string]*Bucket{},
+	}
+}
+
+// CreateBucketWithContext creates an empty bucket.
+func (fake *S3) CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Bucket)
+	if _, ok := fake.Buckets[name]; ok {
+		return nil, awserr.New(s3.ErrCodeBucketAlreadyOwnedByYou, "Your previous request to create the named bucket succeeded and you already own it.", nil)
+	}
+	region := "us-east-1"
+	if input.CreateBucketConfiguration != nil && input.CreateBucketConfiguration.LocationConstraint != nil {
+		region = aws.StringValue(input.CreateBucketConfiguration.LocationConstraint)
+	}
+	fake.Buckets[name] = &Bucket{
+		ACL:     aws.StringValue(input.ACL),
+		Region:  region,
+		Objects: map[string][]*Object{},
+	}
+	return &s3.CreateBucketOutput{
+		Location: aws.String("/" + name),
+	}, nil
+}
+
+// DeleteBucketWithContext deletes a bucket that holds no object versions.
+func (fake *S3) DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucket.Objects) > 0 {
+		return nil, awserr.New("BucketNotEmpty", "The bucket you tried to delete is not empty", nil)
+	}
+	delete(fake.Buckets, aws.StringValue(input.Bucket))
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// PutObjectWithContext stores an object, adding a version when versioning is enabled.
+func (fake *S3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if input.Body != nil {
+		body, err = ioutil.ReadAll(input.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	object := fake.put(bucket, aws.StringValue(input.Key), &Object{
+		Body: body,
+	})
+	output := &s3.PutObjectOutput{}
+	if bucket.Versioning == s3.BucketVersioningStatusEnabled {
+		output.VersionId = aws.String(object.VersionId)
+	}
+	return output, nil
+}
+
+// GetObjectWithContext returns the latest (or the requested) version of an object.
+func (fake *S3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	versions := bucket.Objects[aws.StringValue(input.Key)]
+	var object *Object
+	for _, version := range versions {
+		if input.VersionId == nil || version.VersionId == aws.StringValue(input.VersionId) {
+			object = version
+		}
+	}
+	if object == nil || object.DeleteMarker {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(object.Body)),
+		ContentLength: aws.Int64(int64(len(object.Body))),
+		LastModified:  aws.Time(object.LastModified),
+		VersionId:     aws.String(object.VersionId),
+	}, nil
+}
+
+// ListObjectsWithContext lists the keys whose latest version is not a delete marker.
+func (fake *S3) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	var contents []*s3.Object
+	for _, key := range sortedKeys(bucket) {
+		versions := bucket.Objects[key]
+		latest := versions[len(versions)-1]
+		if !latest.DeleteMarker {
+			contents = append(contents, &s3.Object{
+				Key:          aws.String(key),
+				LastModified: aws.Time(latest.LastModified),
+				Size:         aws.Int64(int64(len(latest.Body))),
+			})
+		}
+	}
+	return &s3.ListObjectsOutput{
+		Contents: contents,
+		Name:     input.Bucket,
+	}, nil
+}
+
+// ListObjectVersionsWithContext lists every version and delete marker in the bucket.
+func (fake *S3) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.ListObjectVersionsOutput{
+		Name: input.Bucket,
+	}
+	for _, key := range sortedKeys(bucket) {
+		versions := bucket.Objects[key]
+		for i, version := range versions {
+			isLatest := i == len(versions)-1
+			if version.DeleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, &s3.DeleteMarkerEntry{
+					IsLatest:     aws.Bool(isLatest),
+					Key:          aws.String(key),
+					LastModified: aws.Time(version.LastModified),
+					VersionId:    aws.String(version.VersionId),
+				})
+			} else {
+				output.Versions = append(output.Versions, &s3.ObjectVersion{
+					IsLatest:     aws.Bool(isLatest),
+					Key:          aws.String(key),
+					LastModified: aws.Time(version.LastModified),
+					Size:         aws.Int64(int64(len(version.Body))),
+					VersionId:    aws.String(version.VersionId),
+				})
+			}
+		}
+	}
+	return output, nil
+}
+
+// DeleteObjectWithContext removes a version when one is given. Otherwise it adds a delete marker
+// to a versioned bucket, or removes the object from an unversioned one.
+func (fake *S3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	fake.delete(bucket, aws.StringValue(input.Key), input.VersionId)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// DeleteObjectsWithContext deletes each object as DeleteObjectWithContext would.
+func (fake *S3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if input.Delete == nil || len(input.Delete.Objects) == 0 {
+		return nil, awserr.New("MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema", nil)
+	}
+	output := &s3.DeleteObjectsOutput{}
+	for _, identifier := range input.Delete.Objects {
+		fake.delete(bucket, aws.StringValue(identifier.Key), identifier.VersionId)
+		output.Deleted = append(output.Deleted, &s3.DeletedObject{
+			Key:       identifier.Key,
+			VersionId: identifier.VersionId,
+		})
+	}
+	return output, nil
+}
+
+// PutBucketEncryptionWithContext stores the default encryption configuration.
+func (fake *S3) PutBucketEncryptionWithContext(ctx aws.Context, input *s3.PutBucketEncryptionInput, opts ...request.Option) (*s3.PutBucketEncryptionOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.Encryption = input.ServerSideEncryptionConfiguration
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+// PutBucketTaggingWithContext replaces the tags of the bucket.
+func (fake *S3) PutBucketTaggingWithContext(ctx aws.Context, input *s3.PutBucketTaggingInput, opts ...request.Option) (*s3.PutBucketTaggingOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.Tags = input.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+// PutBucketVersioningWithContext stores the versioning status.
+func (fake *S3) PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.Versioning = aws.StringValue(input.VersioningConfiguration.Status)
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+// PutBucketWebsiteWithContext stores the website configuration.
+func (fake *S3) PutBucketWebsiteWithContext(ctx aws.Context, input *s3.PutBucketWebsiteInput, opts ...request.Option) (*s3.PutBucketWebsiteOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	bucket, err := fake.bucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	bucket.Website = input.WebsiteConfiguration
+	return &s3.PutBucketWebsiteOutput{}, nil
+}
+
+func (fake *S3) bucket(name *string) (*Bucket, error) {
+	bucket, ok := fake.Buckets[aws.StringValue(name)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	return bucket, nil
+}
+
+func (fake *S3) put(bucket *Bucket, key string, object *Object) *Object {
+	object.LastModified = time.Now()
+	if bucket.Versioning == s3.BucketVersioningStatusEnabled {
+		fake.counter++
+		object.VersionId = fmt.Sprintf("v%d", fake.counter)
+		bucket.Objects[key] = append(bucket.Objects[key], object)
+	} else {
+		object.VersionId = "null"
+		bucket.Objects[key] = []*Object{
+			object,
+		}
+	}
+	return object
+}
+
+func (fake *S3) delete(bucket *Bucket, key string, versionId *string) {
+	if versionId != nil {
+		versions := bucket.Objects[key]
+		for i, version := range versions {
+			if version.VersionId == aws.StringValue(versionId) {
+				versions = append(versions[:i], versions[i+1:]...)
+				break
+			}
+		}
+		if len(versions) == 0 {
+			delete(bucket.Objects, key)
+		} else {
+			bucket.Objects[key] = versions
+		}
+	} else if bucket.Versioning == s3.BucketVersioningStatusEnabled {
+		fake.put(bucket, key, &Object{
+			DeleteMarker: true,
+		})
+	} else {
+		delete(bucket.Objects, key)
+	}
+}
+
+func sortedKeys(bucket *Bucket) []string {
+	var keys []string
+	for key := range bucket.Objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
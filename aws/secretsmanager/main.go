@@ -0,0 +1,407 @@
+package secretsmanager
+
+import (
+  "context"
+  "encoding/json"
+  "sort"
+  "strconv"
+
+  "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/str"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
+  "github.com/aws/aws-sdk-go/aws/session"
+  "github.com/aws/aws-sdk-go/service/secretsmanager"
+  "github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// Client stores, generates and rotates secrets and hands them to ECS and Terraform. Nothing it does logs secret values
+// or puts them in errors.
+type Client struct {
+  SecretsManager secretsmanageriface.SecretsManagerAPI
+}
+
+// SecretOptions holds the optional settings of a secret made by CreateSecret.
+type SecretOptions struct {
+  Description string
+  // KmsKeyId is the id, ARN or alias of the key encrypting the secret, such as one from kms.CreateKey. Without one, the
+  // AWS managed key of the account (alias/aws/secretsmanager) is used
+  KmsKeyId string
+  Tags map[string]string
+}
+
+// PasswordOptions holds the settings of a password made by GeneratePassword. The zero value gives 32 characters
+// without DefaultExcludeCharacters.
+type PasswordOptions struct {
+  Length int64
+  // ExcludeCharacters replaces DefaultExcludeCharacters when set
+  ExcludeCharacters string
+  ExcludePunctuation bool
+}
+
+// SecretRef points at a secret, by name or ARN, or at one key of its JSON value.
+type SecretRef struct {
+  SecretId string
+  JsonKey string
+}
+
+// DefaultExcludeCharacters are left out of generated passwords: RDS does not accept them in master passwords and
+// they need quoting wherever a password is put on a shell command line.
+const DefaultExcludeCharacters = " \"'\\/@`$"
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    SecretsManager: secretsmanager.New(awsSession),
+  }
+}
+
+// ContainerSecrets returns the Secrets of an ecs.Container, by environment variable name, for secret refs, or exits if
+// a secret cannot be found.
+func ContainerSecrets(refs map[string]SecretRef, awsSession *session.Session) map[string]string {
+  secrets, err := ContainerSecretsE(refs, awsSession)
+  errors.QuitIfError(err)
+  return secrets
+}
+
+// ContainerSecretsE is ContainerSecrets returning an error instead of exiting.
+func ContainerSecretsE(refs map[string]SecretRef, awsSession *session.Session) (map[string]string, error) {
+  return ContainerSecretsWithContext(context.Background(), refs, awsSession)
+}
+
+// ContainerSecretsWithContext is ContainerSecretsE with a context to allow cancellation.
+func ContainerSecretsWithContext(ctx context.Context, refs map[string]SecretRef, awsSession *session.Session) (map[string]string, error) {
+  return New(awsSession).ContainerSecrets(ctx, refs)
+}
+
+// ContainerSecrets returns the Secrets of an ecs.Container, by environment variable name, for secret refs. Each is the
+// full ARN of the secret, followed by the JSON key when there is one, so ECS injects the value when the task starts and
+// it is never read here. The task execution role needs secretsmanager:GetSecretValue on the secrets.
+func (client *Client) ContainerSecrets(ctx context.Context, refs map[string]SecretRef) (map[string]string, error) {
+  arns := map[string]string{}
+  secrets := map[string]string{}
+  for name, ref := range refs {
+    arn, ok := arns[ref.SecretId]
+    if !ok {
+      result, err := client.SecretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+        SecretId: aws.String(ref.SecretId),
+      })
+      if err != nil {
+        return nil, errors.New(str.Concat("Could not find the secret ", ref.SecretId, " for ", name, ": ", err.Error()))
+      }
+      if result.DeletedDate != nil {
+        return nil, errors.New(str.Concat("The secret ", ref.SecretId, " for ", name, " is scheduled for deletion"))
+      }
+      arn = aws.StringValue(result.ARN)
+      arns[ref.SecretId] = arn
+    }
+    if ref.JsonKey == "" {
+      secrets[name] = arn
+    } else {
+      secrets[name] = str.Concat(arn, ":", ref.JsonKey, "::")
+    }
+  }
+  return secrets, nil
+}
+
+// CreateSecret stores a new secret and returns its ARN, or exits if it cannot be created.
+func CreateSecret(name string, value interface{}, options SecretOptions, awsSession *session.Session) string {
+  arn, err := CreateSecretE(name, value, options, awsSession)
+  errors.QuitIfError(err)
+  return arn
+}
+
+// CreateSecretE is CreateSecret returning an error instead of exiting.
+func CreateSecretE(name string, value interface{}, options SecretOptions, awsSession *session.Session) (string, error) {
+  return CreateSecretWithContext(context.Background(), name, value, options, awsSession)
+}
+
+// CreateSecretWithContext is CreateSecretE with a context to allow cancellation.
+func CreateSecretWithContext(ctx context.Context, name string, value interface{}, options SecretOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).CreateSecret(ctx, name, value, options)
+}
+
+// CreateSecret stores a new secret and returns its ARN. A string value is stored as it is, such as a password from
+// GeneratePassword, and any other value as JSON, such as a struct or map of database settings.
+func (client *Client) CreateSecret(ctx context.Context, name string, value interface{}, options SecretOptions) (string, error) {
+  secretString, err := toSecretString(value)
+  if err != nil {
+    return "", err
+  }
+  input := &secretsmanager.CreateSecretInput{
+    Name: aws.String(name),
+    SecretString: aws.String(secretString),
+  }
+  if options.Description != "" {
+    input.Description = aws.String(options.Description)
+  }
+  if options.KmsKeyId != "" {
+    input.KmsKeyId = aws.String(options.KmsKeyId)
+  }
+  tagKeys := make([]string, 0, len(options.Tags))
+  for tagKey := range options.Tags {
+    tagKeys = append(tagKeys, tagKey)
+  }
+  sort.Strings(tagKeys)
+  for _, tagKey := range tagKeys {
+    input.Tags = append(input.Tags, &secretsmanager.Tag{
+      Key: aws.String(tagKey),
+      Value: aws.String(options.Tags[tagKey]),
+    })
+  }
+  result, err := client.SecretsManager.CreateSecretWithContext(ctx, input)
+  if err != nil {
+    return "", errors.New(str.Concat("Could not create the secret ", name, ": ", err.Error()))
+  }
+  return aws.StringValue(result.ARN), nil
+}
+
+// DeleteSecret deletes a secret after a recovery window of 7 to 30 days, or at once when it is zero, or exits if it
+// cannot be deleted.
+func DeleteSecret(secretId string, recoveryWindowDays int, awsSession *session.Session) {
+  errors.QuitIfError(DeleteSecretE(secretId, recoveryWindowDays, awsSession))
+}
+
+// DeleteSecretE is DeleteSecret returning an error instead of exiting.
+func DeleteSecretE(secretId string, recoveryWindowDays int, awsSession *session.Session) error {
+  return DeleteSecretWithContext(context.Background(), secretId, recoveryWindowDays, awsSession)
+}
+
+// DeleteSecretWithContext is DeleteSecretE with a context to allow cancellation.
+func DeleteSecretWithContext(ctx context.Context, secretId string, recoveryWindowDays int, awsSession *session.Session) error {
+  return New(awsSession).DeleteSecret(ctx, secretId, recoveryWindowDays)
+}
+
+// DeleteSecret deletes a secret after a recovery window of 7 to 30 days, during which it can be restored from the
+// console, or at once when the window is zero, such as when tearing down a test environment. Deleting a secret that
+// does not exist is not an error.
+func (client *Client) DeleteSecret(ctx context.Context, secretId string, recoveryWindowDays int) error {
+  input := &secretsmanager.DeleteSecretInput{
+    SecretId: aws.String(secretId),
+  }
+  if recoveryWindowDays == 0 {
+    input.ForceDeleteWithoutRecovery = aws.Bool(true)
+  } else if recoveryWindowDays < 7 || recoveryWindowDays > 30 {
+    return errors.New(str.Concat("The recovery window of a secret must be 0 or 7 to 30 days, got ", strconv.Itoa(recoveryWindowDays)))
+  } else {
+    input.RecoveryWindowInDays = aws.Int64(int64(recoveryWindowDays))
+  }
+  _, err := client.SecretsManager.DeleteSecretWithContext(ctx, input)
+  if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+    return nil
+  }
+  return err
+}
+
+// GeneratePassword returns a random password, or exits if one cannot be generated.
+func GeneratePassword(options PasswordOptions, awsSession *session.Session) string {
+  password, err := GeneratePasswordE(options, awsSession)
+  errors.QuitIfError(err)
+  return password
+}
+
+// GeneratePasswordE is GeneratePassword returning an error instead of exiting.
+func GeneratePasswordE(options PasswordOptions, awsSession *session.Session) (string, error) {
+  return GeneratePasswordWithContext(context.Background(), options, awsSession)
+}
+
+// GeneratePasswordWithContext is GeneratePasswordE with a context to allow cancellation.
+func GeneratePasswordWithContext(ctx context.Context, options PasswordOptions, awsSession *session.Session) (string, error) {
+  return New(awsSession).GeneratePassword(ctx, options)
+}
+
+// GeneratePassword returns a random password with at least one upper case letter, lower case letter, number and, unless
+// excluded, punctuation character.
+func (client *Client) GeneratePassword(ctx context.Context, options PasswordOptions) (string, error) {
+  length := options.Length
+  if length == 0 {
+    length = 32
+  }
+  excludeCharacters := options.ExcludeCharacters
+  if excludeCharacters == "" {
+    excludeCharacters = DefaultExcludeCharacters
+  }
+  result, err := client.SecretsManager.GetRandomPasswordWithContext(ctx, &secretsmanager.GetRandomPasswordInput{
+    ExcludeCharacters: aws.String(excludeCharacters),
+    ExcludePunctuation: aws.Bool(options.ExcludePunctuation),
+    PasswordLength: aws.Int64(length),
+    RequireEachIncludedType: aws.Bool(true),
+  })
+  if err != nil {
+    return "", err
+  }
+  return aws.StringValue(result.RandomPassword), nil
+}
+
+// GetSecret returns the current value of a secret, or exits if it cannot be read.
+func GetSecret(secretId string, awsSession *session.Session) string {
+  value, err := GetSecretE(secretId, awsSession)
+  errors.QuitIfError(err)
+  return value
+}
+
+// GetSecretE is GetSecret returning an error instead of exiting.
+func GetSecretE(secretId string, awsSession *session.Session) (string, error) {
+  return GetSecretWithContext(context.Background(), secretId, awsSession)
+}
+
+// GetSecretWithContext is GetSecretE with a context to allow cancellation.
+func GetSecretWithContext(ctx context.Context, secretId string, awsSession *session.Session) (string, error) {
+  return New(awsSession).GetSecret(ctx, secretId)
+}
+
+// GetSecret returns the current value of a secret, given by name or ARN, as it was stored.
+func (client *Client) GetSecret(ctx context.Context, secretId string) (string, error) {
+  result, err := client.SecretsManager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+    SecretId: aws.String(secretId),
+  })
+  if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+    return "", errors.New(str.Concat("The secret ", secretId, " does not exist"))
+  }
+  if err != nil {
+    return "", err
+  }
+  if result.SecretString == nil {
+    return "", errors.New(str.Concat("The secret ", secretId, " holds binary data rather than a string"))
+  }
+  return *result.SecretString, nil
+}
+
+// GetSecretJson reads the current JSON value of a secret into out, or exits if it cannot be read.
+func GetSecretJson(secretId string, out interface{}, awsSession *session.Session) {
+  errors.QuitIfError(GetSecretJsonE(secretId, out, awsSession))
+}
+
+// GetSecretJsonE is GetSecretJson returning an error instead of exiting.
+func GetSecretJsonE(secretId string, out interface{}, awsSession *session.Session) error {
+  return GetSecretJsonWithContext(context.Background(), secretId, out, awsSession)
+}
+
+// GetSecretJsonWithContext is GetSecretJsonE with a context to allow cancellation.
+func GetSecretJsonWithContext(ctx context.Context, secretId string, out interface{}, awsSession *session.Session) error {
+  return New(awsSession).GetSecretJson(ctx, secretId, out)
+}
+
+// GetSecretJson reads the current JSON value of a secret into out, a pointer to a struct or map.
+func (client *Client) GetSecretJson(ctx context.Context, secretId string, out interface{}) error {
+  value, err := client.GetSecret(ctx, secretId)
+  if err != nil {
+    return err
+  }
+  if json.Unmarshal([]byte(value), out) != nil {
+    // The JSON error is not returned as it can quote part of the value
+    return errors.New(str.Concat("The secret ", secretId, " does not hold JSON of the expected shape"))
+  }
+  return nil
+}
+
+// RotateSecret replaces the value of a secret and returns the id of the new version, or exits if it cannot be replaced.
+func RotateSecret(secretId string, value interface{}, awsSession *session.Session) string {
+  versionId, err := RotateSecretE(secretId, value, awsSession)
+  errors.QuitIfError(err)
+  return versionId
+}
+
+// RotateSecretE is RotateSecret returning an error instead of exiting.
+func RotateSecretE(secretId string, value interface{}, awsSession *session.Session) (string, error) {
+  return RotateSecretWithContext(context.Background(), secretId, value, awsSession)
+}
+
+// RotateSecretWithContext is RotateSecretE with a context to allow cancellation.
+func RotateSecretWithContext(ctx context.Context, secretId string, value interface{}, awsSession *session.Session) (string, error) {
+  return New(awsSession).RotateSecret(ctx, secretId, value)
+}
+
+// RotateSecret replaces the value of a secret, stored as CreateSecret does, and returns the id of the new version. The
+// old value stays readable as the AWSPREVIOUS version until the next rotation, so tasks started before the rotation
+// keep working while whatever uses the secret, such as a database password, is changed over.
+func (client *Client) RotateSecret(ctx context.Context, secretId string, value interface{}) (string, error) {
+  secretString, err := toSecretString(value)
+  if err != nil {
+    return "", err
+  }
+  result, err := client.SecretsManager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+    SecretId: aws.String(secretId),
+    SecretString: aws.String(secretString),
+  })
+  if err != nil {
+    return "", errors.New(str.Concat("Could not rotate the secret ", secretId, ": ", err.Error()))
+  }
+  return aws.StringValue(result.VersionId), nil
+}
+
+// TerraformVars returns the values of secret refs by variable name, to give as the secretVars of
+// terraform.PlanWithSecretVars, or exits if a secret cannot be read.
+func TerraformVars(refs map[string]SecretRef, awsSession *session.Session) map[string]string {
+  vars, err := TerraformVarsE(refs, awsSession)
+  errors.QuitIfError(err)
+  return vars
+}
+
+// TerraformVarsE is TerraformVars returning an error instead of exiting.
+func TerraformVarsE(refs map[string]SecretRef, awsSession *session.Session) (map[string]string, error) {
+  return TerraformVarsWithContext(context.Background(), refs, awsSession)
+}
+
+// TerraformVarsWithContext is TerraformVarsE with a context to allow cancellation.
+func TerraformVarsWithContext(ctx context.Context, refs map[string]SecretRef, awsSession *session.Session) (map[string]string, error) {
+  return New(awsSession).TerraformVars(ctx, refs)
+}
+
+// TerraformVars returns the values of secret refs by variable name, to give as the secretVars of
+// terraform.PlanWithSecretVars so that they reach Terraform through its environment rather than its command line. Each
+// secret is read once however many refs point at it. A ref with a JSON key takes that key of the JSON value, which must be
+// a string, number or boolean.
+func (client *Client) TerraformVars(ctx context.Context, refs map[string]SecretRef) (map[string]string, error) {
+  values := map[string]string{}
+  vars := map[string]string{}
+  for name, ref := range refs {
+    value, ok := values[ref.SecretId]
+    if !ok {
+      var err error
+      value, err = client.GetSecret(ctx, ref.SecretId)
+      if err != nil {
+        return nil, err
+      }
+      values[ref.SecretId] = value
+    }
+    if ref.JsonKey == "" {
+      vars[name] = value
+      continue
+    }
+    var fields map[string]json.RawMessage
+    if json.Unmarshal([]byte(value), &fields) != nil {
+      return nil, errors.New(str.Concat("The secret ", ref.SecretId, " for ", name, " does not hold a JSON object"))
+    }
+    field, ok := fields[ref.JsonKey]
+    if !ok {
+      return nil, errors.New(str.Concat("The secret ", ref.SecretId, " for ", name, " has no key ", ref.JsonKey))
+    }
+    var text string
+    if json.Unmarshal(field, &text) == nil {
+      vars[name] = text
+    } else if len(field) > 0 && field[0] != '{' && field[0] != '[' && string(field) != "null" {
+      vars[name] = string(field)
+    } else {
+      return nil, errors.New(str.Concat("The key ", ref.JsonKey, " of the secret ", ref.SecretId, " for ", name, " is not a string, number or boolean"))
+    }
+  }
+  return vars, nil
+}
+
+// toSecretString returns a string value as it is and any other value as JSON.
+func toSecretString(value interface{}) (string, error) {
+  if text, ok := value.(string); ok {
+    return text, nil
+  }
+  data, err := json.Marshal(value)
+  if err != nil {
+    return "", errors.New("The secret value cannot be stored as JSON: " + err.Error())
+  }
+  return string(data), nil
+}
+
+func isErrorCode(err error, code string) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == code
+}
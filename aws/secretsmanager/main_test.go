@@ -0,0 +1,191 @@
+package secretsmanager
+
+import (
+  "context"
+  "strings"
+  "testing"
+
+  packms "github.com/PyramidSystemsInc/go/aws/kms"
+  "github.com/PyramidSystemsInc/go/aws/kms/kmsfake"
+  "github.com/PyramidSystemsInc/go/aws/secretsmanager/secretsmanagerfake"
+)
+
+type database struct {
+  Host string `json:"host"`
+  Port int `json:"port"`
+  Password string `json:"password"`
+}
+
+func newFakeClient() (*Client, *secretsmanagerfake.SecretsManager) {
+  fake := secretsmanagerfake.New()
+  return &Client{SecretsManager: fake}, fake
+}
+
+// createSecrets creates the password secret pac/dev/admin-password and the JSON secret pac/dev/database holding the
+// same password, and returns the ARN of the first.
+func createSecrets(t *testing.T, client *Client, password string) string {
+  ctx := context.Background()
+  passwordArn, err := client.CreateSecret(ctx, "pac/dev/admin-password", password, SecretOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.CreateSecret(ctx, "pac/dev/database", database{"db.internal", 5432, password}, SecretOptions{
+    Description: "Database settings",
+    Tags: map[string]string{"project": "example"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  return passwordArn
+}
+
+// TestClientGeneratePassword generates a password with the default options, which leaves out the characters of
+// DefaultExcludeCharacters, and a shorter one without punctuation.
+func TestClientGeneratePassword(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+
+  password, err := client.GeneratePassword(ctx, PasswordOptions{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(password) != 32 || strings.ContainsAny(password, DefaultExcludeCharacters) {
+    t.Errorf("unexpected password of %d characters", len(password))
+  }
+  password, err = client.GeneratePassword(ctx, PasswordOptions{Length: 16, ExcludePunctuation: true})
+  if err != nil || len(password) != 16 {
+    t.Errorf("unexpected password of %d characters (error %v)", len(password), err)
+  }
+}
+
+// TestClientCreateSecret creates a secret encrypted with a key from CreateKey, and checks that a secret of the same
+// name is not created again.
+func TestClientCreateSecret(t *testing.T) {
+  ctx := context.Background()
+  client, fake := newFakeClient()
+  key, err := (&packms.Client{KMS: kmsfake.New()}).CreateKey(ctx, packms.KeyOptions{Alias: "myteam/secrets"})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  _, err = client.CreateSecret(ctx, "pac/dev/admin-password", "password", SecretOptions{KmsKeyId: key.Arn})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fake.Secrets["pac/dev/admin-password"].KmsKeyId != key.Arn {
+    t.Error("the secret is not encrypted with the key")
+  }
+  if _, err := client.CreateSecret(ctx, "pac/dev/admin-password", "again", SecretOptions{}); err == nil {
+    t.Error("expected an error creating an existing secret")
+  }
+}
+
+// TestClientRotateSecret rotates a JSON secret and reads the new value back.
+func TestClientRotateSecret(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  createSecrets(t, client, "first")
+
+  _, err := client.RotateSecret(ctx, "pac/dev/database", database{"db.internal", 5432, "second"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  var settings database
+  err = client.GetSecretJson(ctx, "pac/dev/database", &settings)
+  if err != nil || settings.Password != "second" || settings.Port != 5432 {
+    t.Errorf("read %+v, %v", settings, err)
+  }
+}
+
+// TestClientGetSecretJsonInvalid checks that reading a secret that is not JSON as JSON fails without giving the
+// value away in the error.
+func TestClientGetSecretJsonInvalid(t *testing.T) {
+  client, _ := newFakeClient()
+  passwordArn := createSecrets(t, client, "not-json-password")
+
+  var settings database
+  if err := client.GetSecretJson(context.Background(), passwordArn, &settings); err == nil || strings.Contains(err.Error(), "not-json-password") {
+    t.Errorf("expected an error without the value reading a password as JSON, got %v", err)
+  }
+}
+
+// TestClientContainerSecrets turns secret refs into the ARNs ECS reads secrets and their JSON keys by.
+func TestClientContainerSecrets(t *testing.T) {
+  client, fake := newFakeClient()
+  passwordArn := createSecrets(t, client, "password")
+
+  containerSecrets, err := client.ContainerSecrets(context.Background(), map[string]SecretRef{
+    "ADMIN_PASSWORD": {SecretId: "pac/dev/admin-password"},
+    "DB_PASSWORD": {SecretId: "pac/dev/database", JsonKey: "password"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  databaseArn := fake.Secrets["pac/dev/database"].ARN
+  if containerSecrets["ADMIN_PASSWORD"] != passwordArn || containerSecrets["DB_PASSWORD"] != databaseArn + ":password::" {
+    t.Errorf("unexpected container secrets %v", containerSecrets)
+  }
+}
+
+// TestClientTerraformVars reads secret refs into Terraform variables, taking string and number JSON keys.
+func TestClientTerraformVars(t *testing.T) {
+  client, _ := newFakeClient()
+  passwordArn := createSecrets(t, client, "password")
+
+  vars, err := client.TerraformVars(context.Background(), map[string]SecretRef{
+    "admin_password": {SecretId: passwordArn},
+    "db_password": {SecretId: "pac/dev/database", JsonKey: "password"},
+    "db_port": {SecretId: "pac/dev/database", JsonKey: "port"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  if vars["admin_password"] != "password" || vars["db_password"] != "password" || vars["db_port"] != "5432" {
+    t.Error("unexpected Terraform variables")
+  }
+}
+
+// TestClientTerraformVarsMissingKey checks that a ref to a JSON key the secret does not have is an error.
+func TestClientTerraformVarsMissingKey(t *testing.T) {
+  client, _ := newFakeClient()
+  createSecrets(t, client, "password")
+
+  _, err := client.TerraformVars(context.Background(), map[string]SecretRef{"missing": {SecretId: "pac/dev/database", JsonKey: "user"}})
+  if err == nil {
+    t.Error("expected an error for a missing JSON key")
+  }
+}
+
+// TestClientDeleteSecret schedules the deletion of a secret and checks it can no longer be read or referenced.
+func TestClientDeleteSecret(t *testing.T) {
+  ctx := context.Background()
+  client, _ := newFakeClient()
+  createSecrets(t, client, "password")
+
+  err := client.DeleteSecret(ctx, "pac/dev/database", 7)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := client.GetSecret(ctx, "pac/dev/database"); err == nil {
+    t.Error("expected an error reading a secret scheduled for deletion")
+  }
+  if _, err := client.ContainerSecrets(ctx, map[string]SecretRef{"DB": {SecretId: "pac/dev/database"}}); err == nil {
+    t.Error("expected an error referencing a secret scheduled for deletion")
+  }
+}
+
+// TestClientDeleteSecretAtOnce deletes a secret without a recovery window twice, which is not an error.
+func TestClientDeleteSecretAtOnce(t *testing.T) {
+  client, fake := newFakeClient()
+  passwordArn := createSecrets(t, client, "password")
+
+  for i := 0; i < 2; i++ {
+    err := client.DeleteSecret(context.Background(), passwordArn, 0)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  if _, ok := fake.Secrets["pac/dev/admin-password"]; ok {
+    t.Error("the secret was not deleted at once")
+  }
+}
@@ -0,0 +1,292 @@
+// Package secretsmanagerfake is an in-memory stand-in for the parts of the Secrets Manager API used by
+// the github.com/PyramidSystemsInc/go/aws/secretsmanager package, so it can be unit tested offline.
+package secretsmanagerfake
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// Secret is a secret with every version of its value.
+type Secret struct {
+	ARN         string
+	Name        string
+	Description string
+	KmsKeyId    string
+	Tags        []*secretsmanager.Tag
+	// Versions maps version ids to values, and Stages maps AWSCURRENT and AWSPREVIOUS to version ids.
+	Versions    map[string]string
+	Stages      map[string]string
+	DeletedDate *time.Time
+}
+
+// SecretsManager keeps secrets in memory, keyed by name. Calling an operation that is not
+// implemented panics.
+type SecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+
+	mutex     sync.Mutex
+	counter   int
+	Region    string
+	AccountID string
+	Secrets   map[string]*Secret
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *SecretsManager {
+	return &SecretsManager{
+		Region:    "us-east-1",
+		AccountID: "123456789012",
+		Secrets:   map[string]*Secret{},
+	}
+}
+
+// CreateSecretWithContext creates a secret whose first version is AWSCURRENT.
+func (fake *SecretsManager) CreateSecretWithContext(ctx aws.Context, input *secretsmanager.CreateSecretInput, opts ...request.Option) (*secretsmanager.CreateSecretOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	if existing, ok := fake.Secrets[name]; ok {
+		if existing.DeletedDate != nil {
+			return nil, awserr.New(secretsmanager.ErrCodeInvalidRequestException, "You can't create this secret because a secret with this name is already scheduled for deletion.", nil)
+		}
+		return nil, awserr.New(secretsmanager.ErrCodeResourceExistsException, "The operation failed because the secret "+name+" already exists.", nil)
+	}
+	if input.SecretString == nil && input.SecretBinary == nil {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidRequestException, "You must provide either SecretString or SecretBinary.", nil)
+	}
+	secret := &Secret{
+		ARN:         fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s-%06d", fake.Region, fake.AccountID, name, len(fake.Secrets)+1),
+		Name:        name,
+		Description: aws.StringValue(input.Description),
+		KmsKeyId:    aws.StringValue(input.KmsKeyId),
+		Tags:        input.Tags,
+		Versions:    map[string]string{},
+		Stages:      map[string]string{},
+	}
+	versionId := fake.put(secret, input.ClientRequestToken, aws.StringValue(input.SecretString))
+	fake.Secrets[name] = secret
+	return &secretsmanager.CreateSecretOutput{
+		ARN:       aws.String(secret.ARN),
+		Name:      aws.String(name),
+		VersionId: aws.String(versionId),
+	}, nil
+}
+
+// DeleteSecretWithContext removes a secret at once, or marks it as deleted until it would be removed.
+func (fake *SecretsManager) DeleteSecretWithContext(ctx aws.Context, input *secretsmanager.DeleteSecretInput, opts ...request.Option) (*secretsmanager.DeleteSecretOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	secret, err := fake.secret(input.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	days := aws.Int64Value(input.RecoveryWindowInDays)
+	if aws.BoolValue(input.ForceDeleteWithoutRecovery) {
+		if days != 0 {
+			return nil, awserr.New(secretsmanager.ErrCodeInvalidParameterException, "You can't use ForceDeleteWithoutRecovery in conjunction with RecoveryWindowInDays.", nil)
+		}
+		delete(fake.Secrets, secret.Name)
+		return &secretsmanager.DeleteSecretOutput{
+			ARN:          aws.String(secret.ARN),
+			DeletionDate: aws.Time(time.Now()),
+			Name:         aws.String(secret.Name),
+		}, nil
+	}
+	if days == 0 {
+		days = 30
+	}
+	if days < 7 || days > 30 {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidParameterException, "RecoveryWindowInDays must be between 7 and 30", nil)
+	}
+	if secret.DeletedDate == nil {
+		secret.DeletedDate = aws.Time(time.Now())
+	}
+	return &secretsmanager.DeleteSecretOutput{
+		ARN:          aws.String(secret.ARN),
+		DeletionDate: aws.Time(secret.DeletedDate.AddDate(0, 0, int(days))),
+		Name:         aws.String(secret.Name),
+	}, nil
+}
+
+// DescribeSecretWithContext returns the settings of a secret, including one marked as deleted.
+func (fake *SecretsManager) DescribeSecretWithContext(ctx aws.Context, input *secretsmanager.DescribeSecretInput, opts ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	secret, err := fake.secret(input.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	output := &secretsmanager.DescribeSecretOutput{
+		ARN:                aws.String(secret.ARN),
+		DeletedDate:        secret.DeletedDate,
+		Name:               aws.String(secret.Name),
+		Tags:               secret.Tags,
+		VersionIdsToStages: map[string][]*string{},
+	}
+	if secret.Description != "" {
+		output.Description = aws.String(secret.Description)
+	}
+	if secret.KmsKeyId != "" {
+		output.KmsKeyId = aws.String(secret.KmsKeyId)
+	}
+	for stage, versionId := range secret.Stages {
+		output.VersionIdsToStages[versionId] = append(output.VersionIdsToStages[versionId], aws.String(stage))
+	}
+	return output, nil
+}
+
+// GetRandomPasswordWithContext returns a random password of the letters, numbers and punctuation
+// not excluded, with one of each included type when RequireEachIncludedType is set.
+func (fake *SecretsManager) GetRandomPasswordWithContext(ctx aws.Context, input *secretsmanager.GetRandomPasswordInput, opts ...request.Option) (*secretsmanager.GetRandomPasswordOutput, error) {
+	length := int(aws.Int64Value(input.PasswordLength))
+	if input.PasswordLength == nil {
+		length = 32
+	}
+	keep := func(characters string, excluded *bool) string {
+		if aws.BoolValue(excluded) {
+			return ""
+		}
+		return strings.Map(func(character rune) rune {
+			if strings.ContainsRune(aws.StringValue(input.ExcludeCharacters), character) {
+				return -1
+			}
+			return character
+		}, characters)
+	}
+	var types []string
+	for _, characters := range []string{
+		keep("ABCDEFGHIJKLMNOPQRSTUVWXYZ", input.ExcludeUppercase),
+		keep("abcdefghijklmnopqrstuvwxyz", input.ExcludeLowercase),
+		keep("0123456789", input.ExcludeNumbers),
+		keep("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", input.ExcludePunctuation),
+	} {
+		if characters != "" {
+			types = append(types, characters)
+		}
+	}
+	if length < 1 || length > 4096 || len(types) == 0 || (aws.BoolValue(input.RequireEachIncludedType) && length < len(types)) {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidParameterException, "The password cannot be generated with these settings", nil)
+	}
+	password := make([]byte, length)
+	for i := range password {
+		characters := strings.Join(types, "")
+		if aws.BoolValue(input.RequireEachIncludedType) && i < len(types) {
+			characters = types[i]
+		}
+		password[i] = characters[randomInt(len(characters))]
+	}
+	for i := len(password) - 1; i > 0; i-- {
+		j := randomInt(i + 1)
+		password[i], password[j] = password[j], password[i]
+	}
+	return &secretsmanager.GetRandomPasswordOutput{
+		RandomPassword: aws.String(string(password)),
+	}, nil
+}
+
+// GetSecretValueWithContext returns the AWSCURRENT value of a secret, or the version or stage asked for.
+func (fake *SecretsManager) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	secret, err := fake.secret(input.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	if secret.DeletedDate != nil {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidRequestException, "You can't perform this operation on the secret because it was marked for deletion.", nil)
+	}
+	versionId := aws.StringValue(input.VersionId)
+	if versionId == "" {
+		stage := aws.StringValue(input.VersionStage)
+		if stage == "" {
+			stage = "AWSCURRENT"
+		}
+		versionId = secret.Stages[stage]
+	}
+	value, ok := secret.Versions[versionId]
+	if !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "Secrets Manager can't find the specified secret value.", nil)
+	}
+	var stages []*string
+	for stage, stageVersionId := range secret.Stages {
+		if stageVersionId == versionId {
+			stages = append(stages, aws.String(stage))
+		}
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:           aws.String(secret.ARN),
+		Name:          aws.String(secret.Name),
+		SecretString:  aws.String(value),
+		VersionId:     aws.String(versionId),
+		VersionStages: stages,
+	}, nil
+}
+
+// PutSecretValueWithContext adds a version that becomes AWSCURRENT, moving the current one to
+// AWSPREVIOUS. Only the current and previous versions are kept.
+func (fake *SecretsManager) PutSecretValueWithContext(ctx aws.Context, input *secretsmanager.PutSecretValueInput, opts ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	secret, err := fake.secret(input.SecretId)
+	if err != nil {
+		return nil, err
+	}
+	if secret.DeletedDate != nil {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidRequestException, "You can't perform this operation on the secret because it was marked for deletion.", nil)
+	}
+	versionId := fake.put(secret, input.ClientRequestToken, aws.StringValue(input.SecretString))
+	return &secretsmanager.PutSecretValueOutput{
+		ARN:           aws.String(secret.ARN),
+		Name:          aws.String(secret.Name),
+		VersionId:     aws.String(versionId),
+		VersionStages: []*string{aws.String("AWSCURRENT")},
+	}, nil
+}
+
+// put stores a new AWSCURRENT version, making the current one AWSPREVIOUS and dropping any older one.
+func (fake *SecretsManager) put(secret *Secret, clientRequestToken *string, value string) string {
+	versionId := aws.StringValue(clientRequestToken)
+	if versionId == "" {
+		fake.counter++
+		versionId = fmt.Sprintf("00000000-0000-0000-0000-%012d", fake.counter)
+	}
+	if previous, ok := secret.Stages["AWSPREVIOUS"]; ok {
+		delete(secret.Versions, previous)
+	}
+	if current, ok := secret.Stages["AWSCURRENT"]; ok {
+		secret.Stages["AWSPREVIOUS"] = current
+	}
+	secret.Versions[versionId] = value
+	secret.Stages["AWSCURRENT"] = versionId
+	return versionId
+}
+
+// secret finds a secret by name, ARN or ARN without its random suffix.
+func (fake *SecretsManager) secret(secretId *string) (*Secret, error) {
+	id := aws.StringValue(secretId)
+	if secret, ok := fake.Secrets[id]; ok {
+		return secret, nil
+	}
+	for _, secret := range fake.Secrets {
+		if id == secret.ARN || id == secret.ARN[:len(secret.ARN)-7] {
+			return secret, nil
+		}
+	}
+	return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "Secrets Manager can't find the specified secret.", nil)
+}
+
+func randomInt(limit int) int {
+	value, _ := rand.Int(rand.Reader, big.NewInt(int64(limit)))
+	return int(value.Int64())
+}
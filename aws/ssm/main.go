@@ -0,0 +1,180 @@
+package ssm
+
+import (
+  "context"
+  "regexp"
+  "strings"
+
+  "github.com/PyramidSystemsInc/go/errors"
+  "github.com/PyramidSystemsInc/go/str"
+  "github.com/aws/aws-sdk-go/aws"
+  "github.com/aws/aws-sdk-go/aws/awserr"
+  "github.com/aws/aws-sdk-go/aws/session"
+  "github.com/aws/aws-sdk-go/service/ssm"
+  "github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// Client stores and reads SecureString parameters of the SSM Parameter Store.
+type Client struct {
+  SSM ssmiface.SSMAPI
+}
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+  return &Client{
+    SSM: ssm.New(awsSession),
+  }
+}
+
+// DeleteParameter deletes a parameter from the Systems Manager Parameter Store, or exits if it cannot be deleted.
+func DeleteParameter(name string, awsSession *session.Session) {
+  errors.QuitIfError(DeleteParameterE(name, awsSession))
+}
+
+// DeleteParameterE is DeleteParameter returning an error instead of exiting.
+func DeleteParameterE(name string, awsSession *session.Session) error {
+  return DeleteParameterWithContext(context.Background(), name, awsSession)
+}
+
+// DeleteParameterWithContext is DeleteParameterE with a context to allow cancellation.
+func DeleteParameterWithContext(ctx context.Context, name string, awsSession *session.Session) error {
+  return New(awsSession).DeleteParameter(ctx, name)
+}
+
+// DeleteParameter deletes a parameter. Deleting a parameter that does not exist is not an error.
+func (client *Client) DeleteParameter(ctx context.Context, name string) error {
+  _, err := client.SSM.DeleteParameterWithContext(ctx, &ssm.DeleteParameterInput{
+    Name: aws.String(name),
+  })
+  if isErrorCode(err, ssm.ErrCodeParameterNotFound) {
+    return nil
+  }
+  return err
+}
+
+// GetParameter returns the decrypted value of a parameter in the Systems Manager Parameter Store, or exits if it cannot be read.
+func GetParameter(name string, awsSession *session.Session) string {
+  value, err := GetParameterE(name, awsSession)
+  errors.QuitIfError(err)
+  return value
+}
+
+// GetParameterE is GetParameter returning an error instead of exiting.
+func GetParameterE(name string, awsSession *session.Session) (string, error) {
+  return GetParameterWithContext(context.Background(), name, awsSession)
+}
+
+// GetParameterWithContext is GetParameterE with a context to allow cancellation.
+func GetParameterWithContext(ctx context.Context, name string, awsSession *session.Session) (string, error) {
+  return New(awsSession).GetParameter(ctx, name)
+}
+
+// GetParameter returns the value of a parameter, decrypting SecureStrings, or an error if it does not exist.
+func (client *Client) GetParameter(ctx context.Context, name string) (string, error) {
+  result, err := client.SSM.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+    Name: aws.String(name),
+    WithDecryption: aws.Bool(true),
+  })
+  if isErrorCode(err, ssm.ErrCodeParameterNotFound) {
+    return "", errors.New(str.Concat("The SSM parameter ", name, " does not exist"))
+  }
+  if err != nil {
+    return "", err
+  }
+  return aws.StringValue(result.Parameter.Value), nil
+}
+
+// GetParametersByPath returns the decrypted values of every parameter under a path, such as /pac/dev, or exits if they cannot be read.
+func GetParametersByPath(path string, awsSession *session.Session) map[string]string {
+  values, err := GetParametersByPathE(path, awsSession)
+  errors.QuitIfError(err)
+  return values
+}
+
+// GetParametersByPathE is GetParametersByPath returning an error instead of exiting.
+func GetParametersByPathE(path string, awsSession *session.Session) (map[string]string, error) {
+  return GetParametersByPathWithContext(context.Background(), path, awsSession)
+}
+
+// GetParametersByPathWithContext is GetParametersByPathE with a context to allow cancellation.
+func GetParametersByPathWithContext(ctx context.Context, path string, awsSession *session.Session) (map[string]string, error) {
+  return New(awsSession).GetParametersByPath(ctx, path)
+}
+
+// GetParametersByPath returns the values of every parameter under a path and its sub-paths, decrypting SecureStrings.
+// The map is keyed by the name relative to the path with every character other than a letter, digit or underscore
+// turned into an underscore, so /pac/dev/db/password under /pac/dev is db_password, a valid Terraform variable and
+// environment variable name. Names that turn into the same key are an error. StringLists are kept comma separated
+func (client *Client) GetParametersByPath(ctx context.Context, path string) (map[string]string, error) {
+  if !strings.HasPrefix(path, "/") {
+    return nil, errors.New(str.Concat("The SSM parameter path ", path, " does not start with /"))
+  }
+  prefix := strings.TrimSuffix(path, "/") + "/"
+  values := map[string]string{}
+  names := map[string]string{}
+  var collision error
+  err := client.SSM.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+    Path: aws.String(path),
+    Recursive: aws.Bool(true),
+    WithDecryption: aws.Bool(true),
+  }, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+    for _, parameter := range page.Parameters {
+      name := aws.StringValue(parameter.Name)
+      key := invalidKeyCharacters.ReplaceAllString(strings.TrimPrefix(name, prefix), "_")
+      if other, ok := names[key]; ok {
+        collision = errors.New(str.Concat("The SSM parameters ", other, " and ", name, " would both be read as ", key))
+        return false
+      }
+      names[key] = name
+      values[key] = aws.StringValue(parameter.Value)
+    }
+    return true
+  })
+  if err == nil {
+    err = collision
+  }
+  if err != nil {
+    return nil, err
+  }
+  return values, nil
+}
+
+// PutParameter stores a value as a SecureString encrypted with a KMS key, such as one from kms.CreateEncryptionKey,
+// replacing any previous value, or exits if it cannot be stored.
+func PutParameter(name string, value string, keyId string, awsSession *session.Session) {
+  errors.QuitIfError(PutParameterE(name, value, keyId, awsSession))
+}
+
+// PutParameterE is PutParameter returning an error instead of exiting.
+func PutParameterE(name string, value string, keyId string, awsSession *session.Session) error {
+  return PutParameterWithContext(context.Background(), name, value, keyId, awsSession)
+}
+
+// PutParameterWithContext is PutParameterE with a context to allow cancellation.
+func PutParameterWithContext(ctx context.Context, name string, value string, keyId string, awsSession *session.Session) error {
+  return New(awsSession).PutParameter(ctx, name, value, keyId)
+}
+
+// PutParameter stores a value as a SecureString, replacing any previous value. The KMS key may be given by id, ARN or
+// alias. Without one, the AWS managed key of the account (alias/aws/ssm) is used.
+func (client *Client) PutParameter(ctx context.Context, name string, value string, keyId string) error {
+  input := &ssm.PutParameterInput{
+    Name: aws.String(name),
+    Overwrite: aws.Bool(true),
+    Type: aws.String(ssm.ParameterTypeSecureString),
+    Value: aws.String(value),
+  }
+  if keyId != "" {
+    input.KeyId = aws.String(keyId)
+  }
+  _, err := client.SSM.PutParameterWithContext(ctx, input)
+  return err
+}
+
+// invalidKeyCharacters matches what GetParametersByPath turns into underscores in its keys.
+var invalidKeyCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func isErrorCode(err error, code string) bool {
+  awsErr, ok := err.(awserr.Error)
+  return ok && awsErr.Code() == code
+}
@@ -0,0 +1,115 @@
+package ssm
+
+import (
+  "context"
+  "testing"
+
+  packms "github.com/PyramidSystemsInc/go/aws/kms"
+  "github.com/PyramidSystemsInc/go/aws/kms/kmsfake"
+  "github.com/PyramidSystemsInc/go/aws/ssm/ssmfake"
+)
+
+// newFakeClient returns a client of a fake that lists two parameters a page, with a key from CreateEncryptionKey to
+// encrypt SecureStrings with.
+func newFakeClient(t *testing.T) (*Client, *ssmfake.SSM, string) {
+  fake := ssmfake.New()
+  fake.PageSize = 2
+  keyId, err := (&packms.Client{KMS: kmsfake.New()}).CreateEncryptionKey(context.Background(), "project", "ssm-test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  return &Client{SSM: fake}, fake, keyId
+}
+
+func putParameters(t *testing.T, client *Client, keyId string, parameters map[string]string) {
+  for name, value := range parameters {
+    err := client.PutParameter(context.Background(), name, value, keyId)
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+}
+
+// TestClientPutParameter overwrites a SecureString and reads the new value back decrypted.
+func TestClientPutParameter(t *testing.T) {
+  ctx := context.Background()
+  client, fake, keyId := newFakeClient(t)
+  putParameters(t, client, keyId, map[string]string{"/pac/dev/DB_PASSWORD": "first"})
+
+  err := client.PutParameter(ctx, "/pac/dev/DB_PASSWORD", "second", keyId)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if fake.KeyIDs["/pac/dev/DB_PASSWORD"] != keyId {
+    t.Errorf("the parameter was not encrypted with the key %s", keyId)
+  }
+  value, err := client.GetParameter(ctx, "/pac/dev/DB_PASSWORD")
+  if err != nil || value != "second" {
+    t.Errorf("expected the decrypted value second, got %q and error %v", value, err)
+  }
+}
+
+// TestClientGetParametersByPath reads the parameters under a path across pages, keyed by the rest of their names
+// with / made _, and leaves out those under other paths.
+func TestClientGetParametersByPath(t *testing.T) {
+  client, _, keyId := newFakeClient(t)
+  putParameters(t, client, keyId, map[string]string{
+    "/pac/dev/DB_HOST": "db.internal",
+    "/pac/dev/DB_PASSWORD": "second",
+    "/pac/dev/api/TOKEN": "token",
+    "/pac/prod/DB_PASSWORD": "prod",
+  })
+
+  values, err := client.GetParametersByPath(context.Background(), "/pac/dev/")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(values) != 3 || values["DB_HOST"] != "db.internal" || values["DB_PASSWORD"] != "second" || values["api_TOKEN"] != "token" {
+    t.Errorf("unexpected parameters %v", values)
+  }
+}
+
+// TestClientGetParametersByPathRelative checks that a path has to start with a /.
+func TestClientGetParametersByPathRelative(t *testing.T) {
+  client, _, _ := newFakeClient(t)
+
+  _, err := client.GetParametersByPath(context.Background(), "pac/dev")
+  if err == nil {
+    t.Error("expected an error for a path without a leading /")
+  }
+}
+
+// TestClientGetParametersByPathCollision checks that two parameters whose names make the same key are refused rather
+// than one hiding the other.
+func TestClientGetParametersByPathCollision(t *testing.T) {
+  client, _, keyId := newFakeClient(t)
+  putParameters(t, client, keyId, map[string]string{
+    "/pac/prod/api_TOKEN": "flat",
+    "/pac/prod/api/TOKEN": "nested",
+  })
+
+  _, err := client.GetParametersByPath(context.Background(), "/pac/prod")
+  if err == nil {
+    t.Error("expected an error for parameters read as the same key")
+  }
+}
+
+// TestClientDeleteParameter deletes a parameter twice, which is not an error, and then fails to read it.
+func TestClientDeleteParameter(t *testing.T) {
+  ctx := context.Background()
+  client, _, keyId := newFakeClient(t)
+  putParameters(t, client, keyId, map[string]string{"/pac/dev/DB_PASSWORD": "first"})
+
+  err := client.DeleteParameter(ctx, "/pac/dev/DB_PASSWORD")
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = client.DeleteParameter(ctx, "/pac/dev/DB_PASSWORD")
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = client.GetParameter(ctx, "/pac/dev/DB_PASSWORD")
+  if err == nil {
+    t.Error("expected an error reading a deleted parameter")
+  }
+}
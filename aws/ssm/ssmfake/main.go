@@ -0,0 +1,172 @@
+// Package ssmfake is an in-memory stand-in for the parts of the SSM API used by the
+// github.com/PyramidSystemsInc/go/aws/ssm package, so it can be unit tested offline.
+package ssmfake
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SSM keeps parameters in memory, keyed by name. SecureStrings are returned base64 encoded
+// unless decryption is asked for. Calling an operation that is not implemented panics.
+type SSM struct {
+	ssmiface.SSMAPI
+
+	mutex      sync.Mutex
+	Region     string
+	AccountID  string
+	Parameters map[string]*ssm.Parameter
+	// KeyIDs holds the KMS key of each SecureString, by name.
+	KeyIDs map[string]string
+	// PageSize is the number of parameters GetParametersByPath returns per page.
+	PageSize int
+}
+
+// New returns an empty fake in us-east-1 for account 123456789012.
+func New() *SSM {
+	return &SSM{
+		Region:     "us-east-1",
+		AccountID:  "123456789012",
+		Parameters: map[string]*ssm.Parameter{},
+		KeyIDs:     map[string]string{},
+		PageSize:   10,
+	}
+}
+
+// PutParameterWithContext creates a parameter, or replaces it when Overwrite is set.
+func (fake *SSM) PutParameterWithContext(ctx aws.Context, input *ssm.PutParameterInput, opts ...request.Option) (*ssm.PutParameterOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	if !strings.HasPrefix(name, "/") && strings.Contains(name, "/") {
+		return nil, awserr.New("ValidationException", "Parameter name: a name formed as a path must begin with /: "+name, nil)
+	}
+	existing, ok := fake.Parameters[name]
+	if ok && !aws.BoolValue(input.Overwrite) {
+		return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "The parameter already exists. To overwrite this value, set the overwrite option in the request to true.", nil)
+	}
+	version := int64(1)
+	if ok {
+		version = aws.Int64Value(existing.Version) + 1
+	}
+	parameterType := aws.StringValue(input.Type)
+	if parameterType == "" && ok {
+		parameterType = aws.StringValue(existing.Type)
+	}
+	fake.Parameters[name] = &ssm.Parameter{
+		ARN:              aws.String("arn:aws:ssm:" + fake.Region + ":" + fake.AccountID + ":parameter/" + strings.TrimPrefix(name, "/")),
+		DataType:         aws.String("text"),
+		LastModifiedDate: aws.Time(time.Now()),
+		Name:             aws.String(name),
+		Type:             aws.String(parameterType),
+		Value:            input.Value,
+		Version:          aws.Int64(version),
+	}
+	if parameterType == ssm.ParameterTypeSecureString {
+		keyID := aws.StringValue(input.KeyId)
+		if keyID == "" {
+			keyID = "alias/aws/ssm"
+		}
+		fake.KeyIDs[name] = keyID
+	} else {
+		delete(fake.KeyIDs, name)
+	}
+	return &ssm.PutParameterOutput{
+		Tier:    aws.String(ssm.ParameterTierStandard),
+		Version: aws.Int64(version),
+	}, nil
+}
+
+// GetParameterWithContext returns a parameter by name.
+func (fake *SSM) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	parameter, ok := fake.Parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "", nil)
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: fake.read(parameter, aws.BoolValue(input.WithDecryption)),
+	}, nil
+}
+
+// DeleteParameterWithContext deletes a parameter by name.
+func (fake *SSM) DeleteParameterWithContext(ctx aws.Context, input *ssm.DeleteParameterInput, opts ...request.Option) (*ssm.DeleteParameterOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	name := aws.StringValue(input.Name)
+	if _, ok := fake.Parameters[name]; !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "", nil)
+	}
+	delete(fake.Parameters, name)
+	delete(fake.KeyIDs, name)
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+// GetParametersByPathWithContext returns a page of the parameters under a path, sorted by name,
+// only including those of sub-paths when Recursive is set. The next token is the offset of the
+// following page.
+func (fake *SSM) GetParametersByPathWithContext(ctx aws.Context, input *ssm.GetParametersByPathInput, opts ...request.Option) (*ssm.GetParametersByPathOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	prefix := strings.TrimSuffix(aws.StringValue(input.Path), "/") + "/"
+	var names []string
+	for name := range fake.Parameters {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if aws.BoolValue(input.Recursive) || !strings.Contains(strings.TrimPrefix(name, prefix), "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	offset := 0
+	if input.NextToken != nil {
+		offset, _ = strconv.Atoi(*input.NextToken)
+	}
+	output := &ssm.GetParametersByPathOutput{}
+	end := offset + fake.PageSize
+	if end < len(names) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	} else {
+		end = len(names)
+	}
+	for _, name := range names[offset:end] {
+		output.Parameters = append(output.Parameters, fake.read(fake.Parameters[name], aws.BoolValue(input.WithDecryption)))
+	}
+	return output, nil
+}
+
+// GetParametersByPathPagesWithContext calls fn with every page of GetParametersByPathWithContext until fn returns false.
+func (fake *SSM) GetParametersByPathPagesWithContext(ctx aws.Context, input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool, opts ...request.Option) error {
+	page := *input
+	for {
+		output, err := fake.GetParametersByPathWithContext(ctx, &page, opts...)
+		if err != nil {
+			return err
+		}
+		if !fn(output, output.NextToken == nil) || output.NextToken == nil {
+			return nil
+		}
+		page.NextToken = output.NextToken
+	}
+}
+
+// read returns a copy of a parameter whose SecureString value is only readable with decryption.
+func (fake *SSM) read(parameter *ssm.Parameter, withDecryption bool) *ssm.Parameter {
+	copied := *parameter
+	if aws.StringValue(parameter.Type) == ssm.ParameterTypeSecureString && !withDecryption {
+		copied.Value = aws.String(base64.StdEncoding.EncodeToString([]byte(aws.StringValue(parameter.Value))))
+	}
+	return &copied
+}
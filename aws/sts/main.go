@@ -1,38 +1,205 @@
 package sts
 
 import (
-	"encoding/json"
-	"fmt"
-	"strings"
+	"context"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/PyramidSystemsInc/go/errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
-// GetAccountID returns AWS account ID of the account being used to call it.
-func GetAccountID() string {
-	svc := sts.New(session.New())
-	input := &sts.GetCallerIdentityInput{}
+// Client looks up the caller and gets temporary credentials through STS.
+type Client struct {
+	STS stsiface.STSAPI
 
-	result, err := svc.GetCallerIdentity(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+	// awsSession is copied by AssumeRole and GetSessionToken, so the sessions they return keep its region and endpoint.
+	awsSession *session.Session
+}
+
+// Identity is who the credentials of a session belong to.
+type Identity struct {
+	Account string
+	Arn     string
+	UserId  string
+}
+
+// AssumeRoleOptions are the optional settings of AssumeRole.
+type AssumeRoleOptions struct {
+	// ExternalID is required by trust policies that guard against the confused deputy problem.
+	ExternalID string
+	// SessionName shows up in CloudTrail and the assumed role ARN. It defaults to a name generated by the SDK.
+	SessionName string
+	// Duration defaults to 15 minutes. The credentials are refreshed when they expire.
+	Duration time.Duration
+	// Policy is a JSON session policy that further limits what the role can do.
+	Policy string
+}
+
+// SessionTokenOptions are the optional settings of GetSessionToken.
+type SessionTokenOptions struct {
+	// Duration defaults to 12 hours.
+	Duration time.Duration
+	// MFASerial is the serial number or ARN of the MFA device of the user, required with TokenCode.
+	MFASerial string
+	TokenCode string
+}
+
+// New returns a Client that talks to AWS using the given session.
+func New(awsSession *session.Session) *Client {
+	return &Client{
+		STS:        sts.New(awsSession),
+		awsSession: awsSession,
+	}
+}
+
+// AssumeRole returns a session that acts as the role, or exits if it cannot be assumed.
+func AssumeRole(roleArn string, options AssumeRoleOptions, awsSession *session.Session) *session.Session {
+	roleSession, err := AssumeRoleE(roleArn, options, awsSession)
+	errors.QuitIfError(err)
+	return roleSession
+}
+
+// AssumeRoleE returns a session that acts as the role, or an error if it cannot be assumed.
+func AssumeRoleE(roleArn string, options AssumeRoleOptions, awsSession *session.Session) (*session.Session, error) {
+	return AssumeRoleWithContext(context.Background(), roleArn, options, awsSession)
+}
+
+// AssumeRoleWithContext is AssumeRoleE with a context to allow cancellation.
+func AssumeRoleWithContext(ctx context.Context, roleArn string, options AssumeRoleOptions, awsSession *session.Session) (*session.Session, error) {
+	return New(awsSession).AssumeRole(ctx, roleArn, options)
+}
+
+// AssumeRole returns a copy of the client's session (keeping its region and endpoint) that acts as the role, such as
+// one in another account, or an error if it cannot be assumed. The role is assumed right away so that a missing
+// permission or a wrong external ID fails here, and again whenever the credentials expire.
+func (client *Client) AssumeRole(ctx context.Context, roleArn string, options AssumeRoleOptions) (*session.Session, error) {
+	roleCredentials := stscreds.NewCredentialsWithClient(client.STS, roleArn, func(provider *stscreds.AssumeRoleProvider) {
+		if options.ExternalID != "" {
+			provider.ExternalID = aws.String(options.ExternalID)
+		}
+		if options.SessionName != "" {
+			provider.RoleSessionName = options.SessionName
+		}
+		if options.Duration != 0 {
+			provider.Duration = options.Duration
+		}
+		if options.Policy != "" {
+			provider.Policy = aws.String(options.Policy)
 		}
-		return "unable to get caller identity"
+	})
+	_, err := roleCredentials.GetWithContext(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return client.sessionWith(roleCredentials)
+}
+
+// GetAccountID returns AWS account ID of the account the session's credentials belong to, or exits if it cannot be found.
+func GetAccountID(awsSession *session.Session) string {
+	accountID, err := GetAccountIDE(awsSession)
+	errors.QuitIfError(err)
+	return accountID
+}
 
-	r, _ := json.Marshal(result.Account)
-	r1 := string(r)
-	r2 := strings.Replace(r1, "\"", "", -1)
+// GetAccountIDE returns AWS account ID of the account the session's credentials belong to, or an error.
+func GetAccountIDE(awsSession *session.Session) (string, error) {
+	return GetAccountIDWithContext(context.Background(), awsSession)
+}
 
-	return r2
+// GetAccountIDWithContext is GetAccountIDE with a context to allow cancellation.
+func GetAccountIDWithContext(ctx context.Context, awsSession *session.Session) (string, error) {
+	return New(awsSession).GetAccountID(ctx)
+}
+
+// GetAccountID returns AWS account ID of the account the client's credentials belong to, or an error.
+func (client *Client) GetAccountID(ctx context.Context) (string, error) {
+	identity, err := client.GetCallerIdentity(ctx)
+	return identity.Account, err
+}
+
+// GetCallerIdentity returns who the session's credentials belong to, or exits if they are not valid.
+func GetCallerIdentity(awsSession *session.Session) Identity {
+	identity, err := GetCallerIdentityE(awsSession)
+	errors.QuitIfError(err)
+	return identity
+}
+
+// GetCallerIdentityE returns who the session's credentials belong to, or an error if they are not valid.
+func GetCallerIdentityE(awsSession *session.Session) (Identity, error) {
+	return GetCallerIdentityWithContext(context.Background(), awsSession)
+}
+
+// GetCallerIdentityWithContext is GetCallerIdentityE with a context to allow cancellation.
+func GetCallerIdentityWithContext(ctx context.Context, awsSession *session.Session) (Identity, error) {
+	return New(awsSession).GetCallerIdentity(ctx)
+}
+
+// GetCallerIdentity returns who the client's credentials belong to, or an error if they are not valid.
+func (client *Client) GetCallerIdentity(ctx context.Context) (Identity, error) {
+	result, err := client.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{
+		Account: aws.StringValue(result.Account),
+		Arn:     aws.StringValue(result.Arn),
+		UserId:  aws.StringValue(result.UserId),
+	}, nil
+}
+
+// GetSessionToken returns a session with temporary credentials of the session's user, or exits if they cannot be issued.
+func GetSessionToken(options SessionTokenOptions, awsSession *session.Session) *session.Session {
+	tokenSession, err := GetSessionTokenE(options, awsSession)
+	errors.QuitIfError(err)
+	return tokenSession
+}
+
+// GetSessionTokenE returns a session with temporary credentials of the session's user, or an error if they cannot be issued.
+func GetSessionTokenE(options SessionTokenOptions, awsSession *session.Session) (*session.Session, error) {
+	return GetSessionTokenWithContext(context.Background(), options, awsSession)
+}
+
+// GetSessionTokenWithContext is GetSessionTokenE with a context to allow cancellation.
+func GetSessionTokenWithContext(ctx context.Context, options SessionTokenOptions, awsSession *session.Session) (*session.Session, error) {
+	return New(awsSession).GetSessionToken(ctx, options)
+}
+
+// GetSessionToken returns a copy of the client's session with temporary credentials of its user, such as ones that
+// satisfy an MFA condition when given a token code, or an error if they cannot be issued. Unlike those of AssumeRole,
+// the credentials are not refreshed, so the session stops working once they expire.
+func (client *Client) GetSessionToken(ctx context.Context, options SessionTokenOptions) (*session.Session, error) {
+	input := &sts.GetSessionTokenInput{}
+	if options.Duration != 0 {
+		input.DurationSeconds = aws.Int64(int64(options.Duration / time.Second))
+	}
+	if options.MFASerial != "" {
+		input.SerialNumber = aws.String(options.MFASerial)
+		input.TokenCode = aws.String(options.TokenCode)
+	}
+	result, err := client.STS.GetSessionTokenWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return client.sessionWith(credentials.NewStaticCredentials(
+		aws.StringValue(result.Credentials.AccessKeyId),
+		aws.StringValue(result.Credentials.SecretAccessKey),
+		aws.StringValue(result.Credentials.SessionToken),
+	))
+}
+
+// sessionWith copies the client's session, or a session from the environment when there is none, with other credentials.
+func (client *Client) sessionWith(sessionCredentials *credentials.Credentials) (*session.Session, error) {
+	if client.awsSession != nil {
+		return client.awsSession.Copy(&aws.Config{
+			Credentials: sessionCredentials,
+		}), nil
+	}
+	return session.NewSession(&aws.Config{
+		Credentials: sessionCredentials,
+	})
 }
@@ -0,0 +1,86 @@
+package sts
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PyramidSystemsInc/go/aws/sts/stsfake"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func newFakeClient() (*Client, *stsfake.STS) {
+	fake := stsfake.New()
+	return &Client{STS: fake}, fake
+}
+
+// TestClientGetCallerIdentity checks that the account, ARN and user ID of the caller are returned.
+func TestClientGetCallerIdentity(t *testing.T) {
+	client, fake := newFakeClient()
+
+	identity, err := client.GetCallerIdentity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Account != "123456789012" || identity.Arn != fake.Arn || identity.UserId != fake.UserID {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+// TestClientAssumeRole assumes a role with an external ID, a session name and a duration, and checks the session
+// signs with the temporary credentials.
+func TestClientAssumeRole(t *testing.T) {
+	client, fake := newFakeClient()
+	roleArn := "arn:aws:iam::210987654321:role/deployer"
+	fake.ExternalIDs[roleArn] = "shared-secret"
+
+	roleSession, err := client.AssumeRole(context.Background(), roleArn, AssumeRoleOptions{
+		ExternalID:  "shared-secret",
+		SessionName: "deploy",
+		Duration:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := roleSession.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value.AccessKeyID, "ASIA") || value.SessionToken == "" {
+		t.Errorf("unexpected credentials %+v", value)
+	}
+	input := fake.AssumedRoles[len(fake.AssumedRoles)-1]
+	if aws.StringValue(input.RoleSessionName) != "deploy" || aws.Int64Value(input.DurationSeconds) != 3600 {
+		t.Errorf("unexpected assume role input %v", input)
+	}
+}
+
+// TestClientAssumeRoleExternalID checks that a role requiring an external ID is not assumed without it.
+func TestClientAssumeRoleExternalID(t *testing.T) {
+	client, fake := newFakeClient()
+	roleArn := "arn:aws:iam::210987654321:role/deployer"
+	fake.ExternalIDs[roleArn] = "shared-secret"
+
+	_, err := client.AssumeRole(context.Background(), roleArn, AssumeRoleOptions{})
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("expected access to be denied without the external ID, got %v", err)
+	}
+}
+
+// TestClientGetSessionToken gets a session token with an MFA code and checks the session signs with its credentials.
+func TestClientGetSessionToken(t *testing.T) {
+	client, _ := newFakeClient()
+
+	tokenSession, err := client.GetSessionToken(context.Background(), SessionTokenOptions{
+		MFASerial: "arn:aws:iam::123456789012:mfa/pac",
+		TokenCode: "123456",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := tokenSession.Config.Credentials.Get()
+	if err != nil || !strings.HasPrefix(value.AccessKeyID, "ASIA") || value.SessionToken == "" {
+		t.Errorf("unexpected session token credentials %+v (error %v)", value, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package stsfake is an in-memory stand-in for the parts of the STS API used by the
+// github.com/PyramidSystemsInc/go/aws/sts package, so it can be unit tested offline.
+package stsfake
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// STS answers GetCallerIdentity with a fixed identity and issues made-up temporary credentials. Calling an operation
+// that is not implemented panics.
+type STS struct {
+	stsiface.STSAPI
+
+	mutex     sync.Mutex
+	AccountID string
+	Arn       string
+	UserID    string
+	// ExternalIDs holds the external ID required to assume a role, by role ARN. Other roles need none.
+	ExternalIDs map[string]string
+	// AssumedRoles records every AssumeRole call.
+	AssumedRoles []*sts.AssumeRoleInput
+	counter      int
+}
+
+// New returns a fake for the user pac in account 123456789012.
+func New() *STS {
+	return &STS{
+		AccountID:   "123456789012",
+		Arn:         "arn:aws:iam::123456789012:user/pac",
+		UserID:      "AIDAEXAMPLEUSERID0001",
+		ExternalIDs: map[string]string{},
+	}
+}
+
+// GetCallerIdentityWithContext returns the identity of the fake.
+func (fake *STS) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(fake.AccountID),
+		Arn:     aws.String(fake.Arn),
+		UserId:  aws.String(fake.UserID),
+	}, nil
+}
+
+// AssumeRoleWithContext issues credentials for any role whose external ID matches.
+func (fake *STS) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.AssumedRoles = append(fake.AssumedRoles, input)
+	roleArn := aws.StringValue(input.RoleArn)
+	parts := strings.Split(roleArn, ":")
+	if len(parts) != 6 || !strings.HasPrefix(parts[5], "role/") {
+		return nil, awserr.New("ValidationError", "Invalid role ARN: "+roleArn, nil)
+	}
+	if fake.ExternalIDs[roleArn] != aws.StringValue(input.ExternalId) {
+		return nil, awserr.New("AccessDenied", fmt.Sprintf("User: %s is not authorized to perform: sts:AssumeRole on resource: %s", fake.Arn, roleArn), nil)
+	}
+	roleName := parts[5][strings.LastIndex(parts[5], "/")+1:]
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{
+			Arn:           aws.String(fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", parts[4], roleName, aws.StringValue(input.RoleSessionName))),
+			AssumedRoleId: aws.String("AROAEXAMPLEROLEID0001:" + aws.StringValue(input.RoleSessionName)),
+		},
+		Credentials: fake.credentials(time.Duration(aws.Int64Value(input.DurationSeconds)) * time.Second),
+	}, nil
+}
+
+// GetSessionTokenWithContext issues credentials for the user of the fake, requiring a token code with a serial number.
+func (fake *STS) GetSessionTokenWithContext(ctx aws.Context, input *sts.GetSessionTokenInput, opts ...request.Option) (*sts.GetSessionTokenOutput, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if input.SerialNumber != nil && aws.StringValue(input.TokenCode) == "" {
+		return nil, awserr.New("ValidationError", "A token code is required with a serial number", nil)
+	}
+	duration := time.Duration(aws.Int64Value(input.DurationSeconds)) * time.Second
+	if duration == 0 {
+		duration = 12 * time.Hour
+	}
+	return &sts.GetSessionTokenOutput{
+		Credentials: fake.credentials(duration),
+	}, nil
+}
+
+func (fake *STS) credentials(duration time.Duration) *sts.Credentials {
+	fake.counter++
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(fmt.Sprintf("ASIAEXAMPLE%09d", fake.counter)),
+		Expiration:      aws.Time(time.Now().Add(duration)),
+		SecretAccessKey: aws.String(fmt.Sprintf("secret%d", fake.counter)),
+		SessionToken:    aws.String(fmt.Sprintf("token%d", fake.counter)),
+	}
+}
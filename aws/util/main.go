@@ -1,6 +1,8 @@
 package util
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -15,17 +17,37 @@ func IsArn(possibleArn string) bool {
 
 // GetPublicIP sends a request to https://www.ipify.org/ for the end user's local ip address in text format.
 func GetPublicIP() string {
-	resp, err := http.Get("https://api.ipify.org")
+	ip, err := GetPublicIPE()
 	if err != nil {
-		log.Fatalf("unable to get IP address: %v\n", err)
+		log.Fatalf("%v\n", err)
+	}
+
+	return ip
+}
+
+// GetPublicIPE is GetPublicIP returning an error instead of exiting.
+func GetPublicIPE() (string, error) {
+	return GetPublicIPWithContext(context.Background())
+}
+
+// GetPublicIPWithContext is GetPublicIPE with a context to allow cancellation.
+func GetPublicIPWithContext(ctx context.Context) (string, error) {
+	req, err := http.NewRequest("GET", "https://api.ipify.org", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to get IP address: %v", err)
 	}
 
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("unable to read response: %v\n", err)
+		return "", fmt.Errorf("unable to read response: %v", err)
 	}
 
-	return string(body)
+	return string(body), nil
 }
@@ -1,7 +1,9 @@
 package commands
 
 import (
+  "context"
   "io/ioutil"
+  "os"
   "os/exec"
   "strings"
   "regexp"
@@ -13,8 +15,24 @@ import (
 
 // Run - Runs a command as if ran from the terminal
 func Run(fullCommand string, directory string) (string, error) {
+  return RunWithContext(context.Background(), fullCommand, directory)
+}
+
+// RunWithContext - Runs a command as if ran from the terminal. The command is killed if the context is done before it exits
+func RunWithContext(ctx context.Context, fullCommand string, directory string) (string, error) {
+  return RunWithEnvironmentContext(ctx, fullCommand, nil, directory)
+}
+
+// RunWithEnvironmentContext - RunWithContext, but `environment` is added to the environment the command inherits. Values given this way are not split on spaces and do not show in the process list like arguments do
+func RunWithEnvironmentContext(ctx context.Context, fullCommand string, environment map[string]string, directory string) (string, error) {
   command, arguments := separateCommand(fullCommand)
-  cmd := exec.Command(command, arguments...)
+  cmd := exec.CommandContext(ctx, command, arguments...)
+  if len(environment) > 0 {
+    cmd.Env = os.Environ()
+    for key, value := range environment {
+      cmd.Env = append(cmd.Env, str.Concat(key, "=", value))
+    }
+  }
 
   stdout, err := cmd.StdoutPipe()
   errors.LogIfError(err)
@@ -34,7 +52,9 @@ func Run(fullCommand string, directory string) (string, error) {
   errOutput, err := ioutil.ReadAll(stderr)
   errors.LogIfError(err)
   err = cmd.Wait()
-  if err != nil {
+  if ctx.Err() != nil {
+    err = ctx.Err()
+  } else if err != nil {
     err = errors.New(str.Concat(err.Error(), ": ", strings.TrimRight(string(errOutput), "\n")))
   }
   out := strings.TrimRight(string(output), "\n")
@@ -43,8 +63,15 @@ func Run(fullCommand string, directory string) (string, error) {
 
 // RunWithStdin - Runs a command as if ran from the terminal
 func RunWithStdin(fullCommand string, data string, directory string) string {
+  out, err := RunWithStdinContext(context.Background(), fullCommand, data, directory)
+  errors.LogIfError(err)
+  return out
+}
+
+// RunWithStdinContext - Runs a command as if ran from the terminal with `data` piped to its standard input. The command is killed if the context is done before it exits
+func RunWithStdinContext(ctx context.Context, fullCommand string, data string, directory string) (string, error) {
   command, arguments := separateCommand(fullCommand)
-  cmd := exec.Command(command, arguments...)
+  cmd := exec.CommandContext(ctx, command, arguments...)
   cmd.Stdin = strings.NewReader(data)
   stdout, err := cmd.StdoutPipe()
   errors.LogIfError(err)
@@ -67,9 +94,11 @@ func RunWithStdin(fullCommand string, data string, directory string) string {
     logger.Warn(string(errorOutput))
   }
   err = cmd.Wait()
-  errors.LogIfError(err)
+  if ctx.Err() != nil {
+    err = ctx.Err()
+  }
   out := strings.TrimRight(string(output), "\n")
-  return out
+  return out, err
 }
 
 
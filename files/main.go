@@ -1,8 +1,11 @@
 package files
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -12,6 +15,7 @@ import (
 	"regexp"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/PyramidSystemsInc/go/directories"
 	"github.com/PyramidSystemsInc/go/errors"
@@ -82,6 +86,56 @@ func Read(filePath string) []byte {
 	return data
 }
 
+// ZipDirectory - Returns a zip archive of every file below a directory, with paths relative to it. Permissions are kept and
+// modification times are zeroed, so zipping the same contents twice gives the same bytes. Symbolic links, to files or
+// directories, are stored as links holding their target, as zip -y does, so they unzip as the same links
+func ZipDirectory(directory string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	archive := zip.NewWriter(buffer)
+	err := filepath.Walk(directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relativePath)
+		header.Method = zip.Deflate
+		header.Modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write([]byte(target))
+			return err
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
 // TODO: Do some regex checking on valid values of fullPath
 // Download - Downloads a file from a URL to a given path on the local filesystem
 func Download(url string, fullPath string) error {
@@ -103,6 +157,54 @@ func Write(fullPath string, data []byte) {
 	ioutil.WriteFile(fullPath, data, 0644)
 }
 
+// Rewrite - Replaces the contents of a file with what transform writes given its current contents, such as the file encrypted.
+// The new contents go to a temporary file in the same directory that is renamed over the file, so it is never left half written,
+// and its permissions are kept. The file is left untouched when transform returns an error
+func Rewrite(filePath string, transform func(io.Reader, io.Writer) error) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return replace(filePath, info.Mode().Perm(), func(writer io.Writer) error {
+		return transform(bufio.NewReader(source), writer)
+	})
+}
+
+// WriteAtomically - Creates or replaces a file with what write writes, such as an export. Like Rewrite, the contents go to a
+// temporary file that is renamed over the file, so the file is left as it was, or not created, when write returns an error
+func WriteAtomically(filePath string, write func(io.Writer) error) error {
+	return replace(filePath, 0644, write)
+}
+
+// replace - Writes a temporary file in the same directory as filePath and renames it over filePath unless write fails
+func replace(filePath string, permissions os.FileMode, write func(io.Writer) error) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(filePath), str.Concat(".", filepath.Base(filePath), ".*"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	writer := bufio.NewWriter(temporary)
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temporary.Chmod(permissions)
+	}
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), filePath)
+}
+
 // Prepend - Adds content to the top of a file
 func Prepend(filePath string, data []byte) {
 	content := Read(filePath)
@@ -1,8 +1,13 @@
 package test
 
 import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/PyramidSystemsInc/go/files"
@@ -73,3 +78,145 @@ func TestDirectoryFileStringReplace(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestZipDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//create an executable at the root and a file in a subdirectory
+	err = ioutil.WriteFile(filepath.Join(dir, "bootstrap"), []byte("#!/bin/sh"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "lib", "handler.js"), []byte("exports.handler = () => {}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := files.ZipDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := files.ZipDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("expected zipping the same contents twice to give the same bytes")
+	}
+
+	//check the paths are relative and the executable bit is kept
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 2 || archive.File[0].Name != "bootstrap" || archive.File[1].Name != "lib/handler.js" {
+		t.Fatalf("expected bootstrap and lib/handler.js, got %d files", len(archive.File))
+	}
+	if archive.File[0].Mode()&0100 == 0 {
+		t.Error("expected bootstrap to stay executable")
+	}
+}
+
+func TestZipDirectorySymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//link to a file, as under node_modules/.bin, and to a directory
+	err = os.MkdirAll(filepath.Join(dir, "lib", "bin"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "lib", "bin", "cli.js"), []byte("#!/usr/bin/env node"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("lib/bin/cli.js", filepath.Join(dir, "cli"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("lib", filepath.Join(dir, "vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := files.ZipDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//check both links are stored as links holding their target
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{}
+	for _, file := range archive.File {
+		if file.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		links[file.Name] = string(target)
+	}
+	if len(archive.File) != 3 || len(links) != 2 || links["cli"] != "lib/bin/cli.js" || links["vendor"] != "lib" {
+		t.Errorf("expected cli and vendor to be links, got %d files and links %v", len(archive.File), links)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	file := filepath.Join(directory, "secret.txt")
+	err = ioutil.WriteFile(file, []byte("hello"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = files.Rewrite(file, func(reader io.Reader, writer io.Writer) error {
+		contents, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(bytes.ToUpper(contents))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := ioutil.ReadFile(file)
+	info, _ := os.Stat(file)
+	if string(contents) != "HELLO" || info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected contents %q or mode %v", contents, info.Mode())
+	}
+
+	err = files.Rewrite(file, func(reader io.Reader, writer io.Writer) error {
+		writer.Write([]byte("partial"))
+		return errors.New("failed")
+	})
+	contents, _ = ioutil.ReadFile(file)
+	if err == nil || string(contents) != "HELLO" {
+		t.Fatalf("expected the file to be untouched after an error, got %q and error %v", contents, err)
+	}
+	entries, _ := ioutil.ReadDir(directory)
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed, found %d files", len(entries))
+	}
+}
@@ -1,62 +1,106 @@
 package terraform
 
 import (
-  "fmt"
+  "context"
   "time"
 
   "github.com/PyramidSystemsInc/go/commands"
   "github.com/PyramidSystemsInc/go/errors"
   "github.com/PyramidSystemsInc/go/files"
+  "github.com/PyramidSystemsInc/go/logger"
   "github.com/PyramidSystemsInc/go/str"
 )
 
 // Apply - Creates resources detailed in the tfplan file (created using the `terraform plan` command
 func Apply(directoryToRunFrom string) string {
-  defer timeTrack(time.Now(), "Terraform apply")
-  output, err := commands.Run("terraform apply -input=false tfplan", directoryToRunFrom)
+  output, err := ApplyWithContext(context.Background(), directoryToRunFrom)
   if err != nil {
     errors.LogAndQuit(str.Concat("ERROR: Applying the Terraform plan failed with the following error: ", err.Error()))
   }
   return output
 }
 
+// ApplyWithContext - Apply, but the `terraform apply` process is killed if the context is done before it finishes
+func ApplyWithContext(ctx context.Context, directoryToRunFrom string) (string, error) {
+  defer timeTrack(time.Now(), "Terraform apply")
+  return commands.RunWithContext(ctx, "terraform apply -input=false tfplan", directoryToRunFrom)
+}
+
 // Destroy - Destroys all resources managed by Terraform
 func Destroy(directoryToRunFrom string) string {
+  output, err := DestroyWithContext(context.Background(), directoryToRunFrom)
+  if err != nil {
+    errors.LogAndQuit(str.Concat("ERROR: Terraform destroy failed with the following error: ", err.Error()))
+  }
+  return output
+}
+
+// DestroyWithContext - Destroy, but the `terraform destroy` process is killed if the context is done before it finishes
+func DestroyWithContext(ctx context.Context, directoryToRunFrom string) (string, error) {
   defer timeTrack(time.Now(), "Terraform destroy")
   if files.Exists(str.Concat(directoryToRunFrom, "/.terraform")) {
-    output, err := commands.Run("terraform destroy -auto-approve", directoryToRunFrom)
-    if err != nil {
-      errors.LogAndQuit(str.Concat("ERROR: Terraform destroy failed with the following error: ", err.Error()))
-    }
-    return output
+    return commands.RunWithContext(ctx, "terraform destroy -auto-approve", directoryToRunFrom)
   } else {
-    return str.Concat("No Terraform resources to destroy in ", directoryToRunFrom)
+    return str.Concat("No Terraform resources to destroy in ", directoryToRunFrom), nil
   }
 }
 
 // Initialize - Initializes the terraform directory, checks for *.tf files, and processes them
 func Initialize(directoryToRunFrom string) string {
-  output, err := commands.Run("terraform init -input=false", directoryToRunFrom)
+  output, err := InitializeWithContext(context.Background(), directoryToRunFrom)
   if err != nil {
     errors.LogAndQuit(str.Concat("ERROR: Initializing Terraform failed with the following error: ", err.Error()))
   }
   return output
 }
 
+// InitializeWithContext - Initialize, but the `terraform init` process is killed if the context is done before it finishes
+func InitializeWithContext(ctx context.Context, directoryToRunFrom string) (string, error) {
+  return commands.RunWithContext(ctx, "terraform init -input=false", directoryToRunFrom)
+}
+
 // Plan - Creates a tfplan file with a detailed specification of what Terraform would create given the set of *.tf files
 func Plan(directoryToRunFrom string, cfg map[string]string) string {
+  output, err := PlanWithContext(context.Background(), directoryToRunFrom, cfg)
+  if err != nil {
+    errors.LogAndQuit(str.Concat("ERROR: Planning Terraform failed with the following error: ", err.Error()))
+  }
+  return output
+}
+
+// PlanWithContext - Plan, but the `terraform plan` process is killed if the context is done before it finishes
+func PlanWithContext(ctx context.Context, directoryToRunFrom string, cfg map[string]string) (string, error) {
   var variables string
   for key, value := range cfg {
     variables = str.Concat(variables, "-var ", key, "=", value, " ")
   }
   planCommand := str.Concat("terraform plan ", variables, "-out tfplan")
-  output, err := commands.Run(planCommand, directoryToRunFrom)
+  return commands.RunWithContext(ctx, planCommand, directoryToRunFrom)
+}
+
+// PlanWithSecretVars - Plan, but the values of `secretVars` are given to Terraform as TF_VAR_ environment variables rather than on the command line, where they could be read from the process list
+func PlanWithSecretVars(directoryToRunFrom string, cfg map[string]string, secretVars map[string]string) string {
+  output, err := PlanWithSecretVarsContext(context.Background(), directoryToRunFrom, cfg, secretVars)
   if err != nil {
-    errors.LogAndQuit(str.Concat("ERROR: Initializing Terraform failed with the following error: ", err.Error()))
+    errors.LogAndQuit(str.Concat("ERROR: Planning Terraform failed with the following error: ", err.Error()))
   }
   return output
 }
 
+// PlanWithSecretVarsContext - PlanWithSecretVars, but the `terraform plan` process is killed if the context is done before it finishes
+func PlanWithSecretVarsContext(ctx context.Context, directoryToRunFrom string, cfg map[string]string, secretVars map[string]string) (string, error) {
+  var variables string
+  for key, value := range cfg {
+    variables = str.Concat(variables, "-var ", key, "=", value, " ")
+  }
+  environment := make(map[string]string, len(secretVars))
+  for key, value := range secretVars {
+    environment[str.Concat("TF_VAR_", key)] = value
+  }
+  planCommand := str.Concat("terraform plan ", variables, "-out tfplan")
+  return commands.RunWithEnvironmentContext(ctx, planCommand, environment, directoryToRunFrom)
+}
+
 // VerifyInstallation - Attempts to get the Terraform version to demonstrate Terraform is installed and accessible. If Terraform is not installed or accessible the execution of the program is stopped
 func VerifyInstallation() {
   _, err := commands.Run("terraform version", "")
@@ -67,5 +111,5 @@ func VerifyInstallation() {
 
 func timeTrack(start time.Time, name string) {
   elapsed := time.Since(start)
-  fmt.Sprintf("%s took %s", name, elapsed)
+  logger.Info(name, "took", elapsed.String())
 }